@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"petProjectMike/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	principalKey = "principal"
+)
+
+// authenticate пропускает запрос только с токеном доступа (Authorization: Bearer ...) или API-ключом
+// (X-API-Key) и кладёт вызывающего в контекст gin
+func (s *Server) authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var principal *auth.Principal
+		var err error
+		switch {
+		case c.GetHeader(apiKeyHeader) != "":
+			principal, err = s.apiKeys.Authenticate(c.GetHeader(apiKeyHeader))
+		case strings.HasPrefix(c.GetHeader("Authorization"), "Bearer "):
+			principal, err = s.authService.Authenticate(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		default:
+			c.Header("WWW-Authenticate", `Bearer realm="banking-api"`)
+			abortWithError(c, newAPIError(http.StatusUnauthorized, codeUnauthorized, "authentication required"))
+			return
+		}
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="banking-api", error="invalid_token"`)
+			status, body := errorFor(err)
+			c.AbortWithStatusJSON(status, body)
+			return
+		}
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// principalFrom вызывающий, которого положил authenticate
+func principalFrom(c *gin.Context) *auth.Principal {
+	if value, ok := c.Get(principalKey); ok {
+		if principal, ok := value.(*auth.Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
+
+func (s *Server) login(c *gin.Context) {
+	var request struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	tokens, err := s.authService.Login(request.Email, request.Password)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (s *Server) refreshToken(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	tokens, err := s.authService.Refresh(request.RefreshToken)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// changePassword меняет пароль вызывающего пользователя; сервисам паролей не положено
+func (s *Server) changePassword(c *gin.Context) {
+	principal := principalFrom(c)
+	if !principal.IsUser() {
+		c.Error(newAPIError(http.StatusForbidden, codeForbidden, "only users have passwords"))
+		return
+	}
+	var request struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	if err := s.authService.ChangePassword(principal.Subject, request.CurrentPassword, request.NewPassword); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
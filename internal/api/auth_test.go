@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"petProjectMike/internal/auth"
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// registerAndLogin регистрирует пользователя и входит им; возвращает выданный сервером ID и токены
+func registerAndLogin(t *testing.T, server *Server, email string) (string, auth.TokenPair) {
+	body := `{"email": "` + email + `", "name": "Test", "password": "s3cret-password"}`
+	register := postJSON(server, "/api/v1/users/", "", body)
+	assert.Equal(t, http.StatusCreated, register.Code)
+	assert.NotContains(t, register.Body.String(), "password")
+	var user models.User
+	assert.NoError(t, json.Unmarshal(register.Body.Bytes(), &user))
+
+	login := postJSON(server, "/api/v1/auth/login", "", `{"email": "`+email+`", "password": "s3cret-password"}`)
+	assert.Equal(t, http.StatusOK, login.Code)
+	var tokens auth.TokenPair
+	assert.NoError(t, json.Unmarshal(login.Body.Bytes(), &tokens))
+	return user.ID, tokens
+}
+
+func withBearer(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestAuth_RequiresCredentials(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/accounts/account-1", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, codeUnauthorized, decodeError(t, w).Code)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/accounts/account-1", nil)
+	req.Header.Set(apiKeyHeader, "wrong-key-0123456789")
+	w = serve(server, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, codeInvalidAPIKey, decodeError(t, w).Code)
+
+	w = serve(server, withBearer(httptest.NewRequest(http.MethodGet, "/api/v1/accounts/account-1", nil), "not-a-jwt"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, codeInvalidToken, decodeError(t, w).Code)
+
+	// Проверка здоровья открыта
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuth_LoginAndRefresh(t *testing.T) {
+	server, _ := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "auth@example.com")
+
+	w := serve(server, withBearer(httptest.NewRequest(http.MethodGet, "/api/v1/users/"+userID, nil), tokens.AccessToken))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Токен обновления не открывает API, но даёт новую пару
+	w = serve(server, withBearer(httptest.NewRequest(http.MethodGet, "/api/v1/users/"+userID, nil), tokens.RefreshToken))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	refresh := postJSON(server, "/api/v1/auth/refresh", "", `{"refresh_token": "`+tokens.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusOK, refresh.Code)
+	var refreshed auth.TokenPair
+	assert.NoError(t, json.Unmarshal(refresh.Body.Bytes(), &refreshed))
+	assert.NotEmpty(t, refreshed.AccessToken)
+}
+
+func TestAuth_WrongPasswordAndUnknownEmailLookTheSame(t *testing.T) {
+	server, _ := newTestServer(t)
+	registerAndLogin(t, server, "auth@example.com")
+
+	wrongPassword := postJSON(server, "/api/v1/auth/login", "", `{"email": "auth@example.com", "password": "wrong-password"}`)
+	unknownEmail := postJSON(server, "/api/v1/auth/login", "", `{"email": "nobody@example.com", "password": "wrong-password"}`)
+	assert.Equal(t, http.StatusUnauthorized, wrongPassword.Code)
+	assert.Equal(t, wrongPassword.Code, unknownEmail.Code)
+	assert.Equal(t, wrongPassword.Body.String(), unknownEmail.Body.String())
+}
+
+func TestAuth_ChangePassword(t *testing.T) {
+	server, _ := newTestServer(t)
+	_, tokens := registerAndLogin(t, server, "auth@example.com")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/password",
+		strings.NewReader(`{"current_password": "s3cret-password", "new_password": "even-better-password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	assert.Equal(t, http.StatusOK, serve(server, withBearer(req, tokens.AccessToken)).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, postJSON(server, "/api/v1/auth/login", "", `{"email": "auth@example.com", "password": "s3cret-password"}`).Code)
+	assert.Equal(t, http.StatusOK, postJSON(server, "/api/v1/auth/login", "", `{"email": "auth@example.com", "password": "even-better-password"}`).Code)
+
+	// Токены, выданные до смены пароля, больше не действуют
+	assert.Equal(t, http.StatusUnauthorized, postJSON(server, "/api/v1/auth/refresh", "", `{"refresh_token": "`+tokens.RefreshToken+`"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/accounts/account-1", "").Code)
+}
+
+func TestAuth_RegistrationRejectsWeakPassword(t *testing.T) {
+	server, _ := newTestServer(t)
+	w := postJSON(server, "/api/v1/users/", "", `{"email": "weak@example.com", "name": "Weak", "password": "123"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeWeakPassword, decodeError(t, w).Code)
+}
+
+func TestIdempotency_KeysAreScopedToCaller(t *testing.T) {
+	server, _ := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "auth@example.com")
+	account := createAccountFor(t, server, userID)
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/transactions/deposit", "", `{"account_id": "`+account.ID+`", "amount": "50.00"}`).Code)
+	body := `{"from_account": "` + account.ID + `", "to_account": "account-1", "amount": "10.00"}`
+
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/transactions/transfer", "shared-key", body).Code)
+
+	// Другой вызывающий с тем же ключом не получает чужой сохранённый ответ
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transactions/transfer", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyKeyHeader, "shared-key")
+	w := serve(server, withBearer(req, tokens.AccessToken))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(idempotencyReplayedHeader))
+}
+
+func TestAuth_RegistrationValidatesEmail(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	// ID выдаёт сервер, присланный клиентом игнорируется; email хранится в нижнем регистре
+	w := postJSON(server, "/api/v1/users/", "", `{"id": "user-mine", "email": "Mixed@Example.com", "name": "Mixed", "password": "s3cret-password"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var user models.User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.NotEqual(t, "user-mine", user.ID)
+	assert.Equal(t, "mixed@example.com", user.Email)
+
+	w = postJSON(server, "/api/v1/users/", "", `{"email": "MIXED@example.com", "name": "Copy", "password": "s3cret-password"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, codeEmailTaken, decodeError(t, w).Code)
+
+	w = postJSON(server, "/api/v1/users/", "", `{"email": "not-an-email", "name": "Bad", "password": "s3cret-password"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeInvalidEmail, decodeError(t, w).Code)
+
+	// Правка профиля не может занять чужой email
+	w = putJSON(server, "/api/v1/users/"+user.ID, `"`+strconv.FormatInt(user.Version, 10)+`"`, `{"email": "test@example.com", "name": "Mixed"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, codeEmailTaken, decodeError(t, w).Code)
+}
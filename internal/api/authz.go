@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/models"
+	"petProjectMike/internal/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// require пропускает запрос, только если у роли вызывающего есть разрешение хоть на какие-то ресурсы.
+// Доступ к конкретному ресурсу обработчик проверяет сам через authorize, когда узнает владельца
+func require(permission policy.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !policy.Allows(principalFrom(c).Role, permission) {
+			status, body := errorFor(fmt.Errorf("%w: %s", policy.ErrForbidden, permission))
+			c.AbortWithStatusJSON(status, body)
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorize проверяет доступ вызывающего к ресурсу с владельцами owners; при отказе ошибка
+// уже записана в контекст и обработчику остаётся выйти
+func authorize(c *gin.Context, permission policy.Permission, owners ...string) bool {
+	principal := principalFrom(c)
+	// Сервис не владеет пользовательскими ресурсами: разрешения "на свои" ему ничего не дают
+	callerID := ""
+	if principal.IsUser() {
+		callerID = principal.Subject
+	}
+	if err := policy.Authorize(principal.Role, callerID, permission, owners...); err != nil {
+		c.Error(err)
+		return false
+	}
+	return true
+}
+
+// accountOwners владельцы счетов. Системные и уже удалённые счета никому не принадлежат
+func (s *Server) accountOwners(ids ...string) ([]string, error) {
+	owners := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if models.IsSystemAccount(id) {
+			continue
+		}
+		account, err := s.accountService.GetAccount(id)
+		if errors.Is(err, database.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		owners = append(owners, account.UserID)
+	}
+	return owners, nil
+}
+
+// authorizeAccounts authorize для операций над счетами, когда сам счёт обработчику не нужен
+func (s *Server) authorizeAccounts(c *gin.Context, permission policy.Permission, ids ...string) bool {
+	owners, err := s.accountOwners(ids...)
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+	return authorize(c, permission, owners...)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createAccountFor открывает счёт пользователю от имени тестового сервиса
+func createAccountFor(t *testing.T, server *Server, userID string) models.Account {
+	w := postJSON(server, "/api/v1/accounts/", "", `{"user_id": "`+userID+`", "currency": "USD"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var account models.Account
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &account))
+	return account
+}
+
+func requestAs(server *Server, token, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return serve(server, withBearer(req, token))
+}
+
+func TestAuthz_CustomerSeesOnlyOwnResources(t *testing.T) {
+	server, _ := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "alice@example.com")
+	own := createAccountFor(t, server, userID)
+
+	assert.Equal(t, http.StatusOK, requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/accounts/"+own.ID, "").Code)
+	assert.Equal(t, http.StatusOK, requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/users/"+userID, "").Code)
+
+	// account-1 и user-1 принадлежат другому клиенту
+	for _, path := range []string{
+		"/api/v1/accounts/account-1",
+		"/api/v1/accounts/user/user-1",
+		"/api/v1/transactions/account/account-1",
+		"/api/v1/users/user-1",
+		"/api/v1/ledger/accounts/account-1",
+		"/api/v1/ledger/trial-balance",
+	} {
+		w := requestAs(server, tokens.AccessToken, http.MethodGet, path, "")
+		assert.Equal(t, http.StatusForbidden, w.Code, path)
+		assert.Equal(t, codeForbidden, decodeError(t, w).Code, path)
+	}
+}
+
+func TestAuthz_CustomerMovesMoneyOnlyFromOwnAccount(t *testing.T) {
+	server, db := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "alice@example.com")
+	own := createAccountFor(t, server, userID)
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/transactions/deposit", "", `{"account_id": "`+own.ID+`", "amount": "50.00"}`).Code)
+
+	w := requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/transactions/transfer",
+		`{"from_account": "account-1", "to_account": "`+own.ID+`", "amount": "10.00"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	account, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1000.00 USD", account.Balance.String())
+
+	// Получатель может быть чужим
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/transactions/transfer",
+		`{"from_account": "`+own.ID+`", "to_account": "account-1", "amount": "10.00"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var transaction models.Transaction
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &transaction))
+	assert.Equal(t, http.StatusOK, requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/transactions/"+transaction.ID, "").Code)
+
+	// Пополнять и списывать деньги извне клиент не может даже по своему счёту
+	for _, path := range []string{"/api/v1/transactions/deposit", "/api/v1/transactions/withdrawal"} {
+		w = requestAs(server, tokens.AccessToken, http.MethodPost, path, `{"account_id": "`+own.ID+`", "amount": "10.00"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code, path)
+	}
+	account, err = db.GetAccount(own.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "40.00 USD", account.Balance.String())
+
+	// Бонусы клиент себе не начисляет
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/bonuses/welcome", `{"user_id": "`+userID+`", "amount": "10.00"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuthz_RolesAssignedByAdmin(t *testing.T) {
+	server, _ := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "staff@example.com")
+
+	// Клиент не может повысить себе роль
+	w := requestAs(server, tokens.AccessToken, http.MethodPut, "/api/v1/users/"+userID+"/role", `{"role": "admin"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = putJSON(server, "/api/v1/users/"+userID+"/role", "", `{"role": "root"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeUnknownRole, decodeError(t, w).Code)
+
+	assert.Equal(t, http.StatusOK, putJSON(server, "/api/v1/users/"+userID+"/role", "", `{"role": "support"}`).Code)
+
+	// Поддержка видит чужие счета, но деньги не двигает
+	assert.Equal(t, http.StatusOK, requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/accounts/account-1", "").Code)
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/transactions/deposit", `{"account_id": "account-1", "amount": "10.00"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.Equal(t, http.StatusOK, putJSON(server, "/api/v1/users/"+userID+"/role", "", `{"role": "auditor"}`).Code)
+	assert.Equal(t, http.StatusOK, requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/ledger/trial-balance", "").Code)
+}
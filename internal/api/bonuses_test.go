@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"petProjectMike/internal/models"
+	"petProjectMike/internal/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBonuses_WelcomeOnlyOnce(t *testing.T) {
+	server, _ := newTestServer(t)
+	userID, _ := registerAndLogin(t, server, "welcome@example.com")
+
+	w := postJSON(server, "/api/v1/bonuses/welcome", "", `{"user_id": "`+userID+`", "amount": "10.00"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = postJSON(server, "/api/v1/bonuses/welcome", "", `{"user_id": "`+userID+`", "amount": "10.00"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, codeWelcomeBonusGranted, decodeError(t, w).Code)
+}
+
+func TestBonuses_PartialUseAndHistory(t *testing.T) {
+	server, _ := newTestServer(t)
+	userID, _ := registerAndLogin(t, server, "history@example.com")
+	account := createAccountFor(t, server, userID)
+	w := postJSON(server, "/api/v1/bonuses/welcome", "", `{"user_id": "`+userID+`", "amount": "50.00"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var bonus models.Bonus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &bonus))
+
+	w = postJSON(server, "/api/v1/bonuses/use", "", `{"bonus_id": "`+bonus.ID+`", "account_id": "`+account.ID+`", "amount": "10.00"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var used struct {
+		Redemption models.BonusRedemption `json:"redemption"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &used))
+	assert.Equal(t, models.NewMoney(1000, "USD"), used.Redemption.Amount)
+
+	w = postJSON(server, "/api/v1/bonuses/use", "", `{"bonus_id": "`+bonus.ID+`", "account_id": "`+account.ID+`", "amount": "45.00"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeBonusInsufficient, decodeError(t, w).Code)
+
+	// Частично использованный бонус остаётся в списке активных
+	w = serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/bonuses/user/"+userID, nil))
+	var active []models.Bonus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &active))
+	if assert.Len(t, active, 1) {
+		assert.Equal(t, models.NewMoney(4000, "USD"), active[0].RemainingAmount)
+	}
+
+	w = postJSON(server, "/api/v1/bonuses/use", "", `{"bonus_id": "`+bonus.ID+`", "account_id": "`+account.ID+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Использованный бонус пропадает из активных, но остаётся в истории
+	w = serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/bonuses/user/"+userID, nil))
+	assert.JSONEq(t, "null", w.Body.String())
+	w = serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/bonuses/user/"+userID+"/history", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var history []services.BonusHistoryEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "used", history[0].Status)
+		if assert.Len(t, history[0].Redemptions, 2) {
+			assert.Equal(t, models.NewMoney(4000, "USD"), history[0].Redemptions[1].Amount)
+		}
+	}
+}
+
+func TestBonuses_PromoBatchAndRedeem(t *testing.T) {
+	server, _ := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "promo@example.com")
+
+	// Партии генерирует только администратор
+	batch := `{"prefix": "fall", "count": 3, "reward": {"amount": "5.00", "currency": "USD"}, "expires_in_days": 30, "max_redemptions": 1}`
+	w := requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/bonuses/promo/batches", batch)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = postJSON(server, "/api/v1/bonuses/promo/batches", "", batch)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		BatchID string             `json:"batch_id"`
+		Codes   []models.PromoCode `json:"codes"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	if !assert.Len(t, created.Codes, 3) {
+		return
+	}
+	code := created.Codes[0].Code
+
+	redeem := `{"user_id": "` + userID + `", "code": "` + code + `"}`
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/bonuses/promo", redeem)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var bonus models.Bonus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &bonus))
+	assert.Equal(t, models.NewMoney(500, "USD"), bonus.Amount)
+	assert.Equal(t, models.SourcePromo, bonus.Source)
+
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/bonuses/promo", redeem)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, codePromoExhausted, decodeError(t, w).Code)
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/bonuses/promo", `{"user_id": "user-1", "code": "`+created.Codes[1].Code+`"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/bonuses/promo", `{"user_id": "`+userID+`", "code": "NOPE"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeUnknownPromoCode, decodeError(t, w).Code)
+
+	w = serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/bonuses/promo/batches/"+created.BatchID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, 1, created.Codes[0].Redemptions+created.Codes[1].Redemptions+created.Codes[2].Redemptions)
+
+	w = postJSON(server, "/api/v1/bonuses/promo/batches", "", `{"count": 1, "reward": {"amount": "5.00", "currency": "USD"}, "expires_in_days": 0, "max_redemptions": 1}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeInvalidPromo, decodeError(t, w).Code)
+}
+
+func TestBonuses_LoyaltyStatusAndConvert(t *testing.T) {
+	server, _ := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "points@example.com")
+	account := createAccountFor(t, server, userID)
+	w := postJSON(server, "/api/v1/transactions/deposit", "", `{"account_id": "`+account.ID+`", "amount": "250.00"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/bonuses/loyalty/user/"+userID, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status services.LoyaltyStatus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, int64(250), status.Points)
+	assert.Equal(t, "bronze", status.Tier)
+	assert.Equal(t, http.StatusForbidden, requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/bonuses/loyalty/user/user-1", "").Code)
+
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/bonuses/loyalty/convert", `{"user_id": "`+userID+`", "points": 200, "currency": "USD"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var bonus models.Bonus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &bonus))
+	assert.Equal(t, models.NewMoney(200, "USD"), bonus.Amount)
+
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/bonuses/loyalty/convert", `{"user_id": "`+userID+`", "points": 100, "currency": "USD"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeInsufficientPoints, decodeError(t, w).Code)
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/bonuses/loyalty/convert", `{"user_id": "`+userID+`", "points": 30, "currency": "USD"}`)
+	assert.Equal(t, codeInvalidPoints, decodeError(t, w).Code)
+}
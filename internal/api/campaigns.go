@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"petProjectMike/internal/campaigns"
+	"petProjectMike/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) listCampaigns(c *gin.Context) {
+	list, err := s.bonusService.ListCampaigns()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (s *Server) getCampaign(c *gin.Context) {
+	campaign, err := s.bonusService.GetCampaign(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	setETag(c, campaign.Version)
+	c.JSON(http.StatusOK, campaign)
+}
+
+// getCampaignBudget бюджет кампании и его остаток; у кампании без бюджета все суммы null
+func (s *Server) getCampaignBudget(c *gin.Context) {
+	campaign, err := s.bonusService.GetCampaign(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	remaining, _ := campaigns.Remaining(campaign)
+	c.JSON(http.StatusOK, gin.H{
+		"campaign_id": campaign.ID,
+		"budget":      campaign.Budget,
+		"spent":       campaign.Spent,
+		"remaining":   remaining,
+	})
+}
+
+func (s *Server) createCampaign(c *gin.Context) {
+	var campaign models.Campaign
+	if err := c.ShouldBindJSON(&campaign); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	if err := s.bonusService.CreateCampaign(&campaign); err != nil {
+		c.Error(err)
+		return
+	}
+	setETag(c, campaign.Version)
+	c.JSON(http.StatusCreated, campaign)
+}
+
+// updateCampaign заменяет кампанию целиком; ID берётся из пути, версия — из If-Match
+func (s *Server) updateCampaign(c *gin.Context) {
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	var campaign models.Campaign
+	if err := c.ShouldBindJSON(&campaign); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	campaign.ID = c.Param("id")
+	if err := s.bonusService.UpdateCampaign(&campaign, version); err != nil {
+		c.Error(ifMatchFailed(err))
+		return
+	}
+	setETag(c, campaign.Version)
+	c.JSON(http.StatusOK, campaign)
+}
+
+func (s *Server) deleteCampaign(c *gin.Context) {
+	if err := s.bonusService.DeleteCampaign(c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Campaign deleted successfully"})
+}
+
+// previewCampaigns показывает, какие кампании сработали бы на операцию, ничего не начисляя
+func (s *Server) previewCampaigns(c *gin.Context) {
+	var request struct {
+		Trigger  string     `json:"trigger" binding:"required"`
+		UserID   string     `json:"user_id" binding:"required"`
+		Amount   string     `json:"amount" binding:"required"`
+		Currency string     `json:"currency"`
+		At       *time.Time `json:"at"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	if request.Currency == "" {
+		request.Currency = "USD"
+	}
+	amount, err := models.ParseMoney(request.Amount, request.Currency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var at time.Time
+	if request.At != nil {
+		at = *request.At
+	}
+	decisions, err := s.bonusService.PreviewCampaigns(request.UserID, request.Trigger, amount, at)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"decisions": decisions})
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"petProjectMike/internal/campaigns"
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const campaignBody = `{
+	"id": "big-deposits", "name": "Big deposits", "active": true, "priority": 5, "triggers": ["deposit"],
+	"conditions": {"currency": "USD", "min_amount": {"amount": "100.00", "currency": "USD"}},
+	"reward": {"kind": "fixed", "amount": {"amount": "7.00", "currency": "USD"}, "bonus_type": "promo", "expires_in_days": 10}
+}`
+
+func TestCampaigns_CRUD(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	w := postJSON(server, "/api/v1/campaigns/", "", campaignBody)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	w = postJSON(server, "/api/v1/campaigns/", "", `{"name": "Broken", "triggers": ["deposit"], "reward": {"kind": "fixed"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeInvalidCampaign, decodeError(t, w).Code)
+
+	// Изменение с устаревшей версией отклоняется
+	update := strings.Replace(campaignBody, `"priority": 5`, `"priority": 50`, 1)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/campaigns/big-deposits", strings.NewReader(update))
+	req.Header.Set("If-Match", `"7"`)
+	assert.Equal(t, http.StatusPreconditionFailed, serve(server, req).Code)
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/campaigns/big-deposits", strings.NewReader(update))
+	req.Header.Set("If-Match", `"1"`)
+	w = serve(server, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	w = serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/campaigns/", nil))
+	var list []models.Campaign
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list, len(campaigns.Defaults())+1)
+
+	assert.Equal(t, http.StatusOK, serve(server, httptest.NewRequest(http.MethodDelete, "/api/v1/campaigns/big-deposits", nil)).Code)
+	assert.Equal(t, http.StatusNotFound, serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/campaigns/big-deposits", nil)).Code)
+
+	// Клиент не видит и не меняет кампании
+	_, tokens := registerAndLogin(t, server, "campaigns@example.com")
+	assert.Equal(t, http.StatusForbidden, requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/campaigns/", "").Code)
+	assert.Equal(t, http.StatusForbidden, requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/campaigns/", campaignBody).Code)
+}
+
+func TestCampaigns_Preview(t *testing.T) {
+	server, db := newTestServer(t)
+	userID, _ := registerAndLogin(t, server, "preview@example.com")
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/campaigns/", "", campaignBody).Code)
+
+	w := postJSON(server, "/api/v1/campaigns/preview", "",
+		`{"trigger": "deposit", "user_id": "`+userID+`", "amount": "250.00", "currency": "USD"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Decisions []campaigns.Decision `json:"decisions"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	fired := campaigns.Fired(response.Decisions)
+	if assert.Len(t, fired, 2) {
+		// Кампания с большим приоритетом первая
+		assert.Equal(t, "big-deposits", fired[0].CampaignID)
+		assert.Equal(t, models.NewMoney(700, "USD"), fired[0].Reward)
+		assert.Equal(t, "default-deposit", fired[1].CampaignID)
+		assert.Equal(t, models.NewMoney(125, "USD"), fired[1].Reward)
+	}
+
+	// Пробный прогон ничего не начисляет
+	bonuses, err := db.GetBonusesByUserID(userID)
+	assert.NoError(t, err)
+	assert.Empty(t, bonuses)
+
+	w = postJSON(server, "/api/v1/campaigns/preview", "", `{"trigger": "login", "user_id": "`+userID+`", "amount": "1.00"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestCampaigns_BudgetStopsIssuance(t *testing.T) {
+	server, db := newTestServer(t)
+	userID, _ := registerAndLogin(t, server, "budget@example.com")
+	account := createAccountFor(t, server, userID)
+	budgeted := strings.Replace(campaignBody, `"priority": 5,`, `"priority": 5, "budget": {"amount": "10.00", "currency": "USD"},`, 1)
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/campaigns/", "", budgeted).Code)
+
+	// Второй бонус урезан до остатка бюджета, третий не начисляется
+	for i := 0; i < 3; i++ {
+		w := postJSON(server, "/api/v1/transactions/deposit", "", `{"account_id": "`+account.ID+`", "amount": "100.00", "currency": "USD"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+	bonuses, err := db.GetBonusesByUserID(userID)
+	assert.NoError(t, err)
+	var issued int64
+	for _, bonus := range bonuses {
+		if bonus.CampaignID == "big-deposits" {
+			issued += bonus.Amount.Minor
+		}
+	}
+	assert.Equal(t, int64(1000), issued)
+
+	w := serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/campaigns/big-deposits/budget", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var budget struct {
+		Budget    models.Money `json:"budget"`
+		Spent     models.Money `json:"spent"`
+		Remaining models.Money `json:"remaining"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &budget))
+	assert.Equal(t, models.NewMoney(1000, "USD"), budget.Budget)
+	assert.Equal(t, models.NewMoney(1000, "USD"), budget.Spent)
+	assert.Equal(t, models.NewMoney(0, "USD"), budget.Remaining)
+
+	// Потраченное ведёт сервер: клиент не может обнулить его изменением кампании
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/campaigns/big-deposits",
+		strings.NewReader(strings.Replace(budgeted, `"name": "Big deposits",`, `"name": "Big deposits", "spent": {"amount": "0.00", "currency": "USD"},`, 1)))
+	campaign, err := db.GetCampaign("big-deposits")
+	assert.NoError(t, err)
+	req.Header.Set("If-Match", `"`+strconv.FormatInt(campaign.Version, 10)+`"`)
+	assert.Equal(t, http.StatusOK, serve(server, req).Code)
+	campaign, err = db.GetCampaign("big-deposits")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(1000, "USD"), campaign.Spent)
+}
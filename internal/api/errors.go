@@ -0,0 +1,191 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"petProjectMike/internal/auth"
+	"petProjectMike/internal/campaigns"
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/fx"
+	"petProjectMike/internal/loyalty"
+	"petProjectMike/internal/models"
+	"petProjectMike/internal/policy"
+	"petProjectMike/internal/scheduler"
+	"petProjectMike/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Коды ошибок в ответах API. Клиенты ветвятся по ним, поэтому коды не переименовываются
+const (
+	codeInvalidRequest        = "invalid_request"
+	codeUnauthorized          = "unauthorized"
+	codeInvalidCredentials    = "invalid_credentials"
+	codeInvalidToken          = "invalid_token"
+	codeInvalidAPIKey         = "invalid_api_key"
+	codeWeakPassword          = "weak_password"
+	codeForbidden             = "forbidden"
+	codeUnknownRole           = "unknown_role"
+	codeInvalidEmail          = "invalid_email"
+	codeEmailTaken            = "email_taken"
+	codeUnknownUser           = "unknown_user"
+	codeNotFound              = "not_found"
+	codeAlreadyExists         = "already_exists"
+	codeVersionConflict       = "version_conflict"
+	codePreconditionRequired  = "precondition_required"
+	codePreconditionFailed    = "precondition_failed"
+	codeInvalidAmount         = "invalid_amount"
+	codeCurrencyMismatch      = "currency_mismatch"
+	codeUnsupportedCurrency   = "unsupported_currency"
+	codeNoExchangeRate        = "no_exchange_rate"
+	codeInsufficientFunds     = "insufficient_funds"
+	codeInvalidTransaction    = "invalid_transaction"
+	codeAccountNotEmpty       = "account_not_empty"
+	codeAccountClosed         = "account_closed"
+	codeBalanceNotZero        = "balance_not_zero"
+	codeUserErased            = "user_erased"
+	codeUnsupportedBonusType  = "unsupported_bonus_type"
+	codeBonusNotActive        = "bonus_not_active"
+	codeBonusExpired          = "bonus_expired"
+	codeBonusNotOwned         = "bonus_not_owned"
+	codeBonusInsufficient     = "bonus_insufficient"
+	codeNoMatchingCampaign    = "no_matching_campaign"
+	codeInvalidCampaign       = "invalid_campaign"
+	codeWelcomeBonusGranted   = "welcome_bonus_granted"
+	codeInvalidReferralCode   = "invalid_referral_code"
+	codeInvalidPromo          = "invalid_promo"
+	codeUnknownPromoCode      = "unknown_promo_code"
+	codePromoNotActive        = "promo_not_active"
+	codePromoExhausted        = "promo_exhausted"
+	codePromoLimitReached     = "promo_limit_reached"
+	codeInvalidPoints         = "invalid_points"
+	codeNotConvertible        = "points_not_convertible"
+	codeInsufficientPoints    = "insufficient_points"
+	codeNotReversible         = "transaction_not_reversible"
+	codeIdempotencyKeyReused  = "idempotency_key_reused"
+	codeIdempotencyInProgress = "idempotency_in_progress"
+	codeJobRunning            = "job_running"
+	codeInternal              = "internal_error"
+)
+
+// errorResponse единый формат ошибки: человекочитаемое сообщение и машинный код
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// apiError ошибка уровня HTTP, у которой статус и код заданы явно
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func newAPIError(status int, code, message string) *apiError {
+	return &apiError{status: status, code: code, message: message}
+}
+
+// invalidRequest некорректное тело или параметры запроса
+func invalidRequest(err error) *apiError {
+	return newAPIError(http.StatusBadRequest, codeInvalidRequest, err.Error())
+}
+
+// domainErrors сопоставление ошибок хранилища и бизнес-правил со статусами; проверяется через errors.Is по порядку
+var domainErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{auth.ErrInvalidCredentials, http.StatusUnauthorized, codeInvalidCredentials},
+	{auth.ErrInvalidToken, http.StatusUnauthorized, codeInvalidToken},
+	{auth.ErrInvalidAPIKey, http.StatusUnauthorized, codeInvalidAPIKey},
+	{auth.ErrWeakPassword, http.StatusUnprocessableEntity, codeWeakPassword},
+	{policy.ErrForbidden, http.StatusForbidden, codeForbidden},
+	{policy.ErrUnknownRole, http.StatusUnprocessableEntity, codeUnknownRole},
+	{services.ErrInvalidEmail, http.StatusUnprocessableEntity, codeInvalidEmail},
+	{services.ErrInvalidUser, http.StatusBadRequest, codeInvalidRequest},
+	{services.ErrUnknownUser, http.StatusUnprocessableEntity, codeUnknownUser},
+	{database.ErrNotFound, http.StatusNotFound, codeNotFound},
+	// ErrEmailTaken — частный случай ErrAlreadyExists, поэтому проверяется раньше
+	{database.ErrEmailTaken, http.StatusConflict, codeEmailTaken},
+	{database.ErrAlreadyExists, http.StatusConflict, codeAlreadyExists},
+	{database.ErrConflict, http.StatusConflict, codeVersionConflict},
+	{services.ErrNonPositiveAmount, http.StatusUnprocessableEntity, codeInvalidAmount},
+	{models.ErrInvalidAmount, http.StatusUnprocessableEntity, codeInvalidAmount},
+	{models.ErrAmountOverflow, http.StatusUnprocessableEntity, codeInvalidAmount},
+	{models.ErrCurrencyMismatch, http.StatusUnprocessableEntity, codeCurrencyMismatch},
+	{models.ErrUnknownCurrency, http.StatusUnprocessableEntity, codeUnsupportedCurrency},
+	{services.ErrUnsupportedCurrency, http.StatusUnprocessableEntity, codeUnsupportedCurrency},
+	{fx.ErrNoRate, http.StatusUnprocessableEntity, codeNoExchangeRate},
+	{services.ErrInsufficientFunds, http.StatusUnprocessableEntity, codeInsufficientFunds},
+	{services.ErrInvalidTransaction, http.StatusUnprocessableEntity, codeInvalidTransaction},
+	{services.ErrAccountNotEmpty, http.StatusConflict, codeAccountNotEmpty},
+	{services.ErrAccountClosed, http.StatusConflict, codeAccountClosed},
+	{services.ErrBalanceNotZero, http.StatusConflict, codeBalanceNotZero},
+	{services.ErrUserErased, http.StatusConflict, codeUserErased},
+	{services.ErrUnsupportedBonusType, http.StatusUnprocessableEntity, codeUnsupportedBonusType},
+	{services.ErrBonusNotActive, http.StatusConflict, codeBonusNotActive},
+	{services.ErrBonusExpired, http.StatusUnprocessableEntity, codeBonusExpired},
+	{services.ErrBonusNotOwned, http.StatusForbidden, codeBonusNotOwned},
+	{services.ErrBonusInsufficient, http.StatusUnprocessableEntity, codeBonusInsufficient},
+	{services.ErrTransactionNotReversible, http.StatusConflict, codeNotReversible},
+	{services.ErrNoMatchingCampaign, http.StatusUnprocessableEntity, codeNoMatchingCampaign},
+	{campaigns.ErrInvalidCampaign, http.StatusUnprocessableEntity, codeInvalidCampaign},
+	{services.ErrWelcomeBonusGranted, http.StatusConflict, codeWelcomeBonusGranted},
+	{services.ErrInvalidReferralCode, http.StatusUnprocessableEntity, codeInvalidReferralCode},
+	{services.ErrInvalidPromo, http.StatusUnprocessableEntity, codeInvalidPromo},
+	{services.ErrUnknownPromoCode, http.StatusUnprocessableEntity, codeUnknownPromoCode},
+	{services.ErrPromoNotActive, http.StatusUnprocessableEntity, codePromoNotActive},
+	{services.ErrPromoExhausted, http.StatusConflict, codePromoExhausted},
+	{services.ErrPromoUserLimit, http.StatusConflict, codePromoLimitReached},
+	{loyalty.ErrInvalidPoints, http.StatusUnprocessableEntity, codeInvalidPoints},
+	{loyalty.ErrNotConvertible, http.StatusUnprocessableEntity, codeNotConvertible},
+	{services.ErrInsufficientPoints, http.StatusUnprocessableEntity, codeInsufficientPoints},
+	{services.ErrInvalidHistoryQuery, http.StatusBadRequest, codeInvalidRequest},
+	{scheduler.ErrUnknownJob, http.StatusNotFound, codeNotFound},
+	{scheduler.ErrJobRunning, http.StatusConflict, codeJobRunning},
+}
+
+// errorFor переводит ошибку в ответ. Неизвестные ошибки — 500 без подробностей:
+// текст внутренней ошибки может раскрыть устройство хранилища
+func errorFor(err error) (int, errorResponse) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.status, errorResponse{Error: apiErr.message, Code: apiErr.code}
+	}
+	for _, mapping := range domainErrors {
+		if errors.Is(err, mapping.err) {
+			return mapping.status, errorResponse{Error: err.Error(), Code: mapping.code}
+		}
+	}
+	log.Printf("internal error: %v", err)
+	return http.StatusInternalServerError, errorResponse{Error: "internal server error", Code: codeInternal}
+}
+
+// abortWithError сразу отвечает ошибкой; используется в middleware, где обработчик ещё не вызван
+func abortWithError(c *gin.Context, err *apiError) {
+	c.AbortWithStatusJSON(err.status, errorResponse{Error: err.message, Code: err.code})
+}
+
+// renderErrors отвечает последней ошибкой, которую обработчик добавил через c.Error, если ответ ещё не записан
+func renderErrors(c *gin.Context) {
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+	status, body := errorFor(c.Errors.Last().Err)
+	c.JSON(status, body)
+}
+
+// errorHandler обработчики сообщают об ошибке через c.Error и выходят, ответ формирует middleware
+func errorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		renderErrors(c)
+	}
+}
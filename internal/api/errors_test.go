@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) errorResponse {
+	var body errorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body
+}
+
+func TestErrors_MappedToStatusAndCode(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		status  int
+		code    string
+		message string
+	}{
+		{"missing account", http.MethodGet, "/api/v1/accounts/missing", "", http.StatusNotFound, codeNotFound, "account not found"},
+		{"delete missing account", http.MethodDelete, "/api/v1/accounts/missing", "", http.StatusNotFound, codeNotFound, "account not found"},
+		{"delete non-empty account", http.MethodDelete, "/api/v1/accounts/account-1", "", http.StatusConflict, codeAccountNotEmpty, "cannot delete account with positive balance"},
+		{"malformed body", http.MethodPost, "/api/v1/transactions/deposit", `{"amount": 1`, http.StatusBadRequest, codeInvalidRequest, ""},
+		{"insufficient funds", http.MethodPost, "/api/v1/transactions/withdrawal", `{"account_id": "account-1", "amount": "5000.00"}`,
+			http.StatusUnprocessableEntity, codeInsufficientFunds, "insufficient funds"},
+		{"currency mismatch", http.MethodPost, "/api/v1/transactions/deposit", `{"account_id": "account-1", "amount": "1.00", "currency": "EUR"}`,
+			http.StatusUnprocessableEntity, codeCurrencyMismatch, ""},
+		{"unsupported currency", http.MethodPost, "/api/v1/accounts/", `{"user_id": "user-1", "currency": "GBP"}`,
+			http.StatusUnprocessableEntity, codeUnsupportedCurrency, "unsupported currency"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := serve(server, req)
+			assert.Equal(t, tt.status, w.Code)
+			body := decodeError(t, w)
+			assert.Equal(t, tt.code, body.Code)
+			if tt.message != "" {
+				assert.Equal(t, tt.message, body.Error)
+			}
+		})
+	}
+}
+
+func TestErrors_UnknownErrorsHideDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(errorHandler())
+	router.GET("/boom", func(c *gin.Context) {
+		c.Error(errors.New("pq: connection refused to 10.0.0.5"))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, errorResponse{Error: "internal server error", Code: codeInternal}, decodeError(t, w))
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"petProjectMike/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setETag отдаёт версию записи в заголовке ETag; клиент возвращает её в If-Match при изменении
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+}
+
+// ifMatchVersion читает версию из If-Match. Без заголовка изменение запрещено (428),
+// иначе клиент мог бы незаметно затереть чужую правку.
+func ifMatchVersion(c *gin.Context) (int64, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		c.Error(newAPIError(http.StatusPreconditionRequired, codePreconditionRequired, "If-Match header is required"))
+		return 0, false
+	}
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+	if err != nil {
+		c.Error(newAPIError(http.StatusBadRequest, codeInvalidRequest, "invalid If-Match header"))
+		return 0, false
+	}
+	return version, true
+}
+
+// ifMatchFailed конфликт версий при изменении с If-Match — это 412: запись изменилась после того, как клиент её прочитал
+func ifMatchFailed(err error) error {
+	if errors.Is(err, database.ErrConflict) {
+		return newAPIError(http.StatusPreconditionFailed, codePreconditionFailed, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func putJSON(server *Server, path, ifMatch, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	return serve(server, req)
+}
+
+func TestUpdateAccount_RequiresMatchingVersion(t *testing.T) {
+	server, db := newTestServer(t)
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-2", Email: "two@example.com"}))
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-3", Email: "three@example.com"}))
+
+	get := serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/accounts/account-1", nil))
+	assert.Equal(t, http.StatusOK, get.Code)
+	etag := get.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	assert.Equal(t, http.StatusPreconditionRequired, putJSON(server, "/api/v1/accounts/account-1", "", `{"user_id": "user-2"}`).Code)
+
+	first := putJSON(server, "/api/v1/accounts/account-1", etag, `{"user_id": "user-2"}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, `"2"`, first.Header().Get("ETag"))
+
+	// Вторая правка с тем же ETag опоздала и не должна затереть первую
+	second := putJSON(server, "/api/v1/accounts/account-1", etag, `{"user_id": "user-3"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, second.Code)
+
+	account, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-2", account.UserID)
+	assert.Equal(t, models.NewMoney(100000, "USD"), account.Balance)
+}
+
+func TestUpdateAccount_RejectsUnknownOwner(t *testing.T) {
+	server, db := newTestServer(t)
+
+	w := putJSON(server, "/api/v1/accounts/account-1", `"1"`, `{"user_id": "user-missing"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeUnknownUser, decodeError(t, w).Code)
+
+	account, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", account.UserID)
+	assert.Equal(t, int64(1), account.Version)
+}
+
+func TestUpdateAccount_RejectsBalanceAndCurrency(t *testing.T) {
+	server, db := newTestServer(t)
+
+	w := putJSON(server, "/api/v1/accounts/account-1", `"1"`, `{"user_id": "user-1", "balance": "999999.00"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "balance can only be changed through transactions")
+
+	w = putJSON(server, "/api/v1/accounts/account-1", `"1"`, `{"user_id": "user-1", "currency": "EUR"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	account, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(100000, "USD"), account.Balance)
+	assert.Equal(t, int64(1), account.Version)
+}
+
+func TestUpdateUser_RequiresMatchingVersion(t *testing.T) {
+	server, db := newTestServer(t)
+
+	first := putJSON(server, "/api/v1/users/user-1", `"1"`, `{"email": "new@example.com", "name": "New"}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, `"2"`, first.Header().Get("ETag"))
+
+	stale := putJSON(server, "/api/v1/users/user-1", `"1"`, `{"email": "other@example.com", "name": "Other"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, stale.Code)
+
+	user, err := db.GetUser("user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "new@example.com", user.Email)
+}
@@ -1,9 +1,17 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"petProjectMike/internal/database"
 	"petProjectMike/internal/models"
+	"petProjectMike/internal/policy"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,17 +20,24 @@ func (s *Server) getAccount(c *gin.Context) {
 	id := c.Param("id")
 	account, err := s.accountService.GetAccount(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	if !authorize(c, policy.AccountsRead, account.UserID) {
+		return
+	}
+	setETag(c, account.Version)
 	c.JSON(http.StatusOK, account)
 }
 
 func (s *Server) getAccountSummary(c *gin.Context) {
 	id := c.Param("id")
+	if !s.authorizeAccounts(c, policy.AccountsRead, id) {
+		return
+	}
 	summary, err := s.accountService.GetAccountSummary(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, summary)
@@ -30,9 +45,12 @@ func (s *Server) getAccountSummary(c *gin.Context) {
 
 func (s *Server) getAccountsByUser(c *gin.Context) {
 	userID := c.Param("userID")
+	if !authorize(c, policy.AccountsRead, userID) {
+		return
+	}
 	accounts, err := s.accountService.GetAccountsByUser(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, accounts)
@@ -44,36 +62,60 @@ func (s *Server) createAccount(c *gin.Context) {
 		Currency string `json:"currency" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
+		return
+	}
+	if !authorize(c, policy.AccountsCreate, request.UserID) {
 		return
 	}
 	account, err := s.accountService.CreateAccount(request.UserID, request.Currency)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusCreated, account)
 }
 
+// updateAccount меняет владельца счёта. Остаток меняется только проводками, валюта — никогда
 func (s *Server) updateAccount(c *gin.Context) {
 	id := c.Param("id")
-	var account models.Account
-	if err := c.ShouldBindJSON(&account); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	version, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		UserID   string           `json:"user_id" binding:"required"`
+		Balance  *json.RawMessage `json:"balance"`
+		Currency *string          `json:"currency"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
 		return
 	}
-	account.ID = id
-	if err := s.accountService.UpdateAccount(&account); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if request.Balance != nil {
+		c.Error(newAPIError(http.StatusBadRequest, codeInvalidRequest, "balance can only be changed through transactions"))
+		return
+	}
+	if request.Currency != nil {
+		c.Error(newAPIError(http.StatusBadRequest, codeInvalidRequest, "currency cannot be changed"))
+		return
+	}
+	account, err := s.accountService.UpdateAccount(id, version, request.UserID)
+	if err != nil {
+		c.Error(ifMatchFailed(err))
 		return
 	}
+	setETag(c, account.Version)
 	c.JSON(http.StatusOK, account)
 }
 
 func (s *Server) deleteAccount(c *gin.Context) {
 	id := c.Param("id")
+	if !s.authorizeAccounts(c, policy.AccountsDelete, id) {
+		return
+	}
 	if err := s.accountService.DeleteAccount(id); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
@@ -83,36 +125,141 @@ func (s *Server) getTransaction(c *gin.Context) {
 	id := c.Param("id")
 	transaction, err := s.transactionService.GetTransaction(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	// Транзакцию видят владельцы обеих сторон
+	if !s.authorizeAccounts(c, policy.TransactionsRead, transaction.FromAccount, transaction.ToAccount) {
 		return
 	}
 	c.JSON(http.StatusOK, transaction)
 }
 
+// getTransactionHistory страница истории счёта. Фильтры: type и status (через запятую или повтором),
+// from и to (RFC 3339), min_amount и max_amount в валюте счёта, counterparty; order=asc|desc
+// (по умолчанию desc), limit и cursor из next_cursor предыдущей страницы
 func (s *Server) getTransactionHistory(c *gin.Context) {
 	accountID := c.Param("accountID")
-	transactions, err := s.transactionService.GetTransactionHistory(accountID)
+	if !s.authorizeAccounts(c, policy.TransactionsRead, accountID) {
+		return
+	}
+	query, err := s.parseHistoryQuery(c, accountID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	page, err := s.transactionService.GetTransactionHistory(query, c.Query("cursor"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, transactions)
+	c.JSON(http.StatusOK, page)
+}
+
+func (s *Server) parseHistoryQuery(c *gin.Context, accountID string) (database.TransactionQuery, error) {
+	query := database.TransactionQuery{
+		AccountID:    accountID,
+		Types:        queryList(c, "type"),
+		Statuses:     queryList(c, "status"),
+		Counterparty: c.Query("counterparty"),
+		Descending:   true,
+	}
+	switch c.Query("order") {
+	case "", "desc":
+	case "asc":
+		query.Descending = false
+	default:
+		return query, invalidRequest(errors.New("order must be asc or desc"))
+	}
+	var err error
+	if query.Since, err = queryTime(c, "from"); err != nil {
+		return query, err
+	}
+	if query.Until, err = queryTime(c, "to"); err != nil {
+		return query, err
+	}
+	if value := c.Query("min_amount"); value != "" {
+		if query.MinAmount, err = s.parseAmount(value, "", accountID); err != nil {
+			return query, err
+		}
+	}
+	if value := c.Query("max_amount"); value != "" {
+		if query.MaxAmount, err = s.parseAmount(value, "", accountID); err != nil {
+			return query, err
+		}
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, invalidRequest(errors.New("limit must be a positive integer"))
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
+
+// queryTime время из параметра в формате RFC 3339; nil, если параметр не передан
+func queryTime(c *gin.Context, param string) (*time.Time, error) {
+	value := c.Query(param)
+	if value == "" {
+		return nil, nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, invalidRequest(fmt.Errorf("%s must be an RFC 3339 time", param))
+	}
+	return &at, nil
+}
+
+// queryList значения параметра, переданные через запятую или повтором
+func queryList(c *gin.Context, param string) []string {
+	var list []string
+	for _, value := range c.QueryArray(param) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// parseAmount разбирает строковую сумму из запроса; если валюта не указана, берётся валюта счёта
+func (s *Server) parseAmount(amount, currency, accountID string) (models.Money, error) {
+	if currency == "" {
+		account, err := s.accountService.GetAccount(accountID)
+		if err != nil {
+			return models.Money{}, err
+		}
+		currency = account.Currency
+	}
+	return models.ParseMoney(amount, currency)
 }
 
 func (s *Server) createTransfer(c *gin.Context) {
 	var request struct {
-		FromAccount string  `json:"from_account" binding:"required"`
-		ToAccount   string  `json:"to_account" binding:"required"`
-		Amount      float64 `json:"amount" binding:"required,gt=0"`
-		Description string  `json:"description"`
+		FromAccount string `json:"from_account" binding:"required"`
+		ToAccount   string `json:"to_account" binding:"required"`
+		Amount      string `json:"amount" binding:"required"`
+		Currency    string `json:"currency"`
+		Description string `json:"description"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
+		return
+	}
+	// Переводить можно только со своего счёта; получатель может быть любым
+	if !s.authorizeAccounts(c, policy.MoneyMove, request.FromAccount) {
 		return
 	}
-	transaction, err := s.transactionService.CreateTransfer(request.FromAccount, request.ToAccount, request.Amount, request.Description)
+	amount, err := s.parseAmount(request.Amount, request.Currency, request.FromAccount)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	transaction, err := s.transactionService.CreateTransfer(request.FromAccount, request.ToAccount, amount, request.Description)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusCreated, transaction)
@@ -120,35 +267,72 @@ func (s *Server) createTransfer(c *gin.Context) {
 
 func (s *Server) createDeposit(c *gin.Context) {
 	var request struct {
-		AccountID   string  `json:"account_id" binding:"required"`
-		Amount      float64 `json:"amount" binding:"required,gt=0"`
-		Description string  `json:"description"`
+		AccountID   string `json:"account_id" binding:"required"`
+		Amount      string `json:"amount" binding:"required"`
+		Currency    string `json:"currency"`
+		Description string `json:"description"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
+		return
+	}
+	if !s.authorizeAccounts(c, policy.MoneySettle, request.AccountID) {
 		return
 	}
-	transaction, err := s.transactionService.CreateDeposit(request.AccountID, request.Amount, request.Description)
+	amount, err := s.parseAmount(request.Amount, request.Currency, request.AccountID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	transaction, err := s.transactionService.CreateDeposit(request.AccountID, amount, request.Description)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusCreated, transaction)
 }
 
+// reverseTransaction сторнирует операцию; тело с описанием сторно необязательно
+func (s *Server) reverseTransaction(c *gin.Context) {
+	var request struct {
+		Description string `json:"description"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.Error(invalidRequest(err))
+			return
+		}
+	}
+	reversal, err := s.transactionService.ReverseTransaction(c.Param("id"), request.Description)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, reversal)
+}
+
 func (s *Server) createWithdrawal(c *gin.Context) {
 	var request struct {
-		AccountID   string  `json:"account_id" binding:"required"`
-		Amount      float64 `json:"amount" binding:"required,gt=0"`
-		Description string  `json:"description"`
+		AccountID   string `json:"account_id" binding:"required"`
+		Amount      string `json:"amount" binding:"required"`
+		Currency    string `json:"currency"`
+		Description string `json:"description"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
+		return
+	}
+	if !s.authorizeAccounts(c, policy.MoneySettle, request.AccountID) {
 		return
 	}
-	transaction, err := s.transactionService.CreateWithdrawal(request.AccountID, request.Amount, request.Description)
+	amount, err := s.parseAmount(request.Amount, request.Currency, request.AccountID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	transaction, err := s.transactionService.CreateWithdrawal(request.AccountID, amount, request.Description)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusCreated, transaction)
@@ -158,7 +342,10 @@ func (s *Server) getBonus(c *gin.Context) {
 	id := c.Param("id")
 	bonus, err := s.bonusService.GetBonus(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	if !authorize(c, policy.BonusesRead, bonus.UserID) {
 		return
 	}
 	c.JSON(http.StatusOK, bonus)
@@ -166,26 +353,55 @@ func (s *Server) getBonus(c *gin.Context) {
 
 func (s *Server) getUserBonuses(c *gin.Context) {
 	userID := c.Param("userID")
+	if !authorize(c, policy.BonusesRead, userID) {
+		return
+	}
 	bonuses, err := s.bonusService.GetActiveBonuses(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, bonuses)
 }
 
+// getBonusHistory все бонусы пользователя с историей использований, включая использованные и истёкшие
+func (s *Server) getBonusHistory(c *gin.Context) {
+	userID := c.Param("userID")
+	if !authorize(c, policy.BonusesRead, userID) {
+		return
+	}
+	history, err := s.bonusService.GetBonusHistory(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
 func (s *Server) createWelcomeBonus(c *gin.Context) {
 	var request struct {
-		UserID string  `json:"user_id" binding:"required"`
-		Amount float64 `json:"amount" binding:"required,gt=0"`
+		UserID   string `json:"user_id" binding:"required"`
+		Amount   string `json:"amount" binding:"required"`
+		Currency string `json:"currency"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
+		return
+	}
+	if !authorize(c, policy.BonusesGrant, request.UserID) {
+		return
+	}
+	if request.Currency == "" {
+		request.Currency = "USD"
+	}
+	amount, err := models.ParseMoney(request.Amount, request.Currency)
+	if err != nil {
+		c.Error(err)
 		return
 	}
-	bonus, err := s.bonusService.CreateWelcomeBonus(request.UserID, request.Amount)
+	bonus, err := s.bonusService.CreateWelcomeBonus(request.UserID, amount)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusCreated, bonus)
@@ -195,61 +411,178 @@ func (s *Server) useBonus(c *gin.Context) {
 	var request struct {
 		BonusID   string `json:"bonus_id" binding:"required"`
 		AccountID string `json:"account_id" binding:"required"`
+		// Amount часть бонуса к зачислению в валюте бонуса; пустая — весь остаток
+		Amount string `json:"amount"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(invalidRequest(err))
 		return
 	}
-	if err := s.bonusService.UseBonus(request.BonusID, request.AccountID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// Бонус зачисляется только на счёт его владельца — это проверяет сервис
+	bonus, err := s.bonusService.GetBonus(request.BonusID)
+	if err != nil {
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Bonus used successfully"})
+	if !authorize(c, policy.BonusesUse, bonus.UserID) {
+		return
+	}
+	var amount models.Money
+	if request.Amount != "" {
+		if amount, err = models.ParseMoney(request.Amount, bonus.Amount.Currency); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	redemption, err := s.bonusService.UseBonus(request.BonusID, request.AccountID, amount)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Bonus used successfully", "redemption": redemption})
 }
 
 func (s *Server) getUser(c *gin.Context) {
 	id := c.Param("id")
+	if !authorize(c, policy.UsersRead, id) {
+		return
+	}
 	user, err := s.accountService.GetDB().GetUser(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
+	setETag(c, user.Version)
 	c.JSON(http.StatusOK, user)
 }
 
+// createUser регистрирует пользователя с паролем; пароль хранится только в виде bcrypt-хеша, ID выдаёт сервер.
+// Пользователь сразу получает свой реферальный код, а с referral_code регистрируется как приглашённый
 func (s *Server) createUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var request struct {
+		Email        string `json:"email" binding:"required"`
+		Name         string `json:"name" binding:"required"`
+		Password     string `json:"password" binding:"required"`
+		ReferralCode string `json:"referral_code"`
+		// DeviceID идентификатор устройства от клиента для проверки самоприглашений
+		DeviceID string `json:"device_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
 		return
 	}
-	if err := s.accountService.GetDB().CreateUser(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	enroll := func(tx database.Tx, user *models.User) error {
+		return s.referralService.Enroll(tx, user, request.ReferralCode, request.DeviceID)
+	}
+	user, err := s.authService.Register(request.Email, request.Name, request.Password, enroll)
+	if err != nil {
+		c.Error(err)
 		return
 	}
+	setETag(c, user.Version)
 	c.JSON(http.StatusCreated, user)
 }
 
 func (s *Server) updateUser(c *gin.Context) {
 	id := c.Param("id")
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !authorize(c, policy.UsersUpdate, id) {
 		return
 	}
-	user.ID = id
-	if err := s.accountService.GetDB().UpdateUser(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	version, ok := ifMatchVersion(c)
+	if !ok {
 		return
 	}
+	var request struct {
+		Email string `json:"email" binding:"required"`
+		Name  string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	// Версия из If-Match, а не прочитанная сейчас: правка поверх чужой должна получить конфликт
+	user, err := s.authService.UpdateProfile(id, version, request.Email, request.Name)
+	if err != nil {
+		c.Error(ifMatchFailed(err))
+		return
+	}
+	setETag(c, user.Version)
 	c.JSON(http.StatusOK, user)
 }
 
+// deleteUser удаляет пользователя: закрывает счета, гасит бонусы и обезличивает персональные данные.
+// Финансовые записи остаются; в ответе сертификат удаления
 func (s *Server) deleteUser(c *gin.Context) {
 	id := c.Param("id")
-	if err := s.accountService.GetDB().DeleteUser(id); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !authorize(c, policy.UsersDelete, id) {
+		return
+	}
+	certificate, err := s.erasureService.EraseUser(id, principalFrom(c).Subject)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, certificate)
+}
+
+func (s *Server) getErasureCertificate(c *gin.Context) {
+	id := c.Param("id")
+	if !authorize(c, policy.UsersRead, id) {
+		return
+	}
+	certificate, err := s.erasureService.GetCertificate(id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, certificate)
+}
+
+// setUserRole назначает роль; роль действует и для уже выданных токенов, со следующего запроса
+func (s *Server) setUserRole(c *gin.Context) {
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	user, err := s.authService.SetRole(c.Param("id"), request.Role)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, user)
+}
+
+// getTrialBalance отдаёт оборотно-сальдовую ведомость; если книга не сходится — 409 с той же ведомостью
+func (s *Server) getTrialBalance(c *gin.Context) {
+	// У книги целиком владельца нет: нужна роль с доступом ко всем счетам
+	if !authorize(c, policy.LedgerRead) {
+		return
+	}
+	report, err := s.ledgerService.TrialBalance()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	status := http.StatusOK
+	if !report.Balanced {
+		status = http.StatusConflict
+	}
+	c.JSON(status, report)
+}
+
+func (s *Server) getAccountLedger(c *gin.Context) {
+	id := c.Param("id")
+	if !s.authorizeAccounts(c, policy.LedgerRead, id) {
+		return
+	}
+	statement, err := s.ledgerService.GetAccountLedger(id)
+	if err != nil {
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+	c.JSON(http.StatusOK, statement)
 }
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+)
+
+// idempotentResponse сохранённый ответ на первый запрос с данным ключом
+type idempotentResponse struct {
+	fingerprint string
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// idempotencyStore хранит ключи в памяти процесса; ключи живут ttl с момента первого запроса
+type idempotencyStore struct {
+	ttl       time.Duration
+	now       func() time.Time
+	mutex     sync.Mutex
+	entries   map[string]*idempotentResponse
+	nextSweep time.Time
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, now: time.Now, entries: make(map[string]*idempotentResponse)}
+}
+
+// reserve возвращает сохранённую запись по ключу или, если её нет, резервирует ключ за текущим запросом
+func (s *idempotencyStore) reserve(key, fingerprint string) (existing *idempotentResponse, reserved bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expiresAt) {
+		copied := *entry
+		return &copied, false
+	}
+	s.entries[key] = &idempotentResponse{fingerprint: fingerprint, expiresAt: now.Add(s.ttl)}
+	return nil, true
+}
+
+// sweep удаляет просроченные ключи не чаще раза в ttl; вызывается под блокировкой
+func (s *idempotencyStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+	s.nextSweep = now.Add(s.ttl)
+}
+
+func (s *idempotencyStore) complete(key string, status int, contentType string, body []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if entry, ok := s.entries[key]; ok {
+		entry.done = true
+		entry.status = status
+		entry.contentType = contentType
+		entry.body = body
+	}
+}
+
+func (s *idempotencyStore) release(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, key)
+}
+
+// definitive окончательный ли ответ: запрос выполнен или отклонён проверкой тела, и повтор
+// ответит так же. Конфликты, отказы в доступе и отсутствующие записи зависят от состояния,
+// поэтому после них ключ освобождается и запрос можно повторить
+func definitive(status int) bool {
+	switch {
+	case status >= http.StatusOK && status < http.StatusMultipleChoices:
+		return true
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// capturingWriter копирует тело ответа, чтобы сохранить его для повторов
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// idempotent делает POST-обработчик безопасным для повторов с заголовком Idempotency-Key:
+// повтор с тем же телом получает исходный ответ, тот же ключ с другим телом — 422,
+// повтор, пришедший пока первый запрос ещё выполняется, — 409. Без заголовка запрос проходит как обычно.
+func (s *Server) idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortWithError(c, newAPIError(http.StatusBadRequest, codeInvalidRequest, "idempotency key is too long"))
+			return
+		}
+
+		// Ключи разных вызывающих не пересекаются: чужой ключ не даёт ни повтора, ни 422
+		if principal := principalFrom(c); principal != nil {
+			key = principal.Kind + ":" + principal.Subject + ":" + key
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, invalidRequest(err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Отпечаток включает фактический путь с запросом, а не шаблон маршрута: ключ, использованный
+		// для перевода, нельзя переиспользовать ни для списания, ни для сторно другой операции
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		existing, reserved := s.idempotency.reserve(key, fingerprint)
+		if !reserved {
+			switch {
+			case existing.fingerprint != fingerprint:
+				abortWithError(c, newAPIError(http.StatusUnprocessableEntity, codeIdempotencyKeyReused, "idempotency key was already used with a different request"))
+			case !existing.done:
+				abortWithError(c, newAPIError(http.StatusConflict, codeIdempotencyInProgress, "request with this idempotency key is still in progress"))
+			default:
+				c.Header(idempotencyReplayedHeader, "true")
+				c.Data(existing.status, existing.contentType, existing.body)
+				c.Abort()
+			}
+			return
+		}
+
+		writer := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		stored := false
+		// Паника, сбой сервера или неокончательный ответ не фиксируют результат: клиент может повторить запрос с тем же ключом
+		defer func() {
+			if !stored {
+				s.idempotency.release(key)
+			}
+		}()
+		c.Next()
+		// Ошибку обработчика нужно записать здесь, а не во внешнем middleware, иначе сохранится пустой ответ
+		renderErrors(c)
+
+		if definitive(c.Writer.Status()) {
+			s.idempotency.complete(key, c.Writer.Status(), c.Writer.Header().Get("Content-Type"), writer.body.Bytes())
+			stored = true
+		}
+	}
+}
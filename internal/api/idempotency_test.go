@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"petProjectMike/internal/auth"
+	"petProjectMike/internal/campaigns"
+	"petProjectMike/internal/config"
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/loyalty"
+	"petProjectMike/internal/models"
+	"petProjectMike/internal/scheduler"
+	"petProjectMike/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAPIKey = "test-service-key-0123456789"
+
+func newTestServer(t *testing.T) (*Server, *database.InMemoryDB) {
+	gin.SetMode(gin.TestMode)
+	db := database.NewInMemoryDB()
+	cfg := &config.Config{Env: "test", IdempotencyTTL: time.Hour}
+	tokens, err := auth.NewTokenIssuer([]byte("test-secret-test-secret-test-secret"), time.Minute, time.Hour)
+	assert.NoError(t, err)
+	apiKeys, err := auth.ParseAPIKeys("tests:" + testAPIKey)
+	assert.NoError(t, err)
+	// Без кампаний приветственные бонусы не начисляются; в тестах действуют правила по умолчанию
+	program := loyalty.New(map[string]models.Money{"USD": models.NewMoney(100, "USD")}, map[string]models.Money{"USD": models.NewMoney(100, "USD")})
+	bonusService := services.NewBonusService(db, services.BonusLimits{}, nil, program)
+	assert.NoError(t, bonusService.SeedCampaigns(campaigns.Defaults(), false))
+	bus := events.NewBus()
+	bonusService.Subscribe(bus)
+	referralService := services.NewReferralService(db, bonusService, nil)
+	referralService.Subscribe(bus)
+	loyaltyService := services.NewLoyaltyService(db, program)
+	loyaltyService.Subscribe(bus)
+	server := NewServer(cfg,
+		services.NewTransactionService(db, bus),
+		bonusService,
+		services.NewAccountService(db),
+		services.NewLedgerService(db),
+		services.NewAuthService(db, tokens),
+		referralService,
+		loyaltyService,
+		services.NewErasureService(db, bus, services.DefaultRetentionYears),
+		apiKeys,
+		scheduler.New(10),
+	)
+	return server, db
+}
+
+// serve выполняет запрос от имени тестового сервиса, если вызывающий не задан явно
+func serve(server *Server, req *http.Request) *httptest.ResponseRecorder {
+	if req.Header.Get("Authorization") == "" && req.Header.Get(apiKeyHeader) == "" {
+		req.Header.Set(apiKeyHeader, testAPIKey)
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	return w
+}
+
+func postJSON(server *Server, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	return serve(server, req)
+}
+
+func TestIdempotency_ReplaysOriginalResponse(t *testing.T) {
+	server, db := newTestServer(t)
+	body := `{"account_id": "account-1", "amount": "10.00", "description": "atm"}`
+
+	first := postJSON(server, "/api/v1/transactions/withdrawal", "key-1", body)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	retry := postJSON(server, "/api/v1/transactions/withdrawal", "key-1", body)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get(idempotencyReplayedHeader))
+
+	// Деньги списаны один раз
+	account, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(99000, "USD"), account.Balance)
+}
+
+func TestIdempotency_RejectsKeyReuseWithDifferentRequest(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	first := postJSON(server, "/api/v1/transactions/deposit", "key-1", `{"account_id": "account-1", "amount": "10.00"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	otherBody := postJSON(server, "/api/v1/transactions/deposit", "key-1", `{"account_id": "account-1", "amount": "20.00"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, otherBody.Code)
+
+	otherRoute := postJSON(server, "/api/v1/transactions/withdrawal", "key-1", `{"account_id": "account-1", "amount": "10.00"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, otherRoute.Code)
+}
+
+func TestIdempotency_RejectsKeyReuseForAnotherResource(t *testing.T) {
+	server, db := newTestServer(t)
+	var deposits []models.Transaction
+	for _, key := range []string{"deposit-1", "deposit-2"} {
+		w := postJSON(server, "/api/v1/transactions/deposit", key, `{"account_id": "account-1", "amount": "10.00"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var deposit models.Transaction
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &deposit))
+		deposits = append(deposits, deposit)
+	}
+
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/transactions/"+deposits[0].ID+"/reverse", "reverse-key", "").Code)
+
+	// Тот же маршрут, но другая операция: это другой запрос, а не повтор первого сторно
+	w := postJSON(server, "/api/v1/transactions/"+deposits[1].ID+"/reverse", "reverse-key", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeIdempotencyKeyReused, decodeError(t, w).Code)
+	second, err := db.GetTransaction(deposits[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", second.Status)
+}
+
+func TestIdempotency_ErrorsAreReplayedToo(t *testing.T) {
+	server, _ := newTestServer(t)
+	body := `{"account_id": "account-1", "amount": "100000.00"}`
+
+	first := postJSON(server, "/api/v1/transactions/withdrawal", "key-1", body)
+	assert.Equal(t, http.StatusUnprocessableEntity, first.Code)
+
+	retry := postJSON(server, "/api/v1/transactions/withdrawal", "key-1", body)
+	assert.Equal(t, first.Code, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+}
+
+func TestIdempotency_WithoutKeyEveryRequestIsExecuted(t *testing.T) {
+	server, db := newTestServer(t)
+	body := `{"account_id": "account-1", "amount": "10.00"}`
+
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/transactions/deposit", "", body).Code)
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/transactions/deposit", "", body).Code)
+
+	account, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(102000, "USD"), account.Balance)
+}
+
+func TestIdempotency_InFlightRequestConflicts(t *testing.T) {
+	server, _ := newTestServer(t)
+	body := `{"account_id": "account-1", "amount": "10.00"}`
+
+	// Первый запрос ещё выполняется: ключ зарезервирован, ответа нет
+	first := postJSON(server, "/api/v1/transactions/deposit", "key-1", body)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	server.idempotency.entries["service:tests:key-1"].done = false
+
+	retry := postJSON(server, "/api/v1/transactions/deposit", "key-1", body)
+	assert.Equal(t, http.StatusConflict, retry.Code)
+}
+
+func TestIdempotency_KeysExpireAfterTTL(t *testing.T) {
+	server, db := newTestServer(t)
+	now := time.Now()
+	server.idempotency.now = func() time.Time { return now }
+	body := `{"account_id": "account-1", "amount": "10.00"}`
+
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/transactions/deposit", "key-1", body).Code)
+
+	now = now.Add(2 * time.Hour)
+	retry := postJSON(server, "/api/v1/transactions/deposit", "key-1", body)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Empty(t, retry.Header().Get(idempotencyReplayedHeader))
+
+	account, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(102000, "USD"), account.Balance)
+}
+
+func TestIdempotency_ConflictReleasesKey(t *testing.T) {
+	server, _ := newTestServer(t)
+	calls := 0
+	router := gin.New()
+	router.POST("/operation", server.idempotent(), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			c.Error(database.ErrConflict)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"call": calls})
+	})
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/operation", strings.NewReader(`{}`))
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Конфликт не окончательный: повтор с тем же ключом выполняется заново
+	assert.Equal(t, http.StatusConflict, post().Code)
+	retry := post()
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Empty(t, retry.Header().Get(idempotencyReplayedHeader))
+
+	// Успешный ответ уже сохранён
+	replay := post()
+	assert.Equal(t, retry.Body.String(), replay.Body.String())
+	assert.Equal(t, "true", replay.Header().Get(idempotencyReplayedHeader))
+	assert.Equal(t, 2, calls)
+}
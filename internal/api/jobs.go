@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listJobs фоновые задачи с расписанием и историей последних запусков
+func (s *Server) listJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, s.jobs.Jobs())
+}
+
+// runJob запускает задачу вне расписания; ответ не ждёт её завершения, результат виден в истории
+func (s *Server) runJob(c *gin.Context) {
+	if err := s.jobs.RunNow(c.Param("name")); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Job started"})
+}
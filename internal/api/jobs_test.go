@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"petProjectMike/internal/scheduler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobs_ListAndRun(t *testing.T) {
+	server, _ := newTestServer(t)
+	release := make(chan struct{})
+	assert.NoError(t, server.jobs.Register("expire-bonuses", scheduler.Every(time.Hour), func(ctx context.Context) error {
+		<-release
+		return nil
+	}))
+
+	assert.Equal(t, http.StatusAccepted, postJSON(server, "/api/v1/jobs/expire-bonuses/run", "", "").Code)
+	w := postJSON(server, "/api/v1/jobs/expire-bonuses/run", "", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, codeJobRunning, decodeError(t, w).Code)
+	assert.Equal(t, http.StatusNotFound, postJSON(server, "/api/v1/jobs/unknown/run", "", "").Code)
+	close(release)
+	server.jobs.Stop()
+
+	w = serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var jobs []scheduler.JobInfo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &jobs))
+	if assert.Len(t, jobs, 1) && assert.Len(t, jobs[0].History, 2) {
+		assert.Equal(t, scheduler.StatusSucceeded, jobs[0].History[0].Status)
+		assert.Equal(t, scheduler.StatusSkipped, jobs[0].History[1].Status)
+	}
+
+	// Клиенту задачи недоступны
+	_, tokens := registerAndLogin(t, server, "jobs@example.com")
+	assert.Equal(t, http.StatusForbidden, requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/jobs/", "").Code)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"petProjectMike/internal/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getLoyaltyStatus баланс баллов и уровень лояльности пользователя
+func (s *Server) getLoyaltyStatus(c *gin.Context) {
+	userID := c.Param("userID")
+	if !authorize(c, policy.BonusesRead, userID) {
+		return
+	}
+	status, err := s.loyaltyService.Status(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// convertPoints обменивает баллы пользователя на бонус в валюте currency
+func (s *Server) convertPoints(c *gin.Context) {
+	var request struct {
+		UserID   string `json:"user_id" binding:"required"`
+		Points   int64  `json:"points" binding:"required"`
+		Currency string `json:"currency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	if !authorize(c, policy.BonusesUse, request.UserID) {
+		return
+	}
+	bonus, err := s.bonusService.ConvertPoints(request.UserID, request.Points, request.Currency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, bonus)
+}
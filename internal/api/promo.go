@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+
+	"petProjectMike/internal/models"
+	"petProjectMike/internal/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redeemPromoCode гасит промокод и начисляет бонус пользователю user_id
+func (s *Server) redeemPromoCode(c *gin.Context) {
+	var request struct {
+		UserID string `json:"user_id" binding:"required"`
+		Code   string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	if !authorize(c, policy.BonusesUse, request.UserID) {
+		return
+	}
+	bonus, err := s.bonusService.RedeemPromoCode(request.UserID, request.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, bonus)
+}
+
+// createPromoBatch генерирует партию промокодов: count случайных кодов с префиксом prefix
+// или один код с именем code
+func (s *Server) createPromoBatch(c *gin.Context) {
+	var request struct {
+		models.PromoCode
+		Count  int    `json:"count"`
+		Prefix string `json:"prefix"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(invalidRequest(err))
+		return
+	}
+	codes, err := s.bonusService.GeneratePromoCodes(&request.PromoCode, request.Count, request.Prefix)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"batch_id": codes[0].BatchID, "codes": codes})
+}
+
+// getPromoBatch коды партии со счётчиками погашений
+func (s *Server) getPromoBatch(c *gin.Context) {
+	batchID := c.Param("id")
+	codes, err := s.bonusService.GetPromoBatch(batchID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"batch_id": batchID, "codes": codes})
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"petProjectMike/internal/policy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getReferralStats реферальный код пользователя и итоги его приглашений
+func (s *Server) getReferralStats(c *gin.Context) {
+	userID := c.Param("userID")
+	if !authorize(c, policy.ReferralsRead, userID) {
+		return
+	}
+	stats, err := s.referralService.Stats(userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"petProjectMike/internal/models"
+	"petProjectMike/internal/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferrals_SignupWithCodeAndStats(t *testing.T) {
+	server, _ := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "inviter@gmail.com")
+
+	w := requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/referrals/user/"+userID, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats services.ReferralStats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.NotEmpty(t, stats.Code)
+
+	// Чужие итоги клиенту недоступны
+	assert.Equal(t, http.StatusForbidden, requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/referrals/user/user-1", "").Code)
+
+	w = postJSON(server, "/api/v1/users/", "", `{"email": "lost@gmail.com", "name": "Lost", "password": "s3cret-password", "referral_code": "NOPE2345"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeInvalidReferralCode, decodeError(t, w).Code)
+
+	w = postJSON(server, "/api/v1/users/", "", `{"email": "invitee@gmail.com", "name": "Invitee", "password": "s3cret-password", "referral_code": "`+stats.Code+`", "device_id": "phone-2"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var invitee models.User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &invitee))
+	account := createAccountFor(t, server, invitee.ID)
+	w = postJSON(server, "/api/v1/transactions/deposit", "", `{"account_id": "`+account.ID+`", "amount": "50.00"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/referrals/user/"+userID, "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 1, stats.Qualified)
+	assert.Equal(t, []models.Money{models.NewMoney(1000, "USD")}, stats.Earned)
+}
@@ -1,9 +1,14 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"time"
 
+	"petProjectMike/internal/auth"
 	"petProjectMike/internal/config"
+	"petProjectMike/internal/policy"
+	"petProjectMike/internal/scheduler"
 	"petProjectMike/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +19,14 @@ type Server struct {
 	transactionService *services.TransactionService
 	bonusService       *services.BonusService
 	accountService     *services.AccountService
+	ledgerService      *services.LedgerService
+	authService        *services.AuthService
+	referralService    *services.ReferralService
+	loyaltyService     *services.LoyaltyService
+	erasureService     *services.ErasureService
+	apiKeys            *auth.APIKeys
+	jobs               *scheduler.Scheduler
+	idempotency        *idempotencyStore
 	router             *gin.Engine
 }
 
@@ -22,12 +35,27 @@ func NewServer(
 	transactionService *services.TransactionService,
 	bonusService *services.BonusService,
 	accountService *services.AccountService,
+	ledgerService *services.LedgerService,
+	authService *services.AuthService,
+	referralService *services.ReferralService,
+	loyaltyService *services.LoyaltyService,
+	erasureService *services.ErasureService,
+	apiKeys *auth.APIKeys,
+	jobs *scheduler.Scheduler,
 ) *Server {
 	server := &Server{
 		config:             cfg,
 		transactionService: transactionService,
 		bonusService:       bonusService,
 		accountService:     accountService,
+		ledgerService:      ledgerService,
+		authService:        authService,
+		referralService:    referralService,
+		loyaltyService:     loyaltyService,
+		erasureService:     erasureService,
+		apiKeys:            apiKeys,
+		jobs:               jobs,
+		idempotency:        newIdempotencyStore(cfg.IdempotencyTTL),
 	}
 	server.setupRoutes()
 	return server
@@ -39,51 +67,114 @@ func (s *Server) setupRoutes() {
 	}
 
 	s.router = gin.Default()
-	s.router.Use(gin.Logger(), gin.Recovery())
+	s.router.Use(gin.Logger(), gin.Recovery(), errorHandler())
 
 	s.router.GET("/health", s.healthCheck)
 
-	v1 := s.router.Group("/api/v1")
+	// Без аутентификации доступны только вход, обновление токенов и регистрация
+	public := s.router.Group("/api/v1")
 	{
+		public.POST("/auth/login", s.login)
+		public.POST("/auth/refresh", s.refreshToken)
+		public.POST("/users/", s.createUser)
+	}
+
+	// Роль проверяется на маршруте (require), владелец ресурса — в обработчике (authorize)
+	v1 := s.router.Group("/api/v1", s.authenticate())
+	{
+		v1.POST("/auth/password", s.changePassword)
+
 		accounts := v1.Group("/accounts")
 		{
-			accounts.GET("/:id", s.getAccount)
-			accounts.GET("/:id/summary", s.getAccountSummary)
-			accounts.GET("/user/:userID", s.getAccountsByUser)
-			accounts.POST("/", s.createAccount)
-			accounts.PUT("/:id", s.updateAccount)
-			accounts.DELETE("/:id", s.deleteAccount)
+			accounts.GET("/:id", require(policy.AccountsRead), s.getAccount)
+			accounts.GET("/:id/summary", require(policy.AccountsRead), s.getAccountSummary)
+			accounts.GET("/user/:userID", require(policy.AccountsRead), s.getAccountsByUser)
+			accounts.POST("/", require(policy.AccountsCreate), s.createAccount)
+			accounts.PUT("/:id", require(policy.AccountsManage), s.updateAccount)
+			accounts.DELETE("/:id", require(policy.AccountsDelete), s.deleteAccount)
 		}
 
 		transactions := v1.Group("/transactions")
 		{
-			transactions.GET("/:id", s.getTransaction)
-			transactions.GET("/account/:accountID", s.getTransactionHistory)
-			transactions.POST("/transfer", s.createTransfer)
-			transactions.POST("/deposit", s.createDeposit)
-			transactions.POST("/withdrawal", s.createWithdrawal)
+			transactions.GET("/:id", require(policy.TransactionsRead), s.getTransaction)
+			transactions.GET("/account/:accountID", require(policy.TransactionsRead), s.getTransactionHistory)
+			transactions.POST("/transfer", require(policy.MoneyMove), s.idempotent(), s.createTransfer)
+			transactions.POST("/deposit", require(policy.MoneySettle), s.idempotent(), s.createDeposit)
+			transactions.POST("/withdrawal", require(policy.MoneySettle), s.idempotent(), s.createWithdrawal)
+			transactions.POST("/:id/reverse", require(policy.TransactionsReverse), s.idempotent(), s.reverseTransaction)
 		}
 
 		bonuses := v1.Group("/bonuses")
 		{
-			bonuses.GET("/:id", s.getBonus)
-			bonuses.GET("/user/:userID", s.getUserBonuses)
-			bonuses.POST("/welcome", s.createWelcomeBonus)
-			bonuses.POST("/use", s.useBonus)
+			bonuses.GET("/:id", require(policy.BonusesRead), s.getBonus)
+			bonuses.GET("/user/:userID", require(policy.BonusesRead), s.getUserBonuses)
+			bonuses.GET("/user/:userID/history", require(policy.BonusesRead), s.getBonusHistory)
+			bonuses.POST("/welcome", require(policy.BonusesGrant), s.createWelcomeBonus)
+			bonuses.POST("/use", require(policy.BonusesUse), s.idempotent(), s.useBonus)
+			bonuses.POST("/promo", require(policy.BonusesUse), s.idempotent(), s.redeemPromoCode)
+			bonuses.POST("/promo/batches", require(policy.PromoManage), s.createPromoBatch)
+			bonuses.GET("/promo/batches/:id", require(policy.PromoManage), s.getPromoBatch)
+			bonuses.GET("/loyalty/user/:userID", require(policy.BonusesRead), s.getLoyaltyStatus)
+			bonuses.POST("/loyalty/convert", require(policy.BonusesUse), s.idempotent(), s.convertPoints)
+		}
+
+		campaigns := v1.Group("/campaigns")
+		{
+			campaigns.GET("/", require(policy.CampaignsRead), s.listCampaigns)
+			campaigns.GET("/:id", require(policy.CampaignsRead), s.getCampaign)
+			campaigns.GET("/:id/budget", require(policy.CampaignsRead), s.getCampaignBudget)
+			campaigns.POST("/", require(policy.CampaignsManage), s.createCampaign)
+			campaigns.PUT("/:id", require(policy.CampaignsManage), s.updateCampaign)
+			campaigns.DELETE("/:id", require(policy.CampaignsManage), s.deleteCampaign)
+			campaigns.POST("/preview", require(policy.CampaignsRead), s.previewCampaigns)
+		}
+
+		referrals := v1.Group("/referrals")
+		{
+			referrals.GET("/user/:userID", require(policy.ReferralsRead), s.getReferralStats)
 		}
 
 		users := v1.Group("/users")
 		{
-			users.GET("/:id", s.getUser)
-			users.POST("/", s.createUser)
-			users.PUT("/:id", s.updateUser)
-			users.DELETE("/:id", s.deleteUser)
+			users.GET("/:id", require(policy.UsersRead), s.getUser)
+			users.PUT("/:id", require(policy.UsersUpdate), s.updateUser)
+			users.DELETE("/:id", require(policy.UsersDelete), s.deleteUser)
+			users.GET("/:id/erasure", require(policy.UsersRead), s.getErasureCertificate)
+			users.PUT("/:id/role", require(policy.RolesManage), s.setUserRole)
+		}
+
+		ledger := v1.Group("/ledger")
+		{
+			ledger.GET("/trial-balance", require(policy.LedgerRead), s.getTrialBalance)
+			ledger.GET("/accounts/:id", require(policy.LedgerRead), s.getAccountLedger)
+		}
+
+		jobs := v1.Group("/jobs")
+		{
+			jobs.GET("/", require(policy.JobsRead), s.listJobs)
+			jobs.POST("/:name/run", require(policy.JobsRun), s.runJob)
 		}
 	}
 }
 
-func (s *Server) Run() error {
-	return s.router.Run(":" + s.config.Port)
+// shutdownTimeout сколько при остановке ждать завершения начатых запросов
+const shutdownTimeout = 15 * time.Second
+
+// Run обслуживает запросы, пока не отменён ctx; после отмены новые соединения не принимаются,
+// а начатые запросы получают shutdownTimeout на завершение
+func (s *Server) Run(ctx context.Context) error {
+	srv := &http.Server{Addr: ":" + s.config.Port, Handler: s.router}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
 }
 
 func (s *Server) healthCheck(c *gin.Context) {
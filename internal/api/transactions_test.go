@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"petProjectMike/internal/models"
+	"petProjectMike/internal/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactions_ReverseRevokesBonus(t *testing.T) {
+	server, db := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "reverse@example.com")
+	account := createAccountFor(t, server, userID)
+
+	w := postJSON(server, "/api/v1/transactions/deposit", "", `{"account_id": "`+account.ID+`", "amount": "200.00", "currency": "USD"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var deposit models.Transaction
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &deposit))
+
+	// Бонус за пополнение начислен владельцу счёта
+	bonuses, err := db.GetBonusesByTransaction(deposit.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, bonuses, 1) {
+		assert.Equal(t, userID, bonuses[0].UserID)
+	}
+
+	// Клиент не может сторнировать даже свою операцию
+	assert.Equal(t, http.StatusForbidden,
+		requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/transactions/"+deposit.ID+"/reverse", "").Code)
+
+	w = postJSON(server, "/api/v1/transactions/"+deposit.ID+"/reverse", "", `{"description": "chargeback"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var reversal models.Transaction
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reversal))
+	assert.Equal(t, "reversal", reversal.Type)
+	assert.Equal(t, "chargeback", reversal.Description)
+
+	bonus, err := db.GetBonus(bonuses[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "revoked", bonus.Status)
+
+	w = postJSON(server, "/api/v1/transactions/"+deposit.ID+"/reverse", "", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, codeNotReversible, decodeError(t, w).Code)
+}
+
+func TestTransactions_TransfersWithinOneUserEarnNoBonus(t *testing.T) {
+	server, db := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "shuffle@example.com")
+	first := createAccountFor(t, server, userID)
+	second := createAccountFor(t, server, userID)
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/transactions/deposit", "", `{"account_id": "`+first.ID+`", "amount": "1000.00"}`).Code)
+
+	w := requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/transactions/transfer",
+		`{"from_account": "`+first.ID+`", "to_account": "`+first.ID+`", "amount": "1000.00"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, codeInvalidTransaction, decodeError(t, w).Code)
+
+	w = requestAs(server, tokens.AccessToken, http.MethodPost, "/api/v1/transactions/transfer",
+		`{"from_account": "`+first.ID+`", "to_account": "`+second.ID+`", "amount": "1000.00"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var transfer models.Transaction
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &transfer))
+	bonuses, err := db.GetBonusesByTransaction(transfer.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, bonuses)
+}
+
+func TestTransactions_HistoryPagination(t *testing.T) {
+	server, _ := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "pages@example.com")
+	account := createAccountFor(t, server, userID)
+	for _, amount := range []string{"10.00", "20.00", "30.00"} {
+		w := postJSON(server, "/api/v1/transactions/deposit", "", `{"account_id": "`+account.ID+`", "amount": "`+amount+`"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	path := "/api/v1/transactions/account/" + account.ID
+	w := requestAs(server, tokens.AccessToken, http.MethodGet, path+"?type=deposit&min_amount=15&limit=1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page services.HistoryPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	if assert.Len(t, page.Transactions, 1) {
+		assert.Equal(t, models.NewMoney(3000, "USD"), page.Transactions[0].Amount)
+	}
+	assert.NotEmpty(t, page.NextCursor)
+
+	w = requestAs(server, tokens.AccessToken, http.MethodGet, path+"?type=deposit&min_amount=15&limit=1&cursor="+page.NextCursor, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	page = services.HistoryPage{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	if assert.Len(t, page.Transactions, 1) {
+		assert.Equal(t, models.NewMoney(2000, "USD"), page.Transactions[0].Amount)
+	}
+	assert.Empty(t, page.NextCursor)
+
+	for _, query := range []string{"?order=sideways", "?limit=0", "?from=yesterday", "?cursor=%21%21"} {
+		w = requestAs(server, tokens.AccessToken, http.MethodGet, path+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.Equal(t, codeInvalidRequest, decodeError(t, w).Code)
+	}
+	w = requestAs(server, tokens.AccessToken, http.MethodGet, path+"?min_amount=1.234", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsers_DeleteErasesUser(t *testing.T) {
+	server, db := newTestServer(t)
+	userID, tokens := registerAndLogin(t, server, "leaving@example.com")
+	account := createAccountFor(t, server, userID)
+	deposit := `{"account_id": "` + account.ID + `", "amount": "25.00", "description": "salary"}`
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/transactions/deposit", "erase-deposit", deposit).Code)
+
+	// Клиент не может удалить себя сам, администратор — пока на счёте деньги
+	w := requestAs(server, tokens.AccessToken, http.MethodDelete, "/api/v1/users/"+userID, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serve(server, httptest.NewRequest(http.MethodDelete, "/api/v1/users/"+userID, nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, codeBalanceNotZero, decodeError(t, w).Code)
+
+	withdrawal := `{"account_id": "` + account.ID + `", "amount": "25.00", "description": "payout"}`
+	assert.Equal(t, http.StatusCreated, postJSON(server, "/api/v1/transactions/withdrawal", "erase-withdrawal", withdrawal).Code)
+	w = serve(server, httptest.NewRequest(http.MethodDelete, "/api/v1/users/"+userID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var certificate models.ErasureCertificate
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &certificate))
+	assert.Equal(t, []string{account.ID}, certificate.ClosedAccounts)
+	assert.Equal(t, "tests", certificate.RequestedBy)
+	assert.True(t, certificate.Verify())
+	assert.NotContains(t, w.Body.String(), "leaving@example.com")
+
+	// Выданные токены больше не действуют, войти с прежним паролем нельзя
+	w = requestAs(server, tokens.AccessToken, http.MethodGet, "/api/v1/users/"+userID, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postJSON(server, "/api/v1/auth/refresh", "", `{"refresh_token": "`+tokens.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postJSON(server, "/api/v1/auth/login", "", `{"email": "leaving@example.com", "password": "s3cret-password"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Счёт и его история остаются, но операции по нему запрещены
+	w = serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/transactions/account/"+account.ID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postJSON(server, "/api/v1/transactions/deposit", "erase-late", deposit)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, codeAccountClosed, decodeError(t, w).Code)
+	user, err := db.GetUser(userID)
+	assert.NoError(t, err)
+	assert.True(t, user.Erased())
+
+	w = serve(server, httptest.NewRequest(http.MethodGet, "/api/v1/users/"+userID+"/erasure", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var saved models.ErasureCertificate
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &saved))
+	assert.Equal(t, certificate.Digest, saved.Digest)
+	w = serve(server, httptest.NewRequest(http.MethodDelete, "/api/v1/users/"+userID, nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, codeUserErased, decodeError(t, w).Code)
+
+	// Прежний email снова свободен
+	w = postJSON(server, "/api/v1/users/", "", `{"email": "leaving@example.com", "name": "Back", "password": "s3cret-password"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
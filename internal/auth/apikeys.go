@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"petProjectMike/internal/policy"
+)
+
+// APIKeys ключи внутренних сервисов. Хранятся только sha256 ключей, сравнение — за постоянное время
+type APIKeys struct {
+	keys []apiKey
+}
+
+type apiKey struct {
+	service string
+	role    policy.Role
+	hash    [sha256.Size]byte
+}
+
+// DefaultServiceRole роль сервиса, если она не указана: интеграции, настроенные до появления ролей, сохраняют полный доступ
+const DefaultServiceRole = policy.RoleAdmin
+
+// ParseAPIKeys разбирает список вида "billing:key1,reporting:key2:auditor"; сам ключ не может содержать двоеточие
+func ParseAPIKeys(spec string) (*APIKeys, error) {
+	keys := &APIKeys{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || len(parts[1]) < 16 {
+			return nil, fmt.Errorf("api key for %q must look like service:key[:role] with a key of at least 16 characters", parts[0])
+		}
+		role := DefaultServiceRole
+		if len(parts) == 3 {
+			var err error
+			if role, err = policy.ParseRole(parts[2]); err != nil {
+				return nil, fmt.Errorf("api key for %q: %w", parts[0], err)
+			}
+		}
+		keys.keys = append(keys.keys, apiKey{service: parts[0], role: role, hash: sha256.Sum256([]byte(parts[1]))})
+	}
+	return keys, nil
+}
+
+// Authenticate возвращает сервис, которому выдан ключ
+func (k *APIKeys) Authenticate(key string) (*Principal, error) {
+	hash := sha256.Sum256([]byte(key))
+	var found *Principal
+	// Перебираем все ключи, не выходя на первом совпадении: время не зависит от позиции ключа
+	for _, candidate := range k.keys {
+		if subtle.ConstantTimeCompare(hash[:], candidate.hash[:]) == 1 {
+			found = &Principal{Subject: candidate.service, Kind: KindService, Role: candidate.role}
+		}
+	}
+	if found == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return found, nil
+}
@@ -0,0 +1,40 @@
+// Package auth — аутентификация вызывающих: пароли пользователей, JWT-токены доступа
+// и обновления, API-ключи сервисов. Пакет не зависит от HTTP: middleware живёт в internal/api.
+package auth
+
+import (
+	"errors"
+
+	"petProjectMike/internal/policy"
+)
+
+var (
+	// ErrInvalidCredentials неверный email или пароль; намеренно не уточняет, что именно
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrInvalidToken токен подделан, истёк или другого типа
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrInvalidAPIKey ключ не найден среди выданных сервисам
+	ErrInvalidAPIKey = errors.New("invalid api key")
+)
+
+// Виды вызывающих
+const (
+	KindUser    = "user"
+	KindService = "service"
+)
+
+// Principal аутентифицированный вызывающий: пользователь (Subject — ID пользователя)
+// или внутренний сервис по API-ключу (Subject — имя сервиса)
+type Principal struct {
+	Subject string      `json:"subject"`
+	Kind    string      `json:"kind"`
+	Role    policy.Role `json:"role"`
+}
+
+func (p *Principal) IsUser() bool {
+	return p.Kind == KindUser
+}
+
+func (p *Principal) IsService() bool {
+	return p.Kind == KindService
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"petProjectMike/internal/policy"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIssuer(t *testing.T) *TokenIssuer {
+	issuer, err := NewTokenIssuer([]byte("test-secret-test-secret-test-secret"), time.Minute, time.Hour)
+	assert.NoError(t, err)
+	return issuer
+}
+
+func TestPassword_HashAndCheck(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	assert.NoError(t, err)
+	assert.NotContains(t, hash, "correct horse")
+
+	assert.NoError(t, CheckPassword(hash, "correct horse"))
+	assert.ErrorIs(t, CheckPassword(hash, "wrong horse"), ErrInvalidCredentials)
+	// Пользователь без пароля войти не может
+	assert.ErrorIs(t, CheckPassword("", ""), ErrInvalidCredentials)
+
+	_, err = HashPassword("short")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+	_, err = HashPassword(strings.Repeat("x", 73))
+	assert.ErrorIs(t, err, ErrWeakPassword)
+}
+
+func TestTokens_IssueAndParse(t *testing.T) {
+	issuer := newTestIssuer(t)
+	pair, err := issuer.Issue("user-1", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer", pair.TokenType)
+
+	claims, err := issuer.Parse(pair.AccessToken, TokenAccess)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+
+	// Токен обновления нельзя предъявить вместо токена доступа и наоборот
+	_, err = issuer.Parse(pair.RefreshToken, TokenAccess)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = issuer.Parse(pair.AccessToken, TokenRefresh)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestTokens_RejectsExpiredForgedAndUnsigned(t *testing.T) {
+	issuer := newTestIssuer(t)
+	now := time.Now()
+	issuer.now = func() time.Time { return now }
+	pair, err := issuer.Issue("user-1", 0)
+	assert.NoError(t, err)
+
+	issuer.now = func() time.Time { return now.Add(2 * time.Minute) }
+	_, err = issuer.Parse(pair.AccessToken, TokenAccess)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	issuer.now = time.Now
+
+	other, err := NewTokenIssuer([]byte("another-secret-another-secret-xx"), time.Minute, time.Hour)
+	assert.NoError(t, err)
+	forged, err := other.Issue("admin", 0)
+	assert.NoError(t, err)
+	_, err = issuer.Parse(forged.AccessToken, TokenAccess)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: tokenIssuer, Subject: "admin", ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))},
+		Type:             TokenAccess,
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.NoError(t, err)
+	_, err = issuer.Parse(unsigned, TokenAccess)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestNewTokenIssuer_RequiresLongSecret(t *testing.T) {
+	_, err := NewTokenIssuer([]byte("short"), time.Minute, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys("billing:billing-key-0123456789, reporting:reporting-key-0123456789:auditor")
+	assert.NoError(t, err)
+
+	principal, err := keys.Authenticate("reporting-key-0123456789")
+	assert.NoError(t, err)
+	assert.Equal(t, &Principal{Subject: "reporting", Kind: KindService, Role: policy.RoleAuditor}, principal)
+	principal, err = keys.Authenticate("billing-key-0123456789")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultServiceRole, principal.Role)
+
+	_, err = keys.Authenticate("unknown-key-0123456789")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	empty, err := ParseAPIKeys("")
+	assert.NoError(t, err)
+	_, err = empty.Authenticate("")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	_, err = ParseAPIKeys("billing:short")
+	assert.Error(t, err)
+	_, err = ParseAPIKeys("no-separator-0123456789")
+	assert.Error(t, err)
+	_, err = ParseAPIKeys("billing:billing-key-0123456789:root")
+	assert.ErrorIs(t, err, policy.ErrUnknownRole)
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength минимальная длина пароля; bcrypt учитывает только первые 72 байта
+const (
+	MinPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+var ErrWeakPassword = fmt.Errorf("password must be %d to %d bytes long", MinPasswordLength, maxPasswordLength)
+
+// dummyHash сравнивается с паролем, когда пользователь не найден, чтобы время ответа
+// не выдавало, зарегистрирован ли email
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// HashPassword проверяет длину пароля и возвращает его bcrypt-хеш
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength || len(password) > maxPasswordLength {
+		return "", ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword сравнивает пароль с хешем. Пустой хеш (пароль не задан) никогда не совпадает,
+// но сравнение всё равно выполняется
+func CheckPassword(hash, password string) error {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return ErrInvalidCredentials
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Типы токенов: токен доступа открывает API, токеном обновления можно только получить новую пару
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+const tokenIssuer = "banking-api"
+
+// Claims содержимое токена. Тип хранится в самом токене, чтобы токен обновления нельзя было предъявить вместо токена доступа
+type Claims struct {
+	jwt.RegisteredClaims
+	Type string `json:"typ"`
+	// Generation поколение токенов пользователя на момент выпуска; у токенов, выпущенных
+	// до появления поколений, оно нулевое
+	Generation int64 `json:"gen,omitempty"`
+}
+
+// TokenPair ответ на вход и обновление
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// TokenIssuer выпускает и проверяет JWT, подписанные HMAC-SHA256
+type TokenIssuer struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+func NewTokenIssuer(secret []byte, accessTTL, refreshTTL time.Duration) (*TokenIssuer, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("jwt secret must be at least 32 bytes")
+	}
+	return &TokenIssuer{secret: secret, accessTTL: accessTTL, refreshTTL: refreshTTL, now: time.Now}, nil
+}
+
+// RandomSecret случайный секрет для разработки: токены перестают действовать после перезапуска
+func RandomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return []byte(hex.EncodeToString(secret))
+}
+
+// Issue выпускает пару токенов для пользователя с текущим поколением его токенов
+func (i *TokenIssuer) Issue(userID string, generation int64) (*TokenPair, error) {
+	now := i.now()
+	access, accessExpires, err := i.sign(userID, generation, TokenAccess, now, i.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	refresh, refreshExpires, err := i.sign(userID, generation, TokenRefresh, now, i.refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		TokenType:        "Bearer",
+		AccessExpiresAt:  accessExpires,
+		RefreshExpiresAt: refreshExpires,
+	}, nil
+}
+
+func (i *TokenIssuer) sign(userID string, generation int64, tokenType string, now time.Time, ttl time.Duration) (string, time.Time, error) {
+	expires := now.Add(ttl)
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+		Type:       tokenType,
+		Generation: generation,
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(i.secret)
+	return signed, expires, err
+}
+
+// Parse проверяет подпись, срок и тип токена и возвращает его содержимое
+func (i *TokenIssuer) Parse(token, tokenType string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) { return i.secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(i.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Type != tokenType || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
@@ -0,0 +1,318 @@
+// Package campaigns — движок правил бонусных кампаний. Кампании хранятся в базе и загружаются
+// из файла; пакет только проверяет их и решает, какие сработают на событие, ничего не записывая.
+package campaigns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"petProjectMike/internal/models"
+)
+
+var ErrInvalidCampaign = errors.New("invalid campaign")
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidCampaign, fmt.Sprintf(format, args...))
+}
+
+// Validate проверяет кампанию перед сохранением
+func Validate(c *models.Campaign) error {
+	if c.Name == "" {
+		return invalid("name is required")
+	}
+	if len(c.Triggers) == 0 {
+		return invalid("at least one trigger is required")
+	}
+	for _, trigger := range c.Triggers {
+		if !KnownTrigger(trigger) {
+			return invalid("unknown trigger %q", trigger)
+		}
+	}
+
+	cond := c.Conditions
+	for name, bound := range map[string]models.Money{"min_amount": cond.MinAmount, "max_amount": cond.MaxAmount} {
+		if bound != (models.Money{}) && bound.Currency != cond.Currency {
+			return invalid("%s must be in the campaign currency", name)
+		}
+	}
+	if cond.MinAmount != (models.Money{}) && cond.MaxAmount != (models.Money{}) && cond.MinAmount.Minor > cond.MaxAmount.Minor {
+		return invalid("min_amount is greater than max_amount")
+	}
+	if cond.RegisteredAfter != nil && cond.RegisteredBefore != nil && !cond.RegisteredAfter.Before(*cond.RegisteredBefore) {
+		return invalid("registered_after must be before registered_before")
+	}
+	if cond.StartsAt != nil && cond.EndsAt != nil && !cond.StartsAt.Before(*cond.EndsAt) {
+		return invalid("starts_at must be before ends_at")
+	}
+
+	reward := c.Reward
+	switch reward.Kind {
+	case models.RewardFixed:
+		if !reward.Amount.IsPositive() {
+			return invalid("fixed reward needs a positive amount")
+		}
+		if reward.RateBP != 0 || reward.Cap != (models.Money{}) {
+			return invalid("fixed reward has no rate or cap")
+		}
+	case models.RewardPercentage:
+		if reward.RateBP <= 0 {
+			return invalid("percentage reward needs a positive rate_bp")
+		}
+		if reward.Amount != (models.Money{}) {
+			return invalid("percentage reward has no fixed amount")
+		}
+		if reward.Cap != (models.Money{}) && (!reward.Cap.IsPositive() || reward.Cap.Currency != cond.Currency) {
+			return invalid("cap must be positive and in the campaign currency")
+		}
+	default:
+		return invalid("unknown reward kind %q", reward.Kind)
+	}
+	if reward.BonusType == "" {
+		return invalid("bonus_type is required")
+	}
+	if c.Budget != (models.Money{}) {
+		if !c.Budget.IsPositive() || cond.Currency == "" || c.Budget.Currency != cond.Currency {
+			return invalid("budget must be positive and in the campaign currency")
+		}
+		if reward.Kind == models.RewardFixed && reward.Amount.Currency != cond.Currency {
+			return invalid("fixed reward of a budgeted campaign must be in the campaign currency")
+		}
+	}
+	if reward.ExpiresInDays <= 0 {
+		return invalid("expires_in_days must be positive")
+	}
+	return nil
+}
+
+// KnownTrigger есть ли событие, на которое может сработать кампания
+func KnownTrigger(trigger string) bool {
+	switch trigger {
+	case models.TriggerWelcome, models.TriggerTransfer, models.TriggerDeposit, models.TriggerReferrer, models.TriggerReferee:
+		return true
+	}
+	return false
+}
+
+// Event событие, за которое может полагаться бонус
+type Event struct {
+	Trigger string
+	UserID  string
+	// UserRegisteredAt дата регистрации пользователя для условий когорты
+	UserRegisteredAt time.Time
+	// Amount сумма операции; для приветственного бонуса — запрошенная сумма бонуса,
+	// для приглашения — пополнение, которым оно подтверждено
+	Amount models.Money
+	At     time.Time
+	// MultiplierBP множитель вознаграждения уровня лояльности в базисных пунктах (10000 — ×1);
+	// ноль — без множителя. Применяется после потолка кампании, но в пределах её бюджета
+	MultiplierBP int64
+}
+
+// Decision результат проверки одной кампании: сработала ли она, а если нет — почему
+type Decision struct {
+	CampaignID   string       `json:"campaign_id"`
+	CampaignName string       `json:"campaign_name"`
+	Fired        bool         `json:"fired"`
+	Reason       string       `json:"reason,omitempty"`
+	Reward       models.Money `json:"reward"`
+	BonusType    string       `json:"bonus_type,omitempty"`
+	ExpiresAt    *time.Time   `json:"expires_at,omitempty"`
+}
+
+// Evaluate проверяет все кампании по порядку приоритета; сработать могут несколько
+func Evaluate(list []*models.Campaign, event Event) []Decision {
+	ordered := append([]*models.Campaign(nil), list...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Priority != ordered[j].Priority {
+			return ordered[i].Priority > ordered[j].Priority
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+	decisions := make([]Decision, 0, len(ordered))
+	for _, campaign := range ordered {
+		decisions = append(decisions, evaluate(campaign, event))
+	}
+	return decisions
+}
+
+// Fired только сработавшие решения
+func Fired(decisions []Decision) []Decision {
+	var fired []Decision
+	for _, d := range decisions {
+		if d.Fired {
+			fired = append(fired, d)
+		}
+	}
+	return fired
+}
+
+func evaluate(c *models.Campaign, event Event) Decision {
+	decision := Decision{CampaignID: c.ID, CampaignName: c.Name}
+	if reason := mismatch(c, event); reason != "" {
+		decision.Reason = reason
+		return decision
+	}
+	reward, err := rewardFor(c.Reward, event.Amount)
+	if err != nil {
+		decision.Reason = err.Error()
+		return decision
+	}
+	if event.MultiplierBP > 0 {
+		if reward, err = reward.MulRat(event.MultiplierBP, 10000, models.RoundHalfEven); err != nil {
+			decision.Reason = err.Error()
+			return decision
+		}
+	}
+	if !reward.IsPositive() {
+		decision.Reason = "reward rounds to zero"
+		return decision
+	}
+	// Остаток бюджета урезает последнее вознаграждение, исчерпанный бюджет выключает кампанию
+	if remaining, limited := Remaining(c); limited {
+		if !remaining.IsPositive() {
+			decision.Reason = "campaign budget is exhausted"
+			return decision
+		}
+		if reward.Minor > remaining.Minor {
+			reward = remaining
+		}
+	}
+	decision.Fired = true
+	decision.Reward = reward
+	decision.BonusType = c.Reward.BonusType
+	expiresAt := event.At.AddDate(0, 0, c.Reward.ExpiresInDays)
+	decision.ExpiresAt = &expiresAt
+	return decision
+}
+
+// mismatch причина, по которой кампания не подходит событию; пустая — подходит
+func mismatch(c *models.Campaign, event Event) string {
+	if !c.Active {
+		return "campaign is inactive"
+	}
+	if !contains(c.Triggers, event.Trigger) {
+		return "trigger does not match"
+	}
+	cond := c.Conditions
+	if cond.StartsAt != nil && event.At.Before(*cond.StartsAt) {
+		return "campaign has not started"
+	}
+	if cond.EndsAt != nil && !event.At.Before(*cond.EndsAt) {
+		return "campaign has ended"
+	}
+	if cond.Currency != "" && event.Amount.Currency != cond.Currency {
+		return "currency does not match"
+	}
+	if cond.MinAmount != (models.Money{}) && event.Amount.Minor < cond.MinAmount.Minor {
+		return "amount is below the minimum"
+	}
+	if cond.MaxAmount != (models.Money{}) && event.Amount.Minor > cond.MaxAmount.Minor {
+		return "amount is above the maximum"
+	}
+	if len(cond.UserIDs) > 0 && !contains(cond.UserIDs, event.UserID) {
+		return "user is not in the campaign cohort"
+	}
+	if cond.RegisteredAfter != nil && event.UserRegisteredAt.Before(*cond.RegisteredAfter) {
+		return "user registered before the cohort window"
+	}
+	if cond.RegisteredBefore != nil && !event.UserRegisteredAt.Before(*cond.RegisteredBefore) {
+		return "user registered after the cohort window"
+	}
+	return ""
+}
+
+func rewardFor(reward models.CampaignReward, amount models.Money) (models.Money, error) {
+	if reward.Kind == models.RewardFixed {
+		return reward.Amount, nil
+	}
+	value, err := amount.MulRat(reward.RateBP, 10000, models.RoundHalfEven)
+	if err != nil {
+		return models.Money{}, err
+	}
+	if reward.Cap != (models.Money{}) && value.Currency == reward.Cap.Currency && value.Minor > reward.Cap.Minor {
+		value = reward.Cap
+	}
+	return value, nil
+}
+
+// Remaining остаток бюджета кампании; limited=false — бюджет не ограничен
+func Remaining(c *models.Campaign) (remaining models.Money, limited bool) {
+	if c.Budget == (models.Money{}) {
+		return models.Money{}, false
+	}
+	return models.NewMoney(c.Budget.Minor-c.Spent.Minor, c.Budget.Currency), true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Defaults кампании, повторяющие прежние жёстко заданные правила: приветственный бонус
+// в запрошенном размере на 30 дней, 1% за перевод и 0.5% за пополнение на 90 дней.
+// За приглашение с пополнением в USD пригласивший получает 10.00 USD, приглашённый — 5.00 USD
+func Defaults() []*models.Campaign {
+	return []*models.Campaign{
+		{
+			ID: "default-welcome", Name: "Welcome bonus", Active: true,
+			Triggers: []string{models.TriggerWelcome},
+			Reward:   models.CampaignReward{Kind: models.RewardPercentage, RateBP: 10000, BonusType: "welcome", ExpiresInDays: 30},
+		},
+		{
+			ID: "default-transfer", Name: "1% for transfers", Active: true,
+			Triggers: []string{models.TriggerTransfer},
+			Reward:   models.CampaignReward{Kind: models.RewardPercentage, RateBP: 100, BonusType: "transaction", ExpiresInDays: 90},
+		},
+		{
+			ID: "default-deposit", Name: "0.5% for deposits", Active: true,
+			Triggers: []string{models.TriggerDeposit},
+			Reward:   models.CampaignReward{Kind: models.RewardPercentage, RateBP: 50, BonusType: "transaction", ExpiresInDays: 90},
+		},
+		{
+			ID: "default-referrer", Name: "Referral: inviter", Active: true,
+			Triggers:   []string{models.TriggerReferrer},
+			Conditions: models.CampaignConditions{Currency: "USD"},
+			Reward:     models.CampaignReward{Kind: models.RewardFixed, Amount: models.NewMoney(1000, "USD"), BonusType: "referral", ExpiresInDays: 90},
+		},
+		{
+			ID: "default-referee", Name: "Referral: invitee", Active: true,
+			Triggers:   []string{models.TriggerReferee},
+			Conditions: models.CampaignConditions{Currency: "USD"},
+			Reward:     models.CampaignReward{Kind: models.RewardFixed, Amount: models.NewMoney(500, "USD"), BonusType: "referral", ExpiresInDays: 90},
+		},
+	}
+}
+
+// LoadFile читает кампании из JSON-файла (массив кампаний в формате API) и проверяет их
+func LoadFile(path string) ([]*models.Campaign, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []*models.Campaign
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("campaigns file %s: %w", path, err)
+	}
+	seen := make(map[string]bool, len(list))
+	for _, campaign := range list {
+		if campaign.ID == "" {
+			return nil, fmt.Errorf("campaigns file %s: %w", path, invalid("id is required"))
+		}
+		if seen[campaign.ID] {
+			return nil, fmt.Errorf("campaigns file %s: %w", path, invalid("duplicate id %q", campaign.ID))
+		}
+		seen[campaign.ID] = true
+		if err := Validate(campaign); err != nil {
+			return nil, fmt.Errorf("campaigns file %s, campaign %q: %w", path, campaign.ID, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,186 @@
+package campaigns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func usdCampaign() *models.Campaign {
+	return &models.Campaign{
+		ID: "c-1", Name: "Big transfers", Active: true,
+		Triggers: []string{models.TriggerTransfer},
+		Conditions: models.CampaignConditions{
+			Currency:  "USD",
+			MinAmount: models.NewMoney(10000, "USD"),
+			MaxAmount: models.NewMoney(1000000, "USD"),
+		},
+		Reward: models.CampaignReward{
+			Kind: models.RewardPercentage, RateBP: 200, Cap: models.NewMoney(5000, "USD"),
+			BonusType: "transaction", ExpiresInDays: 14,
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *models.Campaign)
+		valid  bool
+	}{
+		{"valid", func(c *models.Campaign) {}, true},
+		{"no name", func(c *models.Campaign) { c.Name = "" }, false},
+		{"unknown trigger", func(c *models.Campaign) { c.Triggers = []string{"login"} }, false},
+		{"bound in other currency", func(c *models.Campaign) { c.Conditions.MinAmount = models.NewMoney(100, "EUR") }, false},
+		{"min above max", func(c *models.Campaign) { c.Conditions.MinAmount = models.NewMoney(2000000, "USD") }, false},
+		{"empty date window", func(c *models.Campaign) {
+			at := time.Now()
+			c.Conditions.StartsAt, c.Conditions.EndsAt = &at, &at
+		}, false},
+		{"percentage without rate", func(c *models.Campaign) { c.Reward.RateBP = 0 }, false},
+		{"fixed with rate", func(c *models.Campaign) {
+			c.Reward.Kind = models.RewardFixed
+			c.Reward.Amount = models.NewMoney(500, "USD")
+		}, false},
+		{"no expiry", func(c *models.Campaign) { c.Reward.ExpiresInDays = 0 }, false},
+		{"budget", func(c *models.Campaign) { c.Budget = models.NewMoney(100000, "USD") }, true},
+		{"budget in other currency", func(c *models.Campaign) { c.Budget = models.NewMoney(100000, "EUR") }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := usdCampaign()
+			tt.modify(c)
+			err := Validate(c)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidCampaign)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now()
+	event := Event{Trigger: models.TriggerTransfer, UserID: "user-1", UserRegisteredAt: now.AddDate(0, -1, 0), At: now}
+
+	tests := []struct {
+		name   string
+		amount models.Money
+		modify func(c *models.Campaign)
+		reward models.Money
+		reason string
+	}{
+		{"percentage", models.NewMoney(50000, "USD"), func(c *models.Campaign) {}, models.NewMoney(1000, "USD"), ""},
+		{"capped", models.NewMoney(500000, "USD"), func(c *models.Campaign) {}, models.NewMoney(5000, "USD"), ""},
+		{"fixed", models.NewMoney(50000, "USD"), func(c *models.Campaign) {
+			c.Reward = models.CampaignReward{Kind: models.RewardFixed, Amount: models.NewMoney(700, "USD"), BonusType: "promo", ExpiresInDays: 1}
+		}, models.NewMoney(700, "USD"), ""},
+		{"below minimum", models.NewMoney(5000, "USD"), func(c *models.Campaign) {}, models.Money{}, "amount is below the minimum"},
+		{"other currency", models.NewMoney(50000, "EUR"), func(c *models.Campaign) {}, models.Money{}, "currency does not match"},
+		{"other trigger", models.NewMoney(50000, "USD"), func(c *models.Campaign) {
+			c.Triggers = []string{models.TriggerDeposit}
+		}, models.Money{}, "trigger does not match"},
+		{"not in cohort", models.NewMoney(50000, "USD"), func(c *models.Campaign) {
+			c.Conditions.UserIDs = []string{"user-2"}
+		}, models.Money{}, "user is not in the campaign cohort"},
+		{"registered too early", models.NewMoney(50000, "USD"), func(c *models.Campaign) {
+			after := now.AddDate(0, 0, -7)
+			c.Conditions.RegisteredAfter = &after
+		}, models.Money{}, "user registered before the cohort window"},
+		{"ended", models.NewMoney(50000, "USD"), func(c *models.Campaign) {
+			c.Conditions.EndsAt = &now
+		}, models.Money{}, "campaign has ended"},
+		{"inactive", models.NewMoney(50000, "USD"), func(c *models.Campaign) { c.Active = false }, models.Money{}, "campaign is inactive"},
+		{"budget trims reward", models.NewMoney(50000, "USD"), func(c *models.Campaign) {
+			c.Budget, c.Spent = models.NewMoney(10000, "USD"), models.NewMoney(9700, "USD")
+		}, models.NewMoney(300, "USD"), ""},
+		{"budget exhausted", models.NewMoney(50000, "USD"), func(c *models.Campaign) {
+			c.Budget, c.Spent = models.NewMoney(10000, "USD"), models.NewMoney(10000, "USD")
+		}, models.Money{}, "campaign budget is exhausted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := usdCampaign()
+			tt.modify(c)
+			e := event
+			e.Amount = tt.amount
+
+			decisions := Evaluate([]*models.Campaign{c}, e)
+
+			assert.Len(t, decisions, 1)
+			d := decisions[0]
+			assert.Equal(t, tt.reason == "", d.Fired)
+			assert.Equal(t, tt.reason, d.Reason)
+			assert.Equal(t, tt.reward, d.Reward)
+			if d.Fired {
+				assert.Equal(t, now.AddDate(0, 0, c.Reward.ExpiresInDays), *d.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestEvaluate_TierMultiplier(t *testing.T) {
+	c := usdCampaign()
+	event := Event{Trigger: models.TriggerTransfer, Amount: models.NewMoney(500000, "USD"), At: time.Now(), MultiplierBP: 15000}
+
+	// Множитель применяется к награде после потолка кампании
+	decisions := Evaluate([]*models.Campaign{c}, event)
+	assert.Equal(t, models.NewMoney(7500, "USD"), decisions[0].Reward)
+
+	// но не выходит за бюджет
+	c.Budget, c.Spent = models.NewMoney(10000, "USD"), models.NewMoney(4000, "USD")
+	decisions = Evaluate([]*models.Campaign{c}, event)
+	assert.Equal(t, models.NewMoney(6000, "USD"), decisions[0].Reward)
+}
+
+func TestEvaluate_OrdersByPriority(t *testing.T) {
+	low := usdCampaign()
+	high := usdCampaign()
+	high.ID, high.Priority = "c-2", 10
+	off := usdCampaign()
+	off.ID, off.Priority, off.Active = "c-0", 20, false
+
+	decisions := Evaluate([]*models.Campaign{low, off, high}, Event{
+		Trigger: models.TriggerTransfer, Amount: models.NewMoney(50000, "USD"), At: time.Now(),
+	})
+
+	assert.Equal(t, []string{"c-0", "c-2", "c-1"}, []string{decisions[0].CampaignID, decisions[1].CampaignID, decisions[2].CampaignID})
+	fired := Fired(decisions)
+	assert.Len(t, fired, 2)
+	assert.Equal(t, "c-2", fired[0].CampaignID)
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	for _, c := range Defaults() {
+		assert.NoError(t, Validate(c), c.ID)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "campaigns.json")
+	assert.NoError(t, os.WriteFile(valid, []byte(`[{
+		"id": "spring", "name": "Spring deposits", "active": true, "triggers": ["deposit"],
+		"conditions": {"currency": "USD", "min_amount": {"amount": "50.00", "currency": "USD"}},
+		"reward": {"kind": "fixed", "amount": {"amount": "5.00", "currency": "USD"}, "bonus_type": "promo", "expires_in_days": 7}
+	}]`), 0o600))
+
+	list, err := LoadFile(valid)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, models.NewMoney(5000, "USD"), list[0].Conditions.MinAmount)
+
+	duplicate := filepath.Join(dir, "duplicate.json")
+	assert.NoError(t, os.WriteFile(duplicate, []byte(`[
+		{"id": "a", "name": "A", "active": true, "triggers": ["deposit"], "reward": {"kind": "percentage", "rate_bp": 10, "bonus_type": "x", "expires_in_days": 1}},
+		{"id": "a", "name": "A", "active": true, "triggers": ["deposit"], "reward": {"kind": "percentage", "rate_bp": 10, "bonus_type": "x", "expires_in_days": 1}}
+	]`), 0o600))
+	_, err = LoadFile(duplicate)
+	assert.ErrorIs(t, err, ErrInvalidCampaign)
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -9,6 +11,51 @@ import (
 type Config struct {
 	Port string
 	Env  string
+
+	// DBDriver выбирает хранилище: "memory" (по умолчанию), "postgres" или "sqlite"
+	DBDriver string
+	// DatabaseURL DSN PostgreSQL или путь к файлу SQLite
+	DatabaseURL string
+
+	// MemoryDataDir каталог журнала и снапшотов InMemoryDB; пустой — данные живут только в памяти
+	MemoryDataDir string
+	// MemoryFsync политика fsync журнала: "always" (по умолчанию), "interval" или "never"
+	MemoryFsync string
+	// MemorySnapshotEvery после скольких записей журнала делать снапшот
+	MemorySnapshotEvery int
+
+	// IdempotencyTTL сколько хранится ответ на запрос с Idempotency-Key
+	IdempotencyTTL time.Duration
+
+	// JWTSecret ключ подписи токенов; обязателен в production, в разработке генерируется при запуске
+	JWTSecret string
+	// AccessTokenTTL и RefreshTokenTTL время жизни токенов доступа и обновления
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// APIKeys ключи внутренних сервисов в формате "service:key,service2:key2"
+	APIKeys string
+
+	// BonusExpirySchedule расписание задачи, которая помечает истёкшие бонусы: cron-выражение или "@every 5m"
+	BonusExpirySchedule string
+	// CampaignsFile JSON-файл с бонусными кампаниями; пустой — создаются кампании по умолчанию
+	CampaignsFile string
+	// BonusDailyCap и BonusMonthlyCap лимиты бонусов за операции на пользователя в формате "USD:50.00,EUR:45.00";
+	// пустые — без лимита
+	BonusDailyCap   string
+	BonusMonthlyCap string
+	// FXRates курсы для зачисления бонусов на счёт в другой валюте: "USD/EUR:0.92,EUR/USD:1.08";
+	// пустые — бонус зачисляется только на счёт в его валюте
+	FXRates string
+	// ReferralMinDeposit минимальное пополнение приглашённого, подтверждающее приглашение: "USD:20.00,EUR:20.00";
+	// пустое — подходит любое пополнение
+	ReferralMinDeposit string
+	// LoyaltyEarnUnits за какую сумму операции по валютам начисляется балл лояльности: "USD:1.00,RUB:100.00"
+	LoyaltyEarnUnits string
+	// LoyaltyPointsValue сколько стоят 100 баллов при обмене на бонус по валютам: "USD:1.00"
+	LoyaltyPointsValue string
+
+	// RetentionYears сколько лет после удаления пользователя хранятся его операции, проводки и бонусы
+	RetentionYears int
 }
 
 func Load() *Config {
@@ -25,8 +72,76 @@ func Load() *Config {
 		env = "development"
 	}
 
+	dbDriver := os.Getenv("DB_DRIVER")
+	if dbDriver == "" {
+		dbDriver = "memory"
+	}
+
+	memoryFsync := os.Getenv("MEMORY_FSYNC")
+	if memoryFsync == "" {
+		memoryFsync = "always"
+	}
+
+	snapshotEvery, err := strconv.Atoi(os.Getenv("MEMORY_SNAPSHOT_EVERY"))
+	if err != nil {
+		snapshotEvery = 1000
+	}
+
+	idempotencyTTL, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL"))
+	if err != nil || idempotencyTTL <= 0 {
+		idempotencyTTL = 24 * time.Hour
+	}
+
+	accessTokenTTL, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL"))
+	if err != nil || accessTokenTTL <= 0 {
+		accessTokenTTL = 15 * time.Minute
+	}
+
+	refreshTokenTTL, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL"))
+	if err != nil || refreshTokenTTL <= 0 {
+		refreshTokenTTL = 30 * 24 * time.Hour
+	}
+
+	bonusExpirySchedule := os.Getenv("BONUS_EXPIRY_SCHEDULE")
+	if bonusExpirySchedule == "" {
+		bonusExpirySchedule = "@every 5m"
+	}
+
+	loyaltyEarnUnits := os.Getenv("LOYALTY_EARN_UNITS")
+	if loyaltyEarnUnits == "" {
+		loyaltyEarnUnits = "USD:1.00,EUR:1.00,RUB:100.00"
+	}
+	loyaltyPointsValue := os.Getenv("LOYALTY_POINTS_VALUE")
+	if loyaltyPointsValue == "" {
+		loyaltyPointsValue = "USD:1.00,EUR:1.00,RUB:100.00"
+	}
+
+	retentionYears, err := strconv.Atoi(os.Getenv("DATA_RETENTION_YEARS"))
+	if err != nil || retentionYears <= 0 {
+		retentionYears = 5
+	}
+
 	return &Config{
-		Port: port,
-		Env:  env,
+		Port:                port,
+		Env:                 env,
+		DBDriver:            dbDriver,
+		DatabaseURL:         os.Getenv("DATABASE_URL"),
+		MemoryDataDir:       os.Getenv("MEMORY_DATA_DIR"),
+		MemoryFsync:         memoryFsync,
+		MemorySnapshotEvery: snapshotEvery,
+		IdempotencyTTL:      idempotencyTTL,
+		JWTSecret:           os.Getenv("JWT_SECRET"),
+		AccessTokenTTL:      accessTokenTTL,
+		RefreshTokenTTL:     refreshTokenTTL,
+		APIKeys:             os.Getenv("API_KEYS"),
+		BonusExpirySchedule: bonusExpirySchedule,
+		CampaignsFile:       os.Getenv("CAMPAIGNS_FILE"),
+		BonusDailyCap:       os.Getenv("BONUS_USER_DAILY_CAP"),
+		BonusMonthlyCap:     os.Getenv("BONUS_USER_MONTHLY_CAP"),
+		FXRates:             os.Getenv("FX_RATES"),
+		ReferralMinDeposit:  os.Getenv("REFERRAL_MIN_DEPOSIT"),
+		LoyaltyEarnUnits:    loyaltyEarnUnits,
+		LoyaltyPointsValue:  loyaltyPointsValue,
+		RetentionYears:      retentionYears,
 	}
 }
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Ошибки хранилища. Бэкенды оборачивают их с названием сущности ("account not found"),
+// поэтому проверять их нужно через errors.Is, а не сравнением строк.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrConflict запись изменили после того, как её прочитали: версия в Update* не совпала с сохранённой
+	ErrConflict = errors.New("version conflict")
+	// ErrEmailTaken email принадлежит другому пользователю; частный случай ErrAlreadyExists
+	ErrEmailTaken = fmt.Errorf("email %w", ErrAlreadyExists)
+)
+
+func errNotFound(entity string) error {
+	return fmt.Errorf("%s %w", entity, ErrNotFound)
+}
+
+func errAlreadyExists(entity string) error {
+	return fmt.Errorf("%s %w", entity, ErrAlreadyExists)
+}
+
+func errEmailTaken() error {
+	return fmt.Errorf("user %w", ErrEmailTaken)
+}
@@ -1,40 +1,131 @@
 package database
 
 import (
-	"errors"
+	"sort"
 	"sync"
+	"time"
 
 	"petProjectMike/internal/models"
 )
 
 type InMemoryDB struct {
-	accounts     map[string]*models.Account
-	transactions map[string]*models.Transaction
-	bonuses      map[string]*models.Bonus
-	users        map[string]*models.User
-	mutex        sync.RWMutex
+	accounts      map[string]*models.Account
+	transactions  map[string]*models.Transaction
+	bonuses       map[string]*models.Bonus
+	users         map[string]*models.User
+	ledger        map[string]*models.LedgerEntry
+	campaigns     *memTable[models.Campaign]
+	redemptions   *memTable[models.BonusRedemption]
+	referralCodes *memTable[models.ReferralCode]
+	referrals     *memTable[models.Referral]
+	promoCodes    *memTable[models.PromoCode]
+	promoUses     *memTable[models.PromoRedemption]
+	loyalty       *memTable[models.LoyaltyAccount]
+	points        *memTable[models.PointsEntry]
+	erasures      *memTable[models.ErasureCertificate]
+	mutex         sync.RWMutex
+	// locks блокировки счетов, которые транзакции держат до коммита
+	locks *accountLocks
+
+	// Вторичные индексы (inmemory_index.go): счета и бонусы пользователя, бонусы за операцию,
+	// сроки активных бонусов, история счёта, владелец email
+	accountsByUser       groupIndex
+	bonusesByUser        groupIndex
+	bonusesByTransaction groupIndex
+	bonusExpiry          *expiryIndex
+	timeline             timelineIndex
+	emails               map[string]string
+
+	// journal включается через OpenInMemoryDB; seq — номер последней записи журнала
+	journal *journal
+	seq     uint64
 }
 
-func NewInMemoryDB() *InMemoryDB {
+func newInMemoryDB() *InMemoryDB {
 	db := &InMemoryDB{
 		accounts:     make(map[string]*models.Account),
 		transactions: make(map[string]*models.Transaction),
 		bonuses:      make(map[string]*models.Bonus),
 		users:        make(map[string]*models.User),
+		ledger:       make(map[string]*models.LedgerEntry),
+		locks:        newAccountLocks(),
+	}
+	db.reindex()
+	db.campaigns = newMemTable(db, "campaign", tableCampaigns, models.CloneCampaign,
+		func(c *models.Campaign) string { return c.ID }, func(c *models.Campaign) *int64 { return &c.Version })
+	db.redemptions = newMemTable(db, "bonus redemption", tableRedemptions, clone[models.BonusRedemption],
+		func(r *models.BonusRedemption) string { return r.ID }, nil)
+	db.referralCodes = newMemTable(db, "referral code", tableReferralCodes, clone[models.ReferralCode],
+		func(c *models.ReferralCode) string { return c.UserID }, nil)
+	db.referrals = newMemTable(db, "referral", tableReferrals, cloneReferral,
+		func(r *models.Referral) string { return r.RefereeID }, func(r *models.Referral) *int64 { return &r.Version })
+	db.promoCodes = newMemTable(db, "promo code", tablePromoCodes, models.ClonePromoCode,
+		func(c *models.PromoCode) string { return c.Code }, func(c *models.PromoCode) *int64 { return &c.Version })
+	db.promoUses = newMemTable(db, "promo redemption", tablePromoRedemptions, clone[models.PromoRedemption],
+		func(r *models.PromoRedemption) string { return r.ID }, nil)
+	db.loyalty = newMemTable(db, "loyalty account", tableLoyaltyAccounts, clone[models.LoyaltyAccount],
+		func(a *models.LoyaltyAccount) string { return a.UserID }, func(a *models.LoyaltyAccount) *int64 { return &a.Version })
+	db.points = newMemTable(db, "points entry", tablePointsEntries, clone[models.PointsEntry],
+		func(e *models.PointsEntry) string { return e.ID }, nil)
+	db.erasures = newMemTable(db, "erasure certificate", tableErasures, models.CloneErasureCertificate,
+		func(c *models.ErasureCertificate) string { return c.UserID }, nil)
+	return db
+}
+
+// clone копирует запись: база отдаёт и хранит копии, а не указатели вызывающего кода,
+// поэтому изменить её данные можно только через Update
+func clone[T any](v *T) *T {
+	c := *v
+	return &c
+}
+
+// initVersion задаёт версию новой записи
+func initVersion(version *int64) {
+	if *version == 0 {
+		*version = 1
 	}
+}
+
+// bumpVersion проверяет, что запись обновляют с той версии, что сохранена, и увеличивает её
+func bumpVersion(version *int64, stored int64) error {
+	if *version != stored {
+		return ErrConflict
+	}
+	*version++
+	return nil
+}
+
+func cloneLedgerEntry(entry *models.LedgerEntry) *models.LedgerEntry {
+	c := *entry
+	c.Postings = append([]models.Posting(nil), entry.Postings...)
+	return &c
+}
+
+func NewInMemoryDB() *InMemoryDB {
+	db := newInMemoryDB()
 	db.seedData()
 	return db
 }
 
 func (db *InMemoryDB) seedData() {
-	testUser := &models.User{ID: "user-1", Email: "test@example.com", Name: "Test User"}
+	testUser := &models.User{ID: "user-1", Email: "test@example.com", Name: "Test User", Role: "customer", Version: 1}
 	db.users[testUser.ID] = testUser
 
-	testAccount := &models.Account{ID: "account-1", UserID: testUser.ID, Balance: 1000.0, Currency: "USD"}
+	testAccount := &models.Account{ID: "account-1", UserID: testUser.ID, Balance: models.NewMoney(100000, "USD"), Currency: "USD", Version: 1}
 	db.accounts[testAccount.ID] = testAccount
 
-	testBonus := &models.Bonus{ID: "bonus-1", UserID: testUser.ID, Type: "welcome", Amount: 50.0, Status: "active"}
+	testBonus := &models.Bonus{ID: "bonus-1", UserID: testUser.ID, Type: "welcome", Amount: models.NewMoney(5000, "USD"),
+		RemainingAmount: models.NewMoney(5000, "USD"), Status: "active",
+		ExpiresAt: time.Now().AddDate(0, 0, 30), Version: 1}
 	db.bonuses[testBonus.ID] = testBonus
+
+	// Начальный остаток тестового счёта проводится через главную книгу, чтобы оборотно-сальдовая ведомость сходилась
+	opening := models.NewLedgerEntry(testAccount.ID, "opening", "opening balance",
+		models.Posting{AccountID: models.OpeningBalanceAccount, Amount: models.NewMoney(-100000, "USD")},
+		models.Posting{AccountID: testAccount.ID, Amount: models.NewMoney(100000, "USD")},
+	)
+	db.ledger[opening.ID] = opening
+	db.reindex()
 }
 
 // Account
@@ -42,9 +133,15 @@ func (db *InMemoryDB) CreateAccount(account *models.Account) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 	if _, exists := db.accounts[account.ID]; exists {
-		return errors.New("account already exists")
+		return errAlreadyExists("account")
+	}
+	initVersion(&account.Version)
+	if err := db.logPut(tableAccounts, account.ID, account); err != nil {
+		return err
 	}
-	db.accounts[account.ID] = account
+	db.accounts[account.ID] = clone(account)
+	db.indexAccount(nil, account)
+	db.compactIfDue()
 	return nil
 }
 
@@ -53,40 +150,56 @@ func (db *InMemoryDB) GetAccount(id string) (*models.Account, error) {
 	defer db.mutex.RUnlock()
 	account, exists := db.accounts[id]
 	if !exists {
-		return nil, errors.New("account not found")
+		return nil, errNotFound("account")
 	}
-	return account, nil
+	return clone(account), nil
 }
 
 func (db *InMemoryDB) GetAccountsByUserID(userID string) ([]*models.Account, error) {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 	var accounts []*models.Account
-	for _, account := range db.accounts {
-		if account.UserID == userID {
-			accounts = append(accounts, account)
-		}
+	for _, id := range db.accountsByUser.ids(userID) {
+		accounts = append(accounts, clone(db.accounts[id]))
 	}
+	sortAccountsByCreation(accounts)
 	return accounts, nil
 }
 
 func (db *InMemoryDB) UpdateAccount(account *models.Account) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
-	if _, exists := db.accounts[account.ID]; !exists {
-		return errors.New("account not found")
+	current, exists := db.accounts[account.ID]
+	if !exists {
+		return errNotFound("account")
+	}
+	next := clone(account)
+	if err := bumpVersion(&next.Version, current.Version); err != nil {
+		return err
 	}
-	db.accounts[account.ID] = account
+	if err := db.logPut(tableAccounts, next.ID, next); err != nil {
+		return err
+	}
+	db.accounts[next.ID] = next
+	db.indexAccount(current, next)
+	account.Version = next.Version
+	db.compactIfDue()
 	return nil
 }
 
 func (db *InMemoryDB) DeleteAccount(id string) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
-	if _, exists := db.accounts[id]; !exists {
-		return errors.New("account not found")
+	current, exists := db.accounts[id]
+	if !exists {
+		return errNotFound("account")
+	}
+	if err := db.logDelete(tableAccounts, id); err != nil {
+		return err
 	}
 	delete(db.accounts, id)
+	db.indexAccount(current, nil)
+	db.compactIfDue()
 	return nil
 }
 
@@ -95,9 +208,15 @@ func (db *InMemoryDB) CreateTransaction(transaction *models.Transaction) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 	if _, exists := db.transactions[transaction.ID]; exists {
-		return errors.New("transaction already exists")
+		return errAlreadyExists("transaction")
+	}
+	initVersion(&transaction.Version)
+	if err := db.logPut(tableTransactions, transaction.ID, transaction); err != nil {
+		return err
 	}
-	db.transactions[transaction.ID] = transaction
+	db.transactions[transaction.ID] = clone(transaction)
+	db.indexTransaction(nil, transaction)
+	db.compactIfDue()
 	return nil
 }
 
@@ -106,40 +225,69 @@ func (db *InMemoryDB) GetTransaction(id string) (*models.Transaction, error) {
 	defer db.mutex.RUnlock()
 	transaction, exists := db.transactions[id]
 	if !exists {
-		return nil, errors.New("transaction not found")
+		return nil, errNotFound("transaction")
 	}
-	return transaction, nil
+	return clone(transaction), nil
 }
 
 func (db *InMemoryDB) GetTransactionsByAccount(accountID string) ([]*models.Transaction, error) {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 	var transactions []*models.Transaction
-	for _, transaction := range db.transactions {
-		if transaction.FromAccount == accountID || transaction.ToAccount == accountID {
-			transactions = append(transactions, transaction)
-		}
+	for _, id := range db.timeline.ids(accountID) {
+		transactions = append(transactions, clone(db.transactions[id]))
 	}
 	return transactions, nil
 }
 
+func (db *InMemoryDB) QueryTransactions(query TransactionQuery) ([]*models.Transaction, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	// История счёта уже упорядочена: обход начинается с курсора и останавливается на Limit
+	var transactions []*models.Transaction
+	db.timeline.walk(query.AccountID, query.Descending, query.After, func(id string) bool {
+		if transaction := db.transactions[id]; query.matches(transaction) {
+			transactions = append(transactions, clone(transaction))
+		}
+		return query.Limit == 0 || len(transactions) < query.Limit
+	})
+	return transactions, nil
+}
+
 func (db *InMemoryDB) UpdateTransaction(transaction *models.Transaction) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
-	if _, exists := db.transactions[transaction.ID]; !exists {
-		return errors.New("transaction not found")
+	current, exists := db.transactions[transaction.ID]
+	if !exists {
+		return errNotFound("transaction")
+	}
+	next := clone(transaction)
+	if err := bumpVersion(&next.Version, current.Version); err != nil {
+		return err
 	}
-	db.transactions[transaction.ID] = transaction
+	if err := db.logPut(tableTransactions, next.ID, next); err != nil {
+		return err
+	}
+	db.transactions[next.ID] = next
+	db.indexTransaction(current, next)
+	transaction.Version = next.Version
+	db.compactIfDue()
 	return nil
 }
 
 func (db *InMemoryDB) DeleteTransaction(id string) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
-	if _, exists := db.transactions[id]; !exists {
-		return errors.New("transaction not found")
+	current, exists := db.transactions[id]
+	if !exists {
+		return errNotFound("transaction")
+	}
+	if err := db.logDelete(tableTransactions, id); err != nil {
+		return err
 	}
 	delete(db.transactions, id)
+	db.indexTransaction(current, nil)
+	db.compactIfDue()
 	return nil
 }
 
@@ -148,9 +296,15 @@ func (db *InMemoryDB) CreateBonus(bonus *models.Bonus) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 	if _, exists := db.bonuses[bonus.ID]; exists {
-		return errors.New("bonus already exists")
+		return errAlreadyExists("bonus")
+	}
+	initVersion(&bonus.Version)
+	if err := db.logPut(tableBonuses, bonus.ID, bonus); err != nil {
+		return err
 	}
-	db.bonuses[bonus.ID] = bonus
+	db.bonuses[bonus.ID] = clone(bonus)
+	db.indexBonus(nil, bonus)
+	db.compactIfDue()
 	return nil
 }
 
@@ -159,40 +313,109 @@ func (db *InMemoryDB) GetBonus(id string) (*models.Bonus, error) {
 	defer db.mutex.RUnlock()
 	bonus, exists := db.bonuses[id]
 	if !exists {
-		return nil, errors.New("bonus not found")
+		return nil, errNotFound("bonus")
 	}
-	return bonus, nil
+	return clone(bonus), nil
 }
 
 func (db *InMemoryDB) GetBonusesByUserID(userID string) ([]*models.Bonus, error) {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 	var bonuses []*models.Bonus
-	for _, bonus := range db.bonuses {
-		if bonus.UserID == userID {
-			bonuses = append(bonuses, bonus)
-		}
+	for _, id := range db.bonusesByUser.ids(userID) {
+		bonuses = append(bonuses, clone(db.bonuses[id]))
+	}
+	sortBonusesByCreation(bonuses)
+	return bonuses, nil
+}
+
+func (db *InMemoryDB) GetBonusesByTransaction(transactionID string) ([]*models.Bonus, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	var bonuses []*models.Bonus
+	for _, id := range db.bonusesByTransaction.ids(transactionID) {
+		bonuses = append(bonuses, clone(db.bonuses[id]))
+	}
+	sortByID(bonuses)
+	return bonuses, nil
+}
+
+func (db *InMemoryDB) GetExpiredBonuses(now time.Time) ([]*models.Bonus, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	// Индекс уже упорядочен по сроку, как и выборка
+	var bonuses []*models.Bonus
+	for _, id := range db.bonusExpiry.until(now) {
+		bonuses = append(bonuses, clone(db.bonuses[id]))
 	}
 	return bonuses, nil
 }
 
+// isExpiredBonus бонус ещё активен, но срок уже прошёл
+func isExpiredBonus(bonus *models.Bonus, now time.Time) bool {
+	return bonus.Status == "active" && !bonus.ExpiresAt.After(now)
+}
+
+// sortAccountsByCreation и sortBonusesByCreation упорядочивают записи из индекса по (created_at, id), как SQL-хранилища
+func sortAccountsByCreation(accounts []*models.Account) {
+	sort.Slice(accounts, func(i, j int) bool {
+		return timelineKey{accounts[i].CreatedAt, accounts[i].ID}.less(timelineKey{accounts[j].CreatedAt, accounts[j].ID})
+	})
+}
+
+func sortBonusesByCreation(bonuses []*models.Bonus) {
+	sort.Slice(bonuses, func(i, j int) bool {
+		return timelineKey{bonuses[i].CreatedAt, bonuses[i].ID}.less(timelineKey{bonuses[j].CreatedAt, bonuses[j].ID})
+	})
+}
+
+func sortByID(bonuses []*models.Bonus) {
+	sort.Slice(bonuses, func(i, j int) bool { return bonuses[i].ID < bonuses[j].ID })
+}
+
+func sortByExpiry(bonuses []*models.Bonus) {
+	sort.Slice(bonuses, func(i, j int) bool {
+		if !bonuses[i].ExpiresAt.Equal(bonuses[j].ExpiresAt) {
+			return bonuses[i].ExpiresAt.Before(bonuses[j].ExpiresAt)
+		}
+		return bonuses[i].ID < bonuses[j].ID
+	})
+}
+
 func (db *InMemoryDB) UpdateBonus(bonus *models.Bonus) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
-	if _, exists := db.bonuses[bonus.ID]; !exists {
-		return errors.New("bonus not found")
+	current, exists := db.bonuses[bonus.ID]
+	if !exists {
+		return errNotFound("bonus")
+	}
+	next := clone(bonus)
+	if err := bumpVersion(&next.Version, current.Version); err != nil {
+		return err
+	}
+	if err := db.logPut(tableBonuses, next.ID, next); err != nil {
+		return err
 	}
-	db.bonuses[bonus.ID] = bonus
+	db.bonuses[next.ID] = next
+	db.indexBonus(current, next)
+	bonus.Version = next.Version
+	db.compactIfDue()
 	return nil
 }
 
 func (db *InMemoryDB) DeleteBonus(id string) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
-	if _, exists := db.bonuses[id]; !exists {
-		return errors.New("bonus not found")
+	current, exists := db.bonuses[id]
+	if !exists {
+		return errNotFound("bonus")
+	}
+	if err := db.logDelete(tableBonuses, id); err != nil {
+		return err
 	}
 	delete(db.bonuses, id)
+	db.indexBonus(current, nil)
+	db.compactIfDue()
 	return nil
 }
 
@@ -201,9 +424,18 @@ func (db *InMemoryDB) CreateUser(user *models.User) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 	if _, exists := db.users[user.ID]; exists {
-		return errors.New("user already exists")
+		return errAlreadyExists("user")
+	}
+	if db.emailTaken(user.Email, user.ID) {
+		return errEmailTaken()
+	}
+	initVersion(&user.Version)
+	if err := db.logPut(tableUsers, user.ID, user); err != nil {
+		return err
 	}
-	db.users[user.ID] = user
+	db.users[user.ID] = clone(user)
+	db.indexUser(nil, user)
+	db.compactIfDue()
 	return nil
 }
 
@@ -212,38 +444,122 @@ func (db *InMemoryDB) GetUser(id string) (*models.User, error) {
 	defer db.mutex.RUnlock()
 	user, exists := db.users[id]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, errNotFound("user")
 	}
-	return user, nil
+	return clone(user), nil
 }
 
 func (db *InMemoryDB) GetUserByEmail(email string) (*models.User, error) {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
-	for _, user := range db.users {
-		if user.Email == email {
-			return user, nil
-		}
+	id, exists := db.emails[email]
+	if !exists {
+		return nil, errNotFound("user")
 	}
-	return nil, errors.New("user not found")
+	return clone(db.users[id]), nil
 }
 
 func (db *InMemoryDB) UpdateUser(user *models.User) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
-	if _, exists := db.users[user.ID]; !exists {
-		return errors.New("user not found")
+	current, exists := db.users[user.ID]
+	if !exists {
+		return errNotFound("user")
 	}
-	db.users[user.ID] = user
+	if db.emailTaken(user.Email, user.ID) {
+		return errEmailTaken()
+	}
+	next := clone(user)
+	if err := bumpVersion(&next.Version, current.Version); err != nil {
+		return err
+	}
+	if err := db.logPut(tableUsers, next.ID, next); err != nil {
+		return err
+	}
+	db.users[next.ID] = next
+	db.indexUser(current, next)
+	user.Version = next.Version
+	db.compactIfDue()
 	return nil
 }
 
 func (db *InMemoryDB) DeleteUser(id string) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
-	if _, exists := db.users[id]; !exists {
-		return errors.New("user not found")
+	current, exists := db.users[id]
+	if !exists {
+		return errNotFound("user")
+	}
+	if err := db.logDelete(tableUsers, id); err != nil {
+		return err
 	}
 	delete(db.users, id)
+	db.indexUser(current, nil)
+	db.compactIfDue()
 	return nil
 }
+
+// Ledger
+func (db *InMemoryDB) CreateLedgerEntry(entry *models.LedgerEntry) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if _, exists := db.ledger[entry.ID]; exists {
+		return errAlreadyExists("ledger entry")
+	}
+	if err := db.logPut(tableLedger, entry.ID, entry); err != nil {
+		return err
+	}
+	db.ledger[entry.ID] = cloneLedgerEntry(entry)
+	db.compactIfDue()
+	return nil
+}
+
+func (db *InMemoryDB) GetLedgerEntry(id string) (*models.LedgerEntry, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	entry, exists := db.ledger[id]
+	if !exists {
+		return nil, errNotFound("ledger entry")
+	}
+	return cloneLedgerEntry(entry), nil
+}
+
+func (db *InMemoryDB) GetPostingsByAccount(accountID string) ([]*models.Posting, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return postingsOf(mapValues(db.ledger), func(p *models.Posting) bool { return p.AccountID == accountID }), nil
+}
+
+func (db *InMemoryDB) GetAllPostings() ([]*models.Posting, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return postingsOf(mapValues(db.ledger), func(*models.Posting) bool { return true }), nil
+}
+
+func mapValues[T any](m map[string]*T) []*T {
+	values := make([]*T, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
+
+// postingsOf собирает проводки записей в хронологическом порядке, как их отдают SQL-хранилища
+func postingsOf(entries []*models.LedgerEntry, match func(*models.Posting) bool) []*models.Posting {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	var postings []*models.Posting
+	for _, entry := range entries {
+		for i := range entry.Postings {
+			posting := entry.Postings[i]
+			if match(&posting) {
+				postings = append(postings, &posting)
+			}
+		}
+	}
+	return postings
+}
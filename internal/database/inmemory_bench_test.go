@@ -0,0 +1,128 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"petProjectMike/internal/models"
+)
+
+// Бенчмарки выборок InMemoryDB на растущей базе. У каждого пользователя и счёта одинаковое число записей,
+// поэтому с индексами время выборки не должно зависеть от размера базы:
+//
+//	go test ./internal/database -run '^$' -bench InMemoryDB_ -benchmem
+
+// benchSizes сколько операций в базе; пользователей и счетов в 10 раз меньше
+var benchSizes = []int{10_000, 100_000, 1_000_000}
+
+func benchDB(b *testing.B, transactions int) *InMemoryDB {
+	b.Helper()
+	db := newInMemoryDB()
+	users := transactions / 10
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < users; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		if err := db.CreateUser(&models.User{ID: userID, Email: userID + "@example.com"}); err != nil {
+			b.Fatal(err)
+		}
+		if err := db.CreateAccount(&models.Account{ID: fmt.Sprintf("account-%d", i), UserID: userID, Currency: "USD"}); err != nil {
+			b.Fatal(err)
+		}
+		if err := db.CreateBonus(&models.Bonus{ID: fmt.Sprintf("bonus-%d", i), UserID: userID, Status: "active"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for i := 0; i < transactions; i++ {
+		transaction := &models.Transaction{
+			ID:          fmt.Sprintf("txn-%d", i),
+			FromAccount: fmt.Sprintf("account-%d", i%users),
+			ToAccount:   fmt.Sprintf("account-%d", (i+1)%users),
+			Amount:      models.NewMoney(100, "USD"),
+			Type:        "transfer",
+			Status:      "completed",
+			CreatedAt:   start.Add(time.Duration(i) * time.Second),
+		}
+		if err := db.CreateTransaction(transaction); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return db
+}
+
+func runSizes(b *testing.B, fn func(b *testing.B, db *InMemoryDB, users int)) {
+	for _, size := range benchSizes {
+		if testing.Short() && size > benchSizes[0] {
+			continue
+		}
+		b.Run(fmt.Sprintf("transactions=%d", size), func(b *testing.B) {
+			db := benchDB(b, size)
+			b.ResetTimer()
+			fn(b, db, size/10)
+		})
+	}
+}
+
+func BenchmarkInMemoryDB_GetTransactionsByAccount(b *testing.B) {
+	runSizes(b, func(b *testing.B, db *InMemoryDB, users int) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetTransactionsByAccount(fmt.Sprintf("account-%d", i%users)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkInMemoryDB_QueryTransactionsPage(b *testing.B) {
+	runSizes(b, func(b *testing.B, db *InMemoryDB, users int) {
+		for i := 0; i < b.N; i++ {
+			query := TransactionQuery{AccountID: fmt.Sprintf("account-%d", i%users), Descending: true, Limit: 5}
+			if _, err := db.QueryTransactions(query); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkInMemoryDB_GetAccountsByUserID(b *testing.B) {
+	runSizes(b, func(b *testing.B, db *InMemoryDB, users int) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetAccountsByUserID(fmt.Sprintf("user-%d", i%users)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkInMemoryDB_GetBonusesByUserID(b *testing.B) {
+	runSizes(b, func(b *testing.B, db *InMemoryDB, users int) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetBonusesByUserID(fmt.Sprintf("user-%d", i%users)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkInMemoryDB_GetUserByEmail(b *testing.B) {
+	runSizes(b, func(b *testing.B, db *InMemoryDB, users int) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetUserByEmail(fmt.Sprintf("user-%d@example.com", i%users)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkInMemoryDB_CreateTransaction(b *testing.B) {
+	runSizes(b, func(b *testing.B, db *InMemoryDB, users int) {
+		start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < b.N; i++ {
+			transaction := &models.Transaction{ID: fmt.Sprintf("new-%d", i), FromAccount: fmt.Sprintf("account-%d", i%users),
+				ToAccount: "account-0", Amount: models.NewMoney(100, "USD"), CreatedAt: start.Add(time.Duration(i) * time.Second)}
+			if err := db.CreateTransaction(transaction); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"sort"
+
+	"petProjectMike/internal/models"
+)
+
+func sortCampaigns(campaigns []*models.Campaign) []*models.Campaign {
+	sort.Slice(campaigns, func(i, j int) bool { return campaigns[i].ID < campaigns[j].ID })
+	return campaigns
+}
+
+func (db *InMemoryDB) CreateCampaign(campaign *models.Campaign) error {
+	return db.campaigns.create(campaign)
+}
+
+func (db *InMemoryDB) GetCampaign(id string) (*models.Campaign, error) {
+	return db.campaigns.get(id)
+}
+
+func (db *InMemoryDB) ListCampaigns() ([]*models.Campaign, error) {
+	return sortCampaigns(db.campaigns.list(func(*models.Campaign) bool { return true })), nil
+}
+
+func (db *InMemoryDB) UpdateCampaign(campaign *models.Campaign) error {
+	return db.campaigns.update(campaign)
+}
+
+func (db *InMemoryDB) DeleteCampaign(id string) error {
+	return db.campaigns.delete(id)
+}
+
+func (tx *inMemoryTx) CreateCampaign(campaign *models.Campaign) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.campaigns.create(campaign.ID, campaign)
+}
+
+func (tx *inMemoryTx) GetCampaign(id string) (*models.Campaign, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.campaigns.get(id)
+}
+
+func (tx *inMemoryTx) ListCampaigns() ([]*models.Campaign, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return sortCampaigns(tx.campaigns.list(func(*models.Campaign) bool { return true })), nil
+}
+
+func (tx *inMemoryTx) UpdateCampaign(campaign *models.Campaign) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.campaigns.update(campaign.ID, campaign)
+}
+
+func (tx *inMemoryTx) DeleteCampaign(id string) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.campaigns.delete(id)
+}
@@ -0,0 +1,23 @@
+package database
+
+import "petProjectMike/internal/models"
+
+func (db *InMemoryDB) CreateErasureCertificate(certificate *models.ErasureCertificate) error {
+	return db.erasures.create(certificate)
+}
+
+func (db *InMemoryDB) GetErasureCertificate(userID string) (*models.ErasureCertificate, error) {
+	return db.erasures.get(userID)
+}
+
+func (tx *inMemoryTx) CreateErasureCertificate(certificate *models.ErasureCertificate) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.erasures.create(certificate.UserID, certificate)
+}
+
+func (tx *inMemoryTx) GetErasureCertificate(userID string) (*models.ErasureCertificate, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.erasures.get(userID)
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"petProjectMike/internal/models"
+)
+
+// Вторичные индексы InMemoryDB. Обновляются под блокировкой базы на запись при каждом изменении
+// основных таблиц: прямыми методами, коммитом транзакции и восстановлением из журнала,
+// поэтому выборки по пользователю, счёту, операции, сроку бонуса и email не просматривают таблицы целиком
+
+// groupIndex ключ → ID записей с этим ключом, например пользователь → его счета
+type groupIndex map[string]map[string]struct{}
+
+func (g groupIndex) add(key, id string) {
+	ids, ok := g[key]
+	if !ok {
+		ids = make(map[string]struct{})
+		g[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (g groupIndex) remove(key, id string) {
+	ids := g[key]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(g, key)
+	}
+}
+
+// ids записи с ключом key в произвольном порядке: вызывающий сортирует их, как того требует выборка
+func (g groupIndex) ids(key string) []string {
+	ids := make([]string, 0, len(g[key]))
+	for id := range g[key] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// timelineKey позиция записи в упорядоченном индексе: время (создания операции, истечения бонуса) и ID
+type timelineKey struct {
+	at time.Time
+	id string
+}
+
+func (k timelineKey) less(other timelineKey) bool {
+	if !k.at.Equal(other.at) {
+		return k.at.Before(other.at)
+	}
+	return k.id < other.id
+}
+
+// insertKey вставляет key в отсортированный список, сохраняя порядок
+func insertKey(keys []timelineKey, key timelineKey) []timelineKey {
+	i := sort.Search(len(keys), func(i int) bool { return key.less(keys[i]) })
+	keys = append(keys, timelineKey{})
+	copy(keys[i+1:], keys[i:])
+	keys[i] = key
+	return keys
+}
+
+// removeKey убирает key из отсортированного списка, если он там есть
+func removeKey(keys []timelineKey, key timelineKey) []timelineKey {
+	i := sort.Search(len(keys), func(i int) bool { return !keys[i].less(key) })
+	if i == len(keys) || keys[i] != key {
+		return keys
+	}
+	return append(keys[:i], keys[i+1:]...)
+}
+
+// timelineIndex операции каждого счёта по возрастанию (created_at, id). Новые операции обычно
+// позже всех остальных, поэтому вставка почти всегда дописывает в конец
+type timelineIndex map[string][]timelineKey
+
+func (t timelineIndex) add(accountID string, key timelineKey) {
+	t[accountID] = insertKey(t[accountID], key)
+}
+
+func (t timelineIndex) remove(accountID string, key timelineKey) {
+	keys := removeKey(t[accountID], key)
+	if len(keys) == 0 {
+		delete(t, accountID)
+		return
+	}
+	t[accountID] = keys
+}
+
+func (t timelineIndex) ids(accountID string) []string {
+	keys := t[accountID]
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = key.id
+	}
+	return ids
+}
+
+// walk обходит операции счёта в порядке выборки, начиная строго после курсора after (nil — с начала),
+// пока fn возвращает true
+func (t timelineIndex) walk(accountID string, descending bool, after *TransactionCursor, fn func(id string) bool) {
+	keys := t[accountID]
+	if !descending {
+		start := 0
+		if after != nil {
+			cursor := timelineKey{at: after.CreatedAt, id: after.ID}
+			start = sort.Search(len(keys), func(i int) bool { return cursor.less(keys[i]) })
+		}
+		for _, key := range keys[start:] {
+			if !fn(key.id) {
+				return
+			}
+		}
+		return
+	}
+	end := len(keys)
+	if after != nil {
+		cursor := timelineKey{at: after.CreatedAt, id: after.ID}
+		end = sort.Search(len(keys), func(i int) bool { return !keys[i].less(cursor) })
+	}
+	for i := end - 1; i >= 0; i-- {
+		if !fn(keys[i].id) {
+			return
+		}
+	}
+}
+
+// expiryIndex активные бонусы по возрастанию (expires_at, id)
+type expiryIndex struct {
+	keys []timelineKey
+}
+
+func (e *expiryIndex) add(key timelineKey) {
+	e.keys = insertKey(e.keys, key)
+}
+
+func (e *expiryIndex) remove(key timelineKey) {
+	e.keys = removeKey(e.keys, key)
+}
+
+// until бонусы со сроком не позже now в порядке истечения
+func (e *expiryIndex) until(now time.Time) []string {
+	end := sort.Search(len(e.keys), func(i int) bool { return e.keys[i].at.After(now) })
+	ids := make([]string, end)
+	for i, key := range e.keys[:end] {
+		ids[i] = key.id
+	}
+	return ids
+}
+
+// indexAccount переносит счёт в индексе из состояния old в next; nil — записи нет
+func (db *InMemoryDB) indexAccount(old, next *models.Account) {
+	if old != nil {
+		db.accountsByUser.remove(old.UserID, old.ID)
+	}
+	if next != nil {
+		db.accountsByUser.add(next.UserID, next.ID)
+	}
+}
+
+func (db *InMemoryDB) indexBonus(old, next *models.Bonus) {
+	if old != nil {
+		db.bonusesByUser.remove(old.UserID, old.ID)
+		if old.TransactionID != "" {
+			db.bonusesByTransaction.remove(old.TransactionID, old.ID)
+		}
+		// В индексе сроков только активные бонусы: использованные и истёкшие уже не истекают
+		if old.Status == "active" {
+			db.bonusExpiry.remove(timelineKey{at: old.ExpiresAt, id: old.ID})
+		}
+	}
+	if next != nil {
+		db.bonusesByUser.add(next.UserID, next.ID)
+		if next.TransactionID != "" {
+			db.bonusesByTransaction.add(next.TransactionID, next.ID)
+		}
+		if next.Status == "active" {
+			db.bonusExpiry.add(timelineKey{at: next.ExpiresAt, id: next.ID})
+		}
+	}
+}
+
+func (db *InMemoryDB) indexTransaction(old, next *models.Transaction) {
+	// Смена статуса — самое частое изменение — позицию в истории не меняет
+	if old != nil && next != nil && old.FromAccount == next.FromAccount && old.ToAccount == next.ToAccount &&
+		old.CreatedAt.Equal(next.CreatedAt) {
+		return
+	}
+	if old != nil {
+		for _, accountID := range transactionAccounts(old) {
+			db.timeline.remove(accountID, timelineKey{at: old.CreatedAt, id: old.ID})
+		}
+	}
+	if next != nil {
+		for _, accountID := range transactionAccounts(next) {
+			db.timeline.add(accountID, timelineKey{at: next.CreatedAt, id: next.ID})
+		}
+	}
+}
+
+// transactionAccounts счета, в истории которых видна операция
+func transactionAccounts(transaction *models.Transaction) []string {
+	if transaction.FromAccount == transaction.ToAccount {
+		return []string{transaction.FromAccount}
+	}
+	return []string{transaction.FromAccount, transaction.ToAccount}
+}
+
+func (db *InMemoryDB) indexUser(old, next *models.User) {
+	if old != nil && db.emails[old.Email] == old.ID {
+		delete(db.emails, old.Email)
+	}
+	if next != nil {
+		db.emails[next.Email] = next.ID
+	}
+}
+
+// emailTaken занят ли email другим пользователем, кроме userID
+func (db *InMemoryDB) emailTaken(email, userID string) bool {
+	owner, ok := db.emails[email]
+	return ok && owner != userID
+}
+
+// reindex строит индексы заново по таблицам; вызывается после восстановления из снапшота и журнала
+func (db *InMemoryDB) reindex() {
+	db.accountsByUser = make(groupIndex)
+	db.bonusesByUser = make(groupIndex)
+	db.bonusesByTransaction = make(groupIndex)
+	db.bonusExpiry = &expiryIndex{}
+	db.timeline = make(timelineIndex)
+	db.emails = make(map[string]string)
+	for _, account := range db.accounts {
+		db.indexAccount(nil, account)
+	}
+	for _, bonus := range db.bonuses {
+		db.indexBonus(nil, bonus)
+	}
+	// Сразу отсортированные операции дописываются в конец истории, без сдвигов
+	transactions := mapValues(db.transactions)
+	sortTransactions(transactions, false)
+	for _, transaction := range transactions {
+		db.indexTransaction(nil, transaction)
+	}
+	for _, user := range db.users {
+		db.indexUser(nil, user)
+	}
+}
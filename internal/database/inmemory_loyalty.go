@@ -0,0 +1,77 @@
+package database
+
+import (
+	"sort"
+
+	"petProjectMike/internal/models"
+)
+
+func sortPointsEntries(entries []*models.PointsEntry) []*models.PointsEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+func (db *InMemoryDB) CreateLoyaltyAccount(account *models.LoyaltyAccount) error {
+	return db.loyalty.create(account)
+}
+
+func (db *InMemoryDB) GetLoyaltyAccount(userID string) (*models.LoyaltyAccount, error) {
+	return db.loyalty.get(userID)
+}
+
+func (db *InMemoryDB) UpdateLoyaltyAccount(account *models.LoyaltyAccount) error {
+	return db.loyalty.update(account)
+}
+
+func (db *InMemoryDB) CreatePointsEntry(entry *models.PointsEntry) error {
+	return db.points.create(entry)
+}
+
+func (db *InMemoryDB) GetPointsEntry(id string) (*models.PointsEntry, error) {
+	return db.points.get(id)
+}
+
+func (db *InMemoryDB) GetPointsEntriesByUser(userID string) ([]*models.PointsEntry, error) {
+	return sortPointsEntries(db.points.list(func(e *models.PointsEntry) bool { return e.UserID == userID })), nil
+}
+
+func (tx *inMemoryTx) CreateLoyaltyAccount(account *models.LoyaltyAccount) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.loyalty.create(account.UserID, account)
+}
+
+func (tx *inMemoryTx) GetLoyaltyAccount(userID string) (*models.LoyaltyAccount, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.loyalty.get(userID)
+}
+
+func (tx *inMemoryTx) UpdateLoyaltyAccount(account *models.LoyaltyAccount) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.loyalty.update(account.UserID, account)
+}
+
+func (tx *inMemoryTx) CreatePointsEntry(entry *models.PointsEntry) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.points.create(entry.ID, entry)
+}
+
+func (tx *inMemoryTx) GetPointsEntry(id string) (*models.PointsEntry, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.points.get(id)
+}
+
+func (tx *inMemoryTx) GetPointsEntriesByUser(userID string) ([]*models.PointsEntry, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return sortPointsEntries(tx.points.list(func(e *models.PointsEntry) bool { return e.UserID == userID })), nil
+}
@@ -0,0 +1,408 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"petProjectMike/internal/models"
+)
+
+// Имена таблиц в журнале
+const (
+	tableAccounts         = "accounts"
+	tableTransactions     = "transactions"
+	tableBonuses          = "bonuses"
+	tableUsers            = "users"
+	tableLedger           = "ledger_entries"
+	tableCampaigns        = "campaigns"
+	tableRedemptions      = "bonus_redemptions"
+	tableReferralCodes    = "referral_codes"
+	tableReferrals        = "referrals"
+	tablePromoCodes       = "promo_codes"
+	tablePromoRedemptions = "promo_redemptions"
+	tableLoyaltyAccounts  = "loyalty_accounts"
+	tablePointsEntries    = "points_entries"
+	tableErasures         = "erasure_certificates"
+)
+
+// journalOp одна операция записи; пустой Data означает удаление
+type journalOp struct {
+	Table string          `json:"table"`
+	ID    string          `json:"id"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// journalRecord атомарная группа операций: одиночный Create/Update/Delete или коммит транзакции
+type journalRecord struct {
+	Seq uint64      `json:"seq"`
+	Ops []journalOp `json:"ops"`
+}
+
+// snapshotData полное состояние базы на момент записи Seq
+type snapshotData struct {
+	Seq              uint64                                `json:"seq"`
+	Accounts         map[string]*models.Account            `json:"accounts"`
+	Transactions     map[string]*models.Transaction        `json:"transactions"`
+	Bonuses          map[string]*models.Bonus              `json:"bonuses"`
+	Users            map[string]*persistedUser             `json:"users"`
+	Ledger           map[string]*models.LedgerEntry        `json:"ledger_entries"`
+	Campaigns        map[string]*models.Campaign           `json:"campaigns,omitempty"`
+	Redemptions      map[string]*models.BonusRedemption    `json:"bonus_redemptions,omitempty"`
+	ReferralCodes    map[string]*models.ReferralCode       `json:"referral_codes,omitempty"`
+	Referrals        map[string]*models.Referral           `json:"referrals,omitempty"`
+	PromoCodes       map[string]*models.PromoCode          `json:"promo_codes,omitempty"`
+	PromoRedemptions map[string]*models.PromoRedemption    `json:"promo_redemptions,omitempty"`
+	LoyaltyAccounts  map[string]*models.LoyaltyAccount     `json:"loyalty_accounts,omitempty"`
+	PointsEntries    map[string]*models.PointsEntry        `json:"points_entries,omitempty"`
+	Erasures         map[string]*models.ErasureCertificate `json:"erasure_certificates,omitempty"`
+}
+
+// persistedUser пользователь в журнале и снапшоте: хеш пароля и поколение токенов скрыты из JSON модели,
+// но на диске они нужны
+type persistedUser struct {
+	models.User
+	PasswordHash    string `json:"password_hash,omitempty"`
+	TokenGeneration int64  `json:"token_generation,omitempty"`
+}
+
+func persistUser(user *models.User) *persistedUser {
+	return &persistedUser{User: *user, PasswordHash: user.PasswordHash, TokenGeneration: user.TokenGeneration}
+}
+
+func (p *persistedUser) user() *models.User {
+	user := p.User
+	user.PasswordHash = p.PasswordHash
+	user.TokenGeneration = p.TokenGeneration
+	return &user
+}
+
+func putOp(table, id string, value any) (journalOp, error) {
+	if user, ok := value.(*models.User); ok {
+		value = persistUser(user)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return journalOp{}, err
+	}
+	return journalOp{Table: table, ID: id, Data: data}, nil
+}
+
+func deleteOp(table, id string) journalOp {
+	return journalOp{Table: table, ID: id}
+}
+
+// OpenInMemoryDB создаёт InMemoryDB с журналом в opts.Dir: загружает последний снапшот,
+// доигрывает журнал поверх него и дальше пишет в журнал каждую операцию до её применения.
+// Оборванная последняя запись (сбой посреди записи) отрезается, повреждение в середине — ошибка.
+func OpenInMemoryDB(opts PersistenceOptions) (*InMemoryDB, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("persistence directory is required")
+	}
+	switch opts.Fsync {
+	case "":
+		opts.Fsync = FsyncAlways
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, fmt.Errorf("unknown fsync policy %q", opts.Fsync)
+	}
+	if opts.Fsync == FsyncInterval && opts.FsyncInterval <= 0 {
+		opts.FsyncInterval = time.Second
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	db := newInMemoryDB()
+	fresh := true
+
+	snapshot, err := readSnapshot(filepath.Join(opts.Dir, snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		db.restore(snapshot)
+		fresh = false
+	}
+
+	data, err := os.ReadFile(filepath.Join(opts.Dir, journalFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	payloads, validSize, err := decodeFrames(data)
+	if err != nil {
+		return nil, err
+	}
+	if validSize < len(data) {
+		log.Printf("journal: dropping %d bytes of incomplete record at the tail", len(data)-validSize)
+	}
+	for _, payload := range payloads {
+		var record journalRecord
+		if err := json.Unmarshal(payload, &record); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrJournalCorrupted, err)
+		}
+		// записи до снапшота уже в нём (сбой между записью снапшота и очисткой журнала)
+		if record.Seq <= db.seq {
+			continue
+		}
+		for _, op := range record.Ops {
+			if err := db.applyOp(op); err != nil {
+				return nil, err
+			}
+		}
+		db.seq = record.Seq
+		fresh = false
+	}
+	db.reindex()
+
+	db.journal, err = openJournal(opts, int64(validSize))
+	if err != nil {
+		return nil, err
+	}
+	db.journal.records = len(payloads)
+
+	if fresh {
+		db.seedData()
+		if err := db.Snapshot(); err != nil {
+			db.journal.close()
+			return nil, err
+		}
+	}
+
+	if opts.Fsync == FsyncInterval {
+		db.journal.every(opts.FsyncInterval, func() {
+			if err := db.journal.sync(); err != nil {
+				log.Printf("journal: fsync failed: %v", err)
+			}
+		})
+	}
+	if opts.SnapshotInterval > 0 {
+		db.journal.every(opts.SnapshotInterval, func() {
+			if err := db.Snapshot(); err != nil {
+				log.Printf("journal: snapshot failed: %v", err)
+			}
+		})
+	}
+	return db, nil
+}
+
+func readSnapshot(path string) (*snapshotData, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// снапшот пишется атомарно, поэтому любой дефект в нём — повреждение, а не оборванная запись
+	payloads, validSize, err := decodeFrames(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(payloads) != 1 || validSize != len(data) {
+		return nil, fmt.Errorf("%w: snapshot is damaged", ErrJournalCorrupted)
+	}
+	var snapshot snapshotData
+	if err := json.Unmarshal(payloads[0], &snapshot); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJournalCorrupted, err)
+	}
+	return &snapshot, nil
+}
+
+func (db *InMemoryDB) restore(snapshot *snapshotData) {
+	db.seq = snapshot.Seq
+	for id, v := range snapshot.Accounts {
+		db.accounts[id] = v
+	}
+	for id, v := range snapshot.Transactions {
+		db.transactions[id] = v
+	}
+	for id, v := range snapshot.Bonuses {
+		db.bonuses[id] = v
+	}
+	for id, v := range snapshot.Users {
+		db.users[id] = v.user()
+	}
+	for id, v := range snapshot.Ledger {
+		db.ledger[id] = v
+	}
+	for id, v := range snapshot.Campaigns {
+		db.campaigns.rows[id] = v
+	}
+	for id, v := range snapshot.Redemptions {
+		db.redemptions.rows[id] = v
+	}
+	for id, v := range snapshot.ReferralCodes {
+		db.referralCodes.rows[id] = v
+	}
+	for id, v := range snapshot.Referrals {
+		db.referrals.rows[id] = v
+	}
+	for id, v := range snapshot.PromoCodes {
+		db.promoCodes.rows[id] = v
+	}
+	for id, v := range snapshot.PromoRedemptions {
+		db.promoUses.rows[id] = v
+	}
+	for id, v := range snapshot.LoyaltyAccounts {
+		db.loyalty.rows[id] = v
+	}
+	for id, v := range snapshot.PointsEntries {
+		db.points.rows[id] = v
+	}
+	for id, v := range snapshot.Erasures {
+		db.erasures.rows[id] = v
+	}
+}
+
+func (db *InMemoryDB) applyOp(op journalOp) error {
+	switch op.Table {
+	case tableAccounts:
+		return applyTableOp(db.accounts, op)
+	case tableTransactions:
+		return applyTableOp(db.transactions, op)
+	case tableBonuses:
+		return applyTableOp(db.bonuses, op)
+	case tableUsers:
+		users := make(map[string]*persistedUser, 1)
+		if err := applyTableOp(users, op); err != nil {
+			return err
+		}
+		if user, ok := users[op.ID]; ok {
+			db.users[op.ID] = user.user()
+		} else {
+			delete(db.users, op.ID)
+		}
+		return nil
+	case tableLedger:
+		return applyTableOp(db.ledger, op)
+	case tableCampaigns:
+		return applyTableOp(db.campaigns.rows, op)
+	case tableRedemptions:
+		return applyTableOp(db.redemptions.rows, op)
+	case tableReferralCodes:
+		return applyTableOp(db.referralCodes.rows, op)
+	case tableReferrals:
+		return applyTableOp(db.referrals.rows, op)
+	case tablePromoCodes:
+		return applyTableOp(db.promoCodes.rows, op)
+	case tablePromoRedemptions:
+		return applyTableOp(db.promoUses.rows, op)
+	case tableLoyaltyAccounts:
+		return applyTableOp(db.loyalty.rows, op)
+	case tablePointsEntries:
+		return applyTableOp(db.points.rows, op)
+	case tableErasures:
+		return applyTableOp(db.erasures.rows, op)
+	}
+	return fmt.Errorf("%w: unknown table %q", ErrJournalCorrupted, op.Table)
+}
+
+func applyTableOp[T any](table map[string]*T, op journalOp) error {
+	if len(op.Data) == 0 {
+		delete(table, op.ID)
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(op.Data, &v); err != nil {
+		return fmt.Errorf("%w: %v", ErrJournalCorrupted, err)
+	}
+	table[op.ID] = &v
+	return nil
+}
+
+// logOps записывает операции в журнал до их применения; вызывается под блокировкой на запись.
+// Без журнала ничего не делает.
+func (db *InMemoryDB) logOps(ops ...journalOp) error {
+	if db.journal == nil || len(ops) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(journalRecord{Seq: db.seq + 1, Ops: ops})
+	if err != nil {
+		return err
+	}
+	if err := db.journal.append(payload); err != nil {
+		return err
+	}
+	db.seq++
+	return nil
+}
+
+func (db *InMemoryDB) logPut(table, id string, value any) error {
+	if db.journal == nil {
+		return nil
+	}
+	op, err := putOp(table, id, value)
+	if err != nil {
+		return err
+	}
+	return db.logOps(op)
+}
+
+func (db *InMemoryDB) logDelete(table, id string) error {
+	return db.logOps(deleteOp(table, id))
+}
+
+// compactIfDue делает снапшот, если журнал разросся; вызывается под блокировкой на запись
+// после применения операции, поэтому ошибка не отменяет саму операцию
+func (db *InMemoryDB) compactIfDue() {
+	if db.journal == nil || !db.journal.snapshotDue() {
+		return
+	}
+	if err := db.snapshotLocked(); err != nil {
+		log.Printf("journal: snapshot failed: %v", err)
+	}
+}
+
+// Snapshot записывает компактный снимок состояния и очищает журнал
+func (db *InMemoryDB) Snapshot() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.snapshotLocked()
+}
+
+func (db *InMemoryDB) snapshotLocked() error {
+	if db.journal == nil {
+		return nil
+	}
+	users := make(map[string]*persistedUser, len(db.users))
+	for id, user := range db.users {
+		users[id] = persistUser(user)
+	}
+	payload, err := json.Marshal(snapshotData{
+		Seq:              db.seq,
+		Accounts:         db.accounts,
+		Transactions:     db.transactions,
+		Bonuses:          db.bonuses,
+		Users:            users,
+		Ledger:           db.ledger,
+		Campaigns:        db.campaigns.rows,
+		Redemptions:      db.redemptions.rows,
+		ReferralCodes:    db.referralCodes.rows,
+		Referrals:        db.referrals.rows,
+		PromoCodes:       db.promoCodes.rows,
+		PromoRedemptions: db.promoUses.rows,
+		LoyaltyAccounts:  db.loyalty.rows,
+		PointsEntries:    db.points.rows,
+		Erasures:         db.erasures.rows,
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(db.journal.opts.Dir, snapshotFileName), encodeFrame(payload)); err != nil {
+		return err
+	}
+	return db.journal.reset()
+}
+
+// Close сбрасывает журнал на диск и закрывает его; для базы без журнала ничего не делает
+func (db *InMemoryDB) Close() error {
+	if db.journal == nil {
+		return nil
+	}
+	return db.journal.close()
+}
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestJournalDB(t *testing.T, opts PersistenceOptions) *InMemoryDB {
+	db, err := OpenInMemoryDB(opts)
+	if err != nil {
+		t.Fatalf("open journaled db: %v", err)
+	}
+	return db
+}
+
+func TestInMemoryDB_Journal_Conformance(t *testing.T) {
+	testStoreConformance(t, func(t *testing.T) Database {
+		db := openTestJournalDB(t, PersistenceOptions{Dir: t.TempDir()})
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestInMemoryDB_Journal_ReplaysAfterReopen(t *testing.T) {
+	opts := PersistenceOptions{Dir: t.TempDir()}
+	db := openTestJournalDB(t, opts)
+
+	// Свежая база засеяна тестовыми данными
+	_, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+
+	account := &models.Account{ID: "acc-2", UserID: "user-1", Balance: models.NewMoney(2500, "USD"), Currency: "USD"}
+	assert.NoError(t, db.CreateAccount(account))
+	account.Balance = models.NewMoney(3000, "USD")
+	assert.NoError(t, db.UpdateAccount(account))
+	assert.NoError(t, db.DeleteBonus("bonus-1"))
+	// Кампания попадает в снапшот, а её правка — в журнал после него
+	campaign := &models.Campaign{ID: "campaign-1", Name: "Spring", Triggers: []string{models.TriggerDeposit}}
+	assert.NoError(t, db.CreateCampaign(campaign))
+	redemption := &models.BonusRedemption{ID: "redemption-1", BonusID: "bonus-1", UserID: "user-1", AccountID: "account-1",
+		TransactionID: "tx-1", Amount: models.NewMoney(100, "USD"), Credited: models.NewMoney(100, "USD"), CreatedAt: time.Now().UTC()}
+	assert.NoError(t, db.CreateBonusRedemption(redemption))
+	code := &models.ReferralCode{UserID: "user-1", Code: "ABCD2345", DeviceID: "device-1", CreatedAt: time.Now().UTC()}
+	assert.NoError(t, db.CreateReferralCode(code))
+	promo := &models.PromoCode{Code: "SPRING-1", BatchID: "batch-1", Reward: models.NewMoney(500, "USD"), BonusType: "promo",
+		ExpiresInDays: 30, MaxRedemptions: 10, PerUserLimit: 1, CreatedAt: time.Now().UTC()}
+	assert.NoError(t, db.CreatePromoCode(promo))
+	assert.NoError(t, db.Snapshot())
+	promo.Redemptions = 1
+	assert.NoError(t, db.UpdatePromoCode(promo))
+	campaign.Name = "Spring sale"
+	assert.NoError(t, db.UpdateCampaign(campaign))
+	referral := &models.Referral{RefereeID: "user-2", ReferrerID: "user-1", Code: "ABCD2345", Status: models.ReferralPending, CreatedAt: time.Now().UTC()}
+	assert.NoError(t, db.CreateReferral(referral))
+	assert.NoError(t, db.Close())
+
+	reopened := openTestJournalDB(t, opts)
+	defer reopened.Close()
+
+	got, err := reopened.GetAccount("acc-2")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(3000, "USD"), got.Balance)
+
+	_, err = reopened.GetBonus("bonus-1")
+	assert.Error(t, err)
+
+	gotCampaign, err := reopened.GetCampaign("campaign-1")
+	assert.NoError(t, err)
+	assert.Equal(t, campaign, gotCampaign)
+	redemptions, err := reopened.GetBonusRedemptions("bonus-1")
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.BonusRedemption{redemption}, redemptions)
+	gotCode, err := reopened.GetReferralCodeByCode("ABCD2345")
+	assert.NoError(t, err)
+	assert.Equal(t, code, gotCode)
+	gotReferral, err := reopened.GetReferral("user-2")
+	assert.NoError(t, err)
+	assert.Equal(t, referral, gotReferral)
+	gotPromo, err := reopened.GetPromoCode("SPRING-1")
+	assert.NoError(t, err)
+	assert.Equal(t, promo, gotPromo)
+
+	// Seed не применяется повторно поверх восстановленных данных
+	user, err := reopened.GetUser("user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "test@example.com", user.Email)
+
+	// Индексы построены по восстановленным данным
+	accounts, err := reopened.GetAccountsByUserID("user-1")
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 2)
+	bonuses, err := reopened.GetBonusesByUserID("user-1")
+	assert.NoError(t, err)
+	assert.Empty(t, bonuses)
+	byEmail, err := reopened.GetUserByEmail("test@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", byEmail.ID)
+}
+
+func TestInMemoryDB_Journal_TxCommitIsOneRecord(t *testing.T) {
+	opts := PersistenceOptions{Dir: t.TempDir()}
+	db := openTestJournalDB(t, opts)
+
+	err := db.RunInTx(func(tx Tx) error {
+		account, err := tx.GetAccount("account-1")
+		if err != nil {
+			return err
+		}
+		account.Balance = models.NewMoney(90000, "USD")
+		if err := tx.UpdateAccount(account); err != nil {
+			return err
+		}
+		return tx.CreateTransaction(&models.Transaction{ID: "tx-1", ToAccount: "account-1", Amount: models.NewMoney(100, "USD")})
+	})
+	assert.NoError(t, err)
+
+	// Откатившаяся транзакция в журнал не попадает
+	err = db.RunInTx(func(tx Tx) error {
+		if err := tx.DeleteAccount("account-1"); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	assert.Error(t, err)
+	assert.NoError(t, db.Close())
+
+	data, err := os.ReadFile(filepath.Join(opts.Dir, journalFileName))
+	assert.NoError(t, err)
+	payloads, _, err := decodeFrames(data)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+
+	reopened := openTestJournalDB(t, opts)
+	defer reopened.Close()
+	account, err := reopened.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(90000, "USD"), account.Balance)
+	_, err = reopened.GetTransaction("tx-1")
+	assert.NoError(t, err)
+}
+
+func TestInMemoryDB_Journal_TruncatesTornTail(t *testing.T) {
+	opts := PersistenceOptions{Dir: t.TempDir()}
+	db := openTestJournalDB(t, opts)
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-2", Email: "a@example.com"}))
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-3", Email: "b@example.com"}))
+	assert.NoError(t, db.Close())
+
+	// Имитируем сбой посреди записи последнего кадра
+	path := filepath.Join(opts.Dir, journalFileName)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data[:len(data)-5], 0o644))
+
+	reopened := openTestJournalDB(t, opts)
+	_, err = reopened.GetUser("user-2")
+	assert.NoError(t, err)
+	_, err = reopened.GetUser("user-3")
+	assert.Error(t, err)
+
+	// После отрезания хвоста журнал снова пригоден для дозаписи
+	assert.NoError(t, reopened.CreateUser(&models.User{ID: "user-4", Email: "c@example.com"}))
+	assert.NoError(t, reopened.Close())
+
+	again := openTestJournalDB(t, opts)
+	defer again.Close()
+	_, err = again.GetUser("user-4")
+	assert.NoError(t, err)
+}
+
+// shortWriteFile файл журнала, который при failing записывает только половину данных
+type shortWriteFile struct {
+	*os.File
+	failing bool
+}
+
+func (f *shortWriteFile) Write(data []byte) (int, error) {
+	if !f.failing {
+		return f.File.Write(data)
+	}
+	n, err := f.File.Write(data[:len(data)/2])
+	if err != nil {
+		return n, err
+	}
+	return n, io.ErrShortWrite
+}
+
+func TestInMemoryDB_Journal_RollsBackShortWrite(t *testing.T) {
+	opts := PersistenceOptions{Dir: t.TempDir()}
+	db := openTestJournalDB(t, opts)
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-2", Email: "a@example.com"}))
+	file := &shortWriteFile{File: db.journal.file.(*os.File), failing: true}
+	db.journal.file = file
+
+	assert.ErrorIs(t, db.CreateUser(&models.User{ID: "user-3", Email: "b@example.com"}), io.ErrShortWrite)
+	_, err := db.GetUser("user-3")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Обрывок отрезан, поэтому следующая запись не ложится за ним и журнал остаётся читаемым
+	file.failing = false
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-4", Email: "c@example.com"}))
+	assert.NoError(t, db.Close())
+
+	reopened := openTestJournalDB(t, opts)
+	defer reopened.Close()
+	_, err = reopened.GetUser("user-2")
+	assert.NoError(t, err)
+	_, err = reopened.GetUser("user-3")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = reopened.GetUser("user-4")
+	assert.NoError(t, err)
+}
+
+func TestInMemoryDB_Journal_DetectsCorruption(t *testing.T) {
+	opts := PersistenceOptions{Dir: t.TempDir()}
+	db := openTestJournalDB(t, opts)
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-2", Email: "a@example.com"}))
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-3", Email: "b@example.com"}))
+	assert.NoError(t, db.Close())
+
+	// Портим байт внутри первой записи: за ней есть целая запись, значит это не оборванный хвост
+	path := filepath.Join(opts.Dir, journalFileName)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data[frameHeaderSize+2] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = OpenInMemoryDB(opts)
+	assert.ErrorIs(t, err, ErrJournalCorrupted)
+}
+
+func TestInMemoryDB_Journal_SnapshotCompactsJournal(t *testing.T) {
+	opts := PersistenceOptions{Dir: t.TempDir(), Fsync: FsyncNever, SnapshotEvery: 3}
+	db := openTestJournalDB(t, opts)
+	for _, id := range []string{"u-1", "u-2", "u-3", "u-4"} {
+		assert.NoError(t, db.CreateUser(&models.User{ID: id, Email: id + "@example.com", PasswordHash: "hash-" + id}))
+	}
+	assert.NoError(t, db.Close())
+
+	// Три записи ушли в снапшот, в журнале осталась одна
+	data, err := os.ReadFile(filepath.Join(opts.Dir, journalFileName))
+	assert.NoError(t, err)
+	payloads, _, err := decodeFrames(data)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 1)
+
+	reopened := openTestJournalDB(t, opts)
+	defer reopened.Close()
+	for _, id := range []string{"user-1", "u-1", "u-2", "u-3", "u-4"} {
+		_, err := reopened.GetUser(id)
+		assert.NoError(t, err, id)
+	}
+	// Хеш пароля скрыт из JSON модели, но переживает и снапшот (u-1), и журнал (u-4)
+	for _, id := range []string{"u-1", "u-4"} {
+		user, err := reopened.GetUser(id)
+		assert.NoError(t, err)
+		assert.Equal(t, "hash-"+id, user.PasswordHash)
+	}
+}
+
+func TestInMemoryDB_Journal_SkipsRecordsCoveredBySnapshot(t *testing.T) {
+	opts := PersistenceOptions{Dir: t.TempDir()}
+	db := openTestJournalDB(t, opts)
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-2", Email: "a@example.com"}))
+	assert.NoError(t, db.Close())
+
+	// Сбой между записью снапшота и очисткой журнала: старая запись остаётся в журнале
+	journalPath := filepath.Join(opts.Dir, journalFileName)
+	stale, err := os.ReadFile(journalPath)
+	assert.NoError(t, err)
+
+	db = openTestJournalDB(t, opts)
+	assert.NoError(t, db.DeleteUser("user-2"))
+	assert.NoError(t, db.Snapshot())
+	assert.NoError(t, db.Close())
+	assert.NoError(t, os.WriteFile(journalPath, stale, 0o644))
+
+	reopened := openTestJournalDB(t, opts)
+	defer reopened.Close()
+	_, err = reopened.GetUser("user-2")
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"sort"
+
+	"petProjectMike/internal/models"
+)
+
+func sortPromoCodes(codes []*models.PromoCode) []*models.PromoCode {
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+func sortPromoRedemptions(redemptions []*models.PromoRedemption) []*models.PromoRedemption {
+	sort.Slice(redemptions, func(i, j int) bool {
+		if !redemptions[i].CreatedAt.Equal(redemptions[j].CreatedAt) {
+			return redemptions[i].CreatedAt.Before(redemptions[j].CreatedAt)
+		}
+		return redemptions[i].ID < redemptions[j].ID
+	})
+	return redemptions
+}
+
+func (db *InMemoryDB) CreatePromoCode(code *models.PromoCode) error {
+	return db.promoCodes.create(code)
+}
+
+func (db *InMemoryDB) GetPromoCode(code string) (*models.PromoCode, error) {
+	return db.promoCodes.get(code)
+}
+
+func (db *InMemoryDB) GetPromoCodesByBatch(batchID string) ([]*models.PromoCode, error) {
+	return sortPromoCodes(db.promoCodes.list(func(c *models.PromoCode) bool { return c.BatchID == batchID })), nil
+}
+
+func (db *InMemoryDB) UpdatePromoCode(code *models.PromoCode) error {
+	return db.promoCodes.update(code)
+}
+
+func (db *InMemoryDB) CreatePromoRedemption(redemption *models.PromoRedemption) error {
+	return db.promoUses.create(redemption)
+}
+
+func (db *InMemoryDB) GetPromoRedemptions(code string) ([]*models.PromoRedemption, error) {
+	return sortPromoRedemptions(db.promoUses.list(func(r *models.PromoRedemption) bool { return r.Code == code })), nil
+}
+
+func (tx *inMemoryTx) CreatePromoCode(code *models.PromoCode) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.promoCodes.create(code.Code, code)
+}
+
+func (tx *inMemoryTx) GetPromoCode(code string) (*models.PromoCode, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.promoCodes.get(code)
+}
+
+func (tx *inMemoryTx) GetPromoCodesByBatch(batchID string) ([]*models.PromoCode, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return sortPromoCodes(tx.promoCodes.list(func(c *models.PromoCode) bool { return c.BatchID == batchID })), nil
+}
+
+func (tx *inMemoryTx) UpdatePromoCode(code *models.PromoCode) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.promoCodes.update(code.Code, code)
+}
+
+func (tx *inMemoryTx) CreatePromoRedemption(redemption *models.PromoRedemption) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.promoUses.create(redemption.ID, redemption)
+}
+
+func (tx *inMemoryTx) GetPromoRedemptions(code string) ([]*models.PromoRedemption, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return sortPromoRedemptions(tx.promoUses.list(func(r *models.PromoRedemption) bool { return r.Code == code })), nil
+}
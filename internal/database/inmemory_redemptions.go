@@ -0,0 +1,37 @@
+package database
+
+import (
+	"sort"
+
+	"petProjectMike/internal/models"
+)
+
+func sortRedemptions(redemptions []*models.BonusRedemption) []*models.BonusRedemption {
+	sort.Slice(redemptions, func(i, j int) bool {
+		if !redemptions[i].CreatedAt.Equal(redemptions[j].CreatedAt) {
+			return redemptions[i].CreatedAt.Before(redemptions[j].CreatedAt)
+		}
+		return redemptions[i].ID < redemptions[j].ID
+	})
+	return redemptions
+}
+
+func (db *InMemoryDB) CreateBonusRedemption(redemption *models.BonusRedemption) error {
+	return db.redemptions.create(redemption)
+}
+
+func (db *InMemoryDB) GetBonusRedemptions(bonusID string) ([]*models.BonusRedemption, error) {
+	return sortRedemptions(db.redemptions.list(func(r *models.BonusRedemption) bool { return r.BonusID == bonusID })), nil
+}
+
+func (tx *inMemoryTx) CreateBonusRedemption(redemption *models.BonusRedemption) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.redemptions.create(redemption.ID, redemption)
+}
+
+func (tx *inMemoryTx) GetBonusRedemptions(bonusID string) ([]*models.BonusRedemption, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return sortRedemptions(tx.redemptions.list(func(r *models.BonusRedemption) bool { return r.BonusID == bonusID })), nil
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"sort"
+
+	"petProjectMike/internal/models"
+)
+
+func cloneReferral(r *models.Referral) *models.Referral {
+	copied := *r
+	if r.QualifiedAt != nil {
+		at := *r.QualifiedAt
+		copied.QualifiedAt = &at
+	}
+	return &copied
+}
+
+func sortReferrals(referrals []*models.Referral) []*models.Referral {
+	sort.Slice(referrals, func(i, j int) bool {
+		if !referrals[i].CreatedAt.Equal(referrals[j].CreatedAt) {
+			return referrals[i].CreatedAt.Before(referrals[j].CreatedAt)
+		}
+		return referrals[i].RefereeID < referrals[j].RefereeID
+	})
+	return referrals
+}
+
+// findCode код из списка; коды уникальны, поэтому подходит не больше одного
+func findCode(codes []*models.ReferralCode) (*models.ReferralCode, error) {
+	if len(codes) == 0 {
+		return nil, errNotFound("referral code")
+	}
+	return codes[0], nil
+}
+
+func (db *InMemoryDB) CreateReferralCode(code *models.ReferralCode) error {
+	return db.referralCodes.create(code)
+}
+
+func (db *InMemoryDB) GetReferralCode(userID string) (*models.ReferralCode, error) {
+	return db.referralCodes.get(userID)
+}
+
+func (db *InMemoryDB) GetReferralCodeByCode(code string) (*models.ReferralCode, error) {
+	return findCode(db.referralCodes.list(func(c *models.ReferralCode) bool { return c.Code == code }))
+}
+
+func (db *InMemoryDB) UpdateReferralCode(code *models.ReferralCode) error {
+	return db.referralCodes.update(code)
+}
+
+func (db *InMemoryDB) CreateReferral(referral *models.Referral) error {
+	return db.referrals.create(referral)
+}
+
+func (db *InMemoryDB) GetReferral(refereeID string) (*models.Referral, error) {
+	return db.referrals.get(refereeID)
+}
+
+func (db *InMemoryDB) GetReferralsByReferrer(referrerID string) ([]*models.Referral, error) {
+	return sortReferrals(db.referrals.list(func(r *models.Referral) bool { return r.ReferrerID == referrerID })), nil
+}
+
+func (db *InMemoryDB) UpdateReferral(referral *models.Referral) error {
+	return db.referrals.update(referral)
+}
+
+func (tx *inMemoryTx) CreateReferralCode(code *models.ReferralCode) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.referralCodes.create(code.UserID, code)
+}
+
+func (tx *inMemoryTx) GetReferralCode(userID string) (*models.ReferralCode, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.referralCodes.get(userID)
+}
+
+func (tx *inMemoryTx) UpdateReferralCode(code *models.ReferralCode) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.referralCodes.update(code.UserID, code)
+}
+
+func (tx *inMemoryTx) GetReferralCodeByCode(code string) (*models.ReferralCode, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return findCode(tx.referralCodes.list(func(c *models.ReferralCode) bool { return c.Code == code }))
+}
+
+func (tx *inMemoryTx) CreateReferral(referral *models.Referral) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.referrals.create(referral.RefereeID, referral)
+}
+
+func (tx *inMemoryTx) GetReferral(refereeID string) (*models.Referral, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.referrals.get(refereeID)
+}
+
+func (tx *inMemoryTx) GetReferralsByReferrer(referrerID string) ([]*models.Referral, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return sortReferrals(tx.referrals.list(func(r *models.Referral) bool { return r.ReferrerID == referrerID })), nil
+}
+
+func (tx *inMemoryTx) UpdateReferral(referral *models.Referral) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.referrals.update(referral.RefereeID, referral)
+}
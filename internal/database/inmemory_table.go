@@ -0,0 +1,103 @@
+package database
+
+// memTable таблица InMemoryDB без особой логики: CRUD с копированием, версиями и журналом.
+// Основные таблицы написаны вручную; новые описываются через memTable, чтобы не повторять одно и то же
+type memTable[T any] struct {
+	db *InMemoryDB
+	// name имя сущности в ошибках, table — имя таблицы в журнале
+	name  string
+	table string
+	rows  map[string]*T
+	copy  func(*T) *T
+	// id и version достают ключ и версию записи; version nil — у записей таблицы нет версий
+	id      func(*T) string
+	version func(*T) *int64
+}
+
+func newMemTable[T any](db *InMemoryDB, name, table string, copy func(*T) *T, id func(*T) string, version func(*T) *int64) *memTable[T] {
+	return &memTable[T]{db: db, name: name, table: table, rows: make(map[string]*T), copy: copy, id: id, version: version}
+}
+
+// tx буфер изменений таблицы для транзакции
+func (t *memTable[T]) tx() *txTable[T] {
+	return newTxTable(t.name, t.table, t.rows, t.copy, t.version)
+}
+
+func (t *memTable[T]) get(id string) (*T, error) {
+	t.db.mutex.RLock()
+	defer t.db.mutex.RUnlock()
+	v, exists := t.rows[id]
+	if !exists {
+		return nil, errNotFound(t.name)
+	}
+	return t.copy(v), nil
+}
+
+func (t *memTable[T]) list(match func(*T) bool) []*T {
+	t.db.mutex.RLock()
+	defer t.db.mutex.RUnlock()
+	var result []*T
+	for _, v := range t.rows {
+		if match(v) {
+			result = append(result, t.copy(v))
+		}
+	}
+	return result
+}
+
+func (t *memTable[T]) create(v *T) error {
+	t.db.mutex.Lock()
+	defer t.db.mutex.Unlock()
+	id := t.id(v)
+	if _, exists := t.rows[id]; exists {
+		return errAlreadyExists(t.name)
+	}
+	if t.version != nil {
+		initVersion(t.version(v))
+	}
+	if err := t.db.logPut(t.table, id, v); err != nil {
+		return err
+	}
+	t.rows[id] = t.copy(v)
+	t.db.compactIfDue()
+	return nil
+}
+
+func (t *memTable[T]) update(v *T) error {
+	t.db.mutex.Lock()
+	defer t.db.mutex.Unlock()
+	id := t.id(v)
+	current, exists := t.rows[id]
+	if !exists {
+		return errNotFound(t.name)
+	}
+	next := t.copy(v)
+	if t.version != nil {
+		if err := bumpVersion(t.version(next), *t.version(current)); err != nil {
+			return err
+		}
+	}
+	if err := t.db.logPut(t.table, id, next); err != nil {
+		return err
+	}
+	t.rows[id] = next
+	if t.version != nil {
+		*t.version(v) = *t.version(next)
+	}
+	t.db.compactIfDue()
+	return nil
+}
+
+func (t *memTable[T]) delete(id string) error {
+	t.db.mutex.Lock()
+	defer t.db.mutex.Unlock()
+	if _, exists := t.rows[id]; !exists {
+		return errNotFound(t.name)
+	}
+	if err := t.db.logDelete(t.table, id); err != nil {
+		return err
+	}
+	delete(t.rows, id)
+	t.db.compactIfDue()
+	return nil
+}
@@ -2,6 +2,8 @@ package database
 
 import (
 	"fmt"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -22,7 +24,7 @@ func TestNewInMemoryDB(t *testing.T) {
 
 	account, err := db.GetAccount("account-1")
 	assert.NoError(t, err)
-	assert.Equal(t, 1000.0, account.Balance)
+	assert.Equal(t, models.NewMoney(100000, "USD"), account.Balance)
 
 	bonus, err := db.GetBonus("bonus-1")
 	assert.NoError(t, err)
@@ -35,7 +37,7 @@ func TestInMemoryDB_CreateAndGetAccount(t *testing.T) {
 	account := &models.Account{
 		ID:       "test-account",
 		UserID:   "user-1",
-		Balance:  500.0,
+		Balance:  models.NewMoney(50000, "EUR"),
 		Currency: "EUR",
 	}
 
@@ -55,7 +57,7 @@ func TestInMemoryDB_CreateDuplicateAccount(t *testing.T) {
 	account := &models.Account{
 		ID:       "duplicate-account",
 		UserID:   "user-1",
-		Balance:  500.0,
+		Balance:  models.NewMoney(50000, "EUR"),
 		Currency: "EUR",
 	}
 
@@ -85,21 +87,21 @@ func TestInMemoryDB_UpdateAccount(t *testing.T) {
 	account := &models.Account{
 		ID:       "update-test",
 		UserID:   "user-1",
-		Balance:  100.0,
+		Balance:  models.NewMoney(10000, "USD"),
 		Currency: "USD",
 	}
 	err := db.CreateAccount(account)
 	assert.NoError(t, err)
 
 	// Обновляем счет
-	account.Balance = 200.0
+	account.Balance = models.NewMoney(20000, "USD")
 	err = db.UpdateAccount(account)
 	assert.NoError(t, err)
 
 	// Проверяем обновление
 	updatedAccount, err := db.GetAccount("update-test")
 	assert.NoError(t, err)
-	assert.Equal(t, 200.0, updatedAccount.Balance)
+	assert.Equal(t, models.NewMoney(20000, "USD"), updatedAccount.Balance)
 }
 
 func TestInMemoryDB_DeleteAccount(t *testing.T) {
@@ -109,7 +111,7 @@ func TestInMemoryDB_DeleteAccount(t *testing.T) {
 	account := &models.Account{
 		ID:       "delete-test",
 		UserID:   "user-1",
-		Balance:  0.0, // Пустой счет
+		Balance:  models.NewMoney(0, "USD"), // Пустой счет
 		Currency: "USD",
 	}
 	err := db.CreateAccount(account)
@@ -131,7 +133,7 @@ func TestInMemoryDB_CreateAndGetTransaction(t *testing.T) {
 		ID:          "test-transaction",
 		FromAccount: "account-1",
 		ToAccount:   "account-2",
-		Amount:      100.0,
+		Amount:      models.NewMoney(10000, "USD"),
 		Type:        "transfer",
 		Status:      "pending",
 		Description: "test transfer",
@@ -155,7 +157,7 @@ func TestInMemoryDB_GetTransactionsByAccount(t *testing.T) {
 		ID:          "txn-1",
 		FromAccount: "account-1",
 		ToAccount:   "account-2",
-		Amount:      100.0,
+		Amount:      models.NewMoney(10000, "USD"),
 		Type:        "transfer",
 		Status:      "completed",
 	}
@@ -164,7 +166,7 @@ func TestInMemoryDB_GetTransactionsByAccount(t *testing.T) {
 		ID:          "txn-2",
 		FromAccount: "account-3",
 		ToAccount:   "account-1",
-		Amount:      50.0,
+		Amount:      models.NewMoney(5000, "USD"),
 		Type:        "transfer",
 		Status:      "completed",
 	}
@@ -188,7 +190,7 @@ func TestInMemoryDB_CreateAndGetBonus(t *testing.T) {
 		ID:        "test-bonus",
 		UserID:    "user-1",
 		Type:      "referral",
-		Amount:    25.0,
+		Amount:    models.NewMoney(2500, "USD"),
 		Status:    "active",
 		ExpiresAt: time.Now().AddDate(0, 0, 30),
 	}
@@ -211,7 +213,7 @@ func TestInMemoryDB_GetBonusesByUserID(t *testing.T) {
 		ID:        "bonus-u2-1",
 		UserID:    "user-2",
 		Type:      "welcome",
-		Amount:    50.0,
+		Amount:    models.NewMoney(5000, "USD"),
 		Status:    "active",
 		ExpiresAt: time.Now().AddDate(0, 0, 30),
 	}
@@ -220,7 +222,7 @@ func TestInMemoryDB_GetBonusesByUserID(t *testing.T) {
 		ID:        "bonus-u2-2",
 		UserID:    "user-2",
 		Type:      "transaction",
-		Amount:    25.0,
+		Amount:    models.NewMoney(2500, "USD"),
 		Status:    "active",
 		ExpiresAt: time.Now().AddDate(0, 0, 90),
 	}
@@ -292,7 +294,7 @@ func TestInMemoryDB_ConcurrentAccess(t *testing.T) {
 			account := &models.Account{
 				ID:       fmt.Sprintf("concurrent-%d", id),
 				UserID:   "user-1",
-				Balance:  float64(id * 100),
+				Balance:  models.NewMoney(int64(id*100), "USD"),
 				Currency: "USD",
 			}
 
@@ -317,6 +319,378 @@ func TestInMemoryDB_ConcurrentAccess(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		account, err := db.GetAccount(fmt.Sprintf("concurrent-%d", i))
 		assert.NoError(t, err)
-		assert.Equal(t, float64(i*100), account.Balance)
+		assert.Equal(t, models.NewMoney(int64(i*100), "USD"), account.Balance)
 	}
 }
+
+func TestInMemoryDB_CopyOnRead(t *testing.T) {
+	db := NewInMemoryDB()
+	account := &models.Account{ID: "copy", UserID: "user-1", Balance: models.NewMoney(100, "USD"), Currency: "USD"}
+	assert.NoError(t, db.CreateAccount(account))
+
+	// Ни исходный указатель, ни прочитанная копия не связаны с данными базы
+	account.Balance = models.NewMoney(1, "USD")
+	got, err := db.GetAccount("copy")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(100, "USD"), got.Balance)
+
+	got.Balance = models.NewMoney(2, "USD")
+	again, err := db.GetAccount("copy")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(100, "USD"), again.Balance)
+
+	byUser, err := db.GetAccountsByUserID("user-1")
+	assert.NoError(t, err)
+	for _, a := range byUser {
+		a.Balance = models.Zero("USD")
+	}
+	again, err = db.GetAccount("copy")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(100, "USD"), again.Balance)
+}
+
+func TestInMemoryDB_LockAccounts_SerializesTransactions(t *testing.T) {
+	db := NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "a", UserID: "user-1", Balance: models.NewMoney(1000, "USD"), Currency: "USD"}))
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "b", UserID: "user-1", Balance: models.NewMoney(1000, "USD"), Currency: "USD"}))
+
+	// Встречные переводы A→B и B→A: без общего порядка блокировок они бы взаимоблокировались,
+	// без блокировок — теряли бы обновления
+	move := func(from, to string, amount int64) error {
+		return db.RunInTx(func(tx Tx) error {
+			if err := tx.LockAccounts(from, to); err != nil {
+				return err
+			}
+			source, err := tx.GetAccount(from)
+			if err != nil {
+				return err
+			}
+			target, err := tx.GetAccount(to)
+			if err != nil {
+				return err
+			}
+			// даём другим транзакциям вклиниться между чтением и записью
+			runtime.Gosched()
+			if source.Balance, err = source.Balance.Sub(models.NewMoney(amount, "USD")); err != nil {
+				return err
+			}
+			if target.Balance, err = target.Balance.Add(models.NewMoney(amount, "USD")); err != nil {
+				return err
+			}
+			if err := tx.UpdateAccount(source); err != nil {
+				return err
+			}
+			return tx.UpdateAccount(target)
+		})
+	}
+
+	const workers = 200
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				assert.NoError(t, move("a", "b", 1))
+			} else {
+				assert.NoError(t, move("b", "a", 2))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 100 переводов по 1 в одну сторону и 100 по 2 в другую
+	a, _ := db.GetAccount("a")
+	b, _ := db.GetAccount("b")
+	assert.Equal(t, models.NewMoney(1100, "USD"), a.Balance)
+	assert.Equal(t, models.NewMoney(900, "USD"), b.Balance)
+	assert.Empty(t, db.locks.locks)
+}
+
+func TestInMemoryDB_RunInTx_Commit(t *testing.T) {
+	db := NewInMemoryDB()
+
+	err := db.RunInTx(func(tx Tx) error {
+		account := &models.Account{ID: "tx-account", UserID: "user-1", Balance: models.NewMoney(100, "USD"), Currency: "USD"}
+		if err := tx.CreateAccount(account); err != nil {
+			return err
+		}
+
+		// Изменения видны внутри транзакции, но ещё не видны снаружи
+		inside, err := tx.GetAccount("tx-account")
+		assert.NoError(t, err)
+		assert.Equal(t, account.Balance, inside.Balance)
+		_, err = db.GetAccount("tx-account")
+		assert.Error(t, err)
+
+		seeded, err := tx.GetAccount("account-1")
+		if err != nil {
+			return err
+		}
+		seeded.Balance = models.NewMoney(0, "USD")
+		return tx.UpdateAccount(seeded)
+	})
+	assert.NoError(t, err)
+
+	created, err := db.GetAccount("tx-account")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(100, "USD"), created.Balance)
+
+	seeded, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.True(t, seeded.Balance.IsZero())
+}
+
+func TestInMemoryDB_RunInTx_RollbackOnError(t *testing.T) {
+	db := NewInMemoryDB()
+
+	err := db.RunInTx(func(tx Tx) error {
+		account, err := tx.GetAccount("account-1")
+		if err != nil {
+			return err
+		}
+		account.Balance = models.NewMoney(1, "USD")
+		if err := tx.UpdateAccount(account); err != nil {
+			return err
+		}
+		if err := tx.DeleteBonus("bonus-1"); err != nil {
+			return err
+		}
+		return tx.UpdateAccount(&models.Account{ID: "missing"})
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+
+	account, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(100000, "USD"), account.Balance)
+
+	_, err = db.GetBonus("bonus-1")
+	assert.NoError(t, err)
+}
+
+func TestInMemoryDB_RunInTx_RollbackOnPanic(t *testing.T) {
+	db := NewInMemoryDB()
+
+	assert.Panics(t, func() {
+		_ = db.RunInTx(func(tx Tx) error {
+			_ = tx.DeleteAccount("account-1")
+			panic("boom")
+		})
+	})
+
+	_, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+}
+
+func TestInMemoryDB_RunInTx_CommitValidation(t *testing.T) {
+	db := NewInMemoryDB()
+
+	// Счёт удаляют параллельно, пока транзакция его обновляет: коммит должен отвалиться целиком
+	err := db.RunInTx(func(tx Tx) error {
+		account, err := tx.GetAccount("account-1")
+		if err != nil {
+			return err
+		}
+		account.Balance = models.NewMoney(1, "USD")
+		if err := tx.UpdateAccount(account); err != nil {
+			return err
+		}
+		if err := tx.CreateBonus(&models.Bonus{ID: "tx-bonus", UserID: "user-1"}); err != nil {
+			return err
+		}
+		return db.DeleteAccount("account-1")
+	})
+	assert.Error(t, err)
+
+	_, err = db.GetBonus("tx-bonus")
+	assert.Error(t, err)
+}
+
+func TestInMemoryDB_RunInTx_CreateThenDelete(t *testing.T) {
+	db := NewInMemoryDB()
+
+	err := db.RunInTx(func(tx Tx) error {
+		if err := tx.CreateUser(&models.User{ID: "temp-user", Email: "temp@example.com"}); err != nil {
+			return err
+		}
+		found, err := tx.GetUserByEmail("temp@example.com")
+		if err != nil {
+			return err
+		}
+		return tx.DeleteUser(found.ID)
+	})
+	assert.NoError(t, err)
+
+	_, err = db.GetUser("temp-user")
+	assert.Error(t, err)
+}
+
+func TestInMemoryDB_IndexesFollowChanges(t *testing.T) {
+	db := NewInMemoryDB()
+
+	// Смена владельца переносит счёт между пользователями
+	account, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	account.UserID = "user-2"
+	assert.NoError(t, db.UpdateAccount(account))
+	accounts, _ := db.GetAccountsByUserID("user-1")
+	assert.Empty(t, accounts)
+	accounts, _ = db.GetAccountsByUserID("user-2")
+	assert.Len(t, accounts, 1)
+
+	assert.NoError(t, db.DeleteBonus("bonus-1"))
+	bonuses, _ := db.GetBonusesByUserID("user-1")
+	assert.Empty(t, bonuses)
+
+	// История счёта упорядочена по времени независимо от порядка вставки
+	start := time.Now()
+	for i, offset := range []int{2, 0, 1} {
+		assert.NoError(t, db.CreateTransaction(&models.Transaction{ID: fmt.Sprintf("txn-%d", i), FromAccount: "account-1",
+			ToAccount: "account-2", Amount: models.NewMoney(100, "USD"), CreatedAt: start.Add(time.Duration(offset) * time.Second)}))
+	}
+	assert.NoError(t, db.DeleteTransaction("txn-2"))
+	transactions, _ := db.GetTransactionsByAccount("account-2")
+	if assert.Len(t, transactions, 2) {
+		assert.Equal(t, "txn-1", transactions[0].ID)
+		assert.Equal(t, "txn-0", transactions[1].ID)
+	}
+
+	// Смена email освобождает прежний
+	user, err := db.GetUser("user-1")
+	assert.NoError(t, err)
+	user.Email = "renamed@example.com"
+	assert.NoError(t, db.UpdateUser(user))
+	_, err = db.GetUserByEmail("test@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+	found, err := db.GetUserByEmail("renamed@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", found.ID)
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-3", Email: "test@example.com"}))
+}
+
+func TestInMemoryDB_BonusIndexesFollowChanges(t *testing.T) {
+	db := NewInMemoryDB()
+	now := time.Now()
+	for i, offset := range []time.Duration{time.Hour, -time.Hour, -2 * time.Hour} {
+		assert.NoError(t, db.CreateBonus(&models.Bonus{ID: fmt.Sprintf("bonus-t%d", i), UserID: "user-1", Type: "transaction", TransactionID: "txn-1",
+			Amount: models.NewMoney(100, "USD"), RemainingAmount: models.NewMoney(100, "USD"), Status: "active", ExpiresAt: now.Add(offset), CreatedAt: now}))
+	}
+	ids := func(bonuses []*models.Bonus) []string {
+		var ids []string
+		for _, bonus := range bonuses {
+			ids = append(ids, bonus.ID)
+		}
+		return ids
+	}
+
+	byTransaction, _ := db.GetBonusesByTransaction("txn-1")
+	assert.Equal(t, []string{"bonus-t0", "bonus-t1", "bonus-t2"}, ids(byTransaction))
+	expired, _ := db.GetExpiredBonuses(now)
+	assert.Equal(t, []string{"bonus-t2", "bonus-t1"}, ids(expired))
+
+	// Использованный бонус уже не истекает, а бонус, перенесённый на другую операцию, уходит из выборки прежней
+	used, _ := db.GetBonus("bonus-t2")
+	used.Status = "used"
+	assert.NoError(t, db.UpdateBonus(used))
+	moved, _ := db.GetBonus("bonus-t0")
+	moved.TransactionID = "txn-2"
+	moved.ExpiresAt = now.Add(-3 * time.Hour)
+	assert.NoError(t, db.UpdateBonus(moved))
+
+	byTransaction, _ = db.GetBonusesByTransaction("txn-1")
+	assert.Equal(t, []string{"bonus-t1", "bonus-t2"}, ids(byTransaction))
+	byTransaction, _ = db.GetBonusesByTransaction("txn-2")
+	assert.Equal(t, []string{"bonus-t0"}, ids(byTransaction))
+	expired, _ = db.GetExpiredBonuses(now)
+	assert.Equal(t, []string{"bonus-t0", "bonus-t1"}, ids(expired))
+
+	// Изменения транзакции видны её выборкам до коммита
+	assert.NoError(t, db.RunInTx(func(tx Tx) error {
+		bonus, err := tx.GetBonus("bonus-t1")
+		if err != nil {
+			return err
+		}
+		bonus.Status = "expired"
+		if err := tx.UpdateBonus(bonus); err != nil {
+			return err
+		}
+		expired, err := tx.GetExpiredBonuses(now)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"bonus-t0"}, ids(expired))
+		return tx.DeleteBonus("bonus-t2")
+	}))
+	expired, _ = db.GetExpiredBonuses(now)
+	assert.Equal(t, []string{"bonus-t0"}, ids(expired))
+	byTransaction, _ = db.GetBonusesByTransaction("txn-1")
+	assert.Equal(t, []string{"bonus-t1"}, ids(byTransaction))
+}
+
+func TestInMemoryDB_UniqueEmail(t *testing.T) {
+	db := NewInMemoryDB()
+
+	err := db.CreateUser(&models.User{ID: "user-2", Email: "test@example.com"})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-2", Email: "second@example.com"}))
+	user, _ := db.GetUser("user-2")
+	user.Email = "test@example.com"
+	assert.ErrorIs(t, db.UpdateUser(user), ErrAlreadyExists)
+
+	// В транзакции email можно передать: прежний владелец сменил его раньше в той же транзакции
+	err = db.RunInTx(func(tx Tx) error {
+		first, _ := tx.GetUser("user-1")
+		first.Email = "first@example.com"
+		if err := tx.UpdateUser(first); err != nil {
+			return err
+		}
+		second, _ := tx.GetUser("user-2")
+		second.Email = "test@example.com"
+		if err := tx.UpdateUser(second); err != nil {
+			return err
+		}
+		found, err := tx.GetUserByEmail("test@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "user-2", found.ID)
+		return tx.CreateUser(&models.User{ID: "user-3", Email: "first@example.com"})
+	})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	// Email, занятый другой транзакцией после проверки, не даёт закоммитить
+	err = db.RunInTx(func(tx Tx) error {
+		if err := tx.CreateUser(&models.User{ID: "user-3", Email: "race@example.com"}); err != nil {
+			return err
+		}
+		return db.CreateUser(&models.User{ID: "user-4", Email: "race@example.com"})
+	})
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	_, err = db.GetUser("user-3")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestInMemoryDB_RunInTx_UpdatesIndexes(t *testing.T) {
+	db := NewInMemoryDB()
+
+	err := db.RunInTx(func(tx Tx) error {
+		if err := tx.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}); err != nil {
+			return err
+		}
+		// Внутри транзакции её изменения уже видны в выборках
+		accounts, err := tx.GetAccountsByUserID("user-1")
+		assert.NoError(t, err)
+		assert.Len(t, accounts, 2)
+		if err := tx.DeleteBonus("bonus-1"); err != nil {
+			return err
+		}
+		return tx.CreateTransaction(&models.Transaction{ID: "txn-1", FromAccount: "account-1", ToAccount: "account-2",
+			Amount: models.NewMoney(100, "USD"), CreatedAt: time.Now()})
+	})
+	assert.NoError(t, err)
+
+	accounts, _ := db.GetAccountsByUserID("user-1")
+	assert.Len(t, accounts, 2)
+	bonuses, _ := db.GetBonusesByUserID("user-1")
+	assert.Empty(t, bonuses)
+	transactions, _ := db.GetTransactionsByAccount("account-2")
+	assert.Len(t, transactions, 1)
+}
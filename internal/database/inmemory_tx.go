@@ -0,0 +1,552 @@
+package database
+
+import (
+	"time"
+
+	"petProjectMike/internal/models"
+)
+
+// stagedRow изменение записи, накопленное в транзакции до коммита
+type stagedRow[T any] struct {
+	value   *T
+	created bool
+	deleted bool
+	// base версия записи в базе, от которой транзакция начала изменения; сверяется при коммите
+	base int64
+}
+
+// txTable буфер изменений одной таблицы поверх данных InMemoryDB
+type txTable[T any] struct {
+	// name имя сущности в ошибках, table — имя таблицы в журнале
+	name   string
+	table  string
+	store  map[string]*T
+	staged map[string]*stagedRow[T]
+	// copy делает независимую копию записи, чтобы вызывающий код не менял данные базы
+	copy func(*T) *T
+	// version указатель на версию записи; nil — у записей таблицы нет версий
+	version func(*T) *int64
+	// index переносит запись во вторичных индексах базы при коммите; nil — индексов нет
+	index func(old, next *T)
+}
+
+func newTxTable[T any](name, table string, store map[string]*T, copy func(*T) *T, version func(*T) *int64) *txTable[T] {
+	return &txTable[T]{name: name, table: table, store: store, staged: make(map[string]*stagedRow[T]), copy: copy, version: version}
+}
+
+// baseVersion версия записи в базе до изменений транзакции
+func (t *txTable[T]) baseVersion(id string) int64 {
+	if row, ok := t.staged[id]; ok {
+		return row.base
+	}
+	if v, ok := t.store[id]; ok && t.version != nil {
+		return *t.version(v)
+	}
+	return 0
+}
+
+// lookup возвращает запись с учётом изменений транзакции; вызывается под RLock базы
+func (t *txTable[T]) lookup(id string) (*T, bool) {
+	if row, ok := t.staged[id]; ok {
+		if row.deleted {
+			return nil, false
+		}
+		return row.value, true
+	}
+	v, ok := t.store[id]
+	return v, ok
+}
+
+func (t *txTable[T]) get(id string) (*T, error) {
+	v, ok := t.lookup(id)
+	if !ok {
+		return nil, errNotFound(t.name)
+	}
+	return t.copy(v), nil
+}
+
+// list возвращает все видимые в транзакции записи, подходящие под match
+func (t *txTable[T]) list(match func(*T) bool) []*T {
+	var result []*T
+	for id, v := range t.store {
+		if _, ok := t.staged[id]; ok {
+			continue
+		}
+		if match(v) {
+			result = append(result, t.copy(v))
+		}
+	}
+	for _, row := range t.staged {
+		if !row.deleted && match(row.value) {
+			result = append(result, t.copy(row.value))
+		}
+	}
+	return result
+}
+
+func (t *txTable[T]) create(id string, v *T) error {
+	if _, ok := t.lookup(id); ok {
+		return errAlreadyExists(t.name)
+	}
+	created := true
+	if row, ok := t.staged[id]; ok && row.deleted {
+		// запись удалена и создана заново в рамках одной транзакции
+		created = false
+	}
+	if t.version != nil {
+		initVersion(t.version(v))
+	}
+	t.staged[id] = &stagedRow[T]{value: t.copy(v), created: created, base: t.baseVersion(id)}
+	return nil
+}
+
+func (t *txTable[T]) update(id string, v *T) error {
+	current, ok := t.lookup(id)
+	if !ok {
+		return errNotFound(t.name)
+	}
+	next := t.copy(v)
+	if t.version != nil {
+		if err := bumpVersion(t.version(next), *t.version(current)); err != nil {
+			return err
+		}
+		*t.version(v) = *t.version(next)
+	}
+	created := false
+	if row, ok := t.staged[id]; ok {
+		created = row.created
+	}
+	t.staged[id] = &stagedRow[T]{value: next, created: created, base: t.baseVersion(id)}
+	return nil
+}
+
+func (t *txTable[T]) delete(id string) error {
+	if _, ok := t.lookup(id); !ok {
+		return errNotFound(t.name)
+	}
+	if row, ok := t.staged[id]; ok && row.created {
+		delete(t.staged, id)
+		return nil
+	}
+	t.staged[id] = &stagedRow[T]{deleted: true, base: t.baseVersion(id)}
+	return nil
+}
+
+// validate проверяет, что с момента чтения данные не изменились так, что коммит невозможен
+func (t *txTable[T]) validate() error {
+	for id, row := range t.staged {
+		stored, exists := t.store[id]
+		if row.created && exists {
+			return errAlreadyExists(t.name)
+		}
+		if !row.created && !exists {
+			return errNotFound(t.name)
+		}
+		if !row.created && t.version != nil && *t.version(stored) != row.base {
+			return ErrConflict
+		}
+	}
+	return nil
+}
+
+// journalOps описывает буфер изменений операциями журнала
+func (t *txTable[T]) journalOps() ([]journalOp, error) {
+	var ops []journalOp
+	for id, row := range t.staged {
+		if row.deleted {
+			ops = append(ops, deleteOp(t.table, id))
+			continue
+		}
+		op, err := putOp(t.table, id, row.value)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func (t *txTable[T]) apply() {
+	for id, row := range t.staged {
+		old := t.store[id]
+		if row.deleted {
+			delete(t.store, id)
+		} else {
+			t.store[id] = row.value
+		}
+		if t.index != nil {
+			t.index(old, row.value)
+		}
+	}
+}
+
+// listIn как list, но из базы смотрит только записи ids — кандидатов из вторичного индекса.
+// Изменённые транзакцией записи проверяются все: индекс базы о них ещё не знает
+func (t *txTable[T]) listIn(ids []string, match func(*T) bool) []*T {
+	var result []*T
+	for _, id := range ids {
+		if _, ok := t.staged[id]; ok {
+			continue
+		}
+		if v, ok := t.store[id]; ok && match(v) {
+			result = append(result, t.copy(v))
+		}
+	}
+	for _, row := range t.staged {
+		if !row.deleted && match(row.value) {
+			result = append(result, t.copy(row.value))
+		}
+	}
+	return result
+}
+
+// txCommitter таблица транзакции с точки зрения коммита
+type txCommitter interface {
+	validate() error
+	journalOps() ([]journalOp, error)
+	apply()
+}
+
+// inMemoryTx транзакция InMemoryDB: изменения копятся в буфере и применяются под общей блокировкой
+type inMemoryTx struct {
+	db            *InMemoryDB
+	accounts      *txTable[models.Account]
+	transactions  *txTable[models.Transaction]
+	bonuses       *txTable[models.Bonus]
+	users         *txTable[models.User]
+	ledger        *txTable[models.LedgerEntry]
+	campaigns     *txTable[models.Campaign]
+	redemptions   *txTable[models.BonusRedemption]
+	referralCodes *txTable[models.ReferralCode]
+	referrals     *txTable[models.Referral]
+	promoCodes    *txTable[models.PromoCode]
+	promoUses     *txTable[models.PromoRedemption]
+	loyalty       *txTable[models.LoyaltyAccount]
+	points        *txTable[models.PointsEntry]
+	erasures      *txTable[models.ErasureCertificate]
+	// tables все таблицы транзакции в порядке проверки и применения при коммите
+	tables []txCommitter
+	// held счета, заблокированные транзакцией; отпускаются после коммита или отката
+	held []string
+}
+
+func (db *InMemoryDB) RunInTx(fn func(tx Tx) error) error {
+	tx := &inMemoryTx{
+		db:            db,
+		accounts:      newTxTable("account", tableAccounts, db.accounts, clone[models.Account], func(a *models.Account) *int64 { return &a.Version }),
+		transactions:  newTxTable("transaction", tableTransactions, db.transactions, clone[models.Transaction], func(t *models.Transaction) *int64 { return &t.Version }),
+		bonuses:       newTxTable("bonus", tableBonuses, db.bonuses, clone[models.Bonus], func(b *models.Bonus) *int64 { return &b.Version }),
+		users:         newTxTable("user", tableUsers, db.users, clone[models.User], func(u *models.User) *int64 { return &u.Version }),
+		ledger:        newTxTable("ledger entry", tableLedger, db.ledger, cloneLedgerEntry, nil),
+		campaigns:     db.campaigns.tx(),
+		redemptions:   db.redemptions.tx(),
+		referralCodes: db.referralCodes.tx(),
+		referrals:     db.referrals.tx(),
+		promoCodes:    db.promoCodes.tx(),
+		promoUses:     db.promoUses.tx(),
+		loyalty:       db.loyalty.tx(),
+		points:        db.points.tx(),
+		erasures:      db.erasures.tx(),
+	}
+	tx.tables = []txCommitter{tx.accounts, tx.transactions, tx.bonuses, tx.users, tx.ledger, tx.campaigns, tx.redemptions,
+		tx.referralCodes, tx.referrals, tx.promoCodes, tx.promoUses, tx.loyalty, tx.points, tx.erasures}
+	tx.accounts.index = db.indexAccount
+	tx.transactions.index = db.indexTransaction
+	tx.bonuses.index = db.indexBonus
+	tx.users.index = db.indexUser
+	defer tx.unlock()
+	// При ошибке или панике буфер просто отбрасывается — это и есть откат
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+func (tx *inMemoryTx) LockAccounts(ids ...string) error {
+	for _, id := range lockOrder(ids) {
+		if tx.holds(id) {
+			continue
+		}
+		tx.db.locks.acquire(id)
+		tx.held = append(tx.held, id)
+	}
+	return nil
+}
+
+func (tx *inMemoryTx) holds(id string) bool {
+	for _, held := range tx.held {
+		if held == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (tx *inMemoryTx) unlock() {
+	for _, id := range tx.held {
+		tx.db.locks.release(id)
+	}
+	tx.held = nil
+}
+
+func (tx *inMemoryTx) commit() error {
+	tx.db.mutex.Lock()
+	defer tx.db.mutex.Unlock()
+
+	for _, table := range tx.tables {
+		if err := table.validate(); err != nil {
+			return err
+		}
+	}
+	// Email мог занять пользователь, созданный другой транзакцией после проверки в CreateUser или UpdateUser
+	for id, row := range tx.users.staged {
+		if row.deleted {
+			continue
+		}
+		if owner, ok := tx.db.emails[row.value.Email]; ok && owner != id {
+			if _, staged := tx.users.staged[owner]; !staged {
+				return errEmailTaken()
+			}
+		}
+	}
+
+	// Весь коммит — одна запись журнала, поэтому при восстановлении он тоже применится целиком
+	if tx.db.journal != nil {
+		ops, err := tx.journalOps()
+		if err != nil {
+			return err
+		}
+		if err := tx.db.logOps(ops...); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range tx.tables {
+		table.apply()
+	}
+	tx.db.compactIfDue()
+	return nil
+}
+
+func (tx *inMemoryTx) journalOps() ([]journalOp, error) {
+	var ops []journalOp
+	for _, table := range tx.tables {
+		tableOps, err := table.journalOps()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, tableOps...)
+	}
+	return ops, nil
+}
+
+// Account
+func (tx *inMemoryTx) CreateAccount(account *models.Account) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.accounts.create(account.ID, account)
+}
+
+func (tx *inMemoryTx) GetAccount(id string) (*models.Account, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.accounts.get(id)
+}
+
+func (tx *inMemoryTx) GetAccountsByUserID(userID string) ([]*models.Account, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	accounts := tx.accounts.listIn(tx.db.accountsByUser.ids(userID), func(a *models.Account) bool { return a.UserID == userID })
+	sortAccountsByCreation(accounts)
+	return accounts, nil
+}
+
+func (tx *inMemoryTx) UpdateAccount(account *models.Account) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.accounts.update(account.ID, account)
+}
+
+func (tx *inMemoryTx) DeleteAccount(id string) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.accounts.delete(id)
+}
+
+// Transaction
+func (tx *inMemoryTx) CreateTransaction(transaction *models.Transaction) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.transactions.create(transaction.ID, transaction)
+}
+
+func (tx *inMemoryTx) GetTransaction(id string) (*models.Transaction, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.transactions.get(id)
+}
+
+func (tx *inMemoryTx) GetTransactionsByAccount(accountID string) ([]*models.Transaction, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	transactions := tx.transactions.listIn(tx.db.timeline.ids(accountID), func(t *models.Transaction) bool {
+		return t.FromAccount == accountID || t.ToAccount == accountID
+	})
+	sortTransactions(transactions, false)
+	return transactions, nil
+}
+
+func (tx *inMemoryTx) QueryTransactions(query TransactionQuery) ([]*models.Transaction, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return query.page(tx.transactions.listIn(tx.db.timeline.ids(query.AccountID), query.matches)), nil
+}
+
+func (tx *inMemoryTx) UpdateTransaction(transaction *models.Transaction) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.transactions.update(transaction.ID, transaction)
+}
+
+func (tx *inMemoryTx) DeleteTransaction(id string) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.transactions.delete(id)
+}
+
+// Bonus
+func (tx *inMemoryTx) CreateBonus(bonus *models.Bonus) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.bonuses.create(bonus.ID, bonus)
+}
+
+func (tx *inMemoryTx) GetBonus(id string) (*models.Bonus, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.bonuses.get(id)
+}
+
+func (tx *inMemoryTx) GetBonusesByUserID(userID string) ([]*models.Bonus, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	bonuses := tx.bonuses.listIn(tx.db.bonusesByUser.ids(userID), func(b *models.Bonus) bool { return b.UserID == userID })
+	sortBonusesByCreation(bonuses)
+	return bonuses, nil
+}
+
+func (tx *inMemoryTx) GetBonusesByTransaction(transactionID string) ([]*models.Bonus, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	bonuses := tx.bonuses.listIn(tx.db.bonusesByTransaction.ids(transactionID), func(b *models.Bonus) bool { return b.TransactionID == transactionID })
+	sortByID(bonuses)
+	return bonuses, nil
+}
+
+func (tx *inMemoryTx) GetExpiredBonuses(now time.Time) ([]*models.Bonus, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	bonuses := tx.bonuses.listIn(tx.db.bonusExpiry.until(now), func(b *models.Bonus) bool { return isExpiredBonus(b, now) })
+	sortByExpiry(bonuses)
+	return bonuses, nil
+}
+
+func (tx *inMemoryTx) UpdateBonus(bonus *models.Bonus) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.bonuses.update(bonus.ID, bonus)
+}
+
+func (tx *inMemoryTx) DeleteBonus(id string) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.bonuses.delete(id)
+}
+
+// User
+func (tx *inMemoryTx) CreateUser(user *models.User) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	if tx.emailTaken(user.Email, user.ID) {
+		return errEmailTaken()
+	}
+	return tx.users.create(user.ID, user)
+}
+
+func (tx *inMemoryTx) GetUser(id string) (*models.User, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.users.get(id)
+}
+
+func (tx *inMemoryTx) GetUserByEmail(email string) (*models.User, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	if id, ok := tx.emailOwner(email); ok {
+		return tx.users.get(id)
+	}
+	return nil, errNotFound("user")
+}
+
+func (tx *inMemoryTx) UpdateUser(user *models.User) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	if tx.emailTaken(user.Email, user.ID) {
+		return errEmailTaken()
+	}
+	return tx.users.update(user.ID, user)
+}
+
+// emailOwner пользователь с email с учётом изменений транзакции
+func (tx *inMemoryTx) emailOwner(email string) (string, bool) {
+	for id, row := range tx.users.staged {
+		if !row.deleted && row.value.Email == email {
+			return id, true
+		}
+	}
+	// Владелец по индексу базы не в счёт, если транзакция его удалила или сменила ему email
+	id, ok := tx.db.emails[email]
+	if _, staged := tx.users.staged[id]; !ok || staged {
+		return "", false
+	}
+	return id, true
+}
+
+// emailTaken занят ли email другим пользователем, кроме userID
+func (tx *inMemoryTx) emailTaken(email, userID string) bool {
+	owner, ok := tx.emailOwner(email)
+	return ok && owner != userID
+}
+
+func (tx *inMemoryTx) DeleteUser(id string) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.users.delete(id)
+}
+
+// Ledger
+func (tx *inMemoryTx) CreateLedgerEntry(entry *models.LedgerEntry) error {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.ledger.create(entry.ID, entry)
+}
+
+func (tx *inMemoryTx) GetLedgerEntry(id string) (*models.LedgerEntry, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	return tx.ledger.get(id)
+}
+
+func (tx *inMemoryTx) GetPostingsByAccount(accountID string) ([]*models.Posting, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	entries := tx.ledger.list(func(*models.LedgerEntry) bool { return true })
+	return postingsOf(entries, func(p *models.Posting) bool { return p.AccountID == accountID }), nil
+}
+
+func (tx *inMemoryTx) GetAllPostings() ([]*models.Posting, error) {
+	tx.db.mutex.RLock()
+	defer tx.db.mutex.RUnlock()
+	entries := tx.ledger.list(func(*models.LedgerEntry) bool { return true })
+	return postingsOf(entries, func(*models.Posting) bool { return true }), nil
+}
@@ -1,9 +1,13 @@
 package database
 
-import "petProjectMike/internal/models"
+import (
+	"time"
 
-// Database интерфейс для работы с базой данных
-type Database interface {
+	"petProjectMike/internal/models"
+)
+
+// Store набор CRUD-операций, общий для базы данных и транзакции
+type Store interface {
 	// Account operations
 	CreateAccount(account *models.Account) error
 	GetAccount(id string) (*models.Account, error)
@@ -14,7 +18,10 @@ type Database interface {
 	// Transaction operations
 	CreateTransaction(transaction *models.Transaction) error
 	GetTransaction(id string) (*models.Transaction, error)
+	// GetTransactionsByAccount все операции счёта по возрастанию created_at
 	GetTransactionsByAccount(accountID string) ([]*models.Transaction, error)
+	// QueryTransactions операции счёта по фильтрам, в порядке и с позиции из query
+	QueryTransactions(query TransactionQuery) ([]*models.Transaction, error)
 	UpdateTransaction(transaction *models.Transaction) error
 	DeleteTransaction(id string) error
 
@@ -22,13 +29,87 @@ type Database interface {
 	CreateBonus(bonus *models.Bonus) error
 	GetBonus(id string) (*models.Bonus, error)
 	GetBonusesByUserID(userID string) ([]*models.Bonus, error)
+	// GetBonusesByTransaction бонусы, начисленные за операцию, по ID
+	GetBonusesByTransaction(transactionID string) ([]*models.Bonus, error)
+	// GetExpiredBonuses активные бонусы, срок которых истёк к моменту now, по возрастанию срока
+	GetExpiredBonuses(now time.Time) ([]*models.Bonus, error)
 	UpdateBonus(bonus *models.Bonus) error
 	DeleteBonus(id string) error
 
+	// Bonus redemptions: история использования бонусов, записи только добавляются
+	CreateBonusRedemption(redemption *models.BonusRedemption) error
+	// GetBonusRedemptions использования бонуса в хронологическом порядке
+	GetBonusRedemptions(bonusID string) ([]*models.BonusRedemption, error)
+
 	// User operations
 	CreateUser(user *models.User) error
 	GetUser(id string) (*models.User, error)
 	GetUserByEmail(email string) (*models.User, error)
 	UpdateUser(user *models.User) error
 	DeleteUser(id string) error
+
+	// Campaign operations: правила начисления бонусов
+	CreateCampaign(campaign *models.Campaign) error
+	GetCampaign(id string) (*models.Campaign, error)
+	ListCampaigns() ([]*models.Campaign, error)
+	UpdateCampaign(campaign *models.Campaign) error
+	DeleteCampaign(id string) error
+
+	// Referral operations: реферальные коды пользователей (ключ — пользователь) и приглашения (ключ — приглашённый)
+	CreateReferralCode(code *models.ReferralCode) error
+	GetReferralCode(userID string) (*models.ReferralCode, error)
+	GetReferralCodeByCode(code string) (*models.ReferralCode, error)
+	UpdateReferralCode(code *models.ReferralCode) error
+	CreateReferral(referral *models.Referral) error
+	GetReferral(refereeID string) (*models.Referral, error)
+	// GetReferralsByReferrer приглашения пользователя в порядке регистрации приглашённых
+	GetReferralsByReferrer(referrerID string) ([]*models.Referral, error)
+	UpdateReferral(referral *models.Referral) error
+
+	// Promo code operations: промокоды (ключ — код) и их погашения, которые только добавляются
+	CreatePromoCode(code *models.PromoCode) error
+	GetPromoCode(code string) (*models.PromoCode, error)
+	// GetPromoCodesByBatch коды партии по возрастанию кода
+	GetPromoCodesByBatch(batchID string) ([]*models.PromoCode, error)
+	UpdatePromoCode(code *models.PromoCode) error
+	CreatePromoRedemption(redemption *models.PromoRedemption) error
+	// GetPromoRedemptions погашения кода в хронологическом порядке
+	GetPromoRedemptions(code string) ([]*models.PromoRedemption, error)
+
+	// Loyalty operations: баланс баллов пользователя (ключ — пользователь, с версией) и журнал движений баллов
+	CreateLoyaltyAccount(account *models.LoyaltyAccount) error
+	GetLoyaltyAccount(userID string) (*models.LoyaltyAccount, error)
+	UpdateLoyaltyAccount(account *models.LoyaltyAccount) error
+	CreatePointsEntry(entry *models.PointsEntry) error
+	GetPointsEntry(id string) (*models.PointsEntry, error)
+	// GetPointsEntriesByUser движения баллов пользователя в хронологическом порядке
+	GetPointsEntriesByUser(userID string) ([]*models.PointsEntry, error)
+
+	// Erasure operations: сертификаты удаления пользователей (ключ — пользователь), записи только добавляются
+	CreateErasureCertificate(certificate *models.ErasureCertificate) error
+	GetErasureCertificate(userID string) (*models.ErasureCertificate, error)
+
+	// Ledger operations: записи главной книги только добавляются, но не меняются и не удаляются
+	CreateLedgerEntry(entry *models.LedgerEntry) error
+	GetLedgerEntry(id string) (*models.LedgerEntry, error)
+	GetPostingsByAccount(accountID string) ([]*models.Posting, error)
+	GetAllPostings() ([]*models.Posting, error)
+}
+
+// Tx единица работы: изменения видны внутри транзакции и применяются атомарно при коммите
+type Tx interface {
+	Store
+
+	// LockAccounts блокирует счета до конца транзакции. Все счета, которые транзакция будет менять,
+	// передаются одним вызовом до их чтения: блокировки берутся по возрастанию ID, что исключает
+	// взаимоблокировку встречных переводов. Повторная блокировка уже взятого счёта ничего не делает.
+	LockAccounts(ids ...string) error
+}
+
+// Database интерфейс для работы с базой данных
+type Database interface {
+	Store
+
+	// RunInTx выполняет fn в транзакции: nil — коммит, ошибка или паника — откат всех изменений
+	RunInTx(fn func(tx Tx) error) error
 }
@@ -0,0 +1,261 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrJournalCorrupted повреждение в середине журнала или снапшота, которое нельзя списать на оборванную запись
+var ErrJournalCorrupted = errors.New("journal corrupted")
+
+// FsyncPolicy когда сбрасывать журнал на диск
+type FsyncPolicy string
+
+const (
+	// FsyncAlways — fsync после каждой записи: ни одна подтверждённая операция не теряется
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval — fsync фоном раз в FsyncInterval: при сбое теряется не больше интервала
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncNever — сброс на диск остаётся на усмотрение ОС
+	FsyncNever FsyncPolicy = "never"
+)
+
+// PersistenceOptions настройки журнала и снапшотов InMemoryDB
+type PersistenceOptions struct {
+	// Dir каталог для journal.log и snapshot.dat
+	Dir           string
+	Fsync         FsyncPolicy
+	FsyncInterval time.Duration
+	// SnapshotEvery — после скольких записей журнала делать компактный снапшот (0 — не по счётчику)
+	SnapshotEvery int
+	// SnapshotInterval — как часто делать снапшот по таймеру (0 — не по таймеру)
+	SnapshotInterval time.Duration
+}
+
+const (
+	journalFileName  = "journal.log"
+	snapshotFileName = "snapshot.dat"
+
+	// Кадр: 4 байта длины, 4 байта CRC32C полезной нагрузки, затем сама нагрузка
+	frameHeaderSize = 8
+	maxFrameSize    = 256 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func encodeFrame(payload []byte) []byte {
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[frameHeaderSize:], payload)
+	return frame
+}
+
+// decodeFrames разбирает последовательность кадров. validSize — длина корректного префикса:
+// всё после него — оборванный хвост (недописанная при сбое запись), который можно отрезать.
+// Если испорчен кадр, за которым есть ещё данные, возвращается ErrJournalCorrupted.
+func decodeFrames(data []byte) (payloads [][]byte, validSize int, err error) {
+	offset := 0
+	for offset < len(data) {
+		rest := len(data) - offset
+		if rest < frameHeaderSize {
+			return payloads, offset, nil
+		}
+		size := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
+		checksum := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		if size > maxFrameSize {
+			return nil, 0, fmt.Errorf("%w: frame at offset %d has invalid size %d", ErrJournalCorrupted, offset, size)
+		}
+		end := offset + frameHeaderSize + size
+		if end > len(data) {
+			return payloads, offset, nil
+		}
+		payload := data[offset+frameHeaderSize : end]
+		if crc32.Checksum(payload, crcTable) != checksum {
+			if end == len(data) {
+				// последний кадр записан не полностью
+				return payloads, offset, nil
+			}
+			return nil, 0, fmt.Errorf("%w: checksum mismatch at offset %d", ErrJournalCorrupted, offset)
+		}
+		payloads = append(payloads, payload)
+		offset = end
+	}
+	return payloads, offset, nil
+}
+
+// journalFile то, что журнал использует от *os.File; в тестах подменяется файлом со сбоями
+type journalFile interface {
+	io.WriteSeeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// journal файл упреждающей записи; append вызывается под блокировкой базы
+type journal struct {
+	opts PersistenceOptions
+	mu   sync.Mutex
+	file journalFile
+	// size — длина журнала из целых записей: до неё файл откатывается после неудачной записи
+	size int64
+	// failed — откатить неудачную запись не удалось, и дописывать в журнал больше нельзя
+	failed error
+	// records — число записей с последнего снапшота
+	records int
+	dirty   bool
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// openJournal открывает журнал на дозапись, предварительно отрезав оборванный хвост
+func openJournal(opts PersistenceOptions, validSize int64) (*journal, error) {
+	path := filepath.Join(opts.Dir, journalFileName)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(validSize); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(validSize, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &journal{opts: opts, file: file, size: validSize, stop: make(chan struct{})}, nil
+}
+
+// append дописывает запись. Если запись не удалась (в том числе записалась частично или не сбросилась
+// на диск при FsyncAlways), файл откатывается к прежней длине: иначе следующая запись легла бы
+// за обрывком, и журнал перестал бы читаться
+func (j *journal) append(payload []byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.failed != nil {
+		return j.failed
+	}
+	frame := encodeFrame(payload)
+	_, err := j.file.Write(frame)
+	if err == nil && j.opts.Fsync == FsyncAlways {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		j.rollback()
+		return err
+	}
+	j.size += int64(len(frame))
+	j.records++
+	if j.opts.Fsync != FsyncAlways {
+		j.dirty = true
+	}
+	return nil
+}
+
+// rollback отрезает недописанную запись; если и это не удалось, журнал помечается испорченным
+func (j *journal) rollback() {
+	if err := j.file.Truncate(j.size); err != nil {
+		j.failed = fmt.Errorf("%w: failed to roll back partial write: %v", ErrJournalCorrupted, err)
+		return
+	}
+	if _, err := j.file.Seek(j.size, io.SeekStart); err != nil {
+		j.failed = fmt.Errorf("%w: failed to roll back partial write: %v", ErrJournalCorrupted, err)
+	}
+}
+
+func (j *journal) sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.dirty {
+		return nil
+	}
+	j.dirty = false
+	return j.file.Sync()
+}
+
+// reset очищает журнал после того, как его содержимое попало в снапшот
+func (j *journal) reset() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	j.size = 0
+	j.failed = nil
+	j.records = 0
+	j.dirty = false
+	return j.file.Sync()
+}
+
+func (j *journal) snapshotDue() bool {
+	return j.opts.SnapshotEvery > 0 && j.records >= j.opts.SnapshotEvery
+}
+
+// every запускает фоновую задачу с периодом interval до вызова close
+func (j *journal) every(interval time.Duration, task func()) {
+	j.done.Add(1)
+	go func() {
+		defer j.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				task()
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (j *journal) close() error {
+	close(j.stop)
+	j.done.Wait()
+	if err := j.sync(); err != nil {
+		j.file.Close()
+		return err
+	}
+	return j.file.Close()
+}
+
+// writeFileAtomic пишет файл через временный и rename, чтобы при сбое остался либо старый, либо новый
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	// fsync каталога фиксирует сам rename
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
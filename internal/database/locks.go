@@ -0,0 +1,61 @@
+package database
+
+import (
+	"sort"
+	"sync"
+)
+
+// lockOrder убирает повторы и сортирует ID: все транзакции берут блокировки в одном порядке,
+// поэтому встречные переводы A→B и B→A не могут заблокировать друг друга
+func lockOrder(ids []string) []string {
+	ordered := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ordered = append(ordered, id)
+	}
+	sort.Strings(ordered)
+	return ordered
+}
+
+// accountLocks мьютексы счетов InMemoryDB; мьютекс живёт, пока его кто-то держит или ждёт
+type accountLocks struct {
+	mutex sync.Mutex
+	locks map[string]*accountLock
+}
+
+type accountLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newAccountLocks() *accountLocks {
+	return &accountLocks{locks: make(map[string]*accountLock)}
+}
+
+func (l *accountLocks) acquire(id string) {
+	l.mutex.Lock()
+	lock, ok := l.locks[id]
+	if !ok {
+		lock = &accountLock{}
+		l.locks[id] = lock
+	}
+	lock.refs++
+	l.mutex.Unlock()
+
+	lock.Lock()
+}
+
+func (l *accountLocks) release(id string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	lock := l.locks[id]
+	lock.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, id)
+	}
+}
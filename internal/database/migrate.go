@@ -0,0 +1,123 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Миграции общие для всех SQL-бэкендов, поэтому пишутся на переносимом подмножестве SQL.
+// Имя файла: <версия>_<описание>.sql, версии применяются по возрастанию и только один раз.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []migration
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must start with a version", entry.Name())
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		body, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: entry.Name(), sql: string(body)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// migrate применяет недостающие миграции в одной транзакции
+func migrate(conn *sql.DB, d *dialect) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return runSQLTx(conn, d, func(tx Tx) error {
+		store := tx.(*sqlStore)
+		if d.migrationLock != "" {
+			if _, err := store.exec(d.migrationLock); err != nil {
+				return err
+			}
+		}
+		if _, err := store.exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL)"); err != nil {
+			return err
+		}
+
+		applied := make(map[int]bool)
+		rows, err := store.query("SELECT version FROM schema_migrations")
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var version int
+			if err := rows.Scan(&version); err != nil {
+				rows.Close()
+				return err
+			}
+			applied[version] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if applied[m.version] {
+				continue
+			}
+			for _, statement := range splitStatements(m.sql) {
+				if _, err := store.exec(statement); err != nil {
+					return fmt.Errorf("migration %s: %w", m.name, err)
+				}
+			}
+			if _, err := store.exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", m.version, store.ts(time.Now())); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// splitStatements делит скрипт на отдельные выражения: не все драйверы умеют выполнять несколько за раз
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
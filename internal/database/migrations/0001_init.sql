@@ -0,0 +1,51 @@
+-- Начальная схема: пользователи, счета, транзакции и бонусы.
+-- Суммы хранятся в минимальных единицах валюты (см. models.Money).
+
+CREATE TABLE users (
+    id         TEXT PRIMARY KEY,
+    email      TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_users_email ON users (email);
+
+CREATE TABLE accounts (
+    id            TEXT PRIMARY KEY,
+    user_id       TEXT NOT NULL,
+    balance_minor BIGINT NOT NULL,
+    currency      TEXT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_accounts_user_id ON accounts (user_id);
+
+CREATE TABLE transactions (
+    id           TEXT PRIMARY KEY,
+    from_account TEXT NOT NULL,
+    to_account   TEXT NOT NULL,
+    amount_minor BIGINT NOT NULL,
+    currency     TEXT NOT NULL,
+    type         TEXT NOT NULL,
+    status       TEXT NOT NULL,
+    description  TEXT NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_transactions_from_account ON transactions (from_account);
+CREATE INDEX idx_transactions_to_account ON transactions (to_account);
+
+CREATE TABLE bonuses (
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT NOT NULL,
+    type         TEXT NOT NULL,
+    amount_minor BIGINT NOT NULL,
+    currency     TEXT NOT NULL,
+    status       TEXT NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_bonuses_user_id ON bonuses (user_id);
@@ -0,0 +1,36 @@
+-- Главная книга: записи и проводки двойной записи.
+-- Сумма проводок одной записи равна нулю; остаток счёта — сумма его проводок.
+
+CREATE TABLE ledger_entries (
+    id          TEXT PRIMARY KEY,
+    reference   TEXT NOT NULL,
+    type        TEXT NOT NULL,
+    description TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_ledger_entries_reference ON ledger_entries (reference);
+
+CREATE TABLE postings (
+    entry_id     TEXT NOT NULL,
+    line         INTEGER NOT NULL,
+    account_id   TEXT NOT NULL,
+    amount_minor BIGINT NOT NULL,
+    currency     TEXT NOT NULL,
+    PRIMARY KEY (entry_id, line)
+);
+
+CREATE INDEX idx_postings_account_id ON postings (account_id);
+
+-- Остатки, накопленные до появления книги, переносятся начальными записями
+INSERT INTO ledger_entries (id, reference, type, description, created_at)
+SELECT 'opening-' || id, id, 'opening', 'opening balance', created_at
+FROM accounts WHERE balance_minor <> 0;
+
+INSERT INTO postings (entry_id, line, account_id, amount_minor, currency)
+SELECT 'opening-' || id, 0, 'opening-balance', -balance_minor, currency
+FROM accounts WHERE balance_minor <> 0;
+
+INSERT INTO postings (entry_id, line, account_id, amount_minor, currency)
+SELECT 'opening-' || id, 1, id, balance_minor, currency
+FROM accounts WHERE balance_minor <> 0;
@@ -0,0 +1,6 @@
+-- Версии записей для оптимистичной блокировки: UPDATE проходит, только если версия не изменилась.
+
+ALTER TABLE accounts ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE transactions ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE bonuses ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+-- Пароли пользователей: bcrypt-хеш, пустая строка — вход по паролю невозможен.
+
+ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
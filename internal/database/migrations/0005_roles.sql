@@ -0,0 +1,3 @@
+-- Роли пользователей для проверки доступа; существующие пользователи становятся клиентами.
+
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'customer';
@@ -0,0 +1,3 @@
+-- Планировщик регулярно ищет активные бонусы с истёкшим сроком.
+
+CREATE INDEX idx_bonuses_status_expires_at ON bonuses (status, expires_at);
@@ -0,0 +1,15 @@
+-- Бонусные кампании: условия и вознаграждение хранятся JSON-ом в rules (см. models.Campaign).
+-- Бонус помнит кампанию, по которой начислен.
+
+CREATE TABLE campaigns (
+    id         TEXT PRIMARY KEY,
+    name       TEXT NOT NULL,
+    active     BOOLEAN NOT NULL,
+    priority   INTEGER NOT NULL,
+    rules      TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    version    BIGINT NOT NULL DEFAULT 1
+);
+
+ALTER TABLE bonuses ADD COLUMN campaign_id TEXT NOT NULL DEFAULT '';
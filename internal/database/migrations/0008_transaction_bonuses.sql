@@ -0,0 +1,7 @@
+-- Бонусы за операции: операция, за которую начислен бонус (для дедупликации и отзыва при сторно),
+-- и счёт, на который бонус зачислен при использовании.
+
+ALTER TABLE bonuses ADD COLUMN transaction_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE bonuses ADD COLUMN used_account_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_bonuses_transaction_id ON bonuses (transaction_id);
@@ -0,0 +1,8 @@
+-- Ограничения на бонусы: бюджет кампании и уже выданная по ней сумма, источник бонуса
+-- для лимитов на пользователя.
+
+ALTER TABLE campaigns ADD COLUMN budget_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE campaigns ADD COLUMN spent_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE campaigns ADD COLUMN budget_currency TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE bonuses ADD COLUMN source TEXT NOT NULL DEFAULT '';
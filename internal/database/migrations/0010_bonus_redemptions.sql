@@ -0,0 +1,18 @@
+-- Частичное использование бонусов: неиспользованный остаток бонуса и история использований.
+-- До этой миграции бонус использовался целиком, поэтому остаток использованного — ноль.
+
+ALTER TABLE bonuses ADD COLUMN remaining_minor BIGINT NOT NULL DEFAULT 0;
+UPDATE bonuses SET remaining_minor = amount_minor WHERE status <> 'used';
+
+CREATE TABLE bonus_redemptions (
+    id             TEXT PRIMARY KEY,
+    bonus_id       TEXT NOT NULL,
+    user_id        TEXT NOT NULL,
+    account_id     TEXT NOT NULL,
+    transaction_id TEXT NOT NULL,
+    amount_minor   BIGINT NOT NULL,
+    currency       TEXT NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_bonus_redemptions_bonus_id ON bonus_redemptions (bonus_id);
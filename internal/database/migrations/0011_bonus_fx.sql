@@ -0,0 +1,8 @@
+-- Использование бонуса на счёт в другой валюте: сколько зачислено в валюте счёта и по какому курсу.
+-- Раньше бонус зачислялся только в своей валюте, поэтому зачисленное равно списанному.
+
+ALTER TABLE bonus_redemptions ADD COLUMN credited_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE bonus_redemptions ADD COLUMN credited_currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE bonus_redemptions ADD COLUMN rate TEXT NOT NULL DEFAULT '';
+
+UPDATE bonus_redemptions SET credited_minor = amount_minor, credited_currency = currency;
@@ -0,0 +1,23 @@
+-- Реферальная программа: у пользователя один код, у приглашённого одно приглашение.
+
+CREATE TABLE referral_codes (
+    user_id    TEXT PRIMARY KEY,
+    code       TEXT NOT NULL UNIQUE,
+    device_id  TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE referrals (
+    referee_id     TEXT PRIMARY KEY,
+    referrer_id    TEXT NOT NULL,
+    code           TEXT NOT NULL,
+    status         TEXT NOT NULL,
+    reject_reason  TEXT NOT NULL DEFAULT '',
+    device_id      TEXT NOT NULL DEFAULT '',
+    transaction_id TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL,
+    qualified_at   TIMESTAMPTZ,
+    version        BIGINT NOT NULL DEFAULT 1
+);
+
+CREATE INDEX idx_referrals_referrer_id ON referrals (referrer_id);
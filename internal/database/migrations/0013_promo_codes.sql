@@ -0,0 +1,30 @@
+-- Промокоды на бонусы: счётчик погашений живёт в строке кода и меняется с проверкой версии,
+-- поэтому параллельные погашения одного кода не превысят лимит.
+
+CREATE TABLE promo_codes (
+    code            TEXT PRIMARY KEY,
+    batch_id        TEXT NOT NULL,
+    reward_minor    BIGINT NOT NULL,
+    currency        TEXT NOT NULL,
+    bonus_type      TEXT NOT NULL,
+    expires_in_days INTEGER NOT NULL,
+    max_redemptions INTEGER NOT NULL,
+    per_user_limit  INTEGER NOT NULL,
+    redemptions     INTEGER NOT NULL DEFAULT 0,
+    starts_at       TIMESTAMPTZ,
+    ends_at         TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL,
+    version         BIGINT NOT NULL DEFAULT 1
+);
+
+CREATE INDEX idx_promo_codes_batch_id ON promo_codes (batch_id);
+
+CREATE TABLE promo_redemptions (
+    id         TEXT PRIMARY KEY,
+    code       TEXT NOT NULL,
+    user_id    TEXT NOT NULL,
+    bonus_id   TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_promo_redemptions_code ON promo_redemptions (code);
@@ -0,0 +1,21 @@
+-- Программа лояльности: баланс баллов меняется с проверкой версии, поэтому параллельный обмен
+-- не потратит одни и те же баллы дважды; журнал движений хранит историю для расчёта уровня.
+
+CREATE TABLE loyalty_accounts (
+    user_id    TEXT PRIMARY KEY,
+    points     BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL,
+    version    BIGINT NOT NULL DEFAULT 1
+);
+
+CREATE TABLE points_entries (
+    id             TEXT PRIMARY KEY,
+    user_id        TEXT NOT NULL,
+    kind           TEXT NOT NULL,
+    points         BIGINT NOT NULL,
+    transaction_id TEXT NOT NULL DEFAULT '',
+    bonus_id       TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_points_entries_user_id ON points_entries (user_id, created_at);
@@ -0,0 +1,7 @@
+-- История операций счёта читается страницами по (created_at, id): индексы по каждой стороне
+-- операции отдают её уже упорядоченной, без сортировки всей истории счёта.
+
+CREATE INDEX idx_transactions_from_account_created ON transactions (from_account, created_at, id);
+CREATE INDEX idx_transactions_to_account_created ON transactions (to_account, created_at, id);
+DROP INDEX idx_transactions_from_account;
+DROP INDEX idx_transactions_to_account;
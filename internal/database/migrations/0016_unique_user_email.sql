@@ -0,0 +1,7 @@
+-- Email пользователя уникален без учёта регистра: сервис хранит его в нижнем регистре, а уникальный
+-- индекс не даёт двум параллельным регистрациям занять один адрес. Если после приведения к нижнему
+-- регистру в базе окажутся одинаковые адреса, миграция упадёт: дубликаты нужно разобрать вручную.
+
+UPDATE users SET email = LOWER(TRIM(email));
+DROP INDEX idx_users_email;
+CREATE UNIQUE INDEX idx_users_email ON users (email);
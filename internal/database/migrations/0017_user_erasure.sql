@@ -0,0 +1,17 @@
+-- Удаление пользователя: счета закрываются, а не удаляются — на них ссылаются операции и проводки,
+-- которые хранятся установленный законом срок; персональные данные пользователя обезличиваются,
+-- а сертификат удаления фиксирует, что именно сделано.
+
+ALTER TABLE accounts ADD COLUMN status TEXT NOT NULL DEFAULT 'open';
+ALTER TABLE accounts ADD COLUMN closed_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN erased_at TIMESTAMPTZ;
+
+CREATE TABLE erasure_certificates (
+    user_id      TEXT PRIMARY KEY,
+    id           TEXT NOT NULL UNIQUE,
+    requested_by TEXT NOT NULL,
+    records      TEXT NOT NULL,
+    erased_at    TIMESTAMPTZ NOT NULL,
+    retain_until TIMESTAMPTZ NOT NULL,
+    digest       TEXT NOT NULL
+);
@@ -0,0 +1,4 @@
+-- Поколение токенов пользователя: растёт при смене пароля, и выданные раньше токены
+-- доступа и обновления перестают приниматься.
+
+ALTER TABLE users ADD COLUMN token_generation BIGINT NOT NULL DEFAULT 0;
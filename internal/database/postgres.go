@@ -0,0 +1,55 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+var postgresDialect = &dialect{
+	numberedPlaceholders: true,
+	lockSuffix:           " FOR UPDATE",
+	// произвольный ключ advisory-блокировки, общий для всех экземпляров сервиса
+	migrationLock: "SELECT pg_advisory_xact_lock(7355608)",
+	isUniqueViolation: func(err error) bool {
+		var pgErr *pgconn.PgError
+		return errors.As(err, &pgErr) && pgErr.Code == "23505"
+	},
+}
+
+// PostgresDB реализация Database поверх PostgreSQL
+type PostgresDB struct {
+	*sqlStore
+	conn *sql.DB
+}
+
+// NewPostgresDB подключается к PostgreSQL по DSN и применяет миграции схемы
+func NewPostgresDB(dsn string) (*PostgresDB, error) {
+	conn, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := migrate(conn, postgresDialect); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &PostgresDB{
+		sqlStore: &sqlStore{q: conn, dialect: postgresDialect},
+		conn:     conn,
+	}, nil
+}
+
+// RunInTx выполняет fn в транзакции PostgreSQL; счета, прочитанные внутри, блокируются FOR UPDATE
+func (db *PostgresDB) RunInTx(fn func(tx Tx) error) error {
+	return runSQLTx(db.conn, postgresDialect, fn)
+}
+
+func (db *PostgresDB) Close() error {
+	return db.conn.Close()
+}
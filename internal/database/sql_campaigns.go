@@ -0,0 +1,84 @@
+package database
+
+import (
+	"encoding/json"
+
+	"petProjectMike/internal/models"
+)
+
+// campaignRules условия кампании хранятся одним JSON-столбцом: они читаются только целиком
+type campaignRules struct {
+	Triggers   []string                  `json:"triggers"`
+	Conditions models.CampaignConditions `json:"conditions"`
+	Reward     models.CampaignReward     `json:"reward"`
+}
+
+// Бюджет и потраченное хранятся числами, потраченное — в валюте бюджета: его меняет каждое начисление
+const campaignColumns = "id, name, active, priority, rules, budget_minor, spent_minor, budget_currency, created_at, updated_at, version"
+
+func scanCampaign(row rowScanner) (*models.Campaign, error) {
+	var c models.Campaign
+	var rules string
+	var budget, spent int64
+	var currency string
+	if err := row.Scan(&c.ID, &c.Name, &c.Active, &c.Priority, &rules, &budget, &spent, &currency,
+		timeOf(&c.CreatedAt), timeOf(&c.UpdatedAt), &c.Version); err != nil {
+		return nil, err
+	}
+	if currency != "" {
+		c.Budget, c.Spent = models.NewMoney(budget, currency), models.NewMoney(spent, currency)
+	}
+	var decoded campaignRules
+	if err := json.Unmarshal([]byte(rules), &decoded); err != nil {
+		return nil, err
+	}
+	c.Triggers, c.Conditions, c.Reward = decoded.Triggers, decoded.Conditions, decoded.Reward
+	return &c, nil
+}
+
+func encodeCampaignRules(c *models.Campaign) (string, error) {
+	data, err := json.Marshal(campaignRules{Triggers: c.Triggers, Conditions: c.Conditions, Reward: c.Reward})
+	return string(data), err
+}
+
+func (s *sqlStore) CreateCampaign(campaign *models.Campaign) error {
+	rules, err := encodeCampaignRules(campaign)
+	if err != nil {
+		return err
+	}
+	initVersion(&campaign.Version)
+	return s.insert("campaign",
+		"INSERT INTO campaigns ("+campaignColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		campaign.ID, campaign.Name, campaign.Active, campaign.Priority, rules,
+		campaign.Budget.Minor, campaign.Spent.Minor, campaign.Budget.Currency,
+		s.ts(campaign.CreatedAt), s.ts(campaign.UpdatedAt), campaign.Version)
+}
+
+func (s *sqlStore) GetCampaign(id string) (*models.Campaign, error) {
+	campaign, err := scanCampaign(s.queryRow("SELECT "+campaignColumns+" FROM campaigns WHERE id = ?", id))
+	if err != nil {
+		return nil, notFound("campaign", err)
+	}
+	return campaign, nil
+}
+
+func (s *sqlStore) ListCampaigns() ([]*models.Campaign, error) {
+	rows, err := s.query("SELECT " + campaignColumns + " FROM campaigns ORDER BY id")
+	return scanAll(rows, err, scanCampaign)
+}
+
+func (s *sqlStore) UpdateCampaign(campaign *models.Campaign) error {
+	rules, err := encodeCampaignRules(campaign)
+	if err != nil {
+		return err
+	}
+	result, err := s.exec("UPDATE campaigns SET name = ?, active = ?, priority = ?, rules = ?, budget_minor = ?, spent_minor = ?, budget_currency = ?, created_at = ?, updated_at = ?, version = version + 1 WHERE id = ? AND version = ?",
+		campaign.Name, campaign.Active, campaign.Priority, rules, campaign.Budget.Minor, campaign.Spent.Minor, campaign.Budget.Currency,
+		s.ts(campaign.CreatedAt), s.ts(campaign.UpdatedAt), campaign.ID, campaign.Version)
+	return s.versioned("campaign", "campaigns", campaign.ID, &campaign.Version, result, err)
+}
+
+func (s *sqlStore) DeleteCampaign(id string) error {
+	result, err := s.exec("DELETE FROM campaigns WHERE id = ?", id)
+	return mustAffect("campaign", result, err)
+}
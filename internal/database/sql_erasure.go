@@ -0,0 +1,50 @@
+package database
+
+import (
+	"encoding/json"
+
+	"petProjectMike/internal/models"
+)
+
+// erasureRecords списки из сертификата удаления хранятся одним JSON-столбцом: они читаются только целиком
+type erasureRecords struct {
+	ClosedAccounts []string `json:"closed_accounts"`
+	ExpiredBonuses []string `json:"expired_bonuses"`
+	ErasedFields   []string `json:"erased_fields"`
+}
+
+const erasureColumns = "user_id, id, requested_by, records, erased_at, retain_until, digest"
+
+func scanErasureCertificate(row rowScanner) (*models.ErasureCertificate, error) {
+	var c models.ErasureCertificate
+	var records string
+	if err := row.Scan(&c.UserID, &c.ID, &c.RequestedBy, &records, timeOf(&c.ErasedAt), timeOf(&c.RetainUntil), &c.Digest); err != nil {
+		return nil, err
+	}
+	var decoded erasureRecords
+	if err := json.Unmarshal([]byte(records), &decoded); err != nil {
+		return nil, err
+	}
+	c.ClosedAccounts, c.ExpiredBonuses, c.ErasedFields = decoded.ClosedAccounts, decoded.ExpiredBonuses, decoded.ErasedFields
+	return &c, nil
+}
+
+func (s *sqlStore) CreateErasureCertificate(certificate *models.ErasureCertificate) error {
+	records, err := json.Marshal(erasureRecords{ClosedAccounts: certificate.ClosedAccounts,
+		ExpiredBonuses: certificate.ExpiredBonuses, ErasedFields: certificate.ErasedFields})
+	if err != nil {
+		return err
+	}
+	return s.insert("erasure certificate",
+		"INSERT INTO erasure_certificates ("+erasureColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		certificate.UserID, certificate.ID, certificate.RequestedBy, string(records),
+		s.ts(certificate.ErasedAt), s.ts(certificate.RetainUntil), certificate.Digest)
+}
+
+func (s *sqlStore) GetErasureCertificate(userID string) (*models.ErasureCertificate, error) {
+	certificate, err := scanErasureCertificate(s.queryRow("SELECT "+erasureColumns+" FROM erasure_certificates WHERE user_id = ?", userID))
+	if err != nil {
+		return nil, notFound("erasure certificate", err)
+	}
+	return certificate, nil
+}
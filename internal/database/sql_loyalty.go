@@ -0,0 +1,63 @@
+package database
+
+import "petProjectMike/internal/models"
+
+const loyaltyAccountColumns = "user_id, points, updated_at, version"
+
+func scanLoyaltyAccount(row rowScanner) (*models.LoyaltyAccount, error) {
+	var a models.LoyaltyAccount
+	if err := row.Scan(&a.UserID, &a.Points, timeOf(&a.UpdatedAt), &a.Version); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *sqlStore) CreateLoyaltyAccount(account *models.LoyaltyAccount) error {
+	initVersion(&account.Version)
+	return s.insert("loyalty account",
+		"INSERT INTO loyalty_accounts ("+loyaltyAccountColumns+") VALUES (?, ?, ?, ?)",
+		account.UserID, account.Points, s.ts(account.UpdatedAt), account.Version)
+}
+
+func (s *sqlStore) GetLoyaltyAccount(userID string) (*models.LoyaltyAccount, error) {
+	account, err := scanLoyaltyAccount(s.queryRow("SELECT "+loyaltyAccountColumns+" FROM loyalty_accounts WHERE user_id = ?", userID))
+	if err != nil {
+		return nil, notFound("loyalty account", err)
+	}
+	return account, nil
+}
+
+func (s *sqlStore) UpdateLoyaltyAccount(account *models.LoyaltyAccount) error {
+	result, err := s.exec("UPDATE loyalty_accounts SET points = ?, updated_at = ?, version = version + 1 WHERE user_id = ? AND version = ?",
+		account.Points, s.ts(account.UpdatedAt), account.UserID, account.Version)
+	return s.versionedBy("loyalty account", "loyalty_accounts", "user_id", account.UserID, &account.Version, result, err)
+}
+
+const pointsEntryColumns = "id, user_id, kind, points, transaction_id, bonus_id, created_at"
+
+func scanPointsEntry(row rowScanner) (*models.PointsEntry, error) {
+	var e models.PointsEntry
+	if err := row.Scan(&e.ID, &e.UserID, &e.Kind, &e.Points, &e.TransactionID, &e.BonusID, timeOf(&e.CreatedAt)); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *sqlStore) CreatePointsEntry(entry *models.PointsEntry) error {
+	return s.insert("points entry",
+		"INSERT INTO points_entries ("+pointsEntryColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		entry.ID, entry.UserID, entry.Kind, entry.Points, entry.TransactionID, entry.BonusID, s.ts(entry.CreatedAt))
+}
+
+func (s *sqlStore) GetPointsEntry(id string) (*models.PointsEntry, error) {
+	entry, err := scanPointsEntry(s.queryRow("SELECT "+pointsEntryColumns+" FROM points_entries WHERE id = ?", id))
+	if err != nil {
+		return nil, notFound("points entry", err)
+	}
+	return entry, nil
+}
+
+func (s *sqlStore) GetPointsEntriesByUser(userID string) ([]*models.PointsEntry, error) {
+	rows, err := s.query("SELECT "+pointsEntryColumns+" FROM points_entries WHERE user_id = ? ORDER BY created_at, id", userID)
+	return scanAll(rows, err, scanPointsEntry)
+}
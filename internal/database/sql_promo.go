@@ -0,0 +1,66 @@
+package database
+
+import "petProjectMike/internal/models"
+
+const promoCodeColumns = "code, batch_id, reward_minor, currency, bonus_type, expires_in_days, max_redemptions, per_user_limit, redemptions, starts_at, ends_at, created_at, version"
+
+func scanPromoCode(row rowScanner) (*models.PromoCode, error) {
+	var c models.PromoCode
+	if err := row.Scan(&c.Code, &c.BatchID, &c.Reward.Minor, &c.Reward.Currency, &c.BonusType, &c.ExpiresInDays,
+		&c.MaxRedemptions, &c.PerUserLimit, &c.Redemptions, nullTimeOf(&c.StartsAt), nullTimeOf(&c.EndsAt),
+		timeOf(&c.CreatedAt), &c.Version); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *sqlStore) CreatePromoCode(code *models.PromoCode) error {
+	initVersion(&code.Version)
+	return s.insert("promo code",
+		"INSERT INTO promo_codes ("+promoCodeColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		code.Code, code.BatchID, code.Reward.Minor, code.Reward.Currency, code.BonusType, code.ExpiresInDays,
+		code.MaxRedemptions, code.PerUserLimit, code.Redemptions, s.nullTs(code.StartsAt), s.nullTs(code.EndsAt),
+		s.ts(code.CreatedAt), code.Version)
+}
+
+func (s *sqlStore) GetPromoCode(code string) (*models.PromoCode, error) {
+	found, err := scanPromoCode(s.queryRow("SELECT "+promoCodeColumns+" FROM promo_codes WHERE code = ?", code))
+	if err != nil {
+		return nil, notFound("promo code", err)
+	}
+	return found, nil
+}
+
+func (s *sqlStore) GetPromoCodesByBatch(batchID string) ([]*models.PromoCode, error) {
+	rows, err := s.query("SELECT "+promoCodeColumns+" FROM promo_codes WHERE batch_id = ? ORDER BY code", batchID)
+	return scanAll(rows, err, scanPromoCode)
+}
+
+func (s *sqlStore) UpdatePromoCode(code *models.PromoCode) error {
+	result, err := s.exec("UPDATE promo_codes SET batch_id = ?, reward_minor = ?, currency = ?, bonus_type = ?, expires_in_days = ?, max_redemptions = ?, per_user_limit = ?, redemptions = ?, starts_at = ?, ends_at = ?, created_at = ?, version = version + 1 WHERE code = ? AND version = ?",
+		code.BatchID, code.Reward.Minor, code.Reward.Currency, code.BonusType, code.ExpiresInDays, code.MaxRedemptions,
+		code.PerUserLimit, code.Redemptions, s.nullTs(code.StartsAt), s.nullTs(code.EndsAt), s.ts(code.CreatedAt),
+		code.Code, code.Version)
+	return s.versionedBy("promo code", "promo_codes", "code", code.Code, &code.Version, result, err)
+}
+
+const promoRedemptionColumns = "id, code, user_id, bonus_id, created_at"
+
+func scanPromoRedemption(row rowScanner) (*models.PromoRedemption, error) {
+	var r models.PromoRedemption
+	if err := row.Scan(&r.ID, &r.Code, &r.UserID, &r.BonusID, timeOf(&r.CreatedAt)); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *sqlStore) CreatePromoRedemption(redemption *models.PromoRedemption) error {
+	return s.insert("promo redemption",
+		"INSERT INTO promo_redemptions ("+promoRedemptionColumns+") VALUES (?, ?, ?, ?, ?)",
+		redemption.ID, redemption.Code, redemption.UserID, redemption.BonusID, s.ts(redemption.CreatedAt))
+}
+
+func (s *sqlStore) GetPromoRedemptions(code string) ([]*models.PromoRedemption, error) {
+	rows, err := s.query("SELECT "+promoRedemptionColumns+" FROM promo_redemptions WHERE code = ? ORDER BY created_at, id", code)
+	return scanAll(rows, err, scanPromoRedemption)
+}
@@ -0,0 +1,27 @@
+package database
+
+import "petProjectMike/internal/models"
+
+const redemptionColumns = "id, bonus_id, user_id, account_id, transaction_id, amount_minor, currency, credited_minor, credited_currency, rate, created_at"
+
+func scanRedemption(row rowScanner) (*models.BonusRedemption, error) {
+	var r models.BonusRedemption
+	if err := row.Scan(&r.ID, &r.BonusID, &r.UserID, &r.AccountID, &r.TransactionID, &r.Amount.Minor, &r.Amount.Currency,
+		&r.Credited.Minor, &r.Credited.Currency, &r.Rate, timeOf(&r.CreatedAt)); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *sqlStore) CreateBonusRedemption(redemption *models.BonusRedemption) error {
+	credited := redemption.Payout()
+	return s.insert("bonus redemption",
+		"INSERT INTO bonus_redemptions ("+redemptionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		redemption.ID, redemption.BonusID, redemption.UserID, redemption.AccountID, redemption.TransactionID,
+		redemption.Amount.Minor, redemption.Amount.Currency, credited.Minor, credited.Currency, redemption.Rate, s.ts(redemption.CreatedAt))
+}
+
+func (s *sqlStore) GetBonusRedemptions(bonusID string) ([]*models.BonusRedemption, error) {
+	rows, err := s.query("SELECT "+redemptionColumns+" FROM bonus_redemptions WHERE bonus_id = ? ORDER BY created_at, id", bonusID)
+	return scanAll(rows, err, scanRedemption)
+}
@@ -0,0 +1,81 @@
+package database
+
+import "petProjectMike/internal/models"
+
+const referralCodeColumns = "user_id, code, device_id, created_at"
+
+func scanReferralCode(row rowScanner) (*models.ReferralCode, error) {
+	var c models.ReferralCode
+	if err := row.Scan(&c.UserID, &c.Code, &c.DeviceID, timeOf(&c.CreatedAt)); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *sqlStore) CreateReferralCode(code *models.ReferralCode) error {
+	return s.insert("referral code",
+		"INSERT INTO referral_codes ("+referralCodeColumns+") VALUES (?, ?, ?, ?)",
+		code.UserID, code.Code, code.DeviceID, s.ts(code.CreatedAt))
+}
+
+func (s *sqlStore) GetReferralCode(userID string) (*models.ReferralCode, error) {
+	code, err := scanReferralCode(s.queryRow("SELECT "+referralCodeColumns+" FROM referral_codes WHERE user_id = ?", userID))
+	if err != nil {
+		return nil, notFound("referral code", err)
+	}
+	return code, nil
+}
+
+func (s *sqlStore) GetReferralCodeByCode(code string) (*models.ReferralCode, error) {
+	found, err := scanReferralCode(s.queryRow("SELECT "+referralCodeColumns+" FROM referral_codes WHERE code = ?", code))
+	if err != nil {
+		return nil, notFound("referral code", err)
+	}
+	return found, nil
+}
+
+func (s *sqlStore) UpdateReferralCode(code *models.ReferralCode) error {
+	result, err := s.exec("UPDATE referral_codes SET code = ?, device_id = ?, created_at = ? WHERE user_id = ?",
+		code.Code, code.DeviceID, s.ts(code.CreatedAt), code.UserID)
+	return mustAffect("referral code", result, err)
+}
+
+// Время подтверждения пустое, пока приглашённый не пополнил счёт
+const referralColumns = "referee_id, referrer_id, code, status, reject_reason, device_id, transaction_id, created_at, qualified_at, version"
+
+func scanReferral(row rowScanner) (*models.Referral, error) {
+	var r models.Referral
+	if err := row.Scan(&r.RefereeID, &r.ReferrerID, &r.Code, &r.Status, &r.RejectReason, &r.DeviceID, &r.TransactionID,
+		timeOf(&r.CreatedAt), nullTimeOf(&r.QualifiedAt), &r.Version); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *sqlStore) CreateReferral(referral *models.Referral) error {
+	initVersion(&referral.Version)
+	return s.insert("referral",
+		"INSERT INTO referrals ("+referralColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		referral.RefereeID, referral.ReferrerID, referral.Code, referral.Status, referral.RejectReason, referral.DeviceID,
+		referral.TransactionID, s.ts(referral.CreatedAt), s.nullTs(referral.QualifiedAt), referral.Version)
+}
+
+func (s *sqlStore) GetReferral(refereeID string) (*models.Referral, error) {
+	referral, err := scanReferral(s.queryRow("SELECT "+referralColumns+" FROM referrals WHERE referee_id = ?", refereeID))
+	if err != nil {
+		return nil, notFound("referral", err)
+	}
+	return referral, nil
+}
+
+func (s *sqlStore) GetReferralsByReferrer(referrerID string) ([]*models.Referral, error) {
+	rows, err := s.query("SELECT "+referralColumns+" FROM referrals WHERE referrer_id = ? ORDER BY created_at, referee_id", referrerID)
+	return scanAll(rows, err, scanReferral)
+}
+
+func (s *sqlStore) UpdateReferral(referral *models.Referral) error {
+	result, err := s.exec("UPDATE referrals SET referrer_id = ?, code = ?, status = ?, reject_reason = ?, device_id = ?, transaction_id = ?, created_at = ?, qualified_at = ?, version = version + 1 WHERE referee_id = ? AND version = ?",
+		referral.ReferrerID, referral.Code, referral.Status, referral.RejectReason, referral.DeviceID, referral.TransactionID,
+		s.ts(referral.CreatedAt), s.nullTs(referral.QualifiedAt), referral.RefereeID, referral.Version)
+	return s.versionedBy("referral", "referrals", "referee_id", referral.RefereeID, &referral.Version, result, err)
+}
@@ -0,0 +1,612 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"petProjectMike/internal/models"
+)
+
+// queryer общий набор методов *sql.DB и *sql.Tx
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// dialect различия SQL-движков, которые важны для хранилища
+type dialect struct {
+	// numberedPlaceholders — плейсхолдеры вида $1, $2 вместо ?
+	numberedPlaceholders bool
+	// lockSuffix дописывается к SELECT счёта внутри транзакции (строчная блокировка)
+	lockSuffix string
+	// migrationLock выполняется в транзакции миграций, чтобы два процесса не мигрировали одновременно
+	migrationLock string
+	// isUniqueViolation распознаёт нарушение первичного ключа/уникального индекса
+	isUniqueViolation func(err error) bool
+	// encodeTime преобразует время в значение для записи; nil — передать time.Time как есть
+	encodeTime func(t time.Time) any
+}
+
+// sqlStore реализация Store поверх database/sql; используется и для базы, и для транзакции
+type sqlStore struct {
+	q       queryer
+	dialect *dialect
+	// inTx — хранилище работает внутри транзакции и может блокировать строки
+	inTx bool
+}
+
+// rebind заменяет ? на плейсхолдеры диалекта
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numberedPlaceholders {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *sqlStore) exec(query string, args ...any) (sql.Result, error) {
+	return s.q.Exec(s.rebind(query), args...)
+}
+
+func (s *sqlStore) query(query string, args ...any) (*sql.Rows, error) {
+	return s.q.Query(s.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(query string, args ...any) *sql.Row {
+	return s.q.QueryRow(s.rebind(query), args...)
+}
+
+// insert выполняет INSERT и переводит нарушение ключа в ошибку "already exists"
+func (s *sqlStore) insert(entity, query string, args ...any) error {
+	_, err := s.exec(query, args...)
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return errAlreadyExists(entity)
+	}
+	return err
+}
+
+// mustAffect проверяет, что UPDATE/DELETE затронул строку
+func mustAffect(entity string, result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotFound(entity)
+	}
+	return nil
+}
+
+// versioned проверяет UPDATE ... AND version = ?: если строка не изменилась, отличает
+// отсутствующую запись от записи, которую успели изменить, и увеличивает версию у вызывающего
+func (s *sqlStore) versioned(entity, table, id string, version *int64, result sql.Result, err error) error {
+	return s.versionedBy(entity, table, "id", id, version, result, err)
+}
+
+// versionedBy то же, что versioned, для таблицы с ключом в столбце key
+func (s *sqlStore) versionedBy(entity, table, key, id string, version *int64, result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists int
+		if err := s.queryRow("SELECT 1 FROM "+table+" WHERE "+key+" = ?", id).Scan(&exists); err != nil {
+			return notFound(entity, err)
+		}
+		return ErrConflict
+	}
+	*version++
+	return nil
+}
+
+func notFound(entity string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNotFound(entity)
+	}
+	return err
+}
+
+// ts готовит время к записи: всегда в UTC, чтобы чтение не зависело от часового пояса сервера
+func (s *sqlStore) ts(t time.Time) any {
+	if s.dialect.encodeTime != nil {
+		return s.dialect.encodeTime(t.UTC())
+	}
+	return t.UTC()
+}
+
+// nullTs готовит к записи необязательное время; пустое записывается как NULL
+func (s *sqlStore) nullTs(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return s.ts(*t)
+}
+
+// sortableTimeLayout время фиксированной ширины: строки сравниваются так же, как моменты времени
+const sortableTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// timeColumn читает время независимо от того, как драйвер его вернул:
+// PostgreSQL отдаёт time.Time, SQLite — строку
+type timeColumn struct {
+	dest *time.Time
+}
+
+func (c timeColumn) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		*c.dest = v.UTC()
+		return nil
+	case string:
+		return c.parse(v)
+	case []byte:
+		return c.parse(string(v))
+	}
+	return fmt.Errorf("cannot scan %T into time.Time", src)
+}
+
+func (c timeColumn) parse(value string) error {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return fmt.Errorf("cannot parse time %q: %w", value, err)
+	}
+	*c.dest = t.UTC()
+	return nil
+}
+
+func timeOf(dest *time.Time) timeColumn {
+	return timeColumn{dest: dest}
+}
+
+// nullTimeColumn читает необязательное время: NULL оставляет указатель пустым
+type nullTimeColumn struct {
+	dest **time.Time
+}
+
+func (c nullTimeColumn) Scan(src any) error {
+	if src == nil {
+		*c.dest = nil
+		return nil
+	}
+	var t time.Time
+	if err := timeOf(&t).Scan(src); err != nil {
+		return err
+	}
+	*c.dest = &t
+	return nil
+}
+
+func nullTimeOf(dest **time.Time) nullTimeColumn {
+	return nullTimeColumn{dest: dest}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanAll читает все строки выборки с помощью scan
+func scanAll[T any](rows *sql.Rows, err error, scan func(rowScanner) (*T, error)) ([]*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []*T
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+// Account
+const accountColumns = "id, user_id, balance_minor, currency, status, closed_at, created_at, updated_at, version"
+
+func scanAccount(row rowScanner) (*models.Account, error) {
+	var a models.Account
+	if err := row.Scan(&a.ID, &a.UserID, &a.Balance.Minor, &a.Currency, &a.Status, nullTimeOf(&a.ClosedAt),
+		timeOf(&a.CreatedAt), timeOf(&a.UpdatedAt), &a.Version); err != nil {
+		return nil, err
+	}
+	a.Balance.Currency = a.Currency
+	return &a, nil
+}
+
+func (s *sqlStore) CreateAccount(account *models.Account) error {
+	initVersion(&account.Version)
+	return s.insert("account",
+		"INSERT INTO accounts ("+accountColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		account.ID, account.UserID, account.Balance.Minor, account.Currency, account.Status, s.nullTs(account.ClosedAt),
+		s.ts(account.CreatedAt), s.ts(account.UpdatedAt), account.Version)
+}
+
+func (s *sqlStore) GetAccount(id string) (*models.Account, error) {
+	query := "SELECT " + accountColumns + " FROM accounts WHERE id = ?"
+	if s.inTx {
+		// внутри транзакции счёт читается для изменения баланса — блокируем строку до коммита
+		query += s.dialect.lockSuffix
+	}
+	account, err := scanAccount(s.queryRow(query, id))
+	if err != nil {
+		return nil, notFound("account", err)
+	}
+	return account, nil
+}
+
+func (s *sqlStore) GetAccountsByUserID(userID string) ([]*models.Account, error) {
+	rows, err := s.query("SELECT "+accountColumns+" FROM accounts WHERE user_id = ? ORDER BY created_at, id", userID)
+	return scanAll(rows, err, scanAccount)
+}
+
+func (s *sqlStore) UpdateAccount(account *models.Account) error {
+	result, err := s.exec("UPDATE accounts SET user_id = ?, balance_minor = ?, currency = ?, status = ?, closed_at = ?, created_at = ?, updated_at = ?, version = version + 1 WHERE id = ? AND version = ?",
+		account.UserID, account.Balance.Minor, account.Currency, account.Status, s.nullTs(account.ClosedAt),
+		s.ts(account.CreatedAt), s.ts(account.UpdatedAt), account.ID, account.Version)
+	return s.versioned("account", "accounts", account.ID, &account.Version, result, err)
+}
+
+func (s *sqlStore) DeleteAccount(id string) error {
+	result, err := s.exec("DELETE FROM accounts WHERE id = ?", id)
+	return mustAffect("account", result, err)
+}
+
+// LockAccounts блокирует строки счетов до конца транзакции (SELECT ... ORDER BY id FOR UPDATE).
+// Если у диалекта нет строчных блокировок (SQLite держит блокировку всей базы), ничего не делает.
+func (s *sqlStore) LockAccounts(ids ...string) error {
+	ids = lockOrder(ids)
+	if !s.inTx || s.dialect.lockSuffix == "" || len(ids) == 0 {
+		return nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	rows, err := s.query("SELECT id FROM accounts WHERE id IN ("+placeholders+") ORDER BY id"+s.dialect.lockSuffix, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		// сами строки не нужны: блокировка берётся при их выборке
+	}
+	return rows.Err()
+}
+
+// Transaction
+const transactionColumns = "id, from_account, to_account, amount_minor, currency, type, status, description, created_at, updated_at, version"
+
+func scanTransaction(row rowScanner) (*models.Transaction, error) {
+	var t models.Transaction
+	if err := row.Scan(&t.ID, &t.FromAccount, &t.ToAccount, &t.Amount.Minor, &t.Amount.Currency,
+		&t.Type, &t.Status, &t.Description, timeOf(&t.CreatedAt), timeOf(&t.UpdatedAt), &t.Version); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *sqlStore) CreateTransaction(transaction *models.Transaction) error {
+	initVersion(&transaction.Version)
+	return s.insert("transaction",
+		"INSERT INTO transactions ("+transactionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		transaction.ID, transaction.FromAccount, transaction.ToAccount, transaction.Amount.Minor, transaction.Amount.Currency,
+		transaction.Type, transaction.Status, transaction.Description, s.ts(transaction.CreatedAt), s.ts(transaction.UpdatedAt), transaction.Version)
+}
+
+func (s *sqlStore) GetTransaction(id string) (*models.Transaction, error) {
+	transaction, err := scanTransaction(s.queryRow("SELECT "+transactionColumns+" FROM transactions WHERE id = ?", id))
+	if err != nil {
+		return nil, notFound("transaction", err)
+	}
+	return transaction, nil
+}
+
+func (s *sqlStore) GetTransactionsByAccount(accountID string) ([]*models.Transaction, error) {
+	rows, err := s.query("SELECT "+transactionColumns+" FROM transactions WHERE from_account = ? OR to_account = ? ORDER BY created_at, id",
+		accountID, accountID)
+	return scanAll(rows, err, scanTransaction)
+}
+
+func (s *sqlStore) QueryTransactions(query TransactionQuery) ([]*models.Transaction, error) {
+	where := []string{"(from_account = ? OR to_account = ?)"}
+	args := []any{query.AccountID, query.AccountID}
+	if len(query.Types) > 0 {
+		where = append(where, "type IN ("+placeholders(len(query.Types))+")")
+		for _, t := range query.Types {
+			args = append(args, t)
+		}
+	}
+	if len(query.Statuses) > 0 {
+		where = append(where, "status IN ("+placeholders(len(query.Statuses))+")")
+		for _, status := range query.Statuses {
+			args = append(args, status)
+		}
+	}
+	if query.Since != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, s.ts(*query.Since))
+	}
+	if query.Until != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, s.ts(*query.Until))
+	}
+	if query.MinAmount != (models.Money{}) {
+		where = append(where, "amount_minor >= ?")
+		args = append(args, query.MinAmount.Minor)
+	}
+	if query.MaxAmount != (models.Money{}) {
+		where = append(where, "amount_minor <= ?")
+		args = append(args, query.MaxAmount.Minor)
+	}
+	if query.Counterparty != "" {
+		where = append(where, "((from_account = ? AND to_account = ?) OR (to_account = ? AND from_account = ?))")
+		args = append(args, query.AccountID, query.Counterparty, query.AccountID, query.Counterparty)
+	}
+	order, after := "ASC", ">"
+	if query.Descending {
+		order, after = "DESC", "<"
+	}
+	if query.After != nil {
+		at := s.ts(query.After.CreatedAt)
+		where = append(where, "(created_at "+after+" ? OR (created_at = ? AND id "+after+" ?))")
+		args = append(args, at, at, query.After.ID)
+	}
+	sqlQuery := "SELECT " + transactionColumns + " FROM transactions WHERE " + strings.Join(where, " AND ") +
+		" ORDER BY created_at " + order + ", id " + order
+	if query.Limit > 0 {
+		sqlQuery += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+	rows, err := s.query(sqlQuery, args...)
+	return scanAll(rows, err, scanTransaction)
+}
+
+// placeholders список из n параметров для IN (...)
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func (s *sqlStore) UpdateTransaction(transaction *models.Transaction) error {
+	result, err := s.exec("UPDATE transactions SET from_account = ?, to_account = ?, amount_minor = ?, currency = ?, type = ?, status = ?, description = ?, created_at = ?, updated_at = ?, version = version + 1 WHERE id = ? AND version = ?",
+		transaction.FromAccount, transaction.ToAccount, transaction.Amount.Minor, transaction.Amount.Currency,
+		transaction.Type, transaction.Status, transaction.Description, s.ts(transaction.CreatedAt), s.ts(transaction.UpdatedAt), transaction.ID, transaction.Version)
+	return s.versioned("transaction", "transactions", transaction.ID, &transaction.Version, result, err)
+}
+
+func (s *sqlStore) DeleteTransaction(id string) error {
+	result, err := s.exec("DELETE FROM transactions WHERE id = ?", id)
+	return mustAffect("transaction", result, err)
+}
+
+// Bonus: остаток хранится в валюте бонуса
+const bonusColumns = "id, user_id, type, campaign_id, source, transaction_id, used_account_id, amount_minor, remaining_minor, currency, status, expires_at, created_at, version"
+
+func scanBonus(row rowScanner) (*models.Bonus, error) {
+	var b models.Bonus
+	var remaining int64
+	if err := row.Scan(&b.ID, &b.UserID, &b.Type, &b.CampaignID, &b.Source, &b.TransactionID, &b.UsedAccountID, &b.Amount.Minor, &remaining, &b.Amount.Currency, &b.Status, timeOf(&b.ExpiresAt), timeOf(&b.CreatedAt), &b.Version); err != nil {
+		return nil, err
+	}
+	b.RemainingAmount = models.NewMoney(remaining, b.Amount.Currency)
+	return &b, nil
+}
+
+func (s *sqlStore) CreateBonus(bonus *models.Bonus) error {
+	initVersion(&bonus.Version)
+	return s.insert("bonus",
+		"INSERT INTO bonuses ("+bonusColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		bonus.ID, bonus.UserID, bonus.Type, bonus.CampaignID, bonus.Source, bonus.TransactionID, bonus.UsedAccountID, bonus.Amount.Minor, bonus.Remaining().Minor, bonus.Amount.Currency, bonus.Status, s.ts(bonus.ExpiresAt), s.ts(bonus.CreatedAt), bonus.Version)
+}
+
+func (s *sqlStore) GetBonus(id string) (*models.Bonus, error) {
+	bonus, err := scanBonus(s.queryRow("SELECT "+bonusColumns+" FROM bonuses WHERE id = ?", id))
+	if err != nil {
+		return nil, notFound("bonus", err)
+	}
+	return bonus, nil
+}
+
+func (s *sqlStore) GetBonusesByUserID(userID string) ([]*models.Bonus, error) {
+	rows, err := s.query("SELECT "+bonusColumns+" FROM bonuses WHERE user_id = ? ORDER BY created_at, id", userID)
+	return scanAll(rows, err, scanBonus)
+}
+
+func (s *sqlStore) GetBonusesByTransaction(transactionID string) ([]*models.Bonus, error) {
+	rows, err := s.query("SELECT "+bonusColumns+" FROM bonuses WHERE transaction_id = ? ORDER BY id", transactionID)
+	return scanAll(rows, err, scanBonus)
+}
+
+func (s *sqlStore) GetExpiredBonuses(now time.Time) ([]*models.Bonus, error) {
+	rows, err := s.query("SELECT "+bonusColumns+" FROM bonuses WHERE status = 'active' AND expires_at <= ? ORDER BY expires_at, id", s.ts(now))
+	return scanAll(rows, err, scanBonus)
+}
+
+func (s *sqlStore) UpdateBonus(bonus *models.Bonus) error {
+	result, err := s.exec("UPDATE bonuses SET user_id = ?, type = ?, campaign_id = ?, source = ?, transaction_id = ?, used_account_id = ?, amount_minor = ?, remaining_minor = ?, currency = ?, status = ?, expires_at = ?, created_at = ?, version = version + 1 WHERE id = ? AND version = ?",
+		bonus.UserID, bonus.Type, bonus.CampaignID, bonus.Source, bonus.TransactionID, bonus.UsedAccountID, bonus.Amount.Minor, bonus.Remaining().Minor, bonus.Amount.Currency, bonus.Status, s.ts(bonus.ExpiresAt), s.ts(bonus.CreatedAt), bonus.ID, bonus.Version)
+	return s.versioned("bonus", "bonuses", bonus.ID, &bonus.Version, result, err)
+}
+
+func (s *sqlStore) DeleteBonus(id string) error {
+	result, err := s.exec("DELETE FROM bonuses WHERE id = ?", id)
+	return mustAffect("bonus", result, err)
+}
+
+// User
+const userColumns = "id, email, name, role, password_hash, token_generation, created_at, erased_at, version"
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var u models.User
+	if err := row.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.PasswordHash, &u.TokenGeneration, timeOf(&u.CreatedAt), nullTimeOf(&u.ErasedAt), &u.Version); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *sqlStore) CreateUser(user *models.User) error {
+	initVersion(&user.Version)
+	_, err := s.exec("INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		user.ID, user.Email, user.Name, user.Role, user.PasswordHash, user.TokenGeneration, s.ts(user.CreatedAt), s.nullTs(user.ErasedAt), user.Version)
+	switch {
+	case s.isEmailTaken(err):
+		return errEmailTaken()
+	case err != nil && s.dialect.isUniqueViolation(err):
+		return errAlreadyExists("user")
+	}
+	return err
+}
+
+// isEmailTaken нарушен ли уникальный индекс email пользователей. Столбец назван и в ошибке SQLite
+// ("users.email"), и в имени индекса в ошибке PostgreSQL ("idx_users_email")
+func (s *sqlStore) isEmailTaken(err error) bool {
+	return err != nil && s.dialect.isUniqueViolation(err) && strings.Contains(err.Error(), "email")
+}
+
+func (s *sqlStore) GetUser(id string) (*models.User, error) {
+	user, err := scanUser(s.queryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+	if err != nil {
+		return nil, notFound("user", err)
+	}
+	return user, nil
+}
+
+func (s *sqlStore) GetUserByEmail(email string) (*models.User, error) {
+	user, err := scanUser(s.queryRow("SELECT "+userColumns+" FROM users WHERE email = ? ORDER BY id LIMIT 1", email))
+	if err != nil {
+		return nil, notFound("user", err)
+	}
+	return user, nil
+}
+
+func (s *sqlStore) UpdateUser(user *models.User) error {
+	result, err := s.exec("UPDATE users SET email = ?, name = ?, role = ?, password_hash = ?, token_generation = ?, created_at = ?, erased_at = ?, version = version + 1 WHERE id = ? AND version = ?",
+		user.Email, user.Name, user.Role, user.PasswordHash, user.TokenGeneration, s.ts(user.CreatedAt), s.nullTs(user.ErasedAt), user.ID, user.Version)
+	if s.isEmailTaken(err) {
+		return errEmailTaken()
+	}
+	return s.versioned("user", "users", user.ID, &user.Version, result, err)
+}
+
+func (s *sqlStore) DeleteUser(id string) error {
+	result, err := s.exec("DELETE FROM users WHERE id = ?", id)
+	return mustAffect("user", result, err)
+}
+
+// Ledger
+const ledgerEntryColumns = "id, reference, type, description, created_at"
+
+func scanLedgerEntry(row rowScanner) (*models.LedgerEntry, error) {
+	var e models.LedgerEntry
+	if err := row.Scan(&e.ID, &e.Reference, &e.Type, &e.Description, timeOf(&e.CreatedAt)); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func scanPosting(row rowScanner) (*models.Posting, error) {
+	var p models.Posting
+	if err := row.Scan(&p.EntryID, &p.AccountID, &p.Amount.Minor, &p.Amount.Currency); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// atomically выполняет fn в транзакции: запись книги — несколько INSERT, и они не должны сохраниться частично
+func (s *sqlStore) atomically(fn func(store *sqlStore) error) error {
+	conn, ok := s.q.(*sql.DB)
+	if s.inTx || !ok {
+		return fn(s)
+	}
+	return runSQLTx(conn, s.dialect, func(tx Tx) error {
+		return fn(tx.(*sqlStore))
+	})
+}
+
+func (s *sqlStore) CreateLedgerEntry(entry *models.LedgerEntry) error {
+	return s.atomically(func(store *sqlStore) error {
+		if err := store.insert("ledger entry",
+			"INSERT INTO ledger_entries ("+ledgerEntryColumns+") VALUES (?, ?, ?, ?, ?)",
+			entry.ID, entry.Reference, entry.Type, entry.Description, store.ts(entry.CreatedAt)); err != nil {
+			return err
+		}
+		for line, posting := range entry.Postings {
+			if _, err := store.exec("INSERT INTO postings (entry_id, line, account_id, amount_minor, currency) VALUES (?, ?, ?, ?, ?)",
+				entry.ID, line, posting.AccountID, posting.Amount.Minor, posting.Amount.Currency); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlStore) GetLedgerEntry(id string) (*models.LedgerEntry, error) {
+	entry, err := scanLedgerEntry(s.queryRow("SELECT "+ledgerEntryColumns+" FROM ledger_entries WHERE id = ?", id))
+	if err != nil {
+		return nil, notFound("ledger entry", err)
+	}
+	rows, err := s.query("SELECT entry_id, account_id, amount_minor, currency FROM postings WHERE entry_id = ? ORDER BY line", id)
+	postings, err := scanAll(rows, err, scanPosting)
+	if err != nil {
+		return nil, err
+	}
+	for _, posting := range postings {
+		entry.Postings = append(entry.Postings, *posting)
+	}
+	return entry, nil
+}
+
+// postingsQuery выбирает проводки в хронологическом порядке записей
+const postingsQuery = "SELECT p.entry_id, p.account_id, p.amount_minor, p.currency FROM postings p JOIN ledger_entries e ON e.id = p.entry_id"
+
+const postingsOrder = " ORDER BY e.created_at, e.id, p.line"
+
+func (s *sqlStore) GetPostingsByAccount(accountID string) ([]*models.Posting, error) {
+	rows, err := s.query(postingsQuery+" WHERE p.account_id = ?"+postingsOrder, accountID)
+	return scanAll(rows, err, scanPosting)
+}
+
+func (s *sqlStore) GetAllPostings() ([]*models.Posting, error) {
+	rows, err := s.query(postingsQuery + postingsOrder)
+	return scanAll(rows, err, scanPosting)
+}
+
+// runSQLTx выполняет fn в транзакции database/sql с откатом при ошибке или панике
+func runSQLTx(conn *sql.DB, d *dialect, fn func(tx Tx) error) error {
+	sqlTx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = sqlTx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(&sqlStore{q: sqlTx, dialect: d, inTx: true}); err != nil {
+		_ = sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLStore_Rebind(t *testing.T) {
+	pg := &sqlStore{dialect: &dialect{numberedPlaceholders: true}}
+	assert.Equal(t, "SELECT * FROM t WHERE a = $1 AND b = $2", pg.rebind("SELECT * FROM t WHERE a = ? AND b = ?"))
+
+	plain := &sqlStore{dialect: &dialect{}}
+	assert.Equal(t, "SELECT * FROM t WHERE a = ?", plain.rebind("SELECT * FROM t WHERE a = ?"))
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, migrations) {
+		assert.Equal(t, 1, migrations[0].version)
+	}
+	for i := 1; i < len(migrations); i++ {
+		assert.Greater(t, migrations[i].version, migrations[i-1].version)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- comment
+CREATE TABLE a (
+    id TEXT PRIMARY KEY
+);
+
+CREATE INDEX idx_a ON a (id);
+`
+	statements := splitStatements(script)
+	assert.Len(t, statements, 2)
+	assert.Equal(t, "CREATE TABLE a (\n    id TEXT PRIMARY KEY\n)", statements[0])
+	assert.Equal(t, "CREATE INDEX idx_a ON a (id)", statements[1])
+}
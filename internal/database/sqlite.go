@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var sqliteDialect = &dialect{
+	// SQLite блокирует базу целиком, поэтому отдельная блокировка строк не нужна:
+	// транзакции открываются как BEGIN IMMEDIATE (см. _txlock в DSN) и идут по очереди
+	isUniqueViolation: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		if !errors.As(err, &sqliteErr) {
+			return false
+		}
+		code := sqliteErr.Code()
+		return code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || code == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	},
+	// У SQLite нет типа времени: храним строку фиксированной ширины, чтобы ORDER BY работал корректно
+	encodeTime: func(t time.Time) any {
+		return t.Format(sortableTimeLayout)
+	},
+}
+
+// SQLiteDB реализация Database во встроенном файле SQLite (чистый Go, без cgo)
+type SQLiteDB struct {
+	*sqlStore
+	conn *sql.DB
+}
+
+// sqliteBusyTimeoutMs сколько ждать освобождения блокировки, прежде чем вернуть SQLITE_BUSY
+const sqliteBusyTimeoutMs = "5000"
+
+// NewSQLiteDB открывает (или создаёт) файл базы и применяет миграции схемы
+func NewSQLiteDB(path string) (*SQLiteDB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout("+sqliteBusyTimeoutMs+")")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	// IMMEDIATE берёт блокировку на запись сразу в BEGIN: без этого две транзакции,
+	// начавшие с чтения, упираются в SQLITE_BUSY при попытке записи, и busy_timeout не помогает
+	params.Set("_txlock", "immediate")
+
+	conn, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := migrate(conn, sqliteDialect); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &SQLiteDB{
+		sqlStore: &sqlStore{q: conn, dialect: sqliteDialect},
+		conn:     conn,
+	}, nil
+}
+
+func (db *SQLiteDB) RunInTx(fn func(tx Tx) error) error {
+	return runSQLTx(db.conn, sqliteDialect, fn)
+}
+
+func (db *SQLiteDB) Close() error {
+	return db.conn.Close()
+}
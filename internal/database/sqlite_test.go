@@ -0,0 +1,138 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSQLiteDB(t *testing.T) *SQLiteDB {
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "banking.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLiteDB_Conformance(t *testing.T) {
+	testStoreConformance(t, func(t *testing.T) Database {
+		return newTestSQLiteDB(t)
+	})
+}
+
+func TestSQLiteDB_PersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banking.db")
+	db, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	user := &models.User{ID: "persisted", Email: "persisted@example.com", Name: "Persisted", CreatedAt: now}
+	assert.NoError(t, db.CreateUser(user))
+	assert.NoError(t, db.Close())
+
+	// Повторное открытие не должно повторно применять миграции
+	db, err = NewSQLiteDB(path)
+	if err != nil {
+		t.Fatalf("reopen sqlite: %v", err)
+	}
+	defer db.Close()
+	got, err := db.GetUser("persisted")
+	assert.NoError(t, err)
+	assert.Equal(t, user, got)
+}
+
+func TestSQLiteDB_ConcurrentTransactions(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	now := time.Now()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "shared", UserID: "u", Balance: models.Zero("USD"), Currency: "USD", CreatedAt: now, UpdatedAt: now}))
+
+	// Параллельные транзакции чтение-изменение-запись: WAL + busy_timeout + BEGIN IMMEDIATE
+	// должны выстроить их в очередь без SQLITE_BUSY и без потерянных обновлений
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := db.RunInTx(func(tx Tx) error {
+				account, err := tx.GetAccount("shared")
+				if err != nil {
+					return err
+				}
+				account.Balance, err = account.Balance.Add(models.NewMoney(100, "USD"))
+				if err != nil {
+					return err
+				}
+				return tx.UpdateAccount(account)
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	account, err := db.GetAccount("shared")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(100*workers, "USD"), account.Balance)
+}
+
+func TestSQLiteDB_LedgerMigrationBackfillsOpeningBalances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banking.db")
+
+	// База в состоянии до появления главной книги: применена только первая миграция
+	conn, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	migrations, err := loadMigrations()
+	assert.NoError(t, err)
+	legacy := &sqlStore{q: conn, dialect: sqliteDialect}
+	for _, statement := range splitStatements(migrations[0].sql) {
+		_, err := legacy.exec(statement)
+		assert.NoError(t, err)
+	}
+	_, err = legacy.exec("CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL)")
+	assert.NoError(t, err)
+	_, err = legacy.exec("INSERT INTO schema_migrations (version, applied_at) VALUES (1, ?)", legacy.ts(time.Now()))
+	assert.NoError(t, err)
+	// Схема того времени: колонок, добавленных позже (version), ещё нет
+	now := legacy.ts(time.Now())
+	for id, balance := range map[string]int64{"legacy": 750, "empty": 0} {
+		_, err = legacy.exec("INSERT INTO accounts (id, user_id, balance_minor, currency, created_at, updated_at) VALUES (?, 'u', ?, 'USD', ?, ?)",
+			id, balance, now, now)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, conn.Close())
+
+	db, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatalf("migrate sqlite: %v", err)
+	}
+	defer db.Close()
+
+	postings, err := db.GetPostingsByAccount("legacy")
+	assert.NoError(t, err)
+	if assert.Len(t, postings, 1) {
+		assert.Equal(t, models.NewMoney(750, "USD"), postings[0].Amount)
+	}
+	opening, err := db.GetPostingsByAccount(models.OpeningBalanceAccount)
+	assert.NoError(t, err)
+	if assert.Len(t, opening, 1) {
+		assert.Equal(t, models.NewMoney(-750, "USD"), opening[0].Amount)
+	}
+	empty, err := db.GetPostingsByAccount("empty")
+	assert.NoError(t, err)
+	assert.Empty(t, empty)
+
+	// Существующие строки получают первую версию
+	account, err := db.GetAccount("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), account.Version)
+}
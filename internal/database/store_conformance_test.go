@@ -0,0 +1,753 @@
+package database
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bonusIDsOf ID бонусов пользователя в порядке выборки; сидовые данные бэкенда не мешают проверкам
+func bonusIDsOf(bonuses []*models.Bonus, userID string) []string {
+	var ids []string
+	for _, bonus := range bonuses {
+		if bonus.UserID == userID {
+			ids = append(ids, bonus.ID)
+		}
+	}
+	return ids
+}
+
+// testStoreConformance проверяет контракт Database, общий для всех бэкендов.
+// Время усекается до микросекунд и приводится к UTC — это точность SQL-хранилищ.
+func testStoreConformance(t *testing.T, newDB func(t *testing.T) Database) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	t.Run("accounts", func(t *testing.T) {
+		db := newDB(t)
+		account := &models.Account{ID: "conf-account", UserID: "conf-user", Balance: models.NewMoney(12345, "EUR"), Currency: "EUR", CreatedAt: now, UpdatedAt: now}
+
+		assert.NoError(t, db.CreateAccount(account))
+		err := db.CreateAccount(account)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "already exists")
+		}
+
+		got, err := db.GetAccount("conf-account")
+		assert.NoError(t, err)
+		assert.Equal(t, account, got)
+
+		byUser, err := db.GetAccountsByUserID("conf-user")
+		assert.NoError(t, err)
+		assert.Len(t, byUser, 1)
+
+		account.Balance = models.NewMoney(1, "EUR")
+		account.UpdatedAt = now.Add(time.Minute)
+		assert.NoError(t, db.UpdateAccount(account))
+		got, err = db.GetAccount("conf-account")
+		assert.NoError(t, err)
+		assert.Equal(t, account, got)
+
+		closedAt := now.Add(2 * time.Minute)
+		account.Status, account.ClosedAt = models.AccountClosed, &closedAt
+		assert.NoError(t, db.UpdateAccount(account))
+		got, err = db.GetAccount("conf-account")
+		assert.NoError(t, err)
+		assert.Equal(t, account, got)
+		assert.True(t, got.Closed())
+
+		assert.NoError(t, db.DeleteAccount("conf-account"))
+		_, err = db.GetAccount("conf-account")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "not found")
+		}
+		assert.Error(t, db.DeleteAccount("conf-account"))
+		assert.Error(t, db.UpdateAccount(account))
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		db := newDB(t)
+		first := &models.Transaction{ID: "conf-txn-1", FromAccount: "conf-a", ToAccount: "conf-b", Amount: models.NewMoney(100, "USD"),
+			Type: "transfer", Status: "pending", Description: "first", CreatedAt: now, UpdatedAt: now}
+		second := &models.Transaction{ID: "conf-txn-2", FromAccount: "", ToAccount: "conf-a", Amount: models.NewMoney(50, "USD"),
+			Type: "deposit", Status: "completed", CreatedAt: now, UpdatedAt: now}
+
+		assert.NoError(t, db.CreateTransaction(first))
+		assert.NoError(t, db.CreateTransaction(second))
+		assert.Error(t, db.CreateTransaction(first))
+
+		got, err := db.GetTransaction("conf-txn-1")
+		assert.NoError(t, err)
+		assert.Equal(t, first, got)
+
+		byAccount, err := db.GetTransactionsByAccount("conf-a")
+		assert.NoError(t, err)
+		assert.Len(t, byAccount, 2)
+		byAccount, err = db.GetTransactionsByAccount("conf-b")
+		assert.NoError(t, err)
+		assert.Len(t, byAccount, 1)
+
+		first.Status = "completed"
+		assert.NoError(t, db.UpdateTransaction(first))
+		got, err = db.GetTransaction("conf-txn-1")
+		assert.NoError(t, err)
+		assert.Equal(t, "completed", got.Status)
+
+		assert.NoError(t, db.DeleteTransaction("conf-txn-2"))
+		_, err = db.GetTransaction("conf-txn-2")
+		assert.Error(t, err)
+	})
+
+	t.Run("transaction queries", func(t *testing.T) {
+		db := newDB(t)
+		at := func(minutes int) time.Time { return now.Add(time.Duration(minutes) * time.Minute) }
+		list := []*models.Transaction{
+			{ID: "q-1", FromAccount: "conf-a", ToAccount: "conf-b", Amount: models.NewMoney(1000, "USD"), Type: "transfer", Status: "completed", CreatedAt: at(0), UpdatedAt: at(0)},
+			{ID: "q-2", FromAccount: "cash-in", ToAccount: "conf-a", Amount: models.NewMoney(5000, "USD"), Type: "deposit", Status: "completed", CreatedAt: at(1), UpdatedAt: at(1)},
+			{ID: "q-3", FromAccount: "conf-c", ToAccount: "conf-a", Amount: models.NewMoney(200, "USD"), Type: "transfer", Status: "failed", CreatedAt: at(1), UpdatedAt: at(1)},
+			{ID: "q-4", FromAccount: "conf-b", ToAccount: "conf-a", Amount: models.NewMoney(300, "USD"), Type: "transfer", Status: "completed", CreatedAt: at(2), UpdatedAt: at(2)},
+			{ID: "q-5", FromAccount: "conf-b", ToAccount: "conf-c", Amount: models.NewMoney(700, "USD"), Type: "transfer", Status: "completed", CreatedAt: at(3), UpdatedAt: at(3)},
+		}
+		for _, transaction := range list {
+			assert.NoError(t, db.CreateTransaction(transaction))
+		}
+		ids := func(query TransactionQuery) []string {
+			found, err := db.QueryTransactions(query)
+			assert.NoError(t, err)
+			result := []string{}
+			for _, transaction := range found {
+				result = append(result, transaction.ID)
+			}
+			return result
+		}
+
+		assert.Equal(t, []string{"q-1", "q-2", "q-3", "q-4"}, ids(TransactionQuery{AccountID: "conf-a"}))
+		assert.Equal(t, []string{"q-4", "q-3", "q-2", "q-1"}, ids(TransactionQuery{AccountID: "conf-a", Descending: true}))
+		assert.Equal(t, []string{"q-1", "q-3", "q-4"}, ids(TransactionQuery{AccountID: "conf-a", Types: []string{"transfer"}}))
+		assert.Equal(t, []string{"q-3"}, ids(TransactionQuery{AccountID: "conf-a", Statuses: []string{"failed", "pending"}}))
+		since, until := at(1), at(2)
+		assert.Equal(t, []string{"q-2", "q-3"}, ids(TransactionQuery{AccountID: "conf-a", Since: &since, Until: &until}))
+		assert.Equal(t, []string{"q-1", "q-4"}, ids(TransactionQuery{AccountID: "conf-a", MinAmount: models.NewMoney(300, "USD"), MaxAmount: models.NewMoney(1000, "USD")}))
+		assert.Equal(t, []string{"q-1", "q-4"}, ids(TransactionQuery{AccountID: "conf-a", Counterparty: "conf-b"}))
+
+		// Страницы по курсору не теряют и не повторяют операции с одинаковым временем
+		assert.Equal(t, []string{"q-1", "q-2"}, ids(TransactionQuery{AccountID: "conf-a", Limit: 2}))
+		assert.Equal(t, []string{"q-3", "q-4"}, ids(TransactionQuery{AccountID: "conf-a", Limit: 2, After: &TransactionCursor{CreatedAt: at(1), ID: "q-2"}}))
+		assert.Equal(t, []string{"q-2", "q-1"}, ids(TransactionQuery{AccountID: "conf-a", Descending: true, After: &TransactionCursor{CreatedAt: at(1), ID: "q-3"}}))
+	})
+
+	t.Run("records by user are ordered by creation", func(t *testing.T) {
+		db := newDB(t)
+		// Вставка не по порядку; у двух записей одинаковое время, их порядок задаёт ID
+		for _, row := range []struct {
+			id     string
+			offset time.Duration
+		}{{"conf-c", time.Minute}, {"conf-b", 0}, {"conf-a", time.Minute}, {"conf-d", -time.Minute}} {
+			created := now.Add(row.offset)
+			assert.NoError(t, db.CreateAccount(&models.Account{ID: row.id, UserID: "conf-user", Balance: models.Zero("USD"), Currency: "USD", CreatedAt: created, UpdatedAt: created}))
+			assert.NoError(t, db.CreateBonus(&models.Bonus{ID: row.id, UserID: "conf-user", Type: "welcome", Amount: models.NewMoney(100, "USD"),
+				RemainingAmount: models.NewMoney(100, "USD"), Status: "active", ExpiresAt: now.AddDate(0, 0, 30), CreatedAt: created}))
+		}
+		want := []string{"conf-d", "conf-b", "conf-a", "conf-c"}
+
+		accountIDs := func(accounts []*models.Account) []string {
+			var ids []string
+			for _, account := range accounts {
+				ids = append(ids, account.ID)
+			}
+			return ids
+		}
+		accounts, err := db.GetAccountsByUserID("conf-user")
+		assert.NoError(t, err)
+		assert.Equal(t, want, accountIDs(accounts))
+		bonuses, err := db.GetBonusesByUserID("conf-user")
+		assert.NoError(t, err)
+		assert.Equal(t, want, bonusIDsOf(bonuses, "conf-user"))
+		assert.NoError(t, db.RunInTx(func(tx Tx) error {
+			accounts, err := tx.GetAccountsByUserID("conf-user")
+			assert.NoError(t, err)
+			assert.Equal(t, want, accountIDs(accounts))
+			bonuses, err := tx.GetBonusesByUserID("conf-user")
+			assert.NoError(t, err)
+			assert.Equal(t, want, bonusIDsOf(bonuses, "conf-user"))
+			return nil
+		}))
+	})
+
+	t.Run("bonuses", func(t *testing.T) {
+		db := newDB(t)
+		bonus := &models.Bonus{ID: "conf-bonus", UserID: "conf-user", Type: "transaction", CampaignID: "conf-campaign", Source: models.TriggerDeposit, TransactionID: "conf-tx",
+			Amount: models.NewMoney(5000, "USD"), RemainingAmount: models.NewMoney(5000, "USD"), Status: "active", ExpiresAt: now.AddDate(0, 0, 30), CreatedAt: now}
+
+		assert.NoError(t, db.CreateBonus(bonus))
+		assert.Error(t, db.CreateBonus(bonus))
+
+		got, err := db.GetBonus("conf-bonus")
+		assert.NoError(t, err)
+		assert.Equal(t, bonus, got)
+
+		byUser, err := db.GetBonusesByUserID("conf-user")
+		assert.NoError(t, err)
+		assert.Len(t, byUser, 1)
+
+		// Истёкшими считаются только активные бонусы со сроком не позже момента проверки
+		stale := &models.Bonus{ID: "conf-bonus-stale", UserID: "conf-user", Type: "welcome", Amount: models.NewMoney(100, "USD"),
+			Status: "active", ExpiresAt: now.Add(-time.Hour), CreatedAt: now}
+		usedStale := &models.Bonus{ID: "conf-bonus-used", UserID: "conf-user", Type: "welcome", Amount: models.NewMoney(100, "USD"),
+			Status: "used", ExpiresAt: now.Add(-2 * time.Hour), CreatedAt: now}
+		assert.NoError(t, db.CreateBonus(stale))
+		assert.NoError(t, db.CreateBonus(usedStale))
+		expired, err := db.GetExpiredBonuses(now)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"conf-bonus-stale"}, bonusIDsOf(expired, "conf-user"))
+		assert.NoError(t, db.RunInTx(func(tx Tx) error {
+			expired, err := tx.GetExpiredBonuses(now.AddDate(0, 0, 30))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"conf-bonus-stale", "conf-bonus"}, bonusIDsOf(expired, "conf-user"))
+			return nil
+		}))
+
+		byTransaction, err := db.GetBonusesByTransaction("conf-tx")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"conf-bonus"}, bonusIDsOf(byTransaction, "conf-user"))
+		assert.NoError(t, db.RunInTx(func(tx Tx) error {
+			byTransaction, err := tx.GetBonusesByTransaction("conf-tx")
+			assert.NoError(t, err)
+			assert.Len(t, byTransaction, 1)
+			return nil
+		}))
+
+		bonus.Status = "used"
+		bonus.UsedAccountID = "conf-account"
+		bonus.RemainingAmount = models.Zero("USD")
+		assert.NoError(t, db.UpdateBonus(bonus))
+		got, err = db.GetBonus("conf-bonus")
+		assert.NoError(t, err)
+		assert.Equal(t, "used", got.Status)
+		assert.Equal(t, "conf-account", got.UsedAccountID)
+		assert.Equal(t, models.Zero("USD"), got.RemainingAmount)
+
+		assert.NoError(t, db.DeleteBonus("conf-bonus"))
+		_, err = db.GetBonus("conf-bonus")
+		assert.Error(t, err)
+	})
+
+	t.Run("bonus redemptions", func(t *testing.T) {
+		db := newDB(t)
+		first := &models.BonusRedemption{ID: "conf-redemption-2", BonusID: "conf-bonus", UserID: "conf-user", AccountID: "conf-account",
+			TransactionID: "conf-tx-1", Amount: models.NewMoney(1000, "USD"), Credited: models.NewMoney(920, "EUR"), Rate: "0.92", CreatedAt: now}
+		second := &models.BonusRedemption{ID: "conf-redemption-1", BonusID: "conf-bonus", UserID: "conf-user", AccountID: "conf-account",
+			TransactionID: "conf-tx-2", Amount: models.NewMoney(500, "USD"), Credited: models.NewMoney(500, "USD"), CreatedAt: now.Add(time.Second)}
+		other := &models.BonusRedemption{ID: "conf-redemption-3", BonusID: "conf-bonus-other", UserID: "conf-user", AccountID: "conf-account",
+			TransactionID: "conf-tx-3", Amount: models.NewMoney(100, "USD"), Credited: models.NewMoney(100, "USD"), CreatedAt: now}
+
+		assert.NoError(t, db.CreateBonusRedemption(second))
+		assert.NoError(t, db.CreateBonusRedemption(first))
+		assert.ErrorIs(t, db.CreateBonusRedemption(first), ErrAlreadyExists)
+
+		// Использования отдаются по времени, а не по ID или порядку вставки
+		list, err := db.GetBonusRedemptions("conf-bonus")
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.BonusRedemption{first, second}, list)
+
+		assert.Error(t, db.RunInTx(func(tx Tx) error {
+			if err := tx.CreateBonusRedemption(other); err != nil {
+				return err
+			}
+			inTx, err := tx.GetBonusRedemptions("conf-bonus-other")
+			assert.NoError(t, err)
+			assert.Len(t, inTx, 1)
+			return errors.New("rollback")
+		}))
+		list, err = db.GetBonusRedemptions("conf-bonus-other")
+		assert.NoError(t, err)
+		assert.Empty(t, list)
+	})
+
+	t.Run("referrals", func(t *testing.T) {
+		db := newDB(t)
+		code := &models.ReferralCode{UserID: "conf-referrer", Code: "CONF1234", DeviceID: "device-1", CreatedAt: now}
+		assert.NoError(t, db.CreateReferralCode(code))
+		assert.ErrorIs(t, db.CreateReferralCode(code), ErrAlreadyExists)
+
+		got, err := db.GetReferralCode("conf-referrer")
+		assert.NoError(t, err)
+		assert.Equal(t, code, got)
+		got, err = db.GetReferralCodeByCode("CONF1234")
+		assert.NoError(t, err)
+		assert.Equal(t, code, got)
+		_, err = db.GetReferralCodeByCode("MISSING")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		code.DeviceID = ""
+		assert.NoError(t, db.UpdateReferralCode(code))
+		got, err = db.GetReferralCode("conf-referrer")
+		assert.NoError(t, err)
+		assert.Equal(t, code, got)
+		assert.ErrorIs(t, db.UpdateReferralCode(&models.ReferralCode{UserID: "conf-nobody", Code: "NOPE1234"}), ErrNotFound)
+
+		later := &models.Referral{RefereeID: "conf-referee-a", ReferrerID: "conf-referrer", Code: "CONF1234",
+			Status: models.ReferralPending, DeviceID: "device-2", CreatedAt: now.Add(time.Second)}
+		earlier := &models.Referral{RefereeID: "conf-referee-b", ReferrerID: "conf-referrer", Code: "CONF1234",
+			Status: models.ReferralRejected, RejectReason: "same_device", DeviceID: "device-1", CreatedAt: now}
+		assert.NoError(t, db.CreateReferral(later))
+		assert.NoError(t, db.CreateReferral(earlier))
+		assert.ErrorIs(t, db.CreateReferral(earlier), ErrAlreadyExists)
+		assert.Equal(t, int64(1), later.Version)
+
+		list, err := db.GetReferralsByReferrer("conf-referrer")
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.Referral{earlier, later}, list)
+
+		qualifiedAt := now.Add(time.Minute)
+		later.Status, later.TransactionID, later.QualifiedAt = models.ReferralQualified, "conf-tx", &qualifiedAt
+		assert.NoError(t, db.UpdateReferral(later))
+		assert.Equal(t, int64(2), later.Version)
+		stored, err := db.GetReferral("conf-referee-a")
+		assert.NoError(t, err)
+		assert.Equal(t, later, stored)
+
+		stale := *stored
+		stale.Version = 1
+		assert.ErrorIs(t, db.UpdateReferral(&stale), ErrConflict)
+		missing := *stored
+		missing.RefereeID = "conf-nobody"
+		assert.ErrorIs(t, db.UpdateReferral(&missing), ErrNotFound)
+	})
+
+	t.Run("promo codes", func(t *testing.T) {
+		db := newDB(t)
+		endsAt := now.Add(24 * time.Hour)
+		second := &models.PromoCode{Code: "CONF-B", BatchID: "conf-batch", Reward: models.NewMoney(500, "USD"), BonusType: "promo",
+			ExpiresInDays: 30, MaxRedemptions: 1, PerUserLimit: 1, EndsAt: &endsAt, CreatedAt: now}
+		first := &models.PromoCode{Code: "CONF-A", BatchID: "conf-batch", Reward: models.NewMoney(500, "USD"), BonusType: "promo",
+			ExpiresInDays: 30, MaxRedemptions: 100, PerUserLimit: 2, StartsAt: &now, CreatedAt: now}
+		other := &models.PromoCode{Code: "CONF-C", BatchID: "conf-other", Reward: models.NewMoney(100, "EUR"), BonusType: "promo",
+			ExpiresInDays: 7, MaxRedemptions: 1, PerUserLimit: 1, CreatedAt: now}
+		assert.NoError(t, db.CreatePromoCode(second))
+		assert.NoError(t, db.CreatePromoCode(first))
+		assert.NoError(t, db.CreatePromoCode(other))
+		assert.ErrorIs(t, db.CreatePromoCode(first), ErrAlreadyExists)
+		assert.Equal(t, int64(1), first.Version)
+
+		got, err := db.GetPromoCode("CONF-B")
+		assert.NoError(t, err)
+		assert.Equal(t, second, got)
+		_, err = db.GetPromoCode("MISSING")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		batch, err := db.GetPromoCodesByBatch("conf-batch")
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.PromoCode{first, second}, batch)
+
+		first.Redemptions = 1
+		assert.NoError(t, db.UpdatePromoCode(first))
+		assert.Equal(t, int64(2), first.Version)
+		stale := *first
+		stale.Version = 1
+		assert.ErrorIs(t, db.UpdatePromoCode(&stale), ErrConflict)
+		missing := *first
+		missing.Code = "MISSING"
+		assert.ErrorIs(t, db.UpdatePromoCode(&missing), ErrNotFound)
+
+		later := &models.PromoRedemption{ID: "conf-promo-1", Code: "CONF-A", UserID: "conf-user", BonusID: "conf-bonus-1", CreatedAt: now.Add(time.Second)}
+		earlier := &models.PromoRedemption{ID: "conf-promo-2", Code: "CONF-A", UserID: "conf-user", BonusID: "conf-bonus-2", CreatedAt: now}
+		assert.NoError(t, db.CreatePromoRedemption(later))
+		assert.NoError(t, db.CreatePromoRedemption(earlier))
+		assert.ErrorIs(t, db.CreatePromoRedemption(earlier), ErrAlreadyExists)
+		redemptions, err := db.GetPromoRedemptions("CONF-A")
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.PromoRedemption{earlier, later}, redemptions)
+
+		// Погашение и счётчик кода откатываются вместе
+		assert.Error(t, db.RunInTx(func(tx Tx) error {
+			code, err := tx.GetPromoCode("CONF-C")
+			if err != nil {
+				return err
+			}
+			code.Redemptions++
+			if err := tx.UpdatePromoCode(code); err != nil {
+				return err
+			}
+			if err := tx.CreatePromoRedemption(&models.PromoRedemption{ID: "conf-promo-3", Code: "CONF-C", UserID: "conf-user", BonusID: "conf-bonus-3", CreatedAt: now}); err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		}))
+		got, err = db.GetPromoCode("CONF-C")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, got.Redemptions)
+		redemptions, err = db.GetPromoRedemptions("CONF-C")
+		assert.NoError(t, err)
+		assert.Empty(t, redemptions)
+	})
+
+	t.Run("loyalty", func(t *testing.T) {
+		db := newDB(t)
+		account := &models.LoyaltyAccount{UserID: "conf-user", Points: 120, UpdatedAt: now}
+		assert.NoError(t, db.CreateLoyaltyAccount(account))
+		assert.ErrorIs(t, db.CreateLoyaltyAccount(account), ErrAlreadyExists)
+		assert.Equal(t, int64(1), account.Version)
+
+		account.Points = 20
+		assert.NoError(t, db.UpdateLoyaltyAccount(account))
+		assert.Equal(t, int64(2), account.Version)
+		got, err := db.GetLoyaltyAccount("conf-user")
+		assert.NoError(t, err)
+		assert.Equal(t, account, got)
+		stale := *account
+		stale.Version = 1
+		assert.ErrorIs(t, db.UpdateLoyaltyAccount(&stale), ErrConflict)
+		_, err = db.GetLoyaltyAccount("conf-nobody")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		later := &models.PointsEntry{ID: "conf-points-1", UserID: "conf-user", Kind: models.PointsConvert, Points: -100,
+			BonusID: "conf-bonus", CreatedAt: now.Add(time.Second)}
+		earlier := &models.PointsEntry{ID: "conf-points-2", UserID: "conf-user", Kind: models.PointsEarn, Points: 120,
+			TransactionID: "conf-tx", CreatedAt: now}
+		other := &models.PointsEntry{ID: "conf-points-3", UserID: "conf-other", Kind: models.PointsEarn, Points: 5, CreatedAt: now}
+		assert.NoError(t, db.CreatePointsEntry(later))
+		assert.NoError(t, db.CreatePointsEntry(earlier))
+		assert.NoError(t, db.CreatePointsEntry(other))
+		assert.ErrorIs(t, db.CreatePointsEntry(earlier), ErrAlreadyExists)
+
+		gotEntry, err := db.GetPointsEntry("conf-points-2")
+		assert.NoError(t, err)
+		assert.Equal(t, earlier, gotEntry)
+		entries, err := db.GetPointsEntriesByUser("conf-user")
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.PointsEntry{earlier, later}, entries)
+	})
+
+	t.Run("erasure certificates", func(t *testing.T) {
+		db := newDB(t)
+		certificate := &models.ErasureCertificate{ID: "conf-erasure", UserID: "conf-user", RequestedBy: "conf-admin",
+			ClosedAccounts: []string{"conf-a", "conf-b"}, ExpiredBonuses: []string{}, ErasedFields: []string{"user.email"},
+			ErasedAt: now, RetainUntil: now.AddDate(5, 0, 0)}
+		certificate.Digest = certificate.ComputeDigest()
+		assert.NoError(t, db.CreateErasureCertificate(certificate))
+		assert.ErrorIs(t, db.CreateErasureCertificate(certificate), ErrAlreadyExists)
+
+		got, err := db.GetErasureCertificate("conf-user")
+		assert.NoError(t, err)
+		assert.Equal(t, certificate, got)
+		assert.True(t, got.Verify())
+		_, err = db.GetErasureCertificate("conf-nobody")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("users", func(t *testing.T) {
+		db := newDB(t)
+		user := &models.User{ID: "conf-user", Email: "conf@example.com", Name: "Conformance", Role: "support", PasswordHash: "$2a$10$hash", CreatedAt: now}
+
+		assert.NoError(t, db.CreateUser(user))
+		assert.Error(t, db.CreateUser(user))
+
+		// Email уникален: ни новый пользователь, ни правка другого не займут его
+		other := &models.User{ID: "conf-other", Email: "conf@example.com", Name: "Other", CreatedAt: now}
+		assert.ErrorIs(t, db.CreateUser(other), ErrEmailTaken)
+		other.Email = "other@example.com"
+		assert.NoError(t, db.CreateUser(other))
+		other.Email = "conf@example.com"
+		assert.ErrorIs(t, db.UpdateUser(other), ErrEmailTaken)
+		err := db.CreateUser(&models.User{ID: "conf-user", Email: "third@example.com", CreatedAt: now})
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		assert.NotErrorIs(t, err, ErrEmailTaken)
+
+		got, err := db.GetUser("conf-user")
+		assert.NoError(t, err)
+		assert.Equal(t, user, got)
+
+		got, err = db.GetUserByEmail("conf@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, user, got)
+		_, err = db.GetUserByEmail("nobody@example.com")
+		assert.Error(t, err)
+
+		user.Name = "Renamed"
+		user.PasswordHash = "$2a$10$other"
+		user.TokenGeneration = 2
+		assert.NoError(t, db.UpdateUser(user))
+		got, err = db.GetUser("conf-user")
+		assert.NoError(t, err)
+		assert.Equal(t, "Renamed", got.Name)
+		assert.Equal(t, "$2a$10$other", got.PasswordHash)
+		assert.Equal(t, int64(2), got.TokenGeneration)
+
+		erasedAt := now.Add(time.Hour)
+		user.ErasedAt = &erasedAt
+		assert.NoError(t, db.UpdateUser(user))
+		got, err = db.GetUser("conf-user")
+		assert.NoError(t, err)
+		assert.Equal(t, user, got)
+
+		assert.NoError(t, db.DeleteUser("conf-user"))
+		_, err = db.GetUser("conf-user")
+		assert.Error(t, err)
+	})
+
+	t.Run("transaction commit and rollback", func(t *testing.T) {
+		db := newDB(t)
+		account := &models.Account{ID: "conf-tx-account", UserID: "conf-user", Balance: models.NewMoney(1000, "USD"), Currency: "USD", CreatedAt: now, UpdatedAt: now}
+		assert.NoError(t, db.CreateAccount(account))
+
+		errBoom := errors.New("boom")
+		err := db.RunInTx(func(tx Tx) error {
+			got, err := tx.GetAccount("conf-tx-account")
+			if err != nil {
+				return err
+			}
+			got.Balance = models.Zero("USD")
+			if err := tx.UpdateAccount(got); err != nil {
+				return err
+			}
+			if err := tx.CreateBonus(&models.Bonus{ID: "conf-tx-bonus", UserID: "conf-user", Amount: models.NewMoney(1, "USD"), CreatedAt: now, ExpiresAt: now}); err != nil {
+				return err
+			}
+			return errBoom
+		})
+		assert.ErrorIs(t, err, errBoom)
+
+		got, err := db.GetAccount("conf-tx-account")
+		assert.NoError(t, err)
+		assert.Equal(t, models.NewMoney(1000, "USD"), got.Balance)
+		_, err = db.GetBonus("conf-tx-bonus")
+		assert.Error(t, err)
+
+		err = db.RunInTx(func(tx Tx) error {
+			got, err := tx.GetAccount("conf-tx-account")
+			if err != nil {
+				return err
+			}
+			got.Balance = models.NewMoney(1, "USD")
+			return tx.UpdateAccount(got)
+		})
+		assert.NoError(t, err)
+		got, err = db.GetAccount("conf-tx-account")
+		assert.NoError(t, err)
+		assert.Equal(t, models.NewMoney(1, "USD"), got.Balance)
+	})
+
+	t.Run("lock accounts", func(t *testing.T) {
+		db := newDB(t)
+		for _, id := range []string{"conf-lock-a", "conf-lock-b"} {
+			assert.NoError(t, db.CreateAccount(&models.Account{ID: id, UserID: "conf-user", Balance: models.NewMoney(1000, "USD"), Currency: "USD", CreatedAt: now, UpdatedAt: now}))
+		}
+
+		// Встречные переводы: 10 по 1 с A на B и 10 по 2 с B на A. Итог сходится,
+		// только если ни одно обновление не потерялось и транзакции не взаимоблокировались
+		const workers = 20
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			from, to, amount := "conf-lock-a", "conf-lock-b", int64(1)
+			if i%2 == 1 {
+				from, to, amount = to, from, 2
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := db.RunInTx(func(tx Tx) error {
+					if err := tx.LockAccounts(from, to); err != nil {
+						return err
+					}
+					source, err := tx.GetAccount(from)
+					if err != nil {
+						return err
+					}
+					target, err := tx.GetAccount(to)
+					if err != nil {
+						return err
+					}
+					runtime.Gosched()
+					source.Balance = models.NewMoney(source.Balance.Minor-amount, "USD")
+					target.Balance = models.NewMoney(target.Balance.Minor+amount, "USD")
+					if err := tx.UpdateAccount(source); err != nil {
+						return err
+					}
+					return tx.UpdateAccount(target)
+				})
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		a, err := db.GetAccount("conf-lock-a")
+		assert.NoError(t, err)
+		assert.Equal(t, models.NewMoney(1010, "USD"), a.Balance)
+		b, err := db.GetAccount("conf-lock-b")
+		assert.NoError(t, err)
+		assert.Equal(t, models.NewMoney(990, "USD"), b.Balance)
+	})
+
+	t.Run("versions", func(t *testing.T) {
+		db := newDB(t)
+		user := &models.User{ID: "conf-version-user", Email: "v@example.com", Name: "V", CreatedAt: now}
+		assert.NoError(t, db.CreateUser(user))
+		assert.Equal(t, int64(1), user.Version)
+
+		stale, err := db.GetUser("conf-version-user")
+		assert.NoError(t, err)
+
+		user.Name = "First"
+		assert.NoError(t, db.UpdateUser(user))
+		assert.Equal(t, int64(2), user.Version)
+
+		// Изменение поверх устаревшей версии отклоняется и не затирает данные
+		stale.Name = "Second"
+		assert.ErrorIs(t, db.UpdateUser(stale), ErrConflict)
+		got, err := db.GetUser("conf-version-user")
+		assert.NoError(t, err)
+		assert.Equal(t, "First", got.Name)
+		assert.Equal(t, int64(2), got.Version)
+
+		// Внутри транзакции версия растёт с каждым изменением, устаревшая копия — конфликт
+		err = db.RunInTx(func(tx Tx) error {
+			inTx, err := tx.GetUser("conf-version-user")
+			if err != nil {
+				return err
+			}
+			inTx.Name = "Third"
+			if err := tx.UpdateUser(inTx); err != nil {
+				return err
+			}
+			return tx.UpdateUser(stale)
+		})
+		assert.ErrorIs(t, err, ErrConflict)
+		got, err = db.GetUser("conf-version-user")
+		assert.NoError(t, err)
+		assert.Equal(t, "First", got.Name)
+
+		err = db.UpdateUser(&models.User{ID: "conf-version-missing", Version: 1})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "not found")
+		}
+	})
+
+	t.Run("campaigns", func(t *testing.T) {
+		db := newDB(t)
+		starts := now.Add(-time.Hour)
+		campaign := &models.Campaign{ID: "conf-campaign", Name: "Deposits", Active: true, Priority: 5,
+			Triggers: []string{models.TriggerDeposit, models.TriggerTransfer},
+			Conditions: models.CampaignConditions{Currency: "USD", MinAmount: models.NewMoney(1000, "USD"),
+				UserIDs: []string{"conf-user"}, StartsAt: &starts},
+			Reward: models.CampaignReward{Kind: models.RewardPercentage, RateBP: 150, Cap: models.NewMoney(500, "USD"), BonusType: "transaction", ExpiresInDays: 10},
+			Budget: models.NewMoney(100000, "USD"), Spent: models.NewMoney(2500, "USD"), CreatedAt: now, UpdatedAt: now}
+		other := &models.Campaign{ID: "conf-campaign-0", Name: "Welcome", Triggers: []string{models.TriggerWelcome},
+			Reward:    models.CampaignReward{Kind: models.RewardFixed, Amount: models.NewMoney(100, "EUR"), BonusType: "welcome", ExpiresInDays: 1},
+			CreatedAt: now, UpdatedAt: now}
+
+		assert.NoError(t, db.CreateCampaign(campaign))
+		assert.NoError(t, db.CreateCampaign(other))
+		assert.ErrorIs(t, db.CreateCampaign(campaign), ErrAlreadyExists)
+
+		got, err := db.GetCampaign("conf-campaign")
+		assert.NoError(t, err)
+		assert.Equal(t, campaign, got)
+
+		// Копия не делит срезы с хранилищем
+		got.Triggers[0] = "changed"
+		again, err := db.GetCampaign("conf-campaign")
+		assert.NoError(t, err)
+		assert.Equal(t, models.TriggerDeposit, again.Triggers[0])
+
+		list, err := db.ListCampaigns()
+		assert.NoError(t, err)
+		if assert.Len(t, list, 2) {
+			assert.Equal(t, "conf-campaign", list[0].ID)
+			assert.Equal(t, other, list[1])
+		}
+
+		campaign.Active = false
+		campaign.Spent = models.NewMoney(3000, "USD")
+		assert.NoError(t, db.UpdateCampaign(campaign))
+		assert.Equal(t, int64(2), campaign.Version)
+		got, err = db.GetCampaign("conf-campaign")
+		assert.NoError(t, err)
+		assert.Equal(t, models.NewMoney(3000, "USD"), got.Spent)
+		stale := *campaign
+		stale.Version = 1
+		assert.ErrorIs(t, db.UpdateCampaign(&stale), ErrConflict)
+
+		assert.NoError(t, db.RunInTx(func(tx Tx) error {
+			return tx.DeleteCampaign("conf-campaign-0")
+		}))
+		_, err = db.GetCampaign("conf-campaign-0")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, db.DeleteCampaign("conf-campaign-0"), ErrNotFound)
+	})
+
+	t.Run("ledger", func(t *testing.T) {
+		db := newDB(t)
+		first := &models.LedgerEntry{ID: "conf-entry-1", Reference: "conf-txn", Type: "deposit", Description: "first", CreatedAt: now,
+			Postings: []models.Posting{
+				{EntryID: "conf-entry-1", AccountID: models.CashInAccount, Amount: models.NewMoney(-500, "USD")},
+				{EntryID: "conf-entry-1", AccountID: "conf-ledger-a", Amount: models.NewMoney(500, "USD")},
+			}}
+		second := &models.LedgerEntry{ID: "conf-entry-2", Reference: "conf-txn-2", Type: "transfer", Description: "second", CreatedAt: now.Add(time.Second),
+			Postings: []models.Posting{
+				{EntryID: "conf-entry-2", AccountID: "conf-ledger-a", Amount: models.NewMoney(-200, "USD")},
+				{EntryID: "conf-entry-2", AccountID: "conf-ledger-b", Amount: models.NewMoney(200, "USD")},
+			}}
+
+		assert.NoError(t, db.CreateLedgerEntry(second))
+		assert.NoError(t, db.CreateLedgerEntry(first))
+		err := db.CreateLedgerEntry(first)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "already exists")
+		}
+
+		got, err := db.GetLedgerEntry("conf-entry-1")
+		assert.NoError(t, err)
+		assert.Equal(t, first, got)
+		_, err = db.GetLedgerEntry("missing")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "not found")
+		}
+
+		// Проводки отдаются в хронологическом порядке записей, а не в порядке вставки
+		postings, err := db.GetPostingsByAccount("conf-ledger-a")
+		assert.NoError(t, err)
+		if assert.Len(t, postings, 2) {
+			assert.Equal(t, "conf-entry-1", postings[0].EntryID)
+			assert.Equal(t, models.NewMoney(-200, "USD"), postings[1].Amount)
+		}
+
+		all, err := db.GetAllPostings()
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, len(all), 4)
+
+		// Запись книги откатывается вместе с транзакцией
+		err = db.RunInTx(func(tx Tx) error {
+			if err := tx.CreateLedgerEntry(&models.LedgerEntry{ID: "conf-entry-3", CreatedAt: now,
+				Postings: []models.Posting{
+					{EntryID: "conf-entry-3", AccountID: models.CashInAccount, Amount: models.NewMoney(-1, "USD")},
+					{EntryID: "conf-entry-3", AccountID: "conf-ledger-b", Amount: models.NewMoney(1, "USD")},
+				}}); err != nil {
+				return err
+			}
+			inTx, err := tx.GetPostingsByAccount("conf-ledger-b")
+			if err != nil {
+				return err
+			}
+			assert.Len(t, inTx, 2)
+			return errors.New("rollback")
+		})
+		assert.Error(t, err)
+		_, err = db.GetLedgerEntry("conf-entry-3")
+		assert.Error(t, err)
+		postings, err = db.GetPostingsByAccount("conf-ledger-b")
+		assert.NoError(t, err)
+		assert.Len(t, postings, 1)
+	})
+}
+
+func TestInMemoryDB_Conformance(t *testing.T) {
+	testStoreConformance(t, func(t *testing.T) Database {
+		return NewInMemoryDB()
+	})
+}
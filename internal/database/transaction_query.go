@@ -0,0 +1,111 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"petProjectMike/internal/models"
+)
+
+// TransactionCursor позиция в истории операций: последняя отданная операция. Следующая страница
+// начинается строго после неё в порядке (created_at, id)
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// TransactionQuery выборка операций счёта. Пустые поля не фильтруют; операции отдаются
+// по created_at, при равенстве — по id
+type TransactionQuery struct {
+	AccountID string
+	Types     []string
+	Statuses  []string
+	// Since и Until окно по created_at: [Since, Until)
+	Since *time.Time
+	Until *time.Time
+	// MinAmount и MaxAmount границы суммы включительно; сравниваются минимальные единицы
+	MinAmount models.Money
+	MaxAmount models.Money
+	// Counterparty второй счёт операции: отправитель входящих и получатель исходящих
+	Counterparty string
+	Descending   bool
+	After        *TransactionCursor
+	// Limit сколько операций отдать; 0 — все
+	Limit int
+}
+
+// matches подходит ли операция под все фильтры выборки, включая курсор
+func (q *TransactionQuery) matches(t *models.Transaction) bool {
+	if t.FromAccount != q.AccountID && t.ToAccount != q.AccountID {
+		return false
+	}
+	if len(q.Types) > 0 && !containsString(q.Types, t.Type) {
+		return false
+	}
+	if len(q.Statuses) > 0 && !containsString(q.Statuses, t.Status) {
+		return false
+	}
+	if q.Since != nil && t.CreatedAt.Before(*q.Since) {
+		return false
+	}
+	if q.Until != nil && !t.CreatedAt.Before(*q.Until) {
+		return false
+	}
+	if q.MinAmount != (models.Money{}) && t.Amount.Minor < q.MinAmount.Minor {
+		return false
+	}
+	if q.MaxAmount != (models.Money{}) && t.Amount.Minor > q.MaxAmount.Minor {
+		return false
+	}
+	if q.Counterparty != "" &&
+		!(t.FromAccount == q.AccountID && t.ToAccount == q.Counterparty) &&
+		!(t.ToAccount == q.AccountID && t.FromAccount == q.Counterparty) {
+		return false
+	}
+	if q.After != nil {
+		if q.Descending {
+			return transactionBefore(t, q.After)
+		}
+		return transactionAfter(t, q.After)
+	}
+	return true
+}
+
+func transactionBefore(t *models.Transaction, cursor *TransactionCursor) bool {
+	return t.CreatedAt.Before(cursor.CreatedAt) || (t.CreatedAt.Equal(cursor.CreatedAt) && t.ID < cursor.ID)
+}
+
+func transactionAfter(t *models.Transaction, cursor *TransactionCursor) bool {
+	return t.CreatedAt.After(cursor.CreatedAt) || (t.CreatedAt.Equal(cursor.CreatedAt) && t.ID > cursor.ID)
+}
+
+// page сортирует подошедшие операции в порядке выборки и отрезает Limit
+func (q *TransactionQuery) page(transactions []*models.Transaction) []*models.Transaction {
+	sortTransactions(transactions, q.Descending)
+	if q.Limit > 0 && len(transactions) > q.Limit {
+		transactions = transactions[:q.Limit]
+	}
+	return transactions
+}
+
+func sortTransactions(transactions []*models.Transaction, descending bool) {
+	sort.Slice(transactions, func(i, j int) bool {
+		a, b := transactions[i], transactions[j]
+		if descending {
+			a, b = b, a
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
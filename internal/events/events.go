@@ -0,0 +1,85 @@
+// Package events — доменные события и их доставка подписчикам. Издатель публикует событие
+// после коммита своей транзакции; обработчики вызываются синхронно в порядке подписки.
+// Ошибка или паника обработчика записывается в лог и не затрагивает ни издателя, ни других подписчиков,
+// поэтому обработчики должны быть идемпотентны и сами решать, что делать с повторной доставкой.
+package events
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"petProjectMike/internal/models"
+)
+
+// Event доменное событие; имя связывает его с подписчиками
+type Event interface {
+	EventName() string
+}
+
+// TransactionCompleted операция (перевод, пополнение, списание) проведена
+type TransactionCompleted struct {
+	Transaction models.Transaction
+}
+
+func (TransactionCompleted) EventName() string { return "transaction.completed" }
+
+// TransactionReversed операция сторнирована; Reversal — обратная операция, вернувшая деньги
+type TransactionReversed struct {
+	Transaction models.Transaction
+	Reversal    models.Transaction
+}
+
+func (TransactionReversed) EventName() string { return "transaction.reversed" }
+
+// UserErased пользователь удалён: счета закрыты, персональные данные обезличены; Certificate — выданный сертификат
+type UserErased struct {
+	Certificate models.ErasureCertificate
+}
+
+func (UserErased) EventName() string { return "user.erased" }
+
+type handler func(Event) error
+
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]handler)}
+}
+
+// Subscribe подписывает fn на события типа E
+func Subscribe[E Event](bus *Bus, fn func(E) error) {
+	var zero E
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	name := zero.EventName()
+	bus.handlers[name] = append(bus.handlers[name], func(event Event) error { return fn(event.(E)) })
+}
+
+// Publish доставляет событие всем подписчикам. На nil-шине ничего не делает: сервисы без подписчиков
+// (например, в тестах) создаются без шины
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	handlers := b.handlers[event.EventName()]
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		if err := safeCall(h, event); err != nil {
+			log.Printf("events: %s: %v", event.EventName(), err)
+		}
+	}
+}
+
+func safeCall(h handler, event Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(event)
+}
@@ -0,0 +1,46 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus_DeliversByEventType(t *testing.T) {
+	bus := NewBus()
+	var completed, reversed []string
+	Subscribe(bus, func(e TransactionCompleted) error {
+		completed = append(completed, e.Transaction.ID)
+		return nil
+	})
+	Subscribe(bus, func(e TransactionReversed) error {
+		reversed = append(reversed, e.Transaction.ID+"/"+e.Reversal.ID)
+		return nil
+	})
+
+	bus.Publish(TransactionCompleted{Transaction: models.Transaction{ID: "tx-1"}})
+	bus.Publish(TransactionReversed{Transaction: models.Transaction{ID: "tx-1"}, Reversal: models.Transaction{ID: "tx-2"}})
+
+	assert.Equal(t, []string{"tx-1"}, completed)
+	assert.Equal(t, []string{"tx-1/tx-2"}, reversed)
+}
+
+func TestBus_FailingHandlerDoesNotStopOthers(t *testing.T) {
+	bus := NewBus()
+	delivered := 0
+	Subscribe(bus, func(TransactionCompleted) error { return errors.New("boom") })
+	Subscribe(bus, func(TransactionCompleted) error { panic("boom") })
+	Subscribe(bus, func(TransactionCompleted) error {
+		delivered++
+		return nil
+	})
+
+	assert.NotPanics(t, func() { bus.Publish(TransactionCompleted{}) })
+	assert.Equal(t, 1, delivered)
+
+	var nilBus *Bus
+	assert.NotPanics(t, func() { nilBus.Publish(TransactionCompleted{}) })
+}
@@ -0,0 +1,137 @@
+// Package fx — курсы обмена валют. Курс задаётся отдельно для каждого направления, как в обменнике:
+// курс покупки и продажи различаются, поэтому обратный курс не выводится из прямого.
+package fx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"petProjectMike/internal/models"
+)
+
+var (
+	ErrNoRate      = errors.New("no exchange rate")
+	ErrInvalidRate = errors.New("invalid exchange rate")
+)
+
+// maxRateDecimals сколько знаков после запятой допускается в курсе
+const maxRateDecimals = 8
+
+// Rate курс обмена: сколько единиц To даётся за единицу From. Value — десятичная запись курса
+// в том виде, в каком он задан; по ней конвертация и записывается в историю
+type Rate struct {
+	From  string
+	To    string
+	Value string
+	// num/den курс в минимальных единицах: сколько минимальных единиц To за минимальную единицу From
+	num, den int64
+}
+
+// ParseRate разбирает курс вида "0.92" для пары from→to
+func ParseRate(from, to, value string) (Rate, error) {
+	fromExp, err := models.CurrencyExponent(from)
+	if err != nil {
+		return Rate{}, err
+	}
+	toExp, err := models.CurrencyExponent(to)
+	if err != nil {
+		return Rate{}, err
+	}
+	whole, frac, _ := strings.Cut(value, ".")
+	if whole == "" || !isDigits(whole) || !isDigits(frac) || len(whole) > 9 || len(frac) > maxRateDecimals {
+		return Rate{}, fmt.Errorf("%w: %s/%s %q", ErrInvalidRate, from, to, value)
+	}
+	var num int64
+	for _, c := range whole + frac {
+		num = num*10 + int64(c-'0')
+	}
+	if num == 0 {
+		return Rate{}, fmt.Errorf("%w: %s/%s must be positive", ErrInvalidRate, from, to)
+	}
+	den := pow10(len(frac))
+	// Курс задан для целых единиц валют, а суммы хранятся в минимальных
+	if toExp > fromExp {
+		num *= pow10(toExp - fromExp)
+	} else {
+		den *= pow10(fromExp - toExp)
+	}
+	return Rate{From: from, To: to, Value: value, num: num, den: den}, nil
+}
+
+// Convert переводит сумму в валюте From в валюту To. Дробные минимальные единицы отбрасываются,
+// чтобы конвертация не давала больше, чем положено по курсу
+func (r Rate) Convert(amount models.Money) (models.Money, error) {
+	if amount.Currency != r.From {
+		return models.Money{}, fmt.Errorf("%w: rate %s/%s applied to %s", models.ErrCurrencyMismatch, r.From, r.To, amount.Currency)
+	}
+	converted, err := amount.MulRat(r.num, r.den, models.RoundDown)
+	if err != nil {
+		return models.Money{}, err
+	}
+	return models.NewMoney(converted.Minor, r.To), nil
+}
+
+// Table таблица курсов. Пустая или nil таблица не знает ни одного курса
+type Table struct {
+	rates map[string]Rate
+}
+
+func pairKey(from, to string) string {
+	return from + "/" + to
+}
+
+// ParseTable разбирает курсы вида "USD/EUR:0.92,EUR/USD:1.08"; пустая строка — без курсов
+func ParseTable(spec string) (*Table, error) {
+	table := &Table{rates: make(map[string]Rate)}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pair, value, ok := strings.Cut(item, ":")
+		from, to, okPair := strings.Cut(pair, "/")
+		if !ok || !okPair {
+			return nil, fmt.Errorf("%w: %q: expected FROM/TO:RATE", ErrInvalidRate, item)
+		}
+		if from == to {
+			return nil, fmt.Errorf("%w: %q: same currency", ErrInvalidRate, item)
+		}
+		rate, err := ParseRate(from, to, value)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := table.rates[pairKey(from, to)]; exists {
+			return nil, fmt.Errorf("%w: duplicate rate %s", ErrInvalidRate, pair)
+		}
+		table.rates[pairKey(from, to)] = rate
+	}
+	return table, nil
+}
+
+// Rate курс from→to
+func (t *Table) Rate(from, to string) (Rate, error) {
+	if t != nil {
+		if rate, ok := t.rates[pairKey(from, to)]; ok {
+			return rate, nil
+		}
+	}
+	return Rate{}, fmt.Errorf("%w: %s/%s", ErrNoRate, from, to)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
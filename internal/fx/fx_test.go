@@ -0,0 +1,58 @@
+package fx
+
+import (
+	"testing"
+
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRate_Convert(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		rate     string
+		amount   models.Money
+		expected models.Money
+	}{
+		{"same exponent", "USD", "EUR", "0.92", models.NewMoney(5000, "USD"), models.NewMoney(4600, "EUR")},
+		{"rounds down", "USD", "EUR", "0.9275", models.NewMoney(1001, "USD"), models.NewMoney(928, "EUR")},
+		{"to fewer decimals", "USD", "JPY", "149.5", models.NewMoney(1000, "USD"), models.NewMoney(1495, "JPY")},
+		{"to more decimals", "JPY", "USD", "0.0067", models.NewMoney(1000, "JPY"), models.NewMoney(670, "USD")},
+		{"to three decimals", "EUR", "KWD", "0.33", models.NewMoney(100, "EUR"), models.NewMoney(330, "KWD")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := ParseRate(tt.from, tt.to, tt.rate)
+			assert.NoError(t, err)
+			converted, err := rate.Convert(tt.amount)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, converted)
+		})
+	}
+
+	rate, _ := ParseRate("USD", "EUR", "0.92")
+	_, err := rate.Convert(models.NewMoney(100, "EUR"))
+	assert.ErrorIs(t, err, models.ErrCurrencyMismatch)
+}
+
+func TestParseTable(t *testing.T) {
+	table, err := ParseTable(" USD/EUR:0.92, EUR/USD:1.08 ")
+	assert.NoError(t, err)
+	rate, err := table.Rate("USD", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.92", rate.Value)
+
+	// Обратный курс не выводится из прямого
+	_, err = table.Rate("EUR", "RUB")
+	assert.ErrorIs(t, err, ErrNoRate)
+	var empty *Table
+	_, err = empty.Rate("USD", "EUR")
+	assert.ErrorIs(t, err, ErrNoRate)
+
+	for _, spec := range []string{"USD/EUR", "USDEUR:1", "USD/USD:1", "USD/EUR:0", "USD/EUR:-1", "USD/EUR:1.123456789", "USD/XXX:1", "USD/EUR:1,USD/EUR:2"} {
+		_, err := ParseTable(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,251 @@
+// Package ledger — главная книга по принципу двойной записи. Любое движение денег
+// дебетует один счёт и кредитует другой, поэтому сумма всех проводок всегда равна нулю,
+// а остаток счёта можно пересчитать из его проводок.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/models"
+)
+
+var ErrUnbalancedEntry = errors.New("ledger entry is unbalanced")
+
+// Move описывает перемещение суммы со счёта from на счёт to: кредит from и дебет to
+func Move(from, to string, amount models.Money) []models.Posting {
+	return []models.Posting{
+		{AccountID: from, Amount: models.NewMoney(-amount.Minor, amount.Currency)},
+		{AccountID: to, Amount: amount},
+	}
+}
+
+// validate проверяет, что запись сбалансирована: минимум две ненулевые проводки в одной валюте с нулевой суммой
+func validate(entry *models.LedgerEntry) error {
+	if len(entry.Postings) < 2 {
+		return fmt.Errorf("%w: at least two postings required", ErrUnbalancedEntry)
+	}
+	currency := entry.Postings[0].Amount.Currency
+	total := models.Zero(currency)
+	for _, posting := range entry.Postings {
+		if posting.AccountID == "" {
+			return fmt.Errorf("%w: posting without account", ErrUnbalancedEntry)
+		}
+		if posting.Amount.IsZero() {
+			return fmt.Errorf("%w: zero posting to %s", ErrUnbalancedEntry, posting.AccountID)
+		}
+		var err error
+		if total, err = total.Add(posting.Amount); err != nil {
+			return err
+		}
+	}
+	if !total.IsZero() {
+		return fmt.Errorf("%w: postings sum to %s", ErrUnbalancedEntry, total)
+	}
+	return nil
+}
+
+// Post сохраняет запись и переносит её проводки на остатки клиентских счетов.
+// Вызывается внутри RunInTx, чтобы запись и остатки менялись вместе.
+func Post(tx database.Tx, entry *models.LedgerEntry) error {
+	if err := validate(entry); err != nil {
+		return err
+	}
+	for i := range entry.Postings {
+		entry.Postings[i].EntryID = entry.ID
+	}
+	if err := tx.CreateLedgerEntry(entry); err != nil {
+		return err
+	}
+
+	// Обычно вызывающий код уже заблокировал эти счета, тогда повторная блокировка ничего не делает
+	var accounts []string
+	for _, posting := range entry.Postings {
+		if !models.IsSystemAccount(posting.AccountID) {
+			accounts = append(accounts, posting.AccountID)
+		}
+	}
+	if err := tx.LockAccounts(accounts...); err != nil {
+		return err
+	}
+
+	for _, posting := range entry.Postings {
+		if models.IsSystemAccount(posting.AccountID) {
+			continue
+		}
+		account, err := tx.GetAccount(posting.AccountID)
+		if err != nil {
+			return err
+		}
+		balance, err := account.Balance.Add(posting.Amount)
+		if err != nil {
+			return err
+		}
+		account.Balance = balance
+		account.UpdatedAt = time.Now()
+		if err := tx.UpdateAccount(account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Balance остаток счёта в валюте currency, пересчитанный из проводок
+func Balance(store database.Store, accountID, currency string) (models.Money, error) {
+	postings, err := store.GetPostingsByAccount(accountID)
+	if err != nil {
+		return models.Money{}, err
+	}
+	balance := models.Zero(currency)
+	for _, posting := range postings {
+		if posting.Amount.Currency != currency {
+			continue
+		}
+		if balance, err = balance.Add(posting.Amount); err != nil {
+			return models.Money{}, err
+		}
+	}
+	return balance, nil
+}
+
+// TrialLine остаток одного счёта в одной валюте
+type TrialLine struct {
+	AccountID string       `json:"account_id"`
+	System    bool         `json:"system"`
+	Balance   models.Money `json:"balance"`
+}
+
+// Mismatch расхождение между сохранённым остатком счёта и остатком по проводкам
+type Mismatch struct {
+	AccountID string       `json:"account_id"`
+	Stored    models.Money `json:"stored"`
+	Derived   models.Money `json:"derived"`
+}
+
+// TrialBalance оборотно-сальдовая ведомость. Книга сходится, если итог каждой валюты нулевой
+// и сохранённые остатки клиентских счетов совпадают с остатками по проводкам.
+type TrialBalance struct {
+	Balanced   bool           `json:"balanced"`
+	Totals     []models.Money `json:"totals"`
+	Lines      []TrialLine    `json:"lines"`
+	Mismatches []Mismatch     `json:"mismatches"`
+}
+
+// trialAttempts сколько раз ведомость перестраивается, если по ходу появились проводки по новым счетам
+const trialAttempts = 3
+
+// errNewAccounts в книге появились проводки по счетам, которые ведомость ещё не заблокировала
+var errNewAccounts = errors.New("postings to unlocked accounts")
+
+// ComputeTrialBalance строит ведомость по всем проводкам книги. Проводки и остатки читаются в одной
+// транзакции под блокировками клиентских счетов: иначе перевод, закоммиченный между чтениями,
+// выглядел бы как расхождение. Какие счета блокировать, видно только из проводок, поэтому
+// при появлении нового счёта транзакция повторяется с расширенным набором блокировок.
+func ComputeTrialBalance(db database.Database) (*TrialBalance, error) {
+	locked := make(map[string]bool)
+	for attempt := 0; attempt < trialAttempts; attempt++ {
+		var report *TrialBalance
+		err := db.RunInTx(func(tx database.Tx) error {
+			ids := make([]string, 0, len(locked))
+			for id := range locked {
+				ids = append(ids, id)
+			}
+			if err := tx.LockAccounts(ids...); err != nil {
+				return err
+			}
+			postings, err := tx.GetAllPostings()
+			if err != nil {
+				return err
+			}
+			grown := false
+			for _, posting := range postings {
+				if !models.IsSystemAccount(posting.AccountID) && !locked[posting.AccountID] {
+					locked[posting.AccountID] = true
+					grown = true
+				}
+			}
+			if grown {
+				return errNewAccounts
+			}
+			report, err = trialBalance(tx, postings)
+			return err
+		})
+		if !errors.Is(err, errNewAccounts) {
+			return report, err
+		}
+	}
+	return nil, database.ErrConflict
+}
+
+// trialBalance строит ведомость по проводкам, сверяя их с остатками счетов из store
+func trialBalance(store database.Store, postings []*models.Posting) (*TrialBalance, error) {
+	var err error
+
+	type lineKey struct{ account, currency string }
+	balances := make(map[lineKey]models.Money)
+	totals := make(map[string]models.Money)
+	for _, posting := range postings {
+		key := lineKey{posting.AccountID, posting.Amount.Currency}
+		balance, ok := balances[key]
+		if !ok {
+			balance = models.Zero(key.currency)
+		}
+		if balances[key], err = balance.Add(posting.Amount); err != nil {
+			return nil, err
+		}
+		total, ok := totals[key.currency]
+		if !ok {
+			total = models.Zero(key.currency)
+		}
+		if totals[key.currency], err = total.Add(posting.Amount); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &TrialBalance{
+		Balanced:   true,
+		Totals:     []models.Money{},
+		Lines:      []TrialLine{},
+		Mismatches: []Mismatch{},
+	}
+	for _, total := range totals {
+		report.Totals = append(report.Totals, total)
+		if !total.IsZero() {
+			report.Balanced = false
+		}
+	}
+	sort.Slice(report.Totals, func(i, j int) bool { return report.Totals[i].Currency < report.Totals[j].Currency })
+
+	for key, balance := range balances {
+		system := models.IsSystemAccount(key.account)
+		report.Lines = append(report.Lines, TrialLine{AccountID: key.account, System: system, Balance: balance})
+		if system {
+			continue
+		}
+
+		// У удалённого счёта остаток по проводкам должен быть нулевым
+		stored := models.Zero(key.currency)
+		account, err := store.GetAccount(key.account)
+		switch {
+		case err == nil:
+			stored = account.Balance
+		case !errors.Is(err, database.ErrNotFound):
+			return nil, err
+		}
+		if stored != balance {
+			report.Mismatches = append(report.Mismatches, Mismatch{AccountID: key.account, Stored: stored, Derived: balance})
+			report.Balanced = false
+		}
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		if report.Lines[i].AccountID != report.Lines[j].AccountID {
+			return report.Lines[i].AccountID < report.Lines[j].AccountID
+		}
+		return report.Lines[i].Balance.Currency < report.Lines[j].Balance.Currency
+	})
+	sort.Slice(report.Mismatches, func(i, j int) bool { return report.Mismatches[i].AccountID < report.Mismatches[j].AccountID })
+	return report, nil
+}
@@ -0,0 +1,149 @@
+package ledger
+
+import (
+	"testing"
+
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDB(t *testing.T) *database.InMemoryDB {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	return db
+}
+
+func TestPost_RejectsInvalidEntries(t *testing.T) {
+	db := newTestDB(t)
+	tests := []struct {
+		name     string
+		postings []models.Posting
+	}{
+		{"single posting", []models.Posting{{AccountID: "account-1", Amount: models.NewMoney(100, "USD")}}},
+		{"unbalanced", []models.Posting{
+			{AccountID: models.CashInAccount, Amount: models.NewMoney(-100, "USD")},
+			{AccountID: "account-1", Amount: models.NewMoney(99, "USD")},
+		}},
+		{"zero posting", []models.Posting{
+			{AccountID: models.CashInAccount, Amount: models.Zero("USD")},
+			{AccountID: "account-1", Amount: models.Zero("USD")},
+		}},
+		{"missing account", []models.Posting{
+			{AccountID: "", Amount: models.NewMoney(-100, "USD")},
+			{AccountID: "account-1", Amount: models.NewMoney(100, "USD")},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.RunInTx(func(tx database.Tx) error {
+				return Post(tx, models.NewLedgerEntry("ref", "test", tt.name, tt.postings...))
+			})
+			assert.ErrorIs(t, err, ErrUnbalancedEntry)
+		})
+	}
+
+	// Проводки в разных валютах не складываются
+	err := db.RunInTx(func(tx database.Tx) error {
+		return Post(tx, models.NewLedgerEntry("ref", "test", "fx",
+			models.Posting{AccountID: models.CashInAccount, Amount: models.NewMoney(-100, "EUR")},
+			models.Posting{AccountID: "account-1", Amount: models.NewMoney(100, "USD")},
+		))
+	})
+	assert.ErrorIs(t, err, models.ErrCurrencyMismatch)
+
+	report, err := ComputeTrialBalance(db)
+	assert.NoError(t, err)
+	assert.True(t, report.Balanced)
+}
+
+func TestPost_UpdatesCustomerBalances(t *testing.T) {
+	db := newTestDB(t)
+	err := db.RunInTx(func(tx database.Tx) error {
+		return Post(tx, models.NewLedgerEntry("ref", "transfer", "rent", Move("account-1", "account-2", models.NewMoney(2500, "USD"))...))
+	})
+	assert.NoError(t, err)
+
+	from, _ := db.GetAccount("account-1")
+	to, _ := db.GetAccount("account-2")
+	assert.Equal(t, models.NewMoney(97500, "USD"), from.Balance)
+	assert.Equal(t, models.NewMoney(2500, "USD"), to.Balance)
+
+	derived, err := Balance(db, "account-2", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, to.Balance, derived)
+
+	// Запись на несуществующий клиентский счёт откатывается целиком
+	err = db.RunInTx(func(tx database.Tx) error {
+		return Post(tx, models.NewLedgerEntry("ref", "transfer", "ghost", Move("account-1", "ghost", models.NewMoney(100, "USD"))...))
+	})
+	assert.Error(t, err)
+	from, _ = db.GetAccount("account-1")
+	assert.Equal(t, models.NewMoney(97500, "USD"), from.Balance)
+}
+
+func TestComputeTrialBalance(t *testing.T) {
+	db := newTestDB(t)
+	err := db.RunInTx(func(tx database.Tx) error {
+		if err := Post(tx, models.NewLedgerEntry("d", "deposit", "", Move(models.CashInAccount, "account-2", models.NewMoney(700, "USD"))...)); err != nil {
+			return err
+		}
+		return Post(tx, models.NewLedgerEntry("b", "bonus", "", Move(models.BonusExpenseAccount, "account-2", models.NewMoney(50, "USD"))...))
+	})
+	assert.NoError(t, err)
+
+	report, err := ComputeTrialBalance(db)
+	assert.NoError(t, err)
+	assert.True(t, report.Balanced)
+	assert.Equal(t, []models.Money{models.Zero("USD")}, report.Totals)
+	assert.Empty(t, report.Mismatches)
+	assert.Equal(t, []TrialLine{
+		{AccountID: "account-1", Balance: models.NewMoney(100000, "USD")},
+		{AccountID: "account-2", Balance: models.NewMoney(750, "USD")},
+		{AccountID: models.BonusExpenseAccount, System: true, Balance: models.NewMoney(-50, "USD")},
+		{AccountID: models.CashInAccount, System: true, Balance: models.NewMoney(-700, "USD")},
+		{AccountID: models.OpeningBalanceAccount, System: true, Balance: models.NewMoney(-100000, "USD")},
+	}, report.Lines)
+
+	// Остаток, изменённый в обход книги, ведомость показывает как расхождение
+	account, _ := db.GetAccount("account-2")
+	account.Balance = models.NewMoney(1000000, "USD")
+	assert.NoError(t, db.UpdateAccount(account))
+
+	report, err = ComputeTrialBalance(db)
+	assert.NoError(t, err)
+	assert.False(t, report.Balanced)
+	assert.Equal(t, []Mismatch{{AccountID: "account-2", Stored: models.NewMoney(1000000, "USD"), Derived: models.NewMoney(750, "USD")}}, report.Mismatches)
+}
+
+func TestComputeTrialBalance_ConsistentDuringPosting(t *testing.T) {
+	db := newTestDB(t)
+
+	// Переводы идут параллельно с построением ведомости: проводки и остатки должны читаться согласованно
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 300; i++ {
+			err := db.RunInTx(func(tx database.Tx) error {
+				if err := tx.LockAccounts("account-1", "account-2"); err != nil {
+					return err
+				}
+				return Post(tx, models.NewLedgerEntry("t", "transfer", "", Move("account-1", "account-2", models.NewMoney(1, "USD"))...))
+			})
+			assert.NoError(t, err)
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		report, err := ComputeTrialBalance(db)
+		if assert.NoError(t, err) {
+			assert.Empty(t, report.Mismatches)
+		}
+	}
+}
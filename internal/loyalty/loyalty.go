@@ -0,0 +1,130 @@
+// Package loyalty — правила программы лояльности: сколько баллов даёт операция, какой у пользователя
+// уровень по активности за скользящие 12 месяцев, какой множитель бонусов даёт уровень и сколько стоят
+// баллы при обмене на бонус. Пакет только считает; баланс и журнал баллов ведёт сервис.
+package loyalty
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"petProjectMike/internal/models"
+)
+
+var (
+	ErrInvalidPoints = errors.New("invalid number of points")
+	// ErrNotConvertible для валюты не задана стоимость баллов
+	ErrNotConvertible = errors.New("points cannot be converted into this currency")
+)
+
+// Уровни программы
+const (
+	TierBronze = "bronze"
+	TierSilver = "silver"
+	TierGold   = "gold"
+)
+
+const (
+	// ActivityMonths за сколько месяцев считается активность для уровня
+	ActivityMonths = 12
+	// ConversionStep баллы обмениваются на бонус пачками по столько баллов
+	ConversionStep = 100
+	// BonusExpiresInDays срок бонуса, полученного обменом баллов
+	BonusExpiresInDays = 90
+	// baseMultiplierBP множитель ×1 в базисных пунктах
+	baseMultiplierBP = 10000
+)
+
+// Tier уровень: достаётся при активности от MinPoints баллов и умножает бонусы за операции
+// на MultiplierBP/10000
+type Tier struct {
+	Name         string `json:"name"`
+	MinPoints    int64  `json:"min_points"`
+	MultiplierBP int64  `json:"multiplier_bp"`
+}
+
+// DefaultTiers уровни по умолчанию, по возрастанию порога
+func DefaultTiers() []Tier {
+	return []Tier{
+		{Name: TierBronze, MinPoints: 0, MultiplierBP: baseMultiplierBP},
+		{Name: TierSilver, MinPoints: 1000, MultiplierBP: 12500},
+		{Name: TierGold, MinPoints: 5000, MultiplierBP: 15000},
+	}
+}
+
+// Program параметры программы
+type Program struct {
+	// EarnUnit сумма операции в валюте, за которую начисляется один балл; операция в валюте без суммы баллов не даёт
+	EarnUnit map[string]models.Money
+	// StepValue сколько стоят ConversionStep баллов в валюте бонуса; в валюту без стоимости баллы не обмениваются
+	StepValue map[string]models.Money
+	// Tiers по возрастанию MinPoints; у первого порог нулевой
+	Tiers []Tier
+}
+
+// New программа с уровнями по умолчанию
+func New(earnUnit, stepValue map[string]models.Money) *Program {
+	return &Program{EarnUnit: earnUnit, StepValue: stepValue, Tiers: DefaultTiers()}
+}
+
+// Points баллы за операцию на сумму amount: по баллу за каждую полную EarnUnit
+func (p *Program) Points(amount models.Money) int64 {
+	unit, ok := p.EarnUnit[amount.Currency]
+	if !ok || !unit.IsPositive() || !amount.IsPositive() {
+		return 0
+	}
+	return amount.Minor / unit.Minor
+}
+
+// TierFor уровень при активности activity баллов за последние ActivityMonths месяцев
+func (p *Program) TierFor(activity int64) Tier {
+	tier := p.Tiers[0]
+	for _, candidate := range p.Tiers[1:] {
+		if activity >= candidate.MinPoints {
+			tier = candidate
+		}
+	}
+	return tier
+}
+
+// Next следующий уровень после tier; ok=false — tier высший
+func (p *Program) Next(tier Tier) (next Tier, ok bool) {
+	for i, candidate := range p.Tiers {
+		if candidate.Name == tier.Name && i+1 < len(p.Tiers) {
+			return p.Tiers[i+1], true
+		}
+	}
+	return Tier{}, false
+}
+
+// Value сколько стоят points баллов в валюте currency. Обменять можно только целое число пачек ConversionStep
+func (p *Program) Value(points int64, currency string) (models.Money, error) {
+	if points <= 0 || points%ConversionStep != 0 {
+		return models.Money{}, fmt.Errorf("%w: points must be a positive multiple of %d", ErrInvalidPoints, ConversionStep)
+	}
+	step, ok := p.StepValue[currency]
+	if !ok {
+		return models.Money{}, fmt.Errorf("%w: %s", ErrNotConvertible, currency)
+	}
+	return step.MulRat(points/ConversionStep, 1, models.RoundDown)
+}
+
+// Activity активность для уровня к моменту at: начисленные за операции баллы за последние
+// ActivityMonths месяцев за вычетом возвращённых при сторно. Обмен баллов на бонус уровень не снижает.
+// Движения по операции exceptTransactionID не учитываются: бонус за операцию считается по уровню до неё
+func Activity(entries []*models.PointsEntry, at time.Time, exceptTransactionID string) int64 {
+	since := at.AddDate(0, -ActivityMonths, 0)
+	var activity int64
+	for _, entry := range entries {
+		if entry.Kind != models.PointsEarn && entry.Kind != models.PointsClawback {
+			continue
+		}
+		if exceptTransactionID != "" && entry.TransactionID == exceptTransactionID {
+			continue
+		}
+		if entry.CreatedAt.After(since) && !entry.CreatedAt.After(at) {
+			activity += entry.Points
+		}
+	}
+	return activity
+}
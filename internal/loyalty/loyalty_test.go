@@ -0,0 +1,66 @@
+package loyalty
+
+import (
+	"testing"
+	"time"
+
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testProgram() *Program {
+	return New(
+		map[string]models.Money{"USD": models.NewMoney(100, "USD"), "RUB": models.NewMoney(10000, "RUB")},
+		map[string]models.Money{"USD": models.NewMoney(100, "USD")},
+	)
+}
+
+func TestProgram_Points(t *testing.T) {
+	p := testProgram()
+	assert.Equal(t, int64(12), p.Points(models.NewMoney(1299, "USD")))
+	assert.Equal(t, int64(1), p.Points(models.NewMoney(15000, "RUB")))
+	assert.Equal(t, int64(0), p.Points(models.NewMoney(99, "USD")))
+	assert.Equal(t, int64(0), p.Points(models.NewMoney(100000, "EUR")))
+}
+
+func TestProgram_Tiers(t *testing.T) {
+	p := testProgram()
+	assert.Equal(t, TierBronze, p.TierFor(999).Name)
+	assert.Equal(t, TierSilver, p.TierFor(1000).Name)
+	assert.Equal(t, TierGold, p.TierFor(1000000).Name)
+
+	next, ok := p.Next(p.TierFor(0))
+	assert.True(t, ok)
+	assert.Equal(t, TierSilver, next.Name)
+	_, ok = p.Next(p.TierFor(5000))
+	assert.False(t, ok)
+}
+
+func TestProgram_Value(t *testing.T) {
+	p := testProgram()
+	value, err := p.Value(2500, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(2500, "USD"), value)
+
+	_, err = p.Value(150, "USD")
+	assert.ErrorIs(t, err, ErrInvalidPoints)
+	_, err = p.Value(0, "USD")
+	assert.ErrorIs(t, err, ErrInvalidPoints)
+	_, err = p.Value(100, "EUR")
+	assert.ErrorIs(t, err, ErrNotConvertible)
+}
+
+func TestActivity(t *testing.T) {
+	now := time.Now()
+	entries := []*models.PointsEntry{
+		{Kind: models.PointsEarn, Points: 700, TransactionID: "old", CreatedAt: now.AddDate(-1, 0, -1)},
+		{Kind: models.PointsEarn, Points: 300, TransactionID: "tx-1", CreatedAt: now.AddDate(0, -6, 0)},
+		{Kind: models.PointsEarn, Points: 200, TransactionID: "tx-2", CreatedAt: now.AddDate(0, -1, 0)},
+		{Kind: models.PointsClawback, Points: -200, TransactionID: "tx-2", CreatedAt: now.AddDate(0, 0, -1)},
+		{Kind: models.PointsConvert, Points: -300, CreatedAt: now},
+		{Kind: models.PointsEarn, Points: 50, TransactionID: "tx-3", CreatedAt: now},
+	}
+	assert.Equal(t, int64(350), Activity(entries, now, ""))
+	assert.Equal(t, int64(300), Activity(entries, now, "tx-3"))
+}
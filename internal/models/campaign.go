@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+)
+
+// События, за которые кампания может начислить бонус
+const (
+	TriggerWelcome  = "welcome"
+	TriggerTransfer = "transfer"
+	TriggerDeposit  = "deposit"
+	// TriggerReferrer и TriggerReferee подтверждённое приглашение: бонус пригласившему и приглашённому
+	TriggerReferrer = "referrer"
+	TriggerReferee  = "referee"
+)
+
+// Виды вознаграждения кампании
+const (
+	RewardFixed      = "fixed"
+	RewardPercentage = "percentage"
+)
+
+// Campaign правило начисления бонусов: на какие события срабатывает, при каких условиях и сколько начисляет
+type Campaign struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+	// Priority порядок срабатывания: кампании с большим приоритетом проверяются первыми
+	Priority   int                `json:"priority"`
+	Triggers   []string           `json:"triggers"`
+	Conditions CampaignConditions `json:"conditions"`
+	Reward     CampaignReward     `json:"reward"`
+	// Budget общий бюджет кампании в её валюте; нулевой — без ограничения.
+	// Spent сколько уже выдано, ведёт сервер: отозванные бонусы возвращаются в бюджет
+	Budget    Money     `json:"budget"`
+	Spent     Money     `json:"spent"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"`
+}
+
+// CampaignConditions условия срабатывания; незаданное условие ничего не ограничивает
+type CampaignConditions struct {
+	// Currency валюта операции; обязательна, если заданы границы суммы
+	Currency  string `json:"currency,omitempty"`
+	MinAmount Money  `json:"min_amount"`
+	MaxAmount Money  `json:"max_amount"`
+	// UserIDs, RegisteredAfter и RegisteredBefore задают когорту: явный список пользователей
+	// и окно даты регистрации
+	UserIDs          []string   `json:"user_ids,omitempty"`
+	RegisteredAfter  *time.Time `json:"registered_after,omitempty"`
+	RegisteredBefore *time.Time `json:"registered_before,omitempty"`
+	// StartsAt и EndsAt окно действия кампании
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+// CampaignReward вознаграждение: фиксированная сумма или процент от суммы операции с потолком
+type CampaignReward struct {
+	Kind   string `json:"kind"`
+	Amount Money  `json:"amount"`
+	// RateBP процент в базисных пунктах: 100 = 1%, 50 = 0.5%
+	RateBP int64 `json:"rate_bp,omitempty"`
+	// Cap потолок процентного вознаграждения в валюте операции
+	Cap           Money  `json:"cap"`
+	BonusType     string `json:"bonus_type"`
+	ExpiresInDays int    `json:"expires_in_days"`
+}
+
+// CloneCampaign глубокая копия: срезы и указатели кампании не разделяются с оригиналом
+func CloneCampaign(c *Campaign) *Campaign {
+	copied := *c
+	copied.Triggers = append([]string(nil), c.Triggers...)
+	copied.Conditions.UserIDs = append([]string(nil), c.Conditions.UserIDs...)
+	copied.Conditions.RegisteredAfter = cloneTime(c.Conditions.RegisteredAfter)
+	copied.Conditions.RegisteredBefore = cloneTime(c.Conditions.RegisteredBefore)
+	copied.Conditions.StartsAt = cloneTime(c.Conditions.StartsAt)
+	copied.Conditions.EndsAt = cloneTime(c.Conditions.EndsAt)
+	return &copied
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// ErasureCertificate подтверждение удаления пользователя: какие счета закрыты, какие бонусы погашены,
+// какие персональные данные обезличены и до какого срока хранятся финансовые записи. У пользователя
+// он один и после выдачи не меняется
+type ErasureCertificate struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	// RequestedBy кто запустил удаление: пользователь-администратор или внутренний сервис
+	RequestedBy    string   `json:"requested_by"`
+	ClosedAccounts []string `json:"closed_accounts"`
+	ExpiredBonuses []string `json:"expired_bonuses"`
+	// ErasedFields обезличенные поля с персональными данными ("user.email", "referral_code.device_id")
+	ErasedFields []string  `json:"erased_fields"`
+	ErasedAt     time.Time `json:"erased_at"`
+	// RetainUntil до какого момента хранятся операции, проводки и бонусы пользователя
+	RetainUntil time.Time `json:"retain_until"`
+	// Digest SHA-256 остальных полей в hex: по нему проверяют, что сертификат не изменён после выдачи
+	Digest string `json:"digest"`
+}
+
+// ComputeDigest SHA-256 полей сертификата кроме самого Digest. Время берётся с точностью до секунды
+// в UTC, поэтому дайджест не зависит от того, как хранилище округляет и в каком поясе отдаёт время
+func (c *ErasureCertificate) ComputeDigest() string {
+	lines := []string{
+		c.ID,
+		c.UserID,
+		c.RequestedBy,
+		strings.Join(c.ClosedAccounts, ","),
+		strings.Join(c.ExpiredBonuses, ","),
+		strings.Join(c.ErasedFields, ","),
+		c.ErasedAt.UTC().Format(time.RFC3339),
+		c.RetainUntil.UTC().Format(time.RFC3339),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify совпадает ли Digest с содержимым сертификата
+func (c *ErasureCertificate) Verify() bool {
+	return c.Digest == c.ComputeDigest()
+}
+
+// CloneErasureCertificate копирует сертификат; пустые списки остаются пустыми, а не nil,
+// чтобы в ответах API они были [], а не null
+func CloneErasureCertificate(c *ErasureCertificate) *ErasureCertificate {
+	copied := *c
+	copied.ClosedAccounts = append(make([]string, 0, len(c.ClosedAccounts)), c.ClosedAccounts...)
+	copied.ExpiredBonuses = append(make([]string, 0, len(c.ExpiredBonuses)), c.ExpiredBonuses...)
+	copied.ErasedFields = append(make([]string, 0, len(c.ErasedFields)), c.ErasedFields...)
+	return &copied
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Системные счета главной книги: через них деньги входят в систему и выходят из неё.
+// В таблице счетов их нет, остаток у них есть только в проводках.
+const (
+	CashInAccount         = "cash-in"
+	CashOutAccount        = "cash-out"
+	BonusExpenseAccount   = "bonus-expense"
+	OpeningBalanceAccount = "opening-balance"
+)
+
+func IsSystemAccount(id string) bool {
+	switch id {
+	case CashInAccount, CashOutAccount, BonusExpenseAccount, OpeningBalanceAccount:
+		return true
+	}
+	return false
+}
+
+// Posting одна сторона движения денег: положительная сумма — дебет (остаток счёта растёт),
+// отрицательная — кредит (остаток уменьшается)
+type Posting struct {
+	EntryID   string `json:"entry_id"`
+	AccountID string `json:"account_id"`
+	Amount    Money  `json:"amount"`
+}
+
+// LedgerEntry запись главной книги: набор проводок, сумма которых всегда равна нулю
+type LedgerEntry struct {
+	ID string `json:"id"`
+	// Reference — что породило запись: ID транзакции, бонуса или счёта (для начального остатка)
+	Reference   string    `json:"reference"`
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+	Postings    []Posting `json:"postings"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func NewLedgerEntry(reference, entryType, description string, postings ...Posting) *LedgerEntry {
+	entry := &LedgerEntry{
+		ID:          uuid.New().String(),
+		Reference:   reference,
+		Type:        entryType,
+		Description: description,
+		Postings:    postings,
+		CreatedAt:   time.Now(),
+	}
+	for i := range entry.Postings {
+		entry.Postings[i].EntryID = entry.ID
+	}
+	return entry
+}
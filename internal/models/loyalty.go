@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Виды движения баллов лояльности
+const (
+	PointsEarn     = "earn"
+	PointsClawback = "clawback"
+	PointsConvert  = "convert"
+)
+
+// SourcePoints источник бонусов, полученных обменом баллов
+const SourcePoints = "points"
+
+// LoyaltyAccount баланс баллов пользователя. Баланс меняется только вместе с записью в журнале
+// движений и может уйти в минус, если операцию, за которую начислены баллы, сторнировали
+type LoyaltyAccount struct {
+	UserID    string    `json:"user_id"`
+	Points    int64     `json:"points"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"`
+}
+
+// PointsEntry движение баллов: начисление за операцию, возврат при её сторно или обмен на бонус.
+// Points положительные при начислении и отрицательные при списании
+type PointsEntry struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Kind   string `json:"kind"`
+	Points int64  `json:"points"`
+	// TransactionID операция, за которую начислены или возвращены баллы
+	TransactionID string `json:"transaction_id,omitempty"`
+	// BonusID бонус, полученный обменом баллов
+	BonusID   string    `json:"bonus_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
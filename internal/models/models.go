@@ -6,42 +6,124 @@ import (
 	"github.com/google/uuid"
 )
 
+// Статусы счёта
+const (
+	AccountOpen = "open"
+	// AccountClosed счёт закрыт при удалении владельца: операции по нему запрещены, но сам счёт
+	// и его история хранятся вместе с финансовыми записями
+	AccountClosed = "closed"
+)
+
 type Account struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Balance   float64   `json:"balance"`
-	Currency  string    `json:"currency"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID       string `json:"id"`
+	UserID   string `json:"user_id"`
+	Balance  Money  `json:"balance"`
+	Currency string `json:"currency"`
+	// Status open или closed; у счетов, открытых до появления статусов, пустой — они открыты
+	Status    string     `json:"status"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	// Version растёт при каждом обновлении; Update* с устаревшей версией возвращает ErrConflict
+	Version int64 `json:"version"`
+}
+
+// Closed закрыт ли счёт
+func (a *Account) Closed() bool {
+	return a.Status == AccountClosed
 }
 
 type Transaction struct {
 	ID          string    `json:"id"`
 	FromAccount string    `json:"from_account"`
 	ToAccount   string    `json:"to_account"`
-	Amount      float64   `json:"amount"`
+	Amount      Money     `json:"amount"`
 	Type        string    `json:"type"`
 	Status      string    `json:"status"`
 	Description string    `json:"description"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	Version     int64     `json:"version"`
 }
 
 type Bonus struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Type      string    `json:"type"`
-	Amount    float64   `json:"amount"`
-	Status    string    `json:"status"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Type   string `json:"type"`
+	// CampaignID кампания, по правилам которой начислен бонус
+	CampaignID string `json:"campaign_id,omitempty"`
+	// Source событие, за которое начислен бонус (welcome, transfer, deposit); пустой у бонусов,
+	// начисленных до появления поля
+	Source string `json:"source,omitempty"`
+	// TransactionID операция, за которую начислен бонус; при её сторнировании бонус отзывается
+	TransactionID string `json:"transaction_id,omitempty"`
+	// UsedAccountID счёт, на который бонус зачислялся последним
+	UsedAccountID string `json:"used_account_id,omitempty"`
+	Amount        Money  `json:"amount"`
+	// RemainingAmount ещё не использованная часть бонуса; когда она кончается, бонус становится "used"
+	RemainingAmount Money     `json:"remaining_amount"`
+	Status          string    `json:"status"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	CreatedAt       time.Time `json:"created_at"`
+	Version         int64     `json:"version"`
+}
+
+// Remaining неиспользованный остаток бонуса. У бонусов, начисленных до частичного использования,
+// остатка нет: бонус тогда использовался только целиком, поэтому остаток — вся сумма или ноль
+func (b *Bonus) Remaining() Money {
+	if b.RemainingAmount != (Money{}) {
+		return b.RemainingAmount
+	}
+	if b.Status == "used" {
+		return Zero(b.Amount.Currency)
+	}
+	return b.Amount
+}
+
+// BonusRedemption использование бонуса: сколько списано с бонуса и какой операцией зачислено на счёт
+type BonusRedemption struct {
+	ID      string `json:"id"`
+	BonusID string `json:"bonus_id"`
+	UserID  string `json:"user_id"`
+	// AccountID счёт, на который зачислена сумма, TransactionID — операция зачисления
+	AccountID     string `json:"account_id"`
+	TransactionID string `json:"transaction_id"`
+	// Amount списано с бонуса (в валюте бонуса), Credited — зачислено на счёт (в валюте счёта)
+	Amount   Money `json:"amount"`
+	Credited Money `json:"credited"`
+	// Rate курс, по которому бонус конвертирован в валюту счёта; пустой — валюты совпадают
+	Rate      string    `json:"rate,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Payout сумма, зачисленная на счёт; у записей до появления конвертации она совпадает с Amount
+func (r *BonusRedemption) Payout() Money {
+	if r.Credited != (Money{}) {
+		return r.Credited
+	}
+	return r.Amount
+}
+
 type User struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	// Role роль для проверки доступа (customer, support, auditor, admin); пустая — customer
+	Role string `json:"role"`
+	// PasswordHash bcrypt-хеш пароля; пустой — вход по паролю невозможен. В ответы API не попадает
+	PasswordHash string `json:"-"`
+	// TokenGeneration поколение токенов: растёт при смене пароля, и токены прежних поколений
+	// перестают приниматься. В ответы API не попадает
+	TokenGeneration int64     `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+	// ErasedAt когда персональные данные пользователя обезличены; такой пользователь не может войти
+	ErasedAt *time.Time `json:"erased_at,omitempty"`
+	Version  int64      `json:"version"`
+}
+
+// Erased обезличен ли пользователь
+func (u *User) Erased() bool {
+	return u.ErasedAt != nil
 }
 
 func NewAccount(userID, currency string) *Account {
@@ -49,14 +131,15 @@ func NewAccount(userID, currency string) *Account {
 	return &Account{
 		ID:        uuid.New().String(),
 		UserID:    userID,
-		Balance:   0.0,
+		Balance:   Zero(currency),
 		Currency:  currency,
+		Status:    AccountOpen,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 }
 
-func NewTransaction(fromAccount, toAccount string, amount float64, transactionType, description string) *Transaction {
+func NewTransaction(fromAccount, toAccount string, amount Money, transactionType, description string) *Transaction {
 	now := time.Now()
 	return &Transaction{
 		ID:          uuid.New().String(),
@@ -71,15 +154,31 @@ func NewTransaction(fromAccount, toAccount string, amount float64, transactionTy
 	}
 }
 
-func NewBonus(userID, bonusType string, amount float64, expiresAt time.Time) *Bonus {
+// NewBonusRedemption запись об использовании части бонуса amount, зачисленной операцией transaction по курсу rate
+func NewBonusRedemption(bonus *Bonus, amount Money, transaction *Transaction, rate string) *BonusRedemption {
+	return &BonusRedemption{
+		ID:            uuid.New().String(),
+		BonusID:       bonus.ID,
+		UserID:        bonus.UserID,
+		AccountID:     transaction.ToAccount,
+		TransactionID: transaction.ID,
+		Amount:        amount,
+		Credited:      transaction.Amount,
+		Rate:          rate,
+		CreatedAt:     transaction.CreatedAt,
+	}
+}
+
+func NewBonus(userID, bonusType string, amount Money, expiresAt time.Time) *Bonus {
 	now := time.Now()
 	return &Bonus{
-		ID:        uuid.New().String(),
-		UserID:    userID,
-		Type:      bonusType,
-		Amount:    amount,
-		Status:    "active",
-		ExpiresAt: expiresAt,
-		CreatedAt: now,
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		Type:            bonusType,
+		Amount:          amount,
+		RemainingAmount: amount,
+		Status:          "active",
+		ExpiresAt:       expiresAt,
+		CreatedAt:       now,
 	}
 }
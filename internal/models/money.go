@@ -0,0 +1,272 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrAmountOverflow   = errors.New("amount overflow")
+	ErrInvalidAmount    = errors.New("invalid amount")
+)
+
+// RoundingMode определяет, как округлять результат до минимальной единицы валюты
+type RoundingMode int
+
+const (
+	// RoundHalfEven — банковское округление (к ближайшему чётному)
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp — половина округляется от нуля
+	RoundHalfUp
+	// RoundDown — отбрасывание дробной части (к нулю)
+	RoundDown
+	// RoundUp — от нуля
+	RoundUp
+	// RoundFloor — к минус бесконечности
+	RoundFloor
+	// RoundCeiling — к плюс бесконечности
+	RoundCeiling
+)
+
+// currencyExponents — количество знаков после запятой для каждой валюты (ISO 4217)
+var currencyExponents = map[string]int{
+	"USD": 2,
+	"EUR": 2,
+	"RUB": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"KWD": 3,
+}
+
+// CurrencyExponent возвращает количество дробных знаков валюты
+func CurrencyExponent(currency string) (int, error) {
+	exp, ok := currencyExponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return exp, nil
+}
+
+// Money — точная денежная сумма в минимальных единицах валюты (центы, копейки)
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// ParseMoney разбирает десятичную строку ("10.50") в сумму указанной валюты.
+// Лишние дробные знаки считаются ошибкой, а не округляются.
+func ParseMoney(amount, currency string) (Money, error) {
+	exp, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	s := strings.TrimSpace(amount)
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	intPart, fracPart, hasDot := strings.Cut(s, ".")
+	if intPart == "" || (hasDot && fracPart == "") || !isDigits(intPart) || !isDigits(fracPart) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+	if len(fracPart) > exp {
+		return Money{}, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalidAmount, amount, exp)
+	}
+	fracPart += strings.Repeat("0", exp-len(fracPart))
+
+	minor, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrAmountOverflow, amount)
+	}
+	if negative {
+		minor = -minor
+	}
+	return NewMoney(minor, currency), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if m.Currency != other.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	sum := m.Minor + other.Minor
+	if (other.Minor > 0 && sum < m.Minor) || (other.Minor < 0 && sum > m.Minor) {
+		return Money{}, ErrAmountOverflow
+	}
+	return NewMoney(sum, m.Currency), nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	diff := m.Minor - other.Minor
+	if (other.Minor > 0 && diff > m.Minor) || (other.Minor < 0 && diff < m.Minor) {
+		return Money{}, ErrAmountOverflow
+	}
+	return NewMoney(diff, m.Currency), nil
+}
+
+func (m Money) Neg() (Money, error) {
+	if m.Minor == math.MinInt64 {
+		return Money{}, ErrAmountOverflow
+	}
+	return NewMoney(-m.Minor, m.Currency), nil
+}
+
+// Cmp сравнивает суммы одной валюты: -1, 0 или 1
+func (m Money) Cmp(other Money) (int, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Minor < other.Minor:
+		return -1, nil
+	case m.Minor > other.Minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m Money) IsZero() bool     { return m.Minor == 0 }
+func (m Money) IsPositive() bool { return m.Minor > 0 }
+func (m Money) IsNegative() bool { return m.Minor < 0 }
+
+// MulRat умножает сумму на дробь num/den (например, 5/1000 = 0.5%)
+// и округляет результат до минимальной единицы валюты.
+func (m Money) MulRat(num, den int64, mode RoundingMode) (Money, error) {
+	if den == 0 {
+		return Money{}, fmt.Errorf("%w: zero denominator", ErrInvalidAmount)
+	}
+	product := new(big.Int).Mul(big.NewInt(m.Minor), big.NewInt(num))
+	result := divRound(product, big.NewInt(den), mode)
+	if !result.IsInt64() {
+		return Money{}, ErrAmountOverflow
+	}
+	return NewMoney(result.Int64(), m.Currency), nil
+}
+
+// divRound делит x на y с округлением по заданному режиму
+func divRound(x, y *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	// знак точного результата
+	sign := x.Sign() * y.Sign()
+	awayFromZero := false
+	switch mode {
+	case RoundDown:
+	case RoundUp:
+		awayFromZero = true
+	case RoundFloor:
+		awayFromZero = sign < 0
+	case RoundCeiling:
+		awayFromZero = sign > 0
+	case RoundHalfUp, RoundHalfEven:
+		twiceRem := new(big.Int).Abs(r)
+		twiceRem.Lsh(twiceRem, 1)
+		switch twiceRem.Cmp(new(big.Int).Abs(y)) {
+		case 1:
+			awayFromZero = true
+		case 0:
+			awayFromZero = mode == RoundHalfUp || q.Bit(0) == 1
+		}
+	}
+
+	if awayFromZero {
+		q.Add(q, big.NewInt(int64(sign)))
+	}
+	return q
+}
+
+// Decimal возвращает сумму в десятичной записи с учётом экспоненты валюты ("10.50")
+func (m Money) Decimal() string {
+	exp, ok := currencyExponents[m.Currency]
+	if !ok {
+		exp = 2
+	}
+	digits := strconv.FormatInt(m.Minor, 10)
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON сериализует сумму строкой, чтобы клиенты не теряли точность на float.
+// Незаданная сумма (нулевое значение без валюты) сериализуется как null.
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m == (Money{}) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(moneyJSON{Amount: m.Decimal(), Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var raw moneyJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	parsed, err := ParseMoney(raw.Amount, raw.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
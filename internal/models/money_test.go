@@ -0,0 +1,145 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name          string
+		amount        string
+		currency      string
+		expected      Money
+		expectedError error
+	}{
+		{name: "integer", amount: "10", currency: "USD", expected: NewMoney(1000, "USD")},
+		{name: "one decimal", amount: "10.5", currency: "EUR", expected: NewMoney(1050, "EUR")},
+		{name: "two decimals", amount: "0.01", currency: "RUB", expected: NewMoney(1, "RUB")},
+		{name: "negative", amount: "-3.25", currency: "USD", expected: NewMoney(-325, "USD")},
+		{name: "zero exponent", amount: "150", currency: "JPY", expected: NewMoney(150, "JPY")},
+		{name: "three decimals", amount: "1.005", currency: "KWD", expected: NewMoney(1005, "KWD")},
+		{name: "too many decimals", amount: "1.005", currency: "USD", expectedError: ErrInvalidAmount},
+		{name: "decimals for JPY", amount: "1.5", currency: "JPY", expectedError: ErrInvalidAmount},
+		{name: "garbage", amount: "1e3", currency: "USD", expectedError: ErrInvalidAmount},
+		{name: "empty fraction", amount: "1.", currency: "USD", expectedError: ErrInvalidAmount},
+		{name: "unknown currency", amount: "1", currency: "XXX", expectedError: ErrUnknownCurrency},
+		{name: "overflow", amount: "999999999999999999999", currency: "USD", expectedError: ErrAmountOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			money, err := ParseMoney(tt.amount, tt.currency)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, money)
+		})
+	}
+}
+
+func TestMoney_Decimal(t *testing.T) {
+	assert.Equal(t, "10.50", NewMoney(1050, "USD").Decimal())
+	assert.Equal(t, "0.05", NewMoney(5, "USD").Decimal())
+	assert.Equal(t, "-0.05", NewMoney(-5, "USD").Decimal())
+	assert.Equal(t, "150", NewMoney(150, "JPY").Decimal())
+	assert.Equal(t, "1.005", NewMoney(1005, "KWD").Decimal())
+	assert.Equal(t, "10.50 USD", NewMoney(1050, "USD").String())
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	a := NewMoney(1000, "USD")
+	b := NewMoney(250, "USD")
+
+	sum, err := a.Add(b)
+	assert.NoError(t, err)
+	assert.Equal(t, NewMoney(1250, "USD"), sum)
+
+	diff, err := b.Sub(a)
+	assert.NoError(t, err)
+	assert.Equal(t, NewMoney(-750, "USD"), diff)
+	assert.True(t, diff.IsNegative())
+
+	cmp, err := a.Cmp(b)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cmp)
+
+	_, err = a.Add(NewMoney(1, "EUR"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	_, err = NewMoney(math.MaxInt64, "USD").Add(NewMoney(1, "USD"))
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+
+	_, err = NewMoney(math.MinInt64, "USD").Sub(NewMoney(1, "USD"))
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+
+	_, err = NewMoney(math.MinInt64, "USD").Neg()
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+}
+
+func TestMoney_MulRat(t *testing.T) {
+	tests := []struct {
+		name     string
+		minor    int64
+		mode     RoundingMode
+		expected int64
+	}{
+		// 0.5% от суммы: 5/1000
+		{name: "half even down", minor: 100, mode: RoundHalfEven, expected: 0},    // 0.5 -> 0
+		{name: "half even up", minor: 300, mode: RoundHalfEven, expected: 2},      // 1.5 -> 2
+		{name: "half up", minor: 100, mode: RoundHalfUp, expected: 1},             // 0.5 -> 1
+		{name: "down", minor: 390, mode: RoundDown, expected: 1},                  // 1.95 -> 1
+		{name: "up", minor: 210, mode: RoundUp, expected: 2},                      // 1.05 -> 2
+		{name: "floor negative", minor: -210, mode: RoundFloor, expected: -2},     // -1.05 -> -2
+		{name: "ceiling negative", minor: -390, mode: RoundCeiling, expected: -1}, // -1.95 -> -1
+		{name: "half up negative", minor: -100, mode: RoundHalfUp, expected: -1},  // -0.5 -> -1
+		{name: "exact", minor: 20000, mode: RoundHalfEven, expected: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewMoney(tt.minor, "USD").MulRat(5, 1000, tt.mode)
+			assert.NoError(t, err)
+			assert.Equal(t, NewMoney(tt.expected, "USD"), result)
+		})
+	}
+
+	_, err := NewMoney(math.MaxInt64, "USD").MulRat(2, 1, RoundDown)
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+}
+
+func TestMoney_NoDriftOnRepeatedOperations(t *testing.T) {
+	balance := Zero("USD")
+	tenCents := NewMoney(10, "USD")
+	var err error
+	for i := 0; i < 1000; i++ {
+		balance, err = balance.Add(tenCents)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, "100.00", balance.Decimal())
+}
+
+func TestMoney_JSON(t *testing.T) {
+	data, err := json.Marshal(NewMoney(1050, "EUR"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount":"10.50","currency":"EUR"}`, string(data))
+
+	var money Money
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount":"7.25","currency":"USD"}`), &money))
+	assert.Equal(t, NewMoney(725, "USD"), money)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":7.25,"currency":"USD"}`), &money))
+
+	// Незаданная сумма переживает круговую сериализацию
+	data, err = json.Marshal(Money{})
+	assert.NoError(t, err)
+	assert.Equal(t, "null", string(data))
+	var unset Money
+	assert.NoError(t, json.Unmarshal(data, &unset))
+	assert.Equal(t, Money{}, unset)
+}
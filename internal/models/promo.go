@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// SourcePromo источник бонусов, полученных по промокоду
+const SourcePromo = "promo"
+
+// PromoCode промокод на бонус. Одноразовый код гасится один раз (MaxRedemptions = 1),
+// многоразовый — до MaxRedemptions раз, но не больше PerUserLimit раз одним пользователем
+type PromoCode struct {
+	Code string `json:"code"`
+	// BatchID партия, в которой код сгенерирован
+	BatchID   string `json:"batch_id"`
+	Reward    Money  `json:"reward"`
+	BonusType string `json:"bonus_type"`
+	// ExpiresInDays сколько дней действует бонус, полученный по коду
+	ExpiresInDays  int `json:"expires_in_days"`
+	MaxRedemptions int `json:"max_redemptions"`
+	PerUserLimit   int `json:"per_user_limit"`
+	// Redemptions сколько раз код уже погашен
+	Redemptions int `json:"redemptions"`
+	// StartsAt и EndsAt окно, в которое код можно погасить; пустая граница не ограничивает
+	StartsAt  *time.Time `json:"starts_at,omitempty"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Version   int64      `json:"version"`
+}
+
+// PromoRedemption погашение промокода пользователем и бонус, который он получил
+type PromoRedemption struct {
+	ID        string    `json:"id"`
+	Code      string    `json:"code"`
+	UserID    string    `json:"user_id"`
+	BonusID   string    `json:"bonus_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ClonePromoCode копия кода вместе с границами окна
+func ClonePromoCode(c *PromoCode) *PromoCode {
+	copied := *c
+	copied.StartsAt = cloneTime(c.StartsAt)
+	copied.EndsAt = cloneTime(c.EndsAt)
+	return &copied
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Статусы приглашения
+const (
+	// ReferralPending приглашённый зарегистрировался, но ещё не сделал подходящее пополнение
+	ReferralPending = "pending"
+	// ReferralQualified приглашённый сделал подходящее пополнение, бонусы начислены обоим
+	ReferralQualified = "qualified"
+	// ReferralRejected приглашение похоже на самоприглашение, бонусов по нему не будет
+	ReferralRejected = "rejected"
+)
+
+// ReferralCode реферальный код пользователя; у пользователя он один
+type ReferralCode struct {
+	UserID string `json:"user_id"`
+	Code   string `json:"code"`
+	// DeviceID устройство, с которого владелец регистрировался; нужно для проверки самоприглашений
+	DeviceID  string    `json:"device_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Referral приглашение: кто кого пригласил и чем оно закончилось. У приглашённого оно одно
+type Referral struct {
+	RefereeID  string `json:"referee_id"`
+	ReferrerID string `json:"referrer_id"`
+	Code       string `json:"code"`
+	Status     string `json:"status"`
+	// RejectReason почему приглашение отклонено (same_email_domain, same_device)
+	RejectReason string `json:"reject_reason,omitempty"`
+	// DeviceID устройство, с которого зарегистрировался приглашённый
+	DeviceID string `json:"device_id,omitempty"`
+	// TransactionID пополнение, которым приглашение подтверждено
+	TransactionID string     `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	QualifiedAt   *time.Time `json:"qualified_at,omitempty"`
+	Version       int64      `json:"version"`
+}
@@ -0,0 +1,174 @@
+// Package policy — ролевая модель доступа. Роль даёт разрешение либо на свои ресурсы
+// (владелец совпадает с вызывающим), либо на любые. Пакет не знает ни про HTTP, ни про хранилище:
+// владельцев ресурса определяет вызывающий код.
+package policy
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrForbidden   = errors.New("access denied")
+	ErrUnknownRole = errors.New("unknown role")
+)
+
+type Role string
+
+const (
+	// RoleCustomer клиент: работает только со своими пользователем, счетами и бонусами
+	RoleCustomer Role = "customer"
+	// RoleSupport поддержка: видит всех клиентов, правит профили, начисляет бонусы, но не двигает деньги
+	RoleSupport Role = "support"
+	// RoleAuditor аудитор: только чтение, включая главную книгу
+	RoleAuditor Role = "auditor"
+	// RoleAdmin администратор: всё, включая назначение ролей
+	RoleAdmin Role = "admin"
+)
+
+// ParseRole проверяет, что роль известна
+func ParseRole(role string) (Role, error) {
+	switch r := Role(role); r {
+	case RoleCustomer, RoleSupport, RoleAuditor, RoleAdmin:
+		return r, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownRole, role)
+}
+
+type Permission string
+
+const (
+	AccountsRead   Permission = "accounts:read"
+	AccountsCreate Permission = "accounts:create"
+	// AccountsManage передача счёта другому пользователю
+	AccountsManage Permission = "accounts:manage"
+	AccountsDelete Permission = "accounts:delete"
+
+	TransactionsRead Permission = "transactions:read"
+	// MoneyMove переводы между счетами; владелец — счёт, с которого идут деньги
+	MoneyMove Permission = "money:move"
+	// MoneySettle пополнения и списания: деньги приходят извне или уходят наружу,
+	// поэтому их проводят только внутренние сервисы и администраторы
+	MoneySettle Permission = "money:settle"
+	// TransactionsReverse сторно проведённой операции
+	TransactionsReverse Permission = "transactions:reverse"
+
+	BonusesRead  Permission = "bonuses:read"
+	BonusesGrant Permission = "bonuses:grant"
+	BonusesUse   Permission = "bonuses:use"
+	// CampaignsRead и CampaignsManage правила бонусных кампаний и их пробный прогон
+	CampaignsRead   Permission = "campaigns:read"
+	CampaignsManage Permission = "campaigns:manage"
+	// ReferralsRead реферальный код и итоги приглашений пользователя
+	ReferralsRead Permission = "referrals:read"
+	// PromoManage генерация партий промокодов и просмотр их погашений
+	PromoManage Permission = "promo:manage"
+
+	UsersRead   Permission = "users:read"
+	UsersUpdate Permission = "users:update"
+	UsersDelete Permission = "users:delete"
+	RolesManage Permission = "roles:manage"
+
+	LedgerRead Permission = "ledger:read"
+
+	// JobsRead и JobsRun состояние фоновых задач и их внеплановый запуск
+	JobsRead Permission = "jobs:read"
+	JobsRun  Permission = "jobs:run"
+)
+
+// Scope на какие ресурсы распространяется разрешение
+type Scope int
+
+const (
+	ScopeNone Scope = iota
+	ScopeOwn
+	ScopeAny
+)
+
+var grants = map[Role]map[Permission]Scope{
+	RoleCustomer: {
+		AccountsRead:     ScopeOwn,
+		AccountsCreate:   ScopeOwn,
+		AccountsDelete:   ScopeOwn,
+		TransactionsRead: ScopeOwn,
+		MoneyMove:        ScopeOwn,
+		BonusesRead:      ScopeOwn,
+		BonusesUse:       ScopeOwn,
+		ReferralsRead:    ScopeOwn,
+		UsersRead:        ScopeOwn,
+		UsersUpdate:      ScopeOwn,
+		LedgerRead:       ScopeOwn,
+	},
+	RoleSupport: {
+		AccountsRead:     ScopeAny,
+		AccountsCreate:   ScopeAny,
+		TransactionsRead: ScopeAny,
+		BonusesRead:      ScopeAny,
+		BonusesGrant:     ScopeAny,
+		CampaignsRead:    ScopeAny,
+		ReferralsRead:    ScopeAny,
+		UsersRead:        ScopeAny,
+		UsersUpdate:      ScopeAny,
+	},
+	RoleAuditor: {
+		AccountsRead:     ScopeAny,
+		TransactionsRead: ScopeAny,
+		BonusesRead:      ScopeAny,
+		CampaignsRead:    ScopeAny,
+		ReferralsRead:    ScopeAny,
+		UsersRead:        ScopeAny,
+		LedgerRead:       ScopeAny,
+		JobsRead:         ScopeAny,
+	},
+	RoleAdmin: {
+		AccountsRead:        ScopeAny,
+		AccountsCreate:      ScopeAny,
+		AccountsManage:      ScopeAny,
+		AccountsDelete:      ScopeAny,
+		TransactionsRead:    ScopeAny,
+		MoneyMove:           ScopeAny,
+		MoneySettle:         ScopeAny,
+		TransactionsReverse: ScopeAny,
+		BonusesRead:         ScopeAny,
+		BonusesGrant:        ScopeAny,
+		BonusesUse:          ScopeAny,
+		CampaignsRead:       ScopeAny,
+		CampaignsManage:     ScopeAny,
+		ReferralsRead:       ScopeAny,
+		PromoManage:         ScopeAny,
+		UsersRead:           ScopeAny,
+		UsersUpdate:         ScopeAny,
+		UsersDelete:         ScopeAny,
+		RolesManage:         ScopeAny,
+		LedgerRead:          ScopeAny,
+		JobsRead:            ScopeAny,
+		JobsRun:             ScopeAny,
+	},
+}
+
+// ScopeOf на что роль имеет разрешение; неизвестная роль не имеет ничего
+func ScopeOf(role Role, permission Permission) Scope {
+	return grants[role][permission]
+}
+
+// Allows есть ли у роли разрешение хоть на какие-то ресурсы; для проверки на уровне маршрута
+func Allows(role Role, permission Permission) bool {
+	return ScopeOf(role, permission) != ScopeNone
+}
+
+// Authorize проверяет доступ вызывающего callerID с ролью role к ресурсу с владельцами owners.
+// Разрешения "на свои" хватает, если вызывающий — один из владельцев; ресурс без владельцев
+// (например, вся главная книга) доступен только с разрешением "на любые".
+func Authorize(role Role, callerID string, permission Permission, owners ...string) error {
+	switch ScopeOf(role, permission) {
+	case ScopeAny:
+		return nil
+	case ScopeOwn:
+		for _, owner := range owners {
+			if owner != "" && owner == callerID {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrForbidden, permission)
+}
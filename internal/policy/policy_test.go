@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       Role
+		caller     string
+		permission Permission
+		owners     []string
+		allowed    bool
+	}{
+		{"customer reads own account", RoleCustomer, "user-1", AccountsRead, []string{"user-1"}, true},
+		{"customer cannot read foreign account", RoleCustomer, "user-1", AccountsRead, []string{"user-2"}, false},
+		{"customer moves money from own account", RoleCustomer, "user-1", MoneyMove, []string{"user-1"}, true},
+		{"customer cannot deposit to own account", RoleCustomer, "user-1", MoneySettle, []string{"user-1"}, false},
+		{"customer sees transaction on either side", RoleCustomer, "user-1", TransactionsRead, []string{"user-2", "user-1"}, true},
+		{"customer cannot read whole ledger", RoleCustomer, "user-1", LedgerRead, nil, false},
+		{"empty owner never matches", RoleCustomer, "", AccountsRead, []string{""}, false},
+		{"customer cannot grant bonuses", RoleCustomer, "user-1", BonusesGrant, []string{"user-1"}, false},
+		{"support reads any account", RoleSupport, "support-1", AccountsRead, []string{"user-2"}, true},
+		{"support cannot move money", RoleSupport, "support-1", MoneyMove, []string{"user-2"}, false},
+		{"support grants bonuses", RoleSupport, "support-1", BonusesGrant, []string{"user-2"}, true},
+		{"support cannot change campaigns", RoleSupport, "support-1", CampaignsManage, nil, false},
+		{"support cannot generate promo codes", RoleSupport, "support-1", PromoManage, nil, false},
+		{"auditor reads ledger", RoleAuditor, "auditor-1", LedgerRead, nil, true},
+		{"auditor cannot update users", RoleAuditor, "auditor-1", UsersUpdate, []string{"auditor-1"}, false},
+		{"admin deposits to any account", RoleAdmin, "admin-1", MoneySettle, []string{"user-2"}, true},
+		{"admin manages roles", RoleAdmin, "admin-1", RolesManage, []string{"user-2"}, true},
+		{"unknown role has no permissions", Role("root"), "user-1", AccountsRead, []string{"user-1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Authorize(tt.role, tt.caller, tt.permission, tt.owners...)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrForbidden)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	assert.True(t, Allows(RoleCustomer, AccountsRead))
+	assert.False(t, Allows(RoleCustomer, UsersDelete))
+	assert.False(t, Allows(RoleAuditor, MoneyMove))
+	assert.False(t, Allows(RoleCustomer, MoneySettle))
+	assert.False(t, Allows(RoleSupport, MoneySettle))
+	assert.True(t, Allows(RoleAdmin, UsersDelete))
+}
+
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole("auditor")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleAuditor, role)
+
+	_, err = ParseRole("root")
+	assert.ErrorIs(t, err, ErrUnknownRole)
+}
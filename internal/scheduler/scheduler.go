@@ -0,0 +1,253 @@
+// Package scheduler — фоновые задачи по расписанию: интервал ("@every 5m") или cron-выражение.
+// Задача не запускается повторно, пока идёт предыдущий запуск; история последних запусков
+// хранится в памяти. Stop дожидается завершения работающих задач.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrUnknownJob   = errors.New("unknown job")
+	ErrDuplicateJob = errors.New("job already registered")
+	// ErrJobRunning предыдущий запуск задачи ещё не закончился
+	ErrJobRunning = errors.New("job is already running")
+	ErrStarted    = errors.New("scheduler already started")
+)
+
+// Schedule определяет момент следующего запуска после t
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Parse разбирает расписание: стандартное cron-выражение из пяти полей, "@hourly", "@daily"
+// и т. п. или интервал "@every 10m"
+func Parse(spec string) (Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// Every запуск через равные интервалы; в отличие от "@every" допускает интервалы меньше секунды
+func Every(interval time.Duration) Schedule {
+	return everySchedule(interval)
+}
+
+// JobFunc тело задачи; ctx отменяется при остановке планировщика
+type JobFunc func(ctx context.Context) error
+
+type Status string
+
+const (
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	// StatusSkipped запуск пропущен, потому что предыдущий ещё идёт
+	StatusSkipped Status = "skipped"
+)
+
+// Run один запуск задачи
+type Run struct {
+	Job        string    `json:"job"`
+	Status     Status    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// JobInfo состояние задачи; история — от новых запусков к старым
+type JobInfo struct {
+	Name    string    `json:"name"`
+	Running bool      `json:"running"`
+	NextRun time.Time `json:"next_run"`
+	History []Run     `json:"history"`
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       JobFunc
+	running  bool
+	nextRun  time.Time
+	history  []Run
+}
+
+type Scheduler struct {
+	mu          sync.Mutex
+	jobs        map[string]*job
+	historySize int
+	started     bool
+	// ctx отменяется в Stop; до Start задачи, запущенные через RunNow, получают фоновый контекст
+	ctx    context.Context
+	cancel context.CancelFunc
+	// loops циклы расписаний, runs — идущие запуски; Stop ждёт и те и другие
+	loops sync.WaitGroup
+	runs  sync.WaitGroup
+}
+
+// New создаёт планировщик, который помнит historySize последних запусков каждой задачи
+func New(historySize int) *Scheduler {
+	if historySize < 1 {
+		historySize = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{jobs: make(map[string]*job), historySize: historySize, ctx: ctx, cancel: cancel}
+}
+
+// Register добавляет задачу; задачи регистрируются до Start
+func (s *Scheduler) Register(name string, schedule Schedule, fn JobFunc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return ErrStarted
+	}
+	if _, exists := s.jobs[name]; exists {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, name)
+	}
+	s.jobs[name] = &job{name: name, schedule: schedule, fn: fn}
+	return nil
+}
+
+// Start запускает расписания всех зарегистрированных задач. Отмена parent равносильна Stop,
+// но без ожидания работающих задач
+func (s *Scheduler) Start(parent context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return ErrStarted
+	}
+	s.started = true
+	context.AfterFunc(parent, s.cancel)
+	for _, j := range s.jobs {
+		s.loops.Add(1)
+		go s.loop(j)
+	}
+	return nil
+}
+
+// Stop останавливает расписания, отменяет контекст задач и ждёт, пока идущие запуски закончатся
+func (s *Scheduler) Stop() {
+	// Под s.mu: после отмены trigger уже не начнёт новый запуск, и runs.Wait не пропустит его
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+	s.loops.Wait()
+	s.runs.Wait()
+}
+
+func (s *Scheduler) loop(j *job) {
+	defer s.loops.Done()
+	for {
+		next := j.schedule.Next(time.Now())
+		s.mu.Lock()
+		j.nextRun = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if err := s.trigger(j); err != nil && !errors.Is(err, ErrJobRunning) {
+				log.Printf("scheduler: %s: %v", j.name, err)
+			}
+		}
+	}
+}
+
+// RunNow запускает задачу вне расписания, не дожидаясь её завершения
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	j, exists := s.jobs[name]
+	s.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	return s.trigger(j)
+}
+
+// trigger запускает задачу в отдельной горутине; если она уже идёт, запуск записывается как пропущенный
+func (s *Scheduler) trigger(j *job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	if j.running {
+		now := time.Now()
+		s.record(j, Run{Job: j.name, Status: StatusSkipped, StartedAt: now, FinishedAt: now})
+		return fmt.Errorf("%w: %s", ErrJobRunning, j.name)
+	}
+	j.running = true
+	s.runs.Add(1)
+	go s.execute(j)
+	return nil
+}
+
+func (s *Scheduler) execute(j *job) {
+	defer s.runs.Done()
+	run := Run{Job: j.name, StartedAt: time.Now()}
+	err := safeCall(s.ctx, j.fn)
+	run.FinishedAt = time.Now()
+	run.Status = StatusSucceeded
+	if err != nil {
+		run.Status = StatusFailed
+		run.Error = err.Error()
+		log.Printf("scheduler: %s failed: %v", j.name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.running = false
+	s.record(j, run)
+}
+
+// safeCall паника в задаче превращается в ошибку запуска и не роняет процесс
+func safeCall(ctx context.Context, fn JobFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// record добавляет запуск в историю задачи; вызывается под s.mu
+func (s *Scheduler) record(j *job, run Run) {
+	j.history = append(j.history, run)
+	if len(j.history) > s.historySize {
+		j.history = j.history[len(j.history)-s.historySize:]
+	}
+}
+
+// Jobs состояние всех задач по имени
+func (s *Scheduler) Jobs() []JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]JobInfo, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		history := make([]Run, len(j.history))
+		for i, run := range j.history {
+			history[len(j.history)-1-i] = run
+		}
+		infos = append(infos, JobInfo{Name: j.name, Running: j.running, NextRun: j.nextRun, History: history})
+	}
+	sort.Slice(infos, func(i, k int) bool { return infos[i].Name < infos[k].Name })
+	return infos
+}
@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler_RunsJobsOnSchedule(t *testing.T) {
+	s := New(3)
+	var runs atomic.Int32
+	assert.NoError(t, s.Register("tick", Every(5*time.Millisecond), func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}))
+	assert.ErrorIs(t, s.Register("tick", Every(time.Second), nil), ErrDuplicateJob)
+
+	assert.NoError(t, s.Start(context.Background()))
+	assert.ErrorIs(t, s.Start(context.Background()), ErrStarted)
+	assert.Eventually(t, func() bool { return runs.Load() >= 4 }, time.Second, time.Millisecond)
+	s.Stop()
+
+	jobs := s.Jobs()
+	if assert.Len(t, jobs, 1) {
+		// Хранятся только последние запуски
+		assert.Len(t, jobs[0].History, 3)
+		assert.Equal(t, StatusSucceeded, jobs[0].History[0].Status)
+		assert.False(t, jobs[0].History[0].StartedAt.Before(jobs[0].History[1].StartedAt))
+	}
+}
+
+func TestScheduler_SkipsOverlappingRuns(t *testing.T) {
+	s := New(10)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	assert.NoError(t, s.Register("slow", Every(time.Hour), func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}))
+
+	assert.NoError(t, s.RunNow("slow"))
+	<-started
+	assert.ErrorIs(t, s.RunNow("slow"), ErrJobRunning)
+	assert.True(t, s.Jobs()[0].Running)
+	close(release)
+	s.Stop()
+
+	history := s.Jobs()[0].History
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, StatusSucceeded, history[0].Status)
+		assert.Equal(t, StatusSkipped, history[1].Status)
+	}
+	assert.ErrorIs(t, s.RunNow("missing"), ErrUnknownJob)
+}
+
+func TestScheduler_RecordsFailuresAndPanics(t *testing.T) {
+	s := New(10)
+	assert.NoError(t, s.Register("failing", Every(time.Hour), func(ctx context.Context) error {
+		return errors.New("boom")
+	}))
+	assert.NoError(t, s.Register("panicking", Every(time.Hour), func(ctx context.Context) error {
+		panic("oops")
+	}))
+	assert.NoError(t, s.RunNow("failing"))
+	assert.NoError(t, s.RunNow("panicking"))
+	s.Stop()
+
+	jobs := s.Jobs()
+	assert.Equal(t, "failing", jobs[0].Name)
+	assert.Equal(t, StatusFailed, jobs[0].History[0].Status)
+	assert.Equal(t, "boom", jobs[0].History[0].Error)
+	assert.Equal(t, StatusFailed, jobs[1].History[0].Status)
+	assert.Contains(t, jobs[1].History[0].Error, "oops")
+}
+
+func TestScheduler_StopWaitsForRunningJobs(t *testing.T) {
+	s := New(10)
+	started := make(chan struct{})
+	var finished atomic.Bool
+	assert.NoError(t, s.Register("long", Every(time.Hour), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished.Store(true)
+		return ctx.Err()
+	}))
+	assert.NoError(t, s.Start(context.Background()))
+	assert.NoError(t, s.RunNow("long"))
+	<-started
+
+	s.Stop()
+	assert.True(t, finished.Load())
+	assert.Error(t, s.RunNow("long"))
+}
+
+func TestParse(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 3, 0, 0, time.UTC)
+
+	every, err := Parse("@every 10m")
+	assert.NoError(t, err)
+	assert.Equal(t, from.Add(10*time.Minute), every.Next(from))
+
+	cron, err := Parse("*/15 * * * *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC), cron.Next(from))
+
+	_, err = Parse("every minute")
+	assert.Error(t, err)
+}
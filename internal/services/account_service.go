@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"petProjectMike/internal/database"
@@ -16,24 +17,46 @@ func NewAccountService(db database.Database) *AccountService {
 	return &AccountService{db: db}
 }
 
-func (s *AccountService) CreateAccount(userID, currency string) (*models.Account, error) {
-	_, err := s.db.GetUser(userID)
-	if err != nil {
-		return nil, err
-	}
+// accountAttempts сколько раз открытие счёта повторяется при конфликте версий пользователя
+const accountAttempts = 3
 
-	supportedCurrencies := map[string]bool{
-		"USD": true,
-		"EUR": true,
-		"RUB": true,
-	}
-
-	if !supportedCurrencies[currency] {
-		return nil, errors.New("unsupported currency")
+// CreateAccount открывает счёт пользователю. Запись пользователя переписывается в той же транзакции:
+// её версия растёт, и параллельное удаление, не увидевшее новый счёт, конфликтует с открытием,
+// а повтор получает ErrUserErased
+func (s *AccountService) CreateAccount(userID, currency string) (*models.Account, error) {
+	var account *models.Account
+	var err error
+	for attempt := 0; attempt < accountAttempts; attempt++ {
+		err = s.db.RunInTx(func(tx database.Tx) error {
+			user, err := tx.GetUser(userID)
+			if err != nil {
+				return err
+			}
+			if user.Erased() {
+				return ErrUserErased
+			}
+
+			supportedCurrencies := map[string]bool{
+				"USD": true,
+				"EUR": true,
+				"RUB": true,
+			}
+
+			if !supportedCurrencies[currency] {
+				return ErrUnsupportedCurrency
+			}
+
+			if err := tx.UpdateUser(user); err != nil {
+				return err
+			}
+			account = models.NewAccount(userID, currency)
+			return tx.CreateAccount(account)
+		})
+		if !errors.Is(err, database.ErrConflict) {
+			break
+		}
 	}
-
-	account := models.NewAccount(userID, currency)
-	if err := s.db.CreateAccount(account); err != nil {
+	if err != nil {
 		return nil, err
 	}
 	return account, nil
@@ -47,30 +70,70 @@ func (s *AccountService) GetAccountsByUser(userID string) ([]*models.Account, er
 	return s.db.GetAccountsByUserID(userID)
 }
 
-func (s *AccountService) UpdateAccount(account *models.Account) error {
-	_, err := s.db.GetAccount(account.ID)
+// UpdateAccount передаёт счёт другому пользователю, если счёт не менялся с версии version.
+// Новый владелец должен существовать и не быть удалённым (ErrUnknownUser, ErrUserErased).
+// Остаток и валюта здесь не меняются: остаток двигают только проводки.
+func (s *AccountService) UpdateAccount(id string, version int64, userID string) (*models.Account, error) {
+	var account *models.Account
+	err := s.db.RunInTx(func(tx database.Tx) error {
+		if err := tx.LockAccounts(id); err != nil {
+			return err
+		}
+		var err error
+		account, err = tx.GetAccount(id)
+		if err != nil {
+			return err
+		}
+		if account.Version != version {
+			return database.ErrConflict
+		}
+		if err := ensureOpen(account); err != nil {
+			return err
+		}
+		owner, err := tx.GetUser(userID)
+		if errors.Is(err, database.ErrNotFound) {
+			return fmt.Errorf("%w: %s", ErrUnknownUser, userID)
+		}
+		if err != nil {
+			return err
+		}
+		if owner.Erased() {
+			return ErrUserErased
+		}
+		account.UserID = userID
+		account.UpdatedAt = time.Now()
+		return tx.UpdateAccount(account)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	account.UpdatedAt = time.Now()
-	return s.db.UpdateAccount(account)
+	return account, nil
 }
 
 func (s *AccountService) DeleteAccount(id string) error {
-	account, err := s.db.GetAccount(id)
-	if err != nil {
-		return err
-	}
-	if account.Balance > 0 {
-		return errors.New("cannot delete account with positive balance")
-	}
-	return s.db.DeleteAccount(id)
+	return s.db.RunInTx(func(tx database.Tx) error {
+		if err := tx.LockAccounts(id); err != nil {
+			return err
+		}
+		account, err := tx.GetAccount(id)
+		if err != nil {
+			return err
+		}
+		// Закрытый счёт хранится вместе с операциями удалённого владельца
+		if err := ensureOpen(account); err != nil {
+			return err
+		}
+		if account.Balance.IsPositive() {
+			return ErrAccountNotEmpty
+		}
+		return tx.DeleteAccount(id)
+	})
 }
 
-func (s *AccountService) GetAccountBalance(id string) (float64, error) {
+func (s *AccountService) GetAccountBalance(id string) (models.Money, error) {
 	account, err := s.db.GetAccount(id)
 	if err != nil {
-		return 0, err
+		return models.Money{}, err
 	}
 	return account.Balance, nil
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"petProjectMike/internal/database"
 	"petProjectMike/internal/models"
 
 	"github.com/stretchr/testify/assert"
@@ -29,6 +30,7 @@ func TestAccountService_CreateAccount(t *testing.T) {
 					Name:  "Test User",
 				}
 				mockDB.On("GetUser", "user-1").Return(user, nil)
+				mockDB.On("UpdateUser", user).Return(nil)
 				mockDB.On("CreateAccount", mock.AnythingOfType("*models.Account")).Return(nil)
 			},
 			expectedError: false,
@@ -44,6 +46,7 @@ func TestAccountService_CreateAccount(t *testing.T) {
 					Name:  "Test User",
 				}
 				mockDB.On("GetUser", "user-1").Return(user, nil)
+				mockDB.On("UpdateUser", user).Return(nil)
 				mockDB.On("CreateAccount", mock.AnythingOfType("*models.Account")).Return(nil)
 			},
 			expectedError: false,
@@ -89,7 +92,7 @@ func TestAccountService_CreateAccount(t *testing.T) {
 				assert.NotNil(t, account)
 				assert.Equal(t, tt.userID, account.UserID)
 				assert.Equal(t, tt.currency, account.Currency)
-				assert.Equal(t, 0.0, account.Balance)
+				assert.Equal(t, models.Zero(tt.currency), account.Balance)
 			}
 
 			mockDB.AssertExpectations(t)
@@ -97,12 +100,51 @@ func TestAccountService_CreateAccount(t *testing.T) {
 	}
 }
 
+// eraseOnCreateDB удаляет пользователя отдельной транзакцией в момент, когда открытие счёта
+// уже проверило пользователя, но ещё не закоммитилось
+type eraseOnCreateDB struct {
+	database.Database
+	erase func()
+}
+
+type eraseOnCreateTx struct {
+	database.Tx
+	db *eraseOnCreateDB
+}
+
+func (db *eraseOnCreateDB) RunInTx(fn func(tx database.Tx) error) error {
+	return db.Database.RunInTx(func(tx database.Tx) error { return fn(eraseOnCreateTx{Tx: tx, db: db}) })
+}
+
+func (tx eraseOnCreateTx) CreateAccount(account *models.Account) error {
+	if erase := tx.db.erase; erase != nil {
+		tx.db.erase = nil
+		erase()
+	}
+	return tx.Tx.CreateAccount(account)
+}
+
+func TestAccountService_CreateAccountConflictsWithErasure(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-2", Email: "second@example.com", CreatedAt: time.Now()}))
+	racing := &eraseOnCreateDB{Database: db, erase: func() {
+		_, err := NewErasureService(db, nil, 0).EraseUser("user-2", "admin-1")
+		assert.NoError(t, err)
+	}}
+
+	// Удаление не видело новый счёт, поэтому открытие конфликтует с ним и при повторе отклоняется
+	_, err := NewAccountService(racing).CreateAccount("user-2", "USD")
+	assert.ErrorIs(t, err, ErrUserErased)
+	accounts, _ := db.GetAccountsByUserID("user-2")
+	assert.Empty(t, accounts)
+}
+
 func TestAccountService_GetAccount(t *testing.T) {
 	mockDB := &MockDatabase{}
 	expectedAccount := &models.Account{
 		ID:       "account-1",
 		UserID:   "user-1",
-		Balance:  1000.0,
+		Balance:  models.NewMoney(100000, "USD"),
 		Currency: "USD",
 	}
 
@@ -122,13 +164,13 @@ func TestAccountService_GetAccountsByUser(t *testing.T) {
 		{
 			ID:       "account-1",
 			UserID:   "user-1",
-			Balance:  1000.0,
+			Balance:  models.NewMoney(100000, "USD"),
 			Currency: "USD",
 		},
 		{
 			ID:       "account-2",
 			UserID:   "user-1",
-			Balance:  500.0,
+			Balance:  models.NewMoney(50000, "EUR"),
 			Currency: "EUR",
 		},
 	}
@@ -148,22 +190,55 @@ func TestAccountService_UpdateAccount(t *testing.T) {
 	account := &models.Account{
 		ID:       "account-1",
 		UserID:   "user-1",
-		Balance:  1500.0,
+		Balance:  models.NewMoney(150000, "USD"),
 		Currency: "USD",
+		Version:  3,
 	}
 
 	mockDB.On("GetAccount", "account-1").Return(account, nil)
+	mockDB.On("GetUser", "user-2").Return(&models.User{ID: "user-2", Email: "two@example.com"}, nil)
 	mockDB.On("UpdateAccount", mock.AnythingOfType("*models.Account")).Return(nil)
 
 	service := NewAccountService(mockDB)
-	err := service.UpdateAccount(account)
+	updated, err := service.UpdateAccount("account-1", 3, "user-2")
 
 	assert.NoError(t, err)
+	assert.Equal(t, "user-2", updated.UserID)
+	// Остаток не меняется
+	assert.Equal(t, models.NewMoney(150000, "USD"), updated.Balance)
 	// Проверяем, что время обновления было изменено
-	assert.True(t, account.UpdatedAt.After(time.Now().Add(-time.Second)))
+	assert.True(t, updated.UpdatedAt.After(time.Now().Add(-time.Second)))
 	mockDB.AssertExpectations(t)
 }
 
+func TestAccountService_UpdateAccount_StaleVersion(t *testing.T) {
+	mockDB := &MockDatabase{}
+	account := &models.Account{ID: "account-1", UserID: "user-1", Balance: models.NewMoney(150000, "USD"), Currency: "USD", Version: 3}
+	mockDB.On("GetAccount", "account-1").Return(account, nil)
+
+	service := NewAccountService(mockDB)
+	_, err := service.UpdateAccount("account-1", 2, "user-2")
+
+	assert.ErrorIs(t, err, database.ErrConflict)
+	mockDB.AssertNotCalled(t, "UpdateAccount", mock.Anything)
+}
+
+func TestAccountService_UpdateAccount_RejectsMissingOrErasedOwner(t *testing.T) {
+	erasedAt := time.Now()
+	mockDB := &MockDatabase{}
+	account := &models.Account{ID: "account-1", UserID: "user-1", Balance: models.NewMoney(150000, "USD"), Currency: "USD", Version: 3}
+	mockDB.On("GetAccount", "account-1").Return(account, nil)
+	mockDB.On("GetUser", "user-missing").Return(nil, database.ErrNotFound)
+	mockDB.On("GetUser", "user-erased").Return(&models.User{ID: "user-erased", ErasedAt: &erasedAt}, nil)
+
+	service := NewAccountService(mockDB)
+	_, err := service.UpdateAccount("account-1", 3, "user-missing")
+	assert.ErrorIs(t, err, ErrUnknownUser)
+	_, err = service.UpdateAccount("account-1", 3, "user-erased")
+	assert.ErrorIs(t, err, ErrUserErased)
+	mockDB.AssertNotCalled(t, "UpdateAccount", mock.Anything)
+}
+
 func TestAccountService_DeleteAccount(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -178,7 +253,7 @@ func TestAccountService_DeleteAccount(t *testing.T) {
 				account := &models.Account{
 					ID:       "account-1",
 					UserID:   "user-1",
-					Balance:  0.0,
+					Balance:  models.NewMoney(0, "USD"),
 					Currency: "USD",
 				}
 				mockDB.On("GetAccount", "account-1").Return(account, nil)
@@ -193,7 +268,7 @@ func TestAccountService_DeleteAccount(t *testing.T) {
 				account := &models.Account{
 					ID:       "account-1",
 					UserID:   "user-1",
-					Balance:  100.0,
+					Balance:  models.NewMoney(10000, "USD"),
 					Currency: "USD",
 				}
 				mockDB.On("GetAccount", "account-1").Return(account, nil)
@@ -226,7 +301,7 @@ func TestAccountService_GetAccountBalance(t *testing.T) {
 	expectedAccount := &models.Account{
 		ID:       "account-1",
 		UserID:   "user-1",
-		Balance:  1000.0,
+		Balance:  models.NewMoney(100000, "USD"),
 		Currency: "USD",
 	}
 
@@ -236,7 +311,7 @@ func TestAccountService_GetAccountBalance(t *testing.T) {
 	balance, err := service.GetAccountBalance("account-1")
 
 	assert.NoError(t, err)
-	assert.Equal(t, 1000.0, balance)
+	assert.Equal(t, models.NewMoney(100000, "USD"), balance)
 	mockDB.AssertExpectations(t)
 }
 
@@ -245,7 +320,7 @@ func TestAccountService_ValidateAccount(t *testing.T) {
 	expectedAccount := &models.Account{
 		ID:       "account-1",
 		UserID:   "user-1",
-		Balance:  1000.0,
+		Balance:  models.NewMoney(100000, "USD"),
 		Currency: "USD",
 	}
 
@@ -263,7 +338,7 @@ func TestAccountService_GetAccountSummary(t *testing.T) {
 	account := &models.Account{
 		ID:        "account-1",
 		UserID:    "user-1",
-		Balance:   1000.0,
+		Balance:   models.NewMoney(100000, "USD"),
 		Currency:  "USD",
 		CreatedAt: time.Now().AddDate(0, 0, -1),
 		UpdatedAt: time.Now(),
@@ -273,14 +348,14 @@ func TestAccountService_GetAccountSummary(t *testing.T) {
 			ID:          "txn-1",
 			FromAccount: "account-1",
 			ToAccount:   "account-2",
-			Amount:      100.0,
+			Amount:      models.NewMoney(10000, "USD"),
 			Type:        "transfer",
 			Status:      "completed",
 		},
 		{
 			ID:        "txn-2",
 			ToAccount: "account-1",
-			Amount:    50.0,
+			Amount:    models.NewMoney(5000, "USD"),
 			Type:      "deposit",
 			Status:    "completed",
 		},
@@ -296,7 +371,7 @@ func TestAccountService_GetAccountSummary(t *testing.T) {
 	assert.NotNil(t, summary)
 	assert.Equal(t, "account-1", summary["account_id"])
 	assert.Equal(t, "user-1", summary["user_id"])
-	assert.Equal(t, 1000.0, summary["balance"])
+	assert.Equal(t, models.NewMoney(100000, "USD"), summary["balance"])
 	assert.Equal(t, "USD", summary["currency"])
 	assert.Equal(t, 2, summary["total_transactions"])
 	mockDB.AssertExpectations(t)
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"petProjectMike/internal/auth"
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/models"
+	"petProjectMike/internal/policy"
+
+	"github.com/google/uuid"
+)
+
+type AuthService struct {
+	db     database.Database
+	tokens *auth.TokenIssuer
+}
+
+func NewAuthService(db database.Database, tokens *auth.TokenIssuer) *AuthService {
+	return &AuthService{db: db, tokens: tokens}
+}
+
+// RegisterHook дополняет регистрацию в её транзакции; ошибка отменяет создание пользователя
+type RegisterHook func(tx database.Tx, user *models.User) error
+
+// Register создаёт пользователя с паролем. ID генерирует сервер, email проверяется и хранится
+// в нижнем регистре; уникальность email обеспечивает хранилище (database.ErrEmailTaken)
+func (s *AuthService) Register(email, name, password string, hooks ...RegisterHook) (*models.User, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidUser)
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	// Самостоятельно зарегистрироваться можно только клиентом; остальные роли назначает администратор
+	user := &models.User{ID: uuid.New().String(), Email: email, Name: strings.TrimSpace(name), Role: string(policy.RoleCustomer),
+		PasswordHash: hash, CreatedAt: time.Now()}
+	err = s.db.RunInTx(func(tx database.Tx) error {
+		if err := tx.CreateUser(user); err != nil {
+			return err
+		}
+		for _, hook := range hooks {
+			if err := hook(tx, user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Login проверяет email и пароль и выпускает пару токенов. Неизвестный email и неверный пароль
+// дают одну и ту же ошибку
+func (s *AuthService) Login(email, password string) (*auth.TokenPair, error) {
+	// Адрес в неверном формате не найдётся, как и неизвестный
+	email, _ = NormalizeEmail(email)
+	user, err := s.db.GetUserByEmail(email)
+	if errors.Is(err, database.ErrNotFound) {
+		auth.CheckPassword("", password)
+		return nil, auth.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.CheckPassword(user.PasswordHash, password); err != nil {
+		return nil, err
+	}
+	return s.tokens.Issue(user.ID, user.TokenGeneration)
+}
+
+// Refresh обменивает токен обновления на новую пару, если пользователь ещё существует, не удалён
+// и не менял пароль после выпуска токена
+func (s *AuthService) Refresh(refreshToken string) (*auth.TokenPair, error) {
+	claims, err := s.tokens.Parse(refreshToken, auth.TokenRefresh)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.activeUser(claims)
+	if err != nil {
+		return nil, err
+	}
+	return s.tokens.Issue(user.ID, user.TokenGeneration)
+}
+
+// activeUser владелец токена; отсутствующий и удалённый пользователь, как и токен прежнего поколения, —
+// недействительный токен
+func (s *AuthService) activeUser(claims *auth.Claims) (*models.User, error) {
+	user, err := s.db.GetUser(claims.Subject)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, auth.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Erased() || claims.Generation != user.TokenGeneration {
+		return nil, auth.ErrInvalidToken
+	}
+	return user, nil
+}
+
+// ChangePassword меняет пароль пользователя, проверив текущий. Все выданные пользователю токены,
+// включая токен этого запроса, перестают действовать
+func (s *AuthService) ChangePassword(userID, currentPassword, newPassword string) error {
+	hash, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	return s.db.RunInTx(func(tx database.Tx) error {
+		user, err := tx.GetUser(userID)
+		if err != nil {
+			return err
+		}
+		if err := auth.CheckPassword(user.PasswordHash, currentPassword); err != nil {
+			return err
+		}
+		user.PasswordHash = hash
+		user.TokenGeneration++
+		return tx.UpdateUser(user)
+	})
+}
+
+// Authenticate проверяет токен доступа. Пользователь перечитывается на каждый запрос:
+// смена роли и удаление действуют сразу, а не после истечения токена
+func (s *AuthService) Authenticate(accessToken string) (*auth.Principal, error) {
+	claims, err := s.tokens.Parse(accessToken, auth.TokenAccess)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.activeUser(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Principal{Subject: user.ID, Kind: auth.KindUser, Role: roleOf(user)}, nil
+}
+
+// roleOf роль пользователя; у записей, созданных до появления ролей, её нет — это клиенты
+func roleOf(user *models.User) policy.Role {
+	if user.Role == "" {
+		return policy.RoleCustomer
+	}
+	return policy.Role(user.Role)
+}
+
+// SetRole назначает пользователю роль
+func (s *AuthService) SetRole(userID, role string) (*models.User, error) {
+	parsed, err := policy.ParseRole(role)
+	if err != nil {
+		return nil, err
+	}
+	var user *models.User
+	err = s.db.RunInTx(func(tx database.Tx) error {
+		user, err = tx.GetUser(userID)
+		if err != nil {
+			return err
+		}
+		if user.Erased() {
+			return ErrUserErased
+		}
+		user.Role = string(parsed)
+		return tx.UpdateUser(user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateProfile меняет email и имя пользователя, если его версия всё ещё version. Email проверяется
+// так же, как при регистрации; занятый другим пользователем — database.ErrEmailTaken
+func (s *AuthService) UpdateProfile(userID string, version int64, email, name string) (*models.User, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidUser)
+	}
+	user, err := s.db.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Erased() {
+		return nil, ErrUserErased
+	}
+	user.Version, user.Email, user.Name = version, email, strings.TrimSpace(name)
+	if err := s.db.UpdateUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// NormalizeEmail проверяет адрес и приводит его к виду, в котором он хранится: без пробелов по краям
+// и в нижнем регистре. Адрес с именем ("Ann <ann@example.com>") и домен без точки не принимаются
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > maxEmailLength ||
+		!strings.Contains(email[strings.LastIndex(email, "@")+1:], ".") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidEmail, email)
+	}
+	return email, nil
+}
+
+// maxEmailLength предел длины адреса по RFC 5321
+const maxEmailLength = 254
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"petProjectMike/internal/auth"
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/policy"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAuthService(t *testing.T) (*AuthService, *database.InMemoryDB) {
+	db := database.NewInMemoryDB()
+	tokens, err := auth.NewTokenIssuer([]byte("test-secret-test-secret-test-secret"), time.Minute, time.Hour)
+	assert.NoError(t, err)
+	return NewAuthService(db, tokens), db
+}
+
+func TestAuthService_RegisterAndLogin(t *testing.T) {
+	service, db := newTestAuthService(t)
+
+	user, err := service.Register("new@example.com", "New", "s3cret-password")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, user.ID)
+
+	stored, err := db.GetUser(user.ID)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "s3cret-password", stored.PasswordHash)
+
+	tokens, err := service.Login("new@example.com", "s3cret-password")
+	assert.NoError(t, err)
+	principal, err := service.Authenticate(tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, &auth.Principal{Subject: user.ID, Kind: auth.KindUser, Role: policy.RoleCustomer}, principal)
+
+	_, err = service.Login("new@example.com", "wrong-password")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = service.Login("nobody@example.com", "s3cret-password")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+func TestAuthService_SeedUserWithoutPasswordCannotLogin(t *testing.T) {
+	service, _ := newTestAuthService(t)
+	_, err := service.Login("test@example.com", "")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+func TestAuthService_RefreshFailsForDeletedUser(t *testing.T) {
+	service, db := newTestAuthService(t)
+	user, err := service.Register("gone@example.com", "Gone", "s3cret-password")
+	assert.NoError(t, err)
+	tokens, err := service.Login("gone@example.com", "s3cret-password")
+	assert.NoError(t, err)
+
+	_, err = service.Refresh(tokens.RefreshToken)
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.DeleteUser(user.ID))
+	_, err = service.Refresh(tokens.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestAuthService_ChangePasswordRevokesIssuedTokens(t *testing.T) {
+	service, _ := newTestAuthService(t)
+	user, err := service.Register("moved@example.com", "Moved", "s3cret-password")
+	assert.NoError(t, err)
+	stolen, err := service.Login("moved@example.com", "s3cret-password")
+	assert.NoError(t, err)
+
+	assert.NoError(t, service.ChangePassword(user.ID, "s3cret-password", "even-better-password"))
+	_, err = service.Refresh(stolen.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	_, err = service.Authenticate(stolen.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	// Токены, выпущенные после смены пароля, действуют
+	fresh, err := service.Login("moved@example.com", "even-better-password")
+	assert.NoError(t, err)
+	_, err = service.Authenticate(fresh.AccessToken)
+	assert.NoError(t, err)
+	_, err = service.Refresh(fresh.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestAuthService_RoleChangeAppliesToIssuedTokens(t *testing.T) {
+	service, _ := newTestAuthService(t)
+	user, err := service.Register("staff@example.com", "Staff", "s3cret-password")
+	assert.NoError(t, err)
+	tokens, err := service.Login("staff@example.com", "s3cret-password")
+	assert.NoError(t, err)
+
+	_, err = service.SetRole(user.ID, "support")
+	assert.NoError(t, err)
+	principal, err := service.Authenticate(tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, policy.RoleSupport, principal.Role)
+
+	_, err = service.SetRole(user.ID, "root")
+	assert.ErrorIs(t, err, policy.ErrUnknownRole)
+}
+
+func TestAuthService_EmailIsValidatedAndUnique(t *testing.T) {
+	service, db := newTestAuthService(t)
+
+	user, err := service.Register("  Ann@Example.COM ", "Ann", "s3cret-password")
+	assert.NoError(t, err)
+	assert.Equal(t, "ann@example.com", user.Email)
+	_, err = service.Login("ANN@example.com", "s3cret-password")
+	assert.NoError(t, err)
+
+	for _, email := range []string{"", "ann", "ann@localhost", "Ann <ann@example.com>", "ann@@example.com"} {
+		_, err = service.Register(email, "Ann", "s3cret-password")
+		assert.ErrorIs(t, err, ErrInvalidEmail, email)
+	}
+	_, err = service.Register("ann@EXAMPLE.com", "Ann", "s3cret-password")
+	assert.ErrorIs(t, err, database.ErrEmailTaken)
+
+	// Правка профиля не может занять чужой email
+	_, err = service.UpdateProfile(user.ID, user.Version, "test@example.com", "Ann")
+	assert.ErrorIs(t, err, database.ErrEmailTaken)
+	updated, err := service.UpdateProfile(user.ID, user.Version, "Ann.Smith@example.com", " Ann Smith ")
+	assert.NoError(t, err)
+	assert.Equal(t, "ann.smith@example.com", updated.Email)
+	assert.Equal(t, "Ann Smith", updated.Name)
+	_, err = service.UpdateProfile(user.ID, user.Version, "ann@example.com", "Ann")
+	assert.ErrorIs(t, err, database.ErrConflict)
+
+	// Из параллельных регистраций с одним email проходит ровно одна
+	var wg sync.WaitGroup
+	var registered atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.Register("race@example.com", "Race", "s3cret-password"); err == nil {
+				registered.Add(1)
+			} else {
+				assert.ErrorIs(t, err, database.ErrEmailTaken)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), registered.Load())
+	_, err = db.GetUserByEmail("race@example.com")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"petProjectMike/internal/campaigns"
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func (s *BonusService) ListCampaigns() ([]*models.Campaign, error) {
+	return s.db.ListCampaigns()
+}
+
+func (s *BonusService) GetCampaign(id string) (*models.Campaign, error) {
+	return s.db.GetCampaign(id)
+}
+
+// CreateCampaign проверяет и сохраняет кампанию; если ID не задан, он генерируется
+func (s *BonusService) CreateCampaign(campaign *models.Campaign) error {
+	if err := campaigns.Validate(campaign); err != nil {
+		return err
+	}
+	if campaign.ID == "" {
+		campaign.ID = uuid.New().String()
+	}
+	if err := carrySpent(campaign, nil); err != nil {
+		return err
+	}
+	now := time.Now()
+	campaign.CreatedAt = now
+	campaign.UpdatedAt = now
+	return s.db.CreateCampaign(campaign)
+}
+
+// UpdateCampaign заменяет правила кампании, если она не менялась с версии version
+func (s *BonusService) UpdateCampaign(campaign *models.Campaign, version int64) error {
+	if err := campaigns.Validate(campaign); err != nil {
+		return err
+	}
+	return s.db.RunInTx(func(tx database.Tx) error {
+		current, err := tx.GetCampaign(campaign.ID)
+		if err != nil {
+			return err
+		}
+		if current.Version != version {
+			return database.ErrConflict
+		}
+		if err := carrySpent(campaign, current); err != nil {
+			return err
+		}
+		campaign.CreatedAt = current.CreatedAt
+		campaign.UpdatedAt = time.Now()
+		campaign.Version = current.Version
+		return tx.UpdateCampaign(campaign)
+	})
+}
+
+// DeleteCampaign удаляет кампанию; уже начисленные по ней бонусы остаются
+func (s *BonusService) DeleteCampaign(id string) error {
+	return s.db.DeleteCampaign(id)
+}
+
+// SeedCampaigns загружает кампании при старте. С overwrite существующие кампании заменяются
+// (источник правды — файл), без него добавляются только недостающие
+func (s *BonusService) SeedCampaigns(list []*models.Campaign, overwrite bool) error {
+	return s.db.RunInTx(func(tx database.Tx) error {
+		now := time.Now()
+		for _, campaign := range list {
+			campaign = models.CloneCampaign(campaign)
+			current, err := tx.GetCampaign(campaign.ID)
+			if errors.Is(err, database.ErrNotFound) {
+				if err := carrySpent(campaign, nil); err != nil {
+					return err
+				}
+				campaign.CreatedAt, campaign.UpdatedAt = now, now
+				if err := tx.CreateCampaign(campaign); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !overwrite {
+				continue
+			}
+			if err := carrySpent(campaign, current); err != nil {
+				return err
+			}
+			campaign.CreatedAt, campaign.UpdatedAt = current.CreatedAt, now
+			campaign.Version = current.Version
+			if err := tx.UpdateCampaign(campaign); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PreviewCampaigns пробный прогон: решения всех кампаний по событию без начисления бонусов.
+// Бонусы за перевод и пополнение умножаются по текущему уровню лояльности. Пустой at — текущий момент
+func (s *BonusService) PreviewCampaigns(userID, trigger string, amount models.Money, at time.Time) ([]campaigns.Decision, error) {
+	if !campaigns.KnownTrigger(trigger) {
+		return nil, ErrUnsupportedBonusType
+	}
+	user, err := s.db.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.db.ListCampaigns()
+	if err != nil {
+		return nil, err
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	event := campaigns.Event{Trigger: trigger, UserID: user.ID, UserRegisteredAt: user.CreatedAt, Amount: amount, At: at}
+	if trigger == models.TriggerTransfer || trigger == models.TriggerDeposit {
+		tier, err := s.tier(s.db, user.ID, at, "")
+		if err != nil {
+			return nil, err
+		}
+		event.MultiplierBP = tier.MultiplierBP
+	}
+	return campaigns.Evaluate(list, event), nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"petProjectMike/internal/campaigns"
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/models"
+)
+
+// BonusLimits лимиты бонусов за операции на одного пользователя по валютам: сколько он может получить
+// за календарные сутки и календарный месяц (UTC). Валюта без лимита не ограничена
+type BonusLimits struct {
+	Daily   map[string]models.Money
+	Monthly map[string]models.Money
+}
+
+// ParseBonusCaps разбирает лимиты вида "USD:50.00,EUR:45.00"; пустая строка — без лимитов
+func ParseBonusCaps(spec string) (map[string]models.Money, error) {
+	return parseAmounts("bonus cap", spec)
+}
+
+// parseAmounts разбирает положительные суммы по валютам вида "USD:50.00,EUR:45.00"; what — что это за суммы, для ошибок
+func parseAmounts(what, spec string) (map[string]models.Money, error) {
+	caps := make(map[string]models.Money)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		currency, amount, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s %q: expected CURRENCY:AMOUNT", what, item)
+		}
+		limit, err := models.ParseMoney(amount, currency)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", what, item, err)
+		}
+		if !limit.IsPositive() {
+			return nil, fmt.Errorf("%s %q: %w", what, item, ErrNonPositiveAmount)
+		}
+		caps[currency] = limit
+	}
+	return caps, nil
+}
+
+// isTransactionBonus бонус за операцию; лимиты на пользователя считаются только по ним
+func isTransactionBonus(bonus *models.Bonus) bool {
+	return bonus.Source == models.TriggerTransfer || bonus.Source == models.TriggerDeposit
+}
+
+// allowance сколько ещё бонусов за операции в валюте currency пользователь может получить к моменту at.
+// Отозванные бонусы не считаются; limited=false — лимита для валюты нет
+func (s *BonusService) allowance(tx database.Tx, userID, currency string, at time.Time) (remaining models.Money, limited bool, err error) {
+	daily, hasDaily := s.limits.Daily[currency]
+	monthly, hasMonthly := s.limits.Monthly[currency]
+	if !hasDaily && !hasMonthly {
+		return models.Money{}, false, nil
+	}
+	bonuses, err := tx.GetBonusesByUserID(userID)
+	if err != nil {
+		return models.Money{}, false, err
+	}
+	at = at.UTC()
+	dayStart := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var earnedToday, earnedThisMonth int64
+	for _, bonus := range bonuses {
+		if !isTransactionBonus(bonus) || bonus.Status == "revoked" || bonus.Amount.Currency != currency {
+			continue
+		}
+		if !bonus.CreatedAt.Before(monthStart) {
+			earnedThisMonth += bonus.Amount.Minor
+		}
+		if !bonus.CreatedAt.Before(dayStart) {
+			earnedToday += bonus.Amount.Minor
+		}
+	}
+
+	left := int64(-1)
+	if hasDaily {
+		left = daily.Minor - earnedToday
+	}
+	if hasMonthly && (left < 0 || monthly.Minor-earnedThisMonth < left) {
+		left = monthly.Minor - earnedThisMonth
+	}
+	if left < 0 {
+		left = 0
+	}
+	return models.NewMoney(left, currency), true, nil
+}
+
+// lockUserAwards сериализует начисления бонусов за операции одному пользователю, пока действуют лимиты:
+// проверка лимита только читает его бонусы, и без блокировки два параллельных начисления вместе превысили бы
+// лимит. Блокируются все счета пользователя, потому что операции по разным его счетам делят один лимит
+func (s *BonusService) lockUserAwards(tx database.Tx, userID string) error {
+	if len(s.limits.Daily) == 0 && len(s.limits.Monthly) == 0 {
+		return nil
+	}
+	accounts, err := tx.GetAccountsByUserID(userID)
+	if err != nil || len(accounts) == 0 {
+		return err
+	}
+	ids := make([]string, len(accounts))
+	for i, account := range accounts {
+		ids[i] = account.ID
+	}
+	return tx.LockAccounts(ids...)
+}
+
+// chargeBudget списывает выданный бонус с бюджета кампании
+func chargeBudget(tx database.Tx, campaignID string, amount models.Money) error {
+	return adjustSpent(tx, campaignID, amount.Minor)
+}
+
+// refundBudget возвращает отозванный бонус в бюджет кампании; удалённая кампания пропускается
+func refundBudget(tx database.Tx, campaignID string, amount models.Money) error {
+	err := adjustSpent(tx, campaignID, -amount.Minor)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func adjustSpent(tx database.Tx, campaignID string, delta int64) error {
+	if campaignID == "" {
+		return nil
+	}
+	campaign, err := tx.GetCampaign(campaignID)
+	if err != nil {
+		return err
+	}
+	if _, limited := campaigns.Remaining(campaign); !limited {
+		return nil
+	}
+	spent := campaign.Spent.Minor + delta
+	if spent < 0 {
+		spent = 0
+	}
+	campaign.Spent = models.NewMoney(spent, campaign.Budget.Currency)
+	return tx.UpdateCampaign(campaign)
+}
+
+// carrySpent переносит уже потраченное с прежней версии кампании: бюджет ведёт сервер, а не клиент
+func carrySpent(campaign, current *models.Campaign) error {
+	campaign.Spent = models.Money{}
+	if _, limited := campaigns.Remaining(campaign); !limited {
+		return nil
+	}
+	if current != nil && current.Spent.Minor != 0 {
+		if current.Spent.Currency != campaign.Budget.Currency {
+			return fmt.Errorf("%w: budget currency cannot change once bonuses are issued", campaigns.ErrInvalidCampaign)
+		}
+		campaign.Spent = current.Spent
+		return nil
+	}
+	campaign.Spent = models.Zero(campaign.Budget.Currency)
+	return nil
+}
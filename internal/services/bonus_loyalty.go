@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/loyalty"
+	"petProjectMike/internal/models"
+)
+
+// tier уровень лояльности пользователя к моменту at без учёта операции exceptTransactionID.
+// Без программы у всех базовый уровень с множителем ×1
+func (s *BonusService) tier(store database.Store, userID string, at time.Time, exceptTransactionID string) (loyalty.Tier, error) {
+	if s.loyalty == nil {
+		return loyalty.Tier{}, nil
+	}
+	entries, err := store.GetPointsEntriesByUser(userID)
+	if err != nil {
+		return loyalty.Tier{}, err
+	}
+	return s.loyalty.TierFor(loyalty.Activity(entries, at, exceptTransactionID)), nil
+}
+
+// ConvertPoints обменивает points баллов пользователя на бонус в валюте currency по стоимости из программы.
+// Баланс баллов меняется с проверкой версии, поэтому параллельные обмены не потратят одни баллы дважды
+func (s *BonusService) ConvertPoints(userID string, points int64, currency string) (*models.Bonus, error) {
+	if s.loyalty == nil {
+		return nil, loyalty.ErrNotConvertible
+	}
+	value, err := s.loyalty.Value(points, currency)
+	if err != nil {
+		return nil, err
+	}
+	var bonus *models.Bonus
+	for attempt := 0; attempt < awardAttempts; attempt++ {
+		bonus = nil
+		err = s.db.RunInTx(func(tx database.Tx) error {
+			user, err := tx.GetUser(userID)
+			if err != nil {
+				return err
+			}
+			if user.Erased() {
+				return ErrUserErased
+			}
+			account, err := tx.GetLoyaltyAccount(userID)
+			if errors.Is(err, database.ErrNotFound) {
+				return ErrInsufficientPoints
+			}
+			if err != nil {
+				return err
+			}
+			if account.Points < points {
+				return ErrInsufficientPoints
+			}
+			now := time.Now()
+			account.Points -= points
+			account.UpdatedAt = now
+			if err := tx.UpdateLoyaltyAccount(account); err != nil {
+				return err
+			}
+			bonus = models.NewBonus(userID, models.SourcePoints, value, now.AddDate(0, 0, loyalty.BonusExpiresInDays))
+			bonus.Source = models.SourcePoints
+			if err := tx.CreateBonus(bonus); err != nil {
+				return err
+			}
+			return tx.CreatePointsEntry(&models.PointsEntry{
+				ID: bonus.ID, UserID: userID, Kind: models.PointsConvert, Points: -points, BonusID: bonus.ID, CreatedAt: now,
+			})
+		})
+		if !errors.Is(err, database.ErrConflict) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bonus, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxPromoBatch сколько кодов можно сгенерировать одной партией
+	maxPromoBatch   = 1000
+	promoCodeLength = 8
+	// promoCodeAttempts сколько раз генерировать код, если выпал уже занятый
+	promoCodeAttempts = 5
+)
+
+// promoCodePattern код или префикс кодов, заданный администратором
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9-]{0,31}$`)
+
+// GeneratePromoCodes создаёт партию из count кодов по шаблону template. Если в шаблоне задан Code,
+// создаётся ровно один код с этим именем, иначе коды генерируются случайно с префиксом prefix.
+// Все коды партии сохраняются одной транзакцией и получают общий BatchID
+func (s *BonusService) GeneratePromoCodes(template *models.PromoCode, count int, prefix string) ([]*models.PromoCode, error) {
+	template = models.ClonePromoCode(template)
+	template.Code = NormalizeReferralCode(template.Code)
+	prefix = NormalizeReferralCode(prefix)
+	if template.PerUserLimit == 0 {
+		template.PerUserLimit = 1
+	}
+	if template.BonusType == "" {
+		template.BonusType = models.SourcePromo
+	}
+	if template.Code != "" && count == 0 {
+		count = 1
+	}
+	if err := validatePromo(template, count, prefix); err != nil {
+		return nil, err
+	}
+
+	batchID := uuid.New().String()
+	now := time.Now()
+	codes := make([]*models.PromoCode, 0, count)
+	err := s.db.RunInTx(func(tx database.Tx) error {
+		for i := 0; i < count; i++ {
+			code := models.ClonePromoCode(template)
+			code.BatchID, code.Redemptions, code.CreatedAt, code.Version = batchID, 0, now, 0
+			if template.Code == "" {
+				generated, err := newPromoCode(tx, prefix)
+				if err != nil {
+					return err
+				}
+				code.Code = generated
+			}
+			if err := tx.CreatePromoCode(code); err != nil {
+				return err
+			}
+			codes = append(codes, code)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func validatePromo(template *models.PromoCode, count int, prefix string) error {
+	switch {
+	case template.Code != "" && count != 1:
+		return fmt.Errorf("%w: a custom code makes a batch of exactly one", ErrInvalidPromo)
+	case template.Code != "" && prefix != "":
+		return fmt.Errorf("%w: prefix applies to generated codes only", ErrInvalidPromo)
+	case template.Code != "" && !promoCodePattern.MatchString(template.Code):
+		return fmt.Errorf("%w: code must be up to 32 letters, digits or dashes", ErrInvalidPromo)
+	case prefix != "" && (len(prefix) > 16 || !promoCodePattern.MatchString(prefix)):
+		return fmt.Errorf("%w: prefix must be up to 16 letters, digits or dashes", ErrInvalidPromo)
+	case count < 1 || count > maxPromoBatch:
+		return fmt.Errorf("%w: count must be between 1 and %d", ErrInvalidPromo, maxPromoBatch)
+	case !template.Reward.IsPositive():
+		return fmt.Errorf("%w: reward must be positive", ErrInvalidPromo)
+	case template.ExpiresInDays <= 0:
+		return fmt.Errorf("%w: expires_in_days must be positive", ErrInvalidPromo)
+	case template.MaxRedemptions < 1:
+		return fmt.Errorf("%w: max_redemptions must be at least 1", ErrInvalidPromo)
+	case template.PerUserLimit < 1 || template.PerUserLimit > template.MaxRedemptions:
+		return fmt.Errorf("%w: per_user_limit must be between 1 and max_redemptions", ErrInvalidPromo)
+	case template.StartsAt != nil && template.EndsAt != nil && !template.EndsAt.After(*template.StartsAt):
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidPromo)
+	}
+	return nil
+}
+
+// newPromoCode случайный код с префиксом, не совпадающий с уже созданными
+func newPromoCode(tx database.Tx, prefix string) (string, error) {
+	for attempt := 0; attempt < promoCodeAttempts; attempt++ {
+		code, err := randomCode(promoCodeLength)
+		if err != nil {
+			return "", err
+		}
+		if prefix != "" {
+			code = prefix + "-" + code
+		}
+		_, err = tx.GetPromoCode(code)
+		if errors.Is(err, database.ErrNotFound) {
+			return code, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", database.ErrConflict
+}
+
+// GetPromoBatch коды партии вместе со счётчиками погашений
+func (s *BonusService) GetPromoBatch(batchID string) ([]*models.PromoCode, error) {
+	codes, err := s.db.GetPromoCodesByBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("promo batch %s: %w", batchID, database.ErrNotFound)
+	}
+	return codes, nil
+}
+
+// RedeemPromoCode гасит код и начисляет пользователю бонус. Счётчик погашений хранится в самом коде
+// и обновляется с проверкой версии, поэтому параллельные погашения не превысят ни общий лимит,
+// ни лимит на пользователя: проигравшая транзакция повторяется и видит уже учтённое погашение
+func (s *BonusService) RedeemPromoCode(userID, code string) (*models.Bonus, error) {
+	code = NormalizeReferralCode(code)
+	var bonus *models.Bonus
+	var err error
+	for attempt := 0; attempt < awardAttempts; attempt++ {
+		bonus = nil
+		err = s.db.RunInTx(func(tx database.Tx) error {
+			user, err := tx.GetUser(userID)
+			if err != nil {
+				return err
+			}
+			if user.Erased() {
+				return ErrUserErased
+			}
+			promo, err := tx.GetPromoCode(code)
+			if errors.Is(err, database.ErrNotFound) {
+				return ErrUnknownPromoCode
+			}
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			if (promo.StartsAt != nil && now.Before(*promo.StartsAt)) || (promo.EndsAt != nil && !now.Before(*promo.EndsAt)) {
+				return ErrPromoNotActive
+			}
+			if promo.Redemptions >= promo.MaxRedemptions {
+				return ErrPromoExhausted
+			}
+			redemptions, err := tx.GetPromoRedemptions(code)
+			if err != nil {
+				return err
+			}
+			used := 0
+			for _, redemption := range redemptions {
+				if redemption.UserID == userID {
+					used++
+				}
+			}
+			if used >= promo.PerUserLimit {
+				return ErrPromoUserLimit
+			}
+
+			promo.Redemptions++
+			if err := tx.UpdatePromoCode(promo); err != nil {
+				return err
+			}
+			bonus = models.NewBonus(userID, promo.BonusType, promo.Reward, now.AddDate(0, 0, promo.ExpiresInDays))
+			bonus.Source = models.SourcePromo
+			if err := tx.CreateBonus(bonus); err != nil {
+				return err
+			}
+			return tx.CreatePromoRedemption(&models.PromoRedemption{
+				ID: uuid.New().String(), Code: code, UserID: userID, BonusID: bonus.ID, CreatedAt: now,
+			})
+		})
+		if !errors.Is(err, database.ErrConflict) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bonus, nil
+}
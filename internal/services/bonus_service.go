@@ -2,93 +2,553 @@ package services
 
 import (
 	"errors"
+	"sort"
 	"time"
 
+	"petProjectMike/internal/campaigns"
 	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/fx"
+	"petProjectMike/internal/ledger"
+	"petProjectMike/internal/loyalty"
 	"petProjectMike/internal/models"
 )
 
 type BonusService struct {
-	db database.Database
+	db     database.Database
+	limits BonusLimits
+	// rates курсы для зачисления бонуса на счёт в другой валюте; nil — только в валюте бонуса
+	rates *fx.Table
+	// loyalty программа лояльности: множители уровней и обмен баллов; nil — программа выключена
+	loyalty *loyalty.Program
 }
 
-func NewBonusService(db database.Database) *BonusService {
-	return &BonusService{db: db}
+func NewBonusService(db database.Database, limits BonusLimits, rates *fx.Table, program *loyalty.Program) *BonusService {
+	return &BonusService{db: db, limits: limits, rates: rates, loyalty: program}
 }
 
-func (s *BonusService) CreateWelcomeBonus(userID string, amount float64) (*models.Bonus, error) {
-	_, err := s.db.GetUser(userID)
+// welcomeBonusID у приветственного бонуса ID выводится из пользователя: второй такой бонус
+// хранилище не создаст даже при параллельных запросах
+func welcomeBonusID(userID string) string {
+	return models.TriggerWelcome + ":" + userID
+}
+
+// isWelcomeBonus приветственный бонус; у бонусов до появления Source его узнают по типу
+func isWelcomeBonus(bonus *models.Bonus) bool {
+	return bonus.Source == models.TriggerWelcome || (bonus.Source == "" && bonus.Type == "welcome")
+}
+
+// CreateWelcomeBonus начисляет приветственный бонус по кампании с наивысшим приоритетом,
+// сработавшей на запрошенную сумму. Пользователь получает его один раз
+func (s *BonusService) CreateWelcomeBonus(userID string, amount models.Money) (*models.Bonus, error) {
+	var bonus *models.Bonus
+	err := s.db.RunInTx(func(tx database.Tx) error {
+		user, err := tx.GetUser(userID)
+		if err != nil {
+			return err
+		}
+		if !amount.IsPositive() {
+			return ErrNonPositiveAmount
+		}
+		existing, err := tx.GetBonusesByUserID(userID)
+		if err != nil {
+			return err
+		}
+		for _, b := range existing {
+			if isWelcomeBonus(b) {
+				return ErrWelcomeBonusGranted
+			}
+		}
+		fired, err := s.evaluate(tx, user, models.TriggerWelcome, amount, time.Now(), 0)
+		if err != nil {
+			return err
+		}
+		if len(fired) == 0 {
+			return ErrNoMatchingCampaign
+		}
+		bonus = bonusFor(userID, models.TriggerWelcome, fired[0])
+		bonus.ID = welcomeBonusID(userID)
+		if err := tx.CreateBonus(bonus); err != nil {
+			return err
+		}
+		return chargeBudget(tx, bonus.CampaignID, bonus.Amount)
+	})
+	if errors.Is(err, database.ErrAlreadyExists) {
+		return nil, ErrWelcomeBonusGranted
+	}
 	if err != nil {
 		return nil, err
 	}
-	expiresAt := time.Now().AddDate(0, 0, 30)
-	bonus := models.NewBonus(userID, "welcome", amount, expiresAt)
-	if err := s.db.CreateBonus(bonus); err != nil {
+	return bonus, nil
+}
+
+// CreateTransactionBonus начисляет бонусы за операцию: по одному за каждую сработавшую кампанию.
+// Если ни одна кампания не подошла, бонусов нет и это не ошибка
+func (s *BonusService) CreateTransactionBonus(userID string, amount models.Money, transactionType string) ([]*models.Bonus, error) {
+	switch transactionType {
+	case models.TriggerTransfer, models.TriggerDeposit:
+	default:
+		return nil, ErrUnsupportedBonusType
+	}
+	var bonuses []*models.Bonus
+	err := s.db.RunInTx(func(tx database.Tx) error {
+		user, err := tx.GetUser(userID)
+		if err != nil {
+			return err
+		}
+		bonuses, err = s.award(tx, user, transactionType, amount, time.Now(), "")
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
-	return bonus, nil
+	return bonuses, nil
 }
 
-func (s *BonusService) CreateTransactionBonus(userID string, amount float64, transactionType string) (*models.Bonus, error) {
-	_, err := s.db.GetUser(userID)
+// AwardTransactionBonuses начисляет бонусы за проведённую операцию владельцу счёта: за перевод —
+// отправителю, за пополнение — получателю; за остальные операции и переводы между своими счетами бонусов нет. Повторная доставка
+// события ничего не добавляет: бонусы ищутся по ID операции, а их ID выводятся из ID операции и кампании
+func (s *BonusService) AwardTransactionBonuses(transaction *models.Transaction) ([]*models.Bonus, error) {
+	accountID := rewardedAccount(transaction)
+	if accountID == "" {
+		return nil, nil
+	}
+	var bonuses []*models.Bonus
+	var err error
+	// Бюджет кампании меняет каждое начисление, и параллельные начисления по одной кампании
+	// конфликтуют; повтор безопасен, потому что начисление за операцию идемпотентно
+	for attempt := 0; attempt < awardAttempts; attempt++ {
+		bonuses = nil
+		err = s.db.RunInTx(func(tx database.Tx) error {
+			awarded, err := tx.GetBonusesByTransaction(transaction.ID)
+			if err != nil {
+				return err
+			}
+			// За пополнение могут быть и бонусы за приглашение: они начисляются отдельно
+			for _, bonus := range awarded {
+				if bonus.Source == transaction.Type {
+					return nil
+				}
+			}
+			userID, err := rewardedUser(tx, transaction)
+			if err != nil || userID == "" {
+				return err
+			}
+			user, err := tx.GetUser(userID)
+			if err != nil {
+				return err
+			}
+			bonuses, err = s.award(tx, user, transaction.Type, transaction.Amount, transaction.UpdatedAt, transaction.ID)
+			return err
+		})
+		if !errors.Is(err, database.ErrConflict) {
+			break
+		}
+	}
+	if errors.Is(err, database.ErrAlreadyExists) {
+		// Параллельная доставка того же события успела начислить бонусы первой
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
+	return bonuses, nil
+}
 
-	var bonusType string
-	var bonusAmount float64
-	switch transactionType {
-	case "transfer":
-		bonusType = "transaction"
-		bonusAmount = amount * 0.01
-	case "deposit":
-		bonusType = "transaction"
-		bonusAmount = amount * 0.005
-	default:
-		return nil, errors.New("unsupported transaction type for bonus")
+// rewardedAccount счёт, владелец которого получает вознаграждение за операцию: за перевод — счёт
+// отправителя, за пополнение — получателя; пустой — операция вознаграждения не даёт
+func rewardedAccount(transaction *models.Transaction) string {
+	switch transaction.Type {
+	case models.TriggerTransfer:
+		return transaction.FromAccount
+	case models.TriggerDeposit:
+		return transaction.ToAccount
 	}
+	return ""
+}
 
-	expiresAt := time.Now().AddDate(0, 0, 90)
-	bonus := models.NewBonus(userID, bonusType, bonusAmount, expiresAt)
-	if err := s.db.CreateBonus(bonus); err != nil {
-		return nil, err
+// rewardedUser владелец счёта из rewardedAccount; пустой — вознаграждения нет. Перевод между счетами
+// одного пользователя не вознаграждается: деньги остаются у него, и бонусы с баллами можно было бы
+// накручивать, гоняя их по своим счетам
+func rewardedUser(tx database.Tx, transaction *models.Transaction) (string, error) {
+	accountID := rewardedAccount(transaction)
+	if accountID == "" {
+		return "", nil
 	}
-	return bonus, nil
+	account, err := tx.GetAccount(accountID)
+	if err != nil {
+		return "", err
+	}
+	if transaction.Type == models.TriggerTransfer {
+		recipient, err := tx.GetAccount(transaction.ToAccount)
+		if err != nil {
+			return "", err
+		}
+		if recipient.UserID == account.UserID {
+			return "", nil
+		}
+	}
+	return account.UserID, nil
 }
 
-func (s *BonusService) UseBonus(bonusID, accountID string) error {
-	bonus, err := s.db.GetBonus(bonusID)
+// awardAttempts сколько раз начисление или отзыв бонусов за операцию повторяется при конфликте версий
+const awardAttempts = 3
+
+// ClawBackTransactionBonuses отзывает бонусы за сторнированную операцию и возвращает их число.
+// Бонус получает статус "revoked", а всё, что с него успели зачислить, списывается обратно
+// со счетов зачисления, даже если остаток уйдёт в минус — как при возврате платежа
+func (s *BonusService) ClawBackTransactionBonuses(transactionID string) (int, error) {
+	var revoked int
+	var err error
+	// События не доставляются повторно, поэтому конфликт — бонус использовали после выборки
+	// или его параллельно изменили — решается повтором с новой выборкой и блокировками
+	for attempt := 0; attempt < awardAttempts; attempt++ {
+		revoked, err = s.clawBack(transactionID)
+		if !errors.Is(err, database.ErrConflict) {
+			break
+		}
+	}
+	return revoked, err
+}
+
+// clawBack одна попытка отзыва: выбирает бонусы и счета их зачислений, блокирует счета и отзывает бонусы.
+// Зачисление на счёт, не попавший в выборку, даёт ErrConflict
+func (s *BonusService) clawBack(transactionID string) (int, error) {
+	candidates, err := s.db.GetBonusesByTransaction(transactionID)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if bonus.Status != "active" {
-		return errors.New("bonus is not active")
+	locked := make(map[string]bool)
+	var accountIDs []string
+	for _, bonus := range candidates {
+		payouts, err := bonusPayouts(s.db, bonus)
+		if err != nil {
+			return 0, err
+		}
+		for _, payout := range payouts {
+			if !locked[payout.AccountID] {
+				locked[payout.AccountID] = true
+				accountIDs = append(accountIDs, payout.AccountID)
+			}
+		}
 	}
-	if time.Now().After(bonus.ExpiresAt) {
-		bonus.Status = "expired"
-		_ = s.db.UpdateBonus(bonus)
-		return errors.New("bonus has expired")
+	revoked := 0
+	err = s.db.RunInTx(func(tx database.Tx) error {
+		if len(accountIDs) > 0 {
+			if err := tx.LockAccounts(accountIDs...); err != nil {
+				return err
+			}
+		}
+		for _, candidate := range candidates {
+			bonus, err := tx.GetBonus(candidate.ID)
+			if err != nil {
+				return err
+			}
+			if bonus.Status == "revoked" {
+				continue
+			}
+			payouts, err := bonusPayouts(tx, bonus)
+			if err != nil {
+				return err
+			}
+			// Истёкший бонус, с которого ничего не зачислили, отзывать незачем
+			if bonus.Status == "expired" && len(payouts) == 0 {
+				continue
+			}
+			for _, payout := range payouts {
+				// Бонус использовали уже после выборки, и его счёт не заблокирован: попытка повторится
+				if !locked[payout.AccountID] {
+					return database.ErrConflict
+				}
+				entry := models.NewLedgerEntry(bonus.ID, "bonus_clawback", "clawback of bonus "+bonus.Type,
+					ledger.Move(payout.AccountID, models.BonusExpenseAccount, payout.Payout())...)
+				if err := ledger.Post(tx, entry); err != nil {
+					return err
+				}
+			}
+			bonus.Status = "revoked"
+			bonus.RemainingAmount = models.Zero(bonus.Amount.Currency)
+			if err := tx.UpdateBonus(bonus); err != nil {
+				return err
+			}
+			if err := refundBudget(tx, bonus.CampaignID, bonus.Amount); err != nil {
+				return err
+			}
+			revoked++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	return revoked, nil
+}
 
-	account, err := s.db.GetAccount(accountID)
+// convert переводит часть бонуса в валюту счёта и возвращает курс; в той же валюте курс пустой
+func (s *BonusService) convert(amount models.Money, currency string) (models.Money, string, error) {
+	if amount.Currency == currency {
+		return amount, "", nil
+	}
+	rate, err := s.rates.Rate(amount.Currency, currency)
 	if err != nil {
-		return err
+		return models.Money{}, "", err
 	}
-	if account.UserID != bonus.UserID {
-		return errors.New("bonus can only be used on user's own account")
+	credited, err := rate.Convert(amount)
+	if err != nil {
+		return models.Money{}, "", err
+	}
+	// Слишком малая часть бонуса по курсу округляется до нуля
+	if !credited.IsPositive() {
+		return models.Money{}, "", ErrNonPositiveAmount
 	}
+	return credited, rate.Value, nil
+}
 
-	account.Balance += bonus.Amount
-	account.UpdatedAt = time.Now()
-	if err := s.db.UpdateAccount(account); err != nil {
-		return err
+// bonusPayouts зачисления с бонуса по истории использований. Бонус, использованный до её появления,
+// был зачислен целиком на UsedAccountID
+func bonusPayouts(store database.Store, bonus *models.Bonus) ([]*models.BonusRedemption, error) {
+	redemptions, err := store.GetBonusRedemptions(bonus.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(redemptions) == 0 && bonus.Status == "used" && bonus.UsedAccountID != "" {
+		redemptions = append(redemptions, &models.BonusRedemption{BonusID: bonus.ID, UserID: bonus.UserID, AccountID: bonus.UsedAccountID, Amount: bonus.Amount})
+	}
+	return redemptions, nil
+}
+
+// BonusHistoryEntry бонус в любом статусе вместе с историей его использований
+type BonusHistoryEntry struct {
+	*models.Bonus
+	Redemptions []*models.BonusRedemption `json:"redemptions"`
+}
+
+// GetBonusHistory все бонусы пользователя, включая использованные, истёкшие и отозванные, от новых к старым
+func (s *BonusService) GetBonusHistory(userID string) ([]BonusHistoryEntry, error) {
+	bonuses, err := s.db.GetBonusesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(bonuses, func(i, j int) bool {
+		if !bonuses[i].CreatedAt.Equal(bonuses[j].CreatedAt) {
+			return bonuses[i].CreatedAt.After(bonuses[j].CreatedAt)
+		}
+		return bonuses[i].ID > bonuses[j].ID
+	})
+	history := make([]BonusHistoryEntry, 0, len(bonuses))
+	for _, bonus := range bonuses {
+		redemptions, err := s.db.GetBonusRedemptions(bonus.ID)
+		if err != nil {
+			return nil, err
+		}
+		if redemptions == nil {
+			redemptions = []*models.BonusRedemption{}
+		}
+		bonus.RemainingAmount = bonus.Remaining()
+		history = append(history, BonusHistoryEntry{Bonus: bonus, Redemptions: redemptions})
 	}
+	return history, nil
+}
 
-	bonus.Status = "used"
-	if err := s.db.UpdateBonus(bonus); err != nil {
+// Subscribe подписывает бонусы на события операций: начисление за проведённые и отзыв при сторно
+func (s *BonusService) Subscribe(bus *events.Bus) {
+	events.Subscribe(bus, func(event events.TransactionCompleted) error {
+		_, err := s.AwardTransactionBonuses(&event.Transaction)
+		return err
+	})
+	events.Subscribe(bus, func(event events.TransactionReversed) error {
+		_, err := s.ClawBackTransactionBonuses(event.Transaction.ID)
 		return err
+	})
+}
+
+// award создаёт по бонусу на каждую сработавшую кампанию в пределах лимита пользователя: бонус,
+// который в лимит не помещается, урезается, а после исчерпания лимита не начисляется. Бонусы за перевод
+// и пополнение умножаются по уровню лояльности пользователя. Бонус за операцию transactionID получает ID
+// из операции и кампании, чтобы хранилище не дало начислить его дважды
+func (s *BonusService) award(tx database.Tx, user *models.User, trigger string, amount models.Money, at time.Time, transactionID string) ([]*models.Bonus, error) {
+	var multiplierBP int64
+	if trigger == models.TriggerTransfer || trigger == models.TriggerDeposit {
+		if err := s.lockUserAwards(tx, user.ID); err != nil {
+			return nil, err
+		}
+		tier, err := s.tier(tx, user.ID, at, transactionID)
+		if err != nil {
+			return nil, err
+		}
+		multiplierBP = tier.MultiplierBP
+	}
+	fired, err := s.evaluate(tx, user, trigger, amount, at, multiplierBP)
+	if err != nil {
+		return nil, err
+	}
+	var bonuses []*models.Bonus
+	for _, decision := range fired {
+		// Лимит пересчитывается на каждую кампанию: в нём уже учтены бонусы, созданные выше
+		remaining, limited, err := s.allowance(tx, user.ID, decision.Reward.Currency, at)
+		if err != nil {
+			return nil, err
+		}
+		if limited {
+			if !remaining.IsPositive() {
+				continue
+			}
+			if decision.Reward.Minor > remaining.Minor {
+				decision.Reward = remaining
+			}
+		}
+		bonus := bonusFor(user.ID, trigger, decision)
+		if transactionID != "" {
+			bonus.ID = transactionBonusID(transactionID, trigger, decision.CampaignID)
+			bonus.TransactionID = transactionID
+		}
+		if err := tx.CreateBonus(bonus); err != nil {
+			return nil, err
+		}
+		if err := chargeBudget(tx, bonus.CampaignID, bonus.Amount); err != nil {
+			return nil, err
+		}
+		bonuses = append(bonuses, bonus)
+	}
+	return bonuses, nil
+}
+
+// transactionBonusID ID бонуса за операцию. Бонусы за приглашение по тому же пополнению
+// отличаются событием: одна кампания может срабатывать и на пополнение, и на приглашение
+func transactionBonusID(transactionID, trigger, campaignID string) string {
+	if trigger == models.TriggerReferrer || trigger == models.TriggerReferee {
+		return transactionID + ":" + trigger + ":" + campaignID
+	}
+	return transactionID + ":" + campaignID
+}
+
+// awardReferral начисляет по кампаниям бонусы за подтверждённое приглашение пригласившему и приглашённому.
+// Бонусы помнят пополнение, которым подтверждено приглашение: при его сторно они отзываются.
+// Удалённый пригласивший бонус не получает
+func (s *BonusService) awardReferral(tx database.Tx, referral *models.Referral, deposit *models.Transaction) ([]*models.Bonus, error) {
+	sides := []struct{ userID, trigger string }{
+		{referral.ReferrerID, models.TriggerReferrer},
+		{referral.RefereeID, models.TriggerReferee},
+	}
+	var bonuses []*models.Bonus
+	for _, side := range sides {
+		user, err := tx.GetUser(side.userID)
+		if errors.Is(err, database.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Удалённому пользователю бонусы не начисляются: воспользоваться ими он уже не сможет
+		if user.Erased() {
+			continue
+		}
+		awarded, err := s.award(tx, user, side.trigger, deposit.Amount, deposit.UpdatedAt, deposit.ID)
+		if err != nil {
+			return nil, err
+		}
+		bonuses = append(bonuses, awarded...)
+	}
+	return bonuses, nil
+}
+
+// evaluate сработавшие на событие кампании, от высокого приоритета к низкому
+func (s *BonusService) evaluate(tx database.Tx, user *models.User, trigger string, amount models.Money, at time.Time, multiplierBP int64) ([]campaigns.Decision, error) {
+	list, err := tx.ListCampaigns()
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	event := campaigns.Event{Trigger: trigger, UserID: user.ID, UserRegisteredAt: user.CreatedAt, Amount: amount, At: at, MultiplierBP: multiplierBP}
+	return campaigns.Fired(campaigns.Evaluate(list, event)), nil
+}
+
+func bonusFor(userID, trigger string, decision campaigns.Decision) *models.Bonus {
+	bonus := models.NewBonus(userID, decision.BonusType, decision.Reward, *decision.ExpiresAt)
+	bonus.CampaignID = decision.CampaignID
+	bonus.Source = trigger
+	return bonus
+}
+
+// UseBonus зачисляет на счёт владельца часть бонуса amount (в валюте бонуса); пустая amount — весь остаток.
+// На счёт в другой валюте сумма конвертируется по курсу, а без курса зачисление отклоняется.
+// Зачисление проводится операцией "bonus" и попадает в историю использований бонуса вместе с курсом;
+// когда остаток кончается, бонус становится "used"
+func (s *BonusService) UseBonus(bonusID, accountID string, amount models.Money) (*models.BonusRedemption, error) {
+	// Истёкший бонус помечается "expired" и этот статус должен сохраниться,
+	// поэтому транзакция коммитится, а ошибка возвращается уже после неё
+	expired := false
+	var redemption *models.BonusRedemption
+	err := s.db.RunInTx(func(tx database.Tx) error {
+		bonus, err := tx.GetBonus(bonusID)
+		if err != nil {
+			return err
+		}
+		if bonus.Status != "active" {
+			return ErrBonusNotActive
+		}
+		if time.Now().After(bonus.ExpiresAt) {
+			bonus.Status = "expired"
+			expired = true
+			return tx.UpdateBonus(bonus)
+		}
+
+		if err := tx.LockAccounts(accountID); err != nil {
+			return err
+		}
+		account, err := tx.GetAccount(accountID)
+		if err != nil {
+			return err
+		}
+		if account.UserID != bonus.UserID {
+			return ErrBonusNotOwned
+		}
+		if err := ensureOpen(account); err != nil {
+			return err
+		}
+
+		remaining := bonus.Remaining()
+		if amount == (models.Money{}) {
+			amount = remaining
+		}
+		left, err := remaining.Sub(amount)
+		if err != nil {
+			return err
+		}
+		if !amount.IsPositive() {
+			return ErrNonPositiveAmount
+		}
+		if left.IsNegative() {
+			return ErrBonusInsufficient
+		}
+		credited, rate, err := s.convert(amount, account.Currency)
+		if err != nil {
+			return err
+		}
+
+		// Бонус оплачивается с системного счёта расходов на бонусы в валюте счёта
+		transaction := models.NewTransaction(models.BonusExpenseAccount, account.ID, credited, "bonus", "bonus "+bonus.Type)
+		if err := record(tx, transaction); err != nil {
+			return err
+		}
+		redemption = models.NewBonusRedemption(bonus, amount, transaction, rate)
+		if err := tx.CreateBonusRedemption(redemption); err != nil {
+			return err
+		}
+
+		bonus.RemainingAmount = left
+		if left.IsZero() {
+			bonus.Status = "used"
+		}
+		bonus.UsedAccountID = account.ID
+		return tx.UpdateBonus(bonus)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, ErrBonusExpired
+	}
+	return redemption, nil
 }
 
 func (s *BonusService) GetActiveBonuses(userID string) ([]*models.Bonus, error) {
@@ -110,6 +570,39 @@ func (s *BonusService) GetBonus(id string) (*models.Bonus, error) {
 	return s.db.GetBonus(id)
 }
 
-func (s *BonusService) ExpireExpiredBonuses() error {
-	return nil
+// ExpireExpiredBonuses переводит в "expired" активные бонусы с истёкшим сроком и возвращает их число.
+// Каждый бонус истекает в своей транзакции: бонус, который параллельно использовали или удалили,
+// пропускается, а не срывает весь проход
+func (s *BonusService) ExpireExpiredBonuses() (int, error) {
+	now := time.Now()
+	candidates, err := s.db.GetExpiredBonuses(now)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, candidate := range candidates {
+		changed := false
+		err := s.db.RunInTx(func(tx database.Tx) error {
+			bonus, err := tx.GetBonus(candidate.ID)
+			if err != nil {
+				return err
+			}
+			if bonus.Status != "active" || bonus.ExpiresAt.After(now) {
+				return nil
+			}
+			bonus.Status = "expired"
+			changed = true
+			return tx.UpdateBonus(bonus)
+		})
+		if errors.Is(err, database.ErrNotFound) || errors.Is(err, database.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		if changed {
+			expired++
+		}
+	}
+	return expired, nil
 }
@@ -1,9 +1,17 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"petProjectMike/internal/campaigns"
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/fx"
+	"petProjectMike/internal/ledger"
 	"petProjectMike/internal/models"
 
 	"github.com/stretchr/testify/assert"
@@ -19,17 +27,21 @@ func TestBonusService_CreateWelcomeBonus(t *testing.T) {
 	}
 
 	mockDB.On("GetUser", "user-1").Return(user, nil)
+	mockDB.On("GetBonusesByUserID", "user-1").Return([]*models.Bonus{}, nil)
+	mockDB.On("ListCampaigns").Return(campaigns.Defaults(), nil)
 	mockDB.On("CreateBonus", mock.AnythingOfType("*models.Bonus")).Return(nil)
+	mockDB.On("GetCampaign", "default-welcome").Return(campaigns.Defaults()[0], nil)
 
-	service := NewBonusService(mockDB)
-	bonus, err := service.CreateWelcomeBonus("user-1", 50.0)
+	service := NewBonusService(mockDB, BonusLimits{}, nil, nil)
+	bonus, err := service.CreateWelcomeBonus("user-1", models.NewMoney(5000, "USD"))
 
 	assert.NoError(t, err)
 	assert.NotNil(t, bonus)
 	assert.Equal(t, "user-1", bonus.UserID)
 	assert.Equal(t, "welcome", bonus.Type)
-	assert.Equal(t, 50.0, bonus.Amount)
+	assert.Equal(t, models.NewMoney(5000, "USD"), bonus.Amount)
 	assert.Equal(t, "active", bonus.Status)
+	assert.Equal(t, "default-welcome", bonus.CampaignID)
 
 	// Проверяем, что срок действия установлен на 30 дней вперед
 	expectedExpiry := time.Now().AddDate(0, 0, 30)
@@ -38,35 +50,52 @@ func TestBonusService_CreateWelcomeBonus(t *testing.T) {
 	mockDB.AssertExpectations(t)
 }
 
+func TestBonusService_CreateWelcomeBonus_NoMatchingCampaign(t *testing.T) {
+	mockDB := &MockDatabase{}
+	inactive := campaigns.Defaults()[0]
+	inactive.Active = false
+
+	mockDB.On("GetUser", "user-1").Return(&models.User{ID: "user-1"}, nil)
+	mockDB.On("GetBonusesByUserID", "user-1").Return([]*models.Bonus{}, nil)
+	mockDB.On("ListCampaigns").Return([]*models.Campaign{inactive}, nil)
+
+	service := NewBonusService(mockDB, BonusLimits{}, nil, nil)
+	bonus, err := service.CreateWelcomeBonus("user-1", models.NewMoney(5000, "USD"))
+
+	assert.ErrorIs(t, err, ErrNoMatchingCampaign)
+	assert.Nil(t, bonus)
+	mockDB.AssertNotCalled(t, "CreateBonus", mock.Anything)
+}
+
 func TestBonusService_CreateTransactionBonus(t *testing.T) {
 	tests := []struct {
 		name            string
 		userID          string
-		amount          float64
+		amount          models.Money
 		transactionType string
-		expectedAmount  float64
+		expectedAmount  models.Money
 		expectedError   bool
 	}{
 		{
 			name:            "transfer bonus",
 			userID:          "user-1",
-			amount:          100.0,
+			amount:          models.NewMoney(10000, "USD"),
 			transactionType: "transfer",
-			expectedAmount:  1.0, // 1% от 100
+			expectedAmount:  models.NewMoney(100, "USD"), // 1% от 100
 			expectedError:   false,
 		},
 		{
 			name:            "deposit bonus",
 			userID:          "user-1",
-			amount:          200.0,
+			amount:          models.NewMoney(20000, "USD"),
 			transactionType: "deposit",
-			expectedAmount:  1.0, // 0.5% от 200
+			expectedAmount:  models.NewMoney(100, "USD"), // 0.5% от 200
 			expectedError:   false,
 		},
 		{
 			name:            "unsupported transaction type",
 			userID:          "user-1",
-			amount:          100.0,
+			amount:          models.NewMoney(10000, "USD"),
 			transactionType: "withdrawal",
 			expectedError:   true,
 		},
@@ -81,21 +110,24 @@ func TestBonusService_CreateTransactionBonus(t *testing.T) {
 				Name:  "Test User",
 			}
 
-			mockDB.On("GetUser", tt.userID).Return(user, nil)
-
 			if !tt.expectedError {
+				mockDB.On("GetUser", tt.userID).Return(user, nil)
+				mockDB.On("ListCampaigns").Return(campaigns.Defaults(), nil)
 				mockDB.On("CreateBonus", mock.AnythingOfType("*models.Bonus")).Return(nil)
+				// Кампании по умолчанию без бюджета: списывать с него нечего
+				mockDB.On("GetCampaign", "default-"+tt.transactionType).Return(&models.Campaign{}, nil)
 			}
 
-			service := NewBonusService(mockDB)
-			bonus, err := service.CreateTransactionBonus(tt.userID, tt.amount, tt.transactionType)
+			service := NewBonusService(mockDB, BonusLimits{}, nil, nil)
+			bonuses, err := service.CreateTransactionBonus(tt.userID, tt.amount, tt.transactionType)
 
 			if tt.expectedError {
 				assert.Error(t, err)
-				assert.Nil(t, bonus)
+				assert.Nil(t, bonuses)
 			} else {
 				assert.NoError(t, err)
-				assert.NotNil(t, bonus)
+				assert.Len(t, bonuses, 1)
+				bonus := bonuses[0]
 				assert.Equal(t, tt.expectedAmount, bonus.Amount)
 				assert.Equal(t, "transaction", bonus.Type)
 				assert.Equal(t, "active", bonus.Status)
@@ -115,6 +147,7 @@ func TestBonusService_UseBonus(t *testing.T) {
 		name          string
 		bonusID       string
 		accountID     string
+		amount        models.Money
 		setupMocks    func(*MockDatabase)
 		expectedError bool
 	}{
@@ -127,24 +160,59 @@ func TestBonusService_UseBonus(t *testing.T) {
 					ID:        "bonus-1",
 					UserID:    "user-1",
 					Type:      "welcome",
-					Amount:    50.0,
+					Amount:    models.NewMoney(5000, "USD"),
 					Status:    "active",
 					ExpiresAt: time.Now().AddDate(0, 0, 30),
 				}
 				account := &models.Account{
 					ID:       "account-1",
 					UserID:   "user-1",
-					Balance:  100.0,
+					Balance:  models.NewMoney(10000, "USD"),
 					Currency: "USD",
 				}
 
 				mockDB.On("GetBonus", "bonus-1").Return(bonus, nil)
 				mockDB.On("GetAccount", "account-1").Return(account, nil)
+				mockDB.On("CreateTransaction", mock.MatchedBy(func(tr *models.Transaction) bool {
+					return tr.Type == "bonus" && tr.ToAccount == "account-1" && tr.Amount == models.NewMoney(5000, "USD")
+				})).Return(nil)
+				mockDB.On("CreateLedgerEntry", mock.MatchedBy(func(entry *models.LedgerEntry) bool {
+					return len(entry.Postings) == 2 &&
+						entry.Postings[0].AccountID == models.BonusExpenseAccount && entry.Postings[1].AccountID == "account-1"
+				})).Return(nil)
 				mockDB.On("UpdateAccount", mock.AnythingOfType("*models.Account")).Return(nil)
-				mockDB.On("UpdateBonus", mock.AnythingOfType("*models.Bonus")).Return(nil)
+				mockDB.On("UpdateTransaction", mock.AnythingOfType("*models.Transaction")).Return(nil)
+				mockDB.On("CreateBonusRedemption", mock.MatchedBy(func(r *models.BonusRedemption) bool {
+					return r.BonusID == "bonus-1" && r.AccountID == "account-1" && r.TransactionID != ""
+				})).Return(nil)
+				mockDB.On("UpdateBonus", mock.MatchedBy(func(b *models.Bonus) bool {
+					return b.Status == "used" && b.RemainingAmount.IsZero()
+				})).Return(nil)
 			},
 			expectedError: false,
 		},
+		{
+			name:      "amount above remaining",
+			bonusID:   "bonus-1",
+			accountID: "account-1",
+			amount:    models.NewMoney(3000, "USD"),
+			setupMocks: func(mockDB *MockDatabase) {
+				bonus := &models.Bonus{
+					ID:              "bonus-1",
+					UserID:          "user-1",
+					Type:            "welcome",
+					Amount:          models.NewMoney(5000, "USD"),
+					RemainingAmount: models.NewMoney(2000, "USD"),
+					Status:          "active",
+					ExpiresAt:       time.Now().AddDate(0, 0, 30),
+				}
+				account := &models.Account{ID: "account-1", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}
+
+				mockDB.On("GetBonus", "bonus-1").Return(bonus, nil)
+				mockDB.On("GetAccount", "account-1").Return(account, nil)
+			},
+			expectedError: true,
+		},
 		{
 			name:      "bonus not active",
 			bonusID:   "bonus-1",
@@ -154,7 +222,7 @@ func TestBonusService_UseBonus(t *testing.T) {
 					ID:        "bonus-1",
 					UserID:    "user-1",
 					Type:      "welcome",
-					Amount:    50.0,
+					Amount:    models.NewMoney(5000, "USD"),
 					Status:    "used",
 					ExpiresAt: time.Now().AddDate(0, 0, 30),
 				}
@@ -172,7 +240,7 @@ func TestBonusService_UseBonus(t *testing.T) {
 					ID:        "bonus-1",
 					UserID:    "user-1",
 					Type:      "welcome",
-					Amount:    50.0,
+					Amount:    models.NewMoney(5000, "USD"),
 					Status:    "active",
 					ExpiresAt: time.Now().AddDate(0, 0, -1), // expired yesterday
 				}
@@ -191,14 +259,14 @@ func TestBonusService_UseBonus(t *testing.T) {
 					ID:        "bonus-1",
 					UserID:    "user-1",
 					Type:      "welcome",
-					Amount:    50.0,
+					Amount:    models.NewMoney(5000, "USD"),
 					Status:    "active",
 					ExpiresAt: time.Now().AddDate(0, 0, 30),
 				}
 				account := &models.Account{
 					ID:       "account-1",
 					UserID:   "user-2", // different user
-					Balance:  100.0,
+					Balance:  models.NewMoney(10000, "USD"),
 					Currency: "USD",
 				}
 
@@ -214,8 +282,8 @@ func TestBonusService_UseBonus(t *testing.T) {
 			mockDB := &MockDatabase{}
 			tt.setupMocks(mockDB)
 
-			service := NewBonusService(mockDB)
-			err := service.UseBonus(tt.bonusID, tt.accountID)
+			service := NewBonusService(mockDB, BonusLimits{}, nil, nil)
+			_, err := service.UseBonus(tt.bonusID, tt.accountID, tt.amount)
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -235,7 +303,7 @@ func TestBonusService_GetActiveBonuses(t *testing.T) {
 			ID:        "bonus-1",
 			UserID:    "user-1",
 			Type:      "welcome",
-			Amount:    50.0,
+			Amount:    models.NewMoney(5000, "USD"),
 			Status:    "active",
 			ExpiresAt: time.Now().AddDate(0, 0, 30),
 		},
@@ -243,7 +311,7 @@ func TestBonusService_GetActiveBonuses(t *testing.T) {
 			ID:        "bonus-2",
 			UserID:    "user-1",
 			Type:      "transaction",
-			Amount:    25.0,
+			Amount:    models.NewMoney(2500, "USD"),
 			Status:    "active",
 			ExpiresAt: time.Now().AddDate(0, 0, 60),
 		},
@@ -251,7 +319,7 @@ func TestBonusService_GetActiveBonuses(t *testing.T) {
 			ID:        "bonus-3",
 			UserID:    "user-1",
 			Type:      "welcome",
-			Amount:    100.0,
+			Amount:    models.NewMoney(10000, "USD"),
 			Status:    "used", // неактивный
 			ExpiresAt: time.Now().AddDate(0, 0, 30),
 		},
@@ -259,7 +327,7 @@ func TestBonusService_GetActiveBonuses(t *testing.T) {
 			ID:        "bonus-4",
 			UserID:    "user-1",
 			Type:      "welcome",
-			Amount:    75.0,
+			Amount:    models.NewMoney(7500, "USD"),
 			Status:    "active",
 			ExpiresAt: time.Now().AddDate(0, 0, -1), // истекший
 		},
@@ -267,7 +335,7 @@ func TestBonusService_GetActiveBonuses(t *testing.T) {
 
 	mockDB.On("GetBonusesByUserID", "user-1").Return(bonuses, nil)
 
-	service := NewBonusService(mockDB)
+	service := NewBonusService(mockDB, BonusLimits{}, nil, nil)
 	result, err := service.GetActiveBonuses("user-1")
 
 	assert.NoError(t, err)
@@ -281,3 +349,555 @@ func TestBonusService_GetActiveBonuses(t *testing.T) {
 
 	mockDB.AssertExpectations(t)
 }
+
+func TestBonusService_ExpireExpiredBonuses(t *testing.T) {
+	mockDB := &MockDatabase{}
+	stale := &models.Bonus{ID: "bonus-1", UserID: "user-1", Status: "active", ExpiresAt: time.Now().Add(-time.Hour)}
+	// Второй бонус успели использовать между выборкой и транзакцией
+	used := &models.Bonus{ID: "bonus-2", UserID: "user-1", Status: "active", ExpiresAt: time.Now().Add(-time.Minute)}
+	usedNow := *used
+	usedNow.Status = "used"
+
+	mockDB.On("GetExpiredBonuses", mock.AnythingOfType("time.Time")).Return([]*models.Bonus{stale, used}, nil)
+	mockDB.On("GetBonus", "bonus-1").Return(stale, nil)
+	mockDB.On("GetBonus", "bonus-2").Return(&usedNow, nil)
+	mockDB.On("UpdateBonus", mock.MatchedBy(func(b *models.Bonus) bool {
+		return b.ID == "bonus-1" && b.Status == "expired"
+	})).Return(nil).Once()
+
+	service := NewBonusService(mockDB, BonusLimits{}, nil, nil)
+	expired, err := service.ExpireExpiredBonuses()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	mockDB.AssertExpectations(t)
+}
+
+func TestBonusService_UpdateCampaign(t *testing.T) {
+	mockDB := &MockDatabase{}
+	stored := campaigns.Defaults()[1]
+	stored.Version = 3
+	stored.CreatedAt = time.Now().Add(-time.Hour)
+
+	mockDB.On("GetCampaign", stored.ID).Return(models.CloneCampaign(stored), nil)
+	mockDB.On("UpdateCampaign", mock.MatchedBy(func(c *models.Campaign) bool {
+		return c.Reward.RateBP == 200 && c.Version == 3 && c.CreatedAt.Equal(stored.CreatedAt)
+	})).Return(nil).Once()
+
+	service := NewBonusService(mockDB, BonusLimits{}, nil, nil)
+	update := models.CloneCampaign(stored)
+	update.Reward.RateBP = 200
+
+	// Устаревшая версия — конфликт, запись не меняется
+	assert.ErrorIs(t, service.UpdateCampaign(update, 2), database.ErrConflict)
+	assert.NoError(t, service.UpdateCampaign(update, 3))
+
+	invalid := models.CloneCampaign(stored)
+	invalid.Reward.RateBP = 0
+	assert.ErrorIs(t, service.UpdateCampaign(invalid, 3), campaigns.ErrInvalidCampaign)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestBonusService_TransactionBonusesFollowEvents(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	bonusService := NewBonusService(db, BonusLimits{}, nil, nil)
+	assert.NoError(t, bonusService.SeedCampaigns(campaigns.Defaults(), false))
+	bus := events.NewBus()
+	bonusService.Subscribe(bus)
+	transactions := NewTransactionService(db, bus)
+
+	deposit, err := transactions.CreateDeposit("account-2", models.NewMoney(20000, "USD"), "salary")
+	assert.NoError(t, err)
+	awarded, err := db.GetBonusesByTransaction(deposit.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, awarded, 1) {
+		assert.Equal(t, "user-1", awarded[0].UserID)
+		assert.Equal(t, "default-deposit", awarded[0].CampaignID)
+		assert.Equal(t, models.NewMoney(100, "USD"), awarded[0].Amount)
+	}
+
+	// Повторная доставка события не начисляет бонус второй раз
+	bus.Publish(events.TransactionCompleted{Transaction: *deposit})
+	again, err := bonusService.AwardTransactionBonuses(deposit)
+	assert.NoError(t, err)
+	assert.Empty(t, again)
+	awarded, _ = db.GetBonusesByTransaction(deposit.ID)
+	assert.Len(t, awarded, 1)
+
+	// Списания бонусов не приносят
+	withdrawal, err := transactions.CreateWithdrawal("account-2", models.NewMoney(100, "USD"), "atm")
+	assert.NoError(t, err)
+	none, _ := db.GetBonusesByTransaction(withdrawal.ID)
+	assert.Empty(t, none)
+
+	// Использованный бонус при сторно списывается обратно со счёта
+	_, err = bonusService.UseBonus(awarded[0].ID, "account-2", models.Money{})
+	assert.NoError(t, err)
+	_, err = transactions.ReverseTransaction(deposit.ID, "chargeback")
+	assert.NoError(t, err)
+
+	bonus, err := db.GetBonus(awarded[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "revoked", bonus.Status)
+	assert.Equal(t, "account-2", bonus.UsedAccountID)
+	account, _ := db.GetAccount("account-2")
+	assert.Equal(t, models.NewMoney(-100, "USD"), account.Balance)
+
+	report, err := ledger.ComputeTrialBalance(db)
+	assert.NoError(t, err)
+	assert.True(t, report.Balanced)
+}
+
+func TestBonusService_NoTransferBonusesBetweenOwnAccounts(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-2", Email: "two@example.com"}))
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-3", UserID: "user-2", Balance: models.Zero("USD"), Currency: "USD"}))
+	bonusService := NewBonusService(db, BonusLimits{}, nil, nil)
+	assert.NoError(t, bonusService.SeedCampaigns(campaigns.Defaults(), false))
+	bus := events.NewBus()
+	bonusService.Subscribe(bus)
+	transactions := NewTransactionService(db, bus)
+
+	// Перевод на тот же счёт не проводится вовсе
+	_, err := transactions.CreateTransfer("account-1", "account-1", models.NewMoney(100000, "USD"), "loop")
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+	history, _ := db.GetTransactionsByAccount("account-1")
+	assert.Empty(t, history)
+
+	// Между своими счетами деньги ходят, но бонусов не приносят
+	for _, route := range [][2]string{{"account-1", "account-2"}, {"account-2", "account-1"}} {
+		transfer, err := transactions.CreateTransfer(route[0], route[1], models.NewMoney(50000, "USD"), "shuffle")
+		assert.NoError(t, err)
+		awarded, err := db.GetBonusesByTransaction(transfer.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, awarded)
+	}
+
+	// Перевод другому пользователю вознаграждается как обычно
+	transfer, err := transactions.CreateTransfer("account-1", "account-3", models.NewMoney(50000, "USD"), "gift")
+	assert.NoError(t, err)
+	awarded, err := db.GetBonusesByTransaction(transfer.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, awarded, 1) {
+		assert.Equal(t, "user-1", awarded[0].UserID)
+	}
+}
+
+func TestBonusService_ClawBackRevokesActiveBonus(t *testing.T) {
+	mockDB := &MockDatabase{}
+	active := &models.Bonus{ID: "tx-1:default-transfer", UserID: "user-1", TransactionID: "tx-1", Status: "active", Amount: models.NewMoney(100, "USD")}
+	expired := &models.Bonus{ID: "tx-1:old", UserID: "user-1", TransactionID: "tx-1", Status: "expired", Amount: models.NewMoney(100, "USD")}
+
+	mockDB.On("GetBonusesByTransaction", "tx-1").Return([]*models.Bonus{active, expired}, nil)
+	mockDB.On("GetBonusRedemptions", active.ID).Return([]*models.BonusRedemption{}, nil)
+	mockDB.On("GetBonusRedemptions", expired.ID).Return([]*models.BonusRedemption{}, nil)
+	mockDB.On("GetBonus", active.ID).Return(active, nil)
+	mockDB.On("GetBonus", expired.ID).Return(expired, nil)
+	mockDB.On("UpdateBonus", mock.MatchedBy(func(b *models.Bonus) bool {
+		return b.ID == active.ID && b.Status == "revoked"
+	})).Return(nil).Once()
+
+	service := NewBonusService(mockDB, BonusLimits{}, nil, nil)
+	revoked, err := service.ClawBackTransactionBonuses("tx-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, revoked)
+	mockDB.AssertExpectations(t)
+}
+
+func TestBonusService_UserDailyCap(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	bonusService := NewBonusService(db, BonusLimits{Daily: map[string]models.Money{"USD": models.NewMoney(150, "USD")}}, nil, nil)
+	assert.NoError(t, bonusService.SeedCampaigns(campaigns.Defaults(), false))
+
+	// 0.5% от 200 — 1.00, второй бонус урезается до остатка лимита 0.50, третий не начисляется
+	var amounts []models.Money
+	for i := 0; i < 3; i++ {
+		bonuses, err := bonusService.CreateTransactionBonus("user-1", models.NewMoney(20000, "USD"), "deposit")
+		assert.NoError(t, err)
+		for _, bonus := range bonuses {
+			amounts = append(amounts, bonus.Amount)
+		}
+	}
+	assert.Equal(t, []models.Money{models.NewMoney(100, "USD"), models.NewMoney(50, "USD")}, amounts)
+
+	// Приветственный бонус в лимит не входит, но выдаётся один раз
+	_, err := bonusService.CreateWelcomeBonus("user-1", models.NewMoney(500, "USD"))
+	assert.ErrorIs(t, err, ErrWelcomeBonusGranted) // у user-1 есть приветственный бонус из начальных данных
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-new", Email: "new@example.com"}))
+	_, err = bonusService.CreateWelcomeBonus("user-new", models.NewMoney(500, "USD"))
+	assert.NoError(t, err)
+	_, err = bonusService.CreateWelcomeBonus("user-new", models.NewMoney(500, "USD"))
+	assert.ErrorIs(t, err, ErrWelcomeBonusGranted)
+}
+
+// slowBonusDB задерживает создание бонуса в транзакции: параллельные начисления успевают
+// проверить лимит до того, как первое из них закоммитится
+type slowBonusDB struct {
+	database.Database
+}
+
+type slowBonusTx struct {
+	database.Tx
+}
+
+func (db *slowBonusDB) RunInTx(fn func(tx database.Tx) error) error {
+	return db.Database.RunInTx(func(tx database.Tx) error { return fn(slowBonusTx{tx}) })
+}
+
+func (tx slowBonusTx) CreateBonus(bonus *models.Bonus) error {
+	time.Sleep(10 * time.Millisecond)
+	return tx.Tx.CreateBonus(bonus)
+}
+
+func TestBonusService_UserCapHoldsUnderConcurrentAwards(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	bonusService := NewBonusService(&slowBonusDB{db}, BonusLimits{Daily: map[string]models.Money{"USD": models.NewMoney(150, "USD")}}, nil, nil)
+	assert.NoError(t, bonusService.SeedCampaigns(campaigns.Defaults(), false))
+	transactions := NewTransactionService(db, nil)
+
+	// Пополнения обоих счетов пользователя проведены, бонусы за них начисляются одновременно
+	const deposits = 20
+	var completed []*models.Transaction
+	for i := 0; i < deposits; i++ {
+		deposit, err := transactions.CreateDeposit([]string{"account-1", "account-2"}[i%2], models.NewMoney(20000, "USD"), "salary")
+		assert.NoError(t, err)
+		completed = append(completed, deposit)
+	}
+	var wg sync.WaitGroup
+	for _, deposit := range completed {
+		wg.Add(1)
+		go func(deposit *models.Transaction) {
+			defer wg.Done()
+			_, err := bonusService.AwardTransactionBonuses(deposit)
+			assert.NoError(t, err)
+		}(deposit)
+	}
+	wg.Wait()
+
+	bonuses, err := db.GetBonusesByUserID("user-1")
+	assert.NoError(t, err)
+	var total int64
+	for _, bonus := range bonuses {
+		if isTransactionBonus(bonus) {
+			total += bonus.Amount.Minor
+		}
+	}
+	assert.Equal(t, int64(150), total)
+}
+
+func TestBonusService_ClawBackRefundsBudget(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	bonusService := NewBonusService(db, BonusLimits{}, nil, nil)
+	assert.NoError(t, bonusService.CreateCampaign(&models.Campaign{
+		ID: "limited", Name: "Limited deposits", Active: true, Triggers: []string{models.TriggerDeposit},
+		Conditions: models.CampaignConditions{Currency: "USD"},
+		Reward:     models.CampaignReward{Kind: models.RewardFixed, Amount: models.NewMoney(300, "USD"), BonusType: "promo", ExpiresInDays: 7},
+		Budget:     models.NewMoney(500, "USD"),
+	}))
+	bus := events.NewBus()
+	bonusService.Subscribe(bus)
+	transactions := NewTransactionService(db, bus)
+
+	first, err := transactions.CreateDeposit("account-2", models.NewMoney(1000, "USD"), "first")
+	assert.NoError(t, err)
+	_, err = transactions.CreateDeposit("account-2", models.NewMoney(1000, "USD"), "second")
+	assert.NoError(t, err)
+	campaign, _ := db.GetCampaign("limited")
+	assert.Equal(t, models.NewMoney(500, "USD"), campaign.Spent)
+
+	// Отозванный бонус возвращается в бюджет
+	_, err = transactions.ReverseTransaction(first.ID, "chargeback")
+	assert.NoError(t, err)
+	campaign, _ = db.GetCampaign("limited")
+	assert.Equal(t, models.NewMoney(200, "USD"), campaign.Spent)
+}
+
+// beforeTxDB вызывает before один раз перед первой транзакцией: так тест вклинивается между выборкой и транзакцией
+type beforeTxDB struct {
+	database.Database
+	before func()
+}
+
+func (db *beforeTxDB) RunInTx(fn func(tx database.Tx) error) error {
+	if before := db.before; before != nil {
+		db.before = nil
+		before()
+	}
+	return db.Database.RunInTx(fn)
+}
+
+func TestBonusService_ClawBackRetriesWhenBonusUsedAfterSelection(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	bonusService := NewBonusService(db, BonusLimits{}, nil, nil)
+	assert.NoError(t, bonusService.CreateCampaign(&models.Campaign{
+		ID: "deposits", Name: "Deposits", Active: true, Triggers: []string{models.TriggerDeposit},
+		Conditions: models.CampaignConditions{Currency: "USD"},
+		Reward:     models.CampaignReward{Kind: models.RewardFixed, Amount: models.NewMoney(300, "USD"), BonusType: "promo", ExpiresInDays: 7},
+	}))
+	deposit, err := NewTransactionService(db, nil).CreateDeposit("account-2", models.NewMoney(1000, "USD"), "salary")
+	assert.NoError(t, err)
+	bonuses, err := bonusService.AwardTransactionBonuses(deposit)
+	assert.NoError(t, err)
+	if !assert.Len(t, bonuses, 1) {
+		return
+	}
+
+	// Бонус зачисляют на account-1 уже после того, как отзыв выбрал счета для блокировки
+	racing := &beforeTxDB{Database: db, before: func() {
+		_, err := bonusService.UseBonus(bonuses[0].ID, "account-1", models.NewMoney(100, "USD"))
+		assert.NoError(t, err)
+	}}
+	revoked, err := NewBonusService(racing, BonusLimits{}, nil, nil).ClawBackTransactionBonuses(deposit.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, revoked)
+
+	bonus, _ := db.GetBonus(bonuses[0].ID)
+	assert.Equal(t, "revoked", bonus.Status)
+	account, _ := db.GetAccount("account-1")
+	assert.Equal(t, models.NewMoney(100000, "USD"), account.Balance)
+}
+
+func TestParseBonusCaps(t *testing.T) {
+	caps, err := ParseBonusCaps(" USD:50.00, EUR:45 ")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]models.Money{"USD": models.NewMoney(5000, "USD"), "EUR": models.NewMoney(4500, "EUR")}, caps)
+
+	caps, err = ParseBonusCaps("")
+	assert.NoError(t, err)
+	assert.Empty(t, caps)
+
+	for _, spec := range []string{"USD", "USD:abc", "USD:0", "XXX:1.00"} {
+		_, err := ParseBonusCaps(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestBonusService_PartialRedemption(t *testing.T) {
+	db := database.NewInMemoryDB()
+	service := NewBonusService(db, BonusLimits{}, nil, nil)
+
+	first, err := service.UseBonus("bonus-1", "account-1", models.NewMoney(1000, "USD"))
+	assert.NoError(t, err)
+	_, err = service.UseBonus("bonus-1", "account-1", models.NewMoney(1500, "USD"))
+	assert.NoError(t, err)
+
+	bonus, err := db.GetBonus("bonus-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "active", bonus.Status)
+	assert.Equal(t, models.NewMoney(2500, "USD"), bonus.RemainingAmount)
+
+	// Зачисление — обычная операция по счёту
+	transaction, err := db.GetTransaction(first.TransactionID)
+	assert.NoError(t, err)
+	assert.Equal(t, "bonus", transaction.Type)
+	assert.Equal(t, "completed", transaction.Status)
+	assert.Equal(t, models.NewMoney(1000, "USD"), transaction.Amount)
+
+	_, err = service.UseBonus("bonus-1", "account-1", models.NewMoney(3000, "USD"))
+	assert.ErrorIs(t, err, ErrBonusInsufficient)
+	_, err = service.UseBonus("bonus-1", "account-1", models.NewMoney(100, "EUR"))
+	assert.ErrorIs(t, err, models.ErrCurrencyMismatch)
+
+	// Без суммы используется весь остаток
+	last, err := service.UseBonus("bonus-1", "account-1", models.Money{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(2500, "USD"), last.Amount)
+	_, err = service.UseBonus("bonus-1", "account-1", models.NewMoney(1, "USD"))
+	assert.ErrorIs(t, err, ErrBonusNotActive)
+
+	history, err := service.GetBonusHistory("user-1")
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "used", history[0].Status)
+		assert.Equal(t, models.Zero("USD"), history[0].RemainingAmount)
+		assert.Len(t, history[0].Redemptions, 3)
+	}
+	account, _ := db.GetAccount("account-1")
+	assert.Equal(t, models.NewMoney(105000, "USD"), account.Balance)
+
+	report, err := ledger.ComputeTrialBalance(db)
+	assert.NoError(t, err)
+	assert.True(t, report.Balanced)
+}
+
+func TestBonusService_UseBonusConvertsCurrency(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-eur", UserID: "user-1", Balance: models.Zero("EUR"), Currency: "EUR"}))
+	rates, err := fx.ParseTable("USD/EUR:0.92")
+	assert.NoError(t, err)
+	bonusService := NewBonusService(db, BonusLimits{}, rates, nil)
+	assert.NoError(t, bonusService.SeedCampaigns(campaigns.Defaults(), false))
+	bus := events.NewBus()
+	bonusService.Subscribe(bus)
+	transactions := NewTransactionService(db, bus)
+
+	// Бонус в USD зачисляется на EUR-счёт по курсу, который сохраняется в истории
+	redemption, err := bonusService.UseBonus("bonus-1", "account-eur", models.NewMoney(1000, "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(1000, "USD"), redemption.Amount)
+	assert.Equal(t, models.NewMoney(920, "EUR"), redemption.Credited)
+	assert.Equal(t, "0.92", redemption.Rate)
+	bonus, _ := db.GetBonus("bonus-1")
+	assert.Equal(t, models.NewMoney(4000, "USD"), bonus.RemainingAmount)
+
+	// Без курса зачисление в другой валюте отклоняется
+	_, err = NewBonusService(db, BonusLimits{}, nil, nil).UseBonus("bonus-1", "account-eur", models.NewMoney(1000, "USD"))
+	assert.ErrorIs(t, err, fx.ErrNoRate)
+
+	// При сторно списывается зачисленное в валюте счёта
+	deposit, err := transactions.CreateDeposit("account-1", models.NewMoney(20000, "USD"), "salary")
+	assert.NoError(t, err)
+	awarded, _ := db.GetBonusesByTransaction(deposit.ID)
+	if assert.Len(t, awarded, 1) {
+		_, err = bonusService.UseBonus(awarded[0].ID, "account-eur", models.Money{})
+		assert.NoError(t, err)
+	}
+	_, err = transactions.ReverseTransaction(deposit.ID, "chargeback")
+	assert.NoError(t, err)
+	account, _ := db.GetAccount("account-eur")
+	assert.Equal(t, models.NewMoney(920, "EUR"), account.Balance)
+
+	report, err := ledger.ComputeTrialBalance(db)
+	assert.NoError(t, err)
+	assert.True(t, report.Balanced)
+}
+
+func TestBonusService_GeneratePromoCodes(t *testing.T) {
+	db := database.NewInMemoryDB()
+	bonusService := NewBonusService(db, BonusLimits{}, nil, nil)
+	template := &models.PromoCode{Reward: models.NewMoney(500, "USD"), ExpiresInDays: 30, MaxRedemptions: 1}
+
+	codes, err := bonusService.GeneratePromoCodes(template, 50, "spring")
+	assert.NoError(t, err)
+	assert.Len(t, codes, 50)
+	unique := make(map[string]bool)
+	for _, code := range codes {
+		assert.Regexp(t, `^SPRING-[A-Z2-9]{8}$`, code.Code)
+		assert.Equal(t, codes[0].BatchID, code.BatchID)
+		assert.Equal(t, 1, code.PerUserLimit)
+		unique[code.Code] = true
+	}
+	assert.Len(t, unique, 50)
+	batch, err := bonusService.GetPromoBatch(codes[0].BatchID)
+	assert.NoError(t, err)
+	assert.Len(t, batch, 50)
+
+	custom := *template
+	custom.Code, custom.MaxRedemptions, custom.PerUserLimit = "welcome2026", 100, 2
+	codes, err = bonusService.GeneratePromoCodes(&custom, 0, "")
+	assert.NoError(t, err)
+	if assert.Len(t, codes, 1) {
+		assert.Equal(t, "WELCOME2026", codes[0].Code)
+	}
+	_, err = bonusService.GeneratePromoCodes(&custom, 0, "")
+	assert.ErrorIs(t, err, database.ErrAlreadyExists)
+
+	for name, modify := range map[string]func(c *models.PromoCode){
+		"no reward":          func(c *models.PromoCode) { c.Reward = models.Money{} },
+		"no expiry":          func(c *models.PromoCode) { c.ExpiresInDays = 0 },
+		"user limit too big": func(c *models.PromoCode) { c.PerUserLimit = 2 },
+		"empty window": func(c *models.PromoCode) {
+			at := time.Now()
+			c.StartsAt, c.EndsAt = &at, &at
+		},
+	} {
+		invalid := *template
+		modify(&invalid)
+		_, err := bonusService.GeneratePromoCodes(&invalid, 1, "")
+		assert.ErrorIs(t, err, ErrInvalidPromo, name)
+	}
+	_, err = bonusService.GeneratePromoCodes(template, maxPromoBatch+1, "")
+	assert.ErrorIs(t, err, ErrInvalidPromo)
+}
+
+func TestBonusService_RedeemPromoCode(t *testing.T) {
+	db := database.NewInMemoryDB()
+	bonusService := NewBonusService(db, BonusLimits{}, nil, nil)
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-2", Email: "second@example.com", CreatedAt: time.Now()}))
+	later := time.Now().Add(time.Hour)
+	codes, err := bonusService.GeneratePromoCodes(&models.PromoCode{
+		Code: "TWICE", Reward: models.NewMoney(700, "USD"), ExpiresInDays: 14, MaxRedemptions: 3, PerUserLimit: 2,
+	}, 1, "")
+	assert.NoError(t, err)
+	_, err = bonusService.GeneratePromoCodes(&models.PromoCode{
+		Code: "LATER", Reward: models.NewMoney(700, "USD"), ExpiresInDays: 14, MaxRedemptions: 1, StartsAt: &later,
+	}, 1, "")
+	assert.NoError(t, err)
+
+	bonus, err := bonusService.RedeemPromoCode("user-1", " twice ")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(700, "USD"), bonus.Amount)
+	assert.Equal(t, models.SourcePromo, bonus.Source)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 14), bonus.ExpiresAt, time.Minute)
+
+	_, err = bonusService.RedeemPromoCode("user-1", "TWICE")
+	assert.NoError(t, err)
+	_, err = bonusService.RedeemPromoCode("user-1", "TWICE")
+	assert.ErrorIs(t, err, ErrPromoUserLimit)
+	_, err = bonusService.RedeemPromoCode("user-2", "TWICE")
+	assert.NoError(t, err)
+	_, err = bonusService.RedeemPromoCode("user-2", "TWICE")
+	assert.ErrorIs(t, err, ErrPromoExhausted)
+
+	_, err = bonusService.RedeemPromoCode("user-1", "LATER")
+	assert.ErrorIs(t, err, ErrPromoNotActive)
+	_, err = bonusService.RedeemPromoCode("user-1", "MISSING")
+	assert.ErrorIs(t, err, ErrUnknownPromoCode)
+	erasedAt := time.Now()
+	assert.NoError(t, db.CreateUser(&models.User{ID: "user-erased", Email: "erased@example.com", CreatedAt: erasedAt, ErasedAt: &erasedAt}))
+	_, err = bonusService.RedeemPromoCode("user-erased", "TWICE")
+	assert.ErrorIs(t, err, ErrUserErased)
+
+	code, _ := db.GetPromoCode(codes[0].Code)
+	assert.Equal(t, 3, code.Redemptions)
+	redemptions, _ := db.GetPromoRedemptions(codes[0].Code)
+	assert.Len(t, redemptions, 3)
+}
+
+func TestBonusService_RedeemPromoCodeConcurrently(t *testing.T) {
+	db := database.NewInMemoryDB()
+	bonusService := NewBonusService(db, BonusLimits{}, nil, nil)
+	_, err := bonusService.GeneratePromoCodes(&models.PromoCode{
+		Code: "ONCE", Reward: models.NewMoney(1000, "USD"), ExpiresInDays: 7, MaxRedemptions: 1,
+	}, 1, "")
+	assert.NoError(t, err)
+
+	// Одноразовый код гасится ровно один раз, сколько бы запросов ни пришло одновременно
+	const attempts = 20
+	results := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		userID := fmt.Sprintf("promo-user-%d", i)
+		assert.NoError(t, db.CreateUser(&models.User{ID: userID, Email: userID + "@example.com", CreatedAt: time.Now()}))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := bonusService.RedeemPromoCode(userID, "ONCE")
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.True(t, errors.Is(err, ErrPromoExhausted) || errors.Is(err, database.ErrConflict), err)
+	}
+	assert.Equal(t, 1, succeeded)
+	code, _ := db.GetPromoCode("ONCE")
+	assert.Equal(t, 1, code.Redemptions)
+	redemptions, _ := db.GetPromoRedemptions("ONCE")
+	assert.Len(t, redemptions, 1)
+}
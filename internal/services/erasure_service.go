@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// DefaultRetentionYears сколько лет после удаления пользователя хранятся его финансовые записи
+const DefaultRetentionYears = 5
+
+// erasedName имя, которое остаётся у обезличенного пользователя
+const erasedName = "Erased user"
+
+// ErasureService удаление пользователя: счета закрываются, бонусы гасятся, персональные данные
+// обезличиваются. Сами записи пользователя, счета, операции, проводки и бонусы остаются:
+// финансовая история хранится установленный законом срок
+type ErasureService struct {
+	db     database.Database
+	events *events.Bus
+	// retentionYears срок хранения финансовых записей, который указывается в сертификате
+	retentionYears int
+}
+
+func NewErasureService(db database.Database, bus *events.Bus, retentionYears int) *ErasureService {
+	if retentionYears <= 0 {
+		retentionYears = DefaultRetentionYears
+	}
+	return &ErasureService{db: db, events: bus, retentionYears: retentionYears}
+}
+
+// EraseUser удаляет пользователя по запросу requestedBy и выдаёт сертификат удаления. Пока на каком-то
+// из счетов остаток не нулевой, ничего не меняется: деньги нужно сначала вывести (ErrBalanceNotZero).
+// Всё делается в одной транзакции, поэтому операция по счёту, начатая параллельно, либо успевает
+// до закрытия, либо получает ErrAccountClosed
+func (s *ErasureService) EraseUser(userID, requestedBy string) (*models.ErasureCertificate, error) {
+	// Время в сертификате с точностью до секунды: так его дайджест не зависит от хранилища
+	now := time.Now().UTC().Truncate(time.Second)
+	var certificate *models.ErasureCertificate
+	err := s.db.RunInTx(func(tx database.Tx) error {
+		user, err := tx.GetUser(userID)
+		if err != nil {
+			return err
+		}
+		if user.Erased() {
+			return ErrUserErased
+		}
+		certificate = &models.ErasureCertificate{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			RequestedBy: requestedBy,
+			ErasedAt:    now,
+			RetainUntil: now.AddDate(s.retentionYears, 0, 0),
+		}
+		if certificate.ClosedAccounts, err = closeAccounts(tx, userID, now); err != nil {
+			return err
+		}
+		if certificate.ExpiredBonuses, err = expireBonuses(tx, userID); err != nil {
+			return err
+		}
+		if certificate.ErasedFields, err = pseudonymize(tx, user, now); err != nil {
+			return err
+		}
+		certificate.Digest = certificate.ComputeDigest()
+		return tx.CreateErasureCertificate(certificate)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.events.Publish(events.UserErased{Certificate: *certificate})
+	return certificate, nil
+}
+
+// GetCertificate сертификат удаления пользователя
+func (s *ErasureService) GetCertificate(userID string) (*models.ErasureCertificate, error) {
+	return s.db.GetErasureCertificate(userID)
+}
+
+// closeAccounts закрывает счета пользователя и возвращает их ID. Счета блокируются до чтения остатков,
+// иначе параллельное пополнение успеет пройти между проверкой и закрытием
+func closeAccounts(tx database.Tx, userID string, now time.Time) ([]string, error) {
+	accounts, err := tx.GetAccountsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(accounts))
+	for i, account := range accounts {
+		ids[i] = account.ID
+	}
+	if err := tx.LockAccounts(ids...); err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	closed := []string{}
+	for _, id := range ids {
+		account, err := tx.GetAccount(id)
+		if err != nil {
+			return nil, err
+		}
+		if !account.Balance.IsZero() {
+			return nil, fmt.Errorf("%w: account %s has %s", ErrBalanceNotZero, account.ID, account.Balance)
+		}
+		if account.Closed() {
+			continue
+		}
+		account.Status, account.ClosedAt, account.UpdatedAt = models.AccountClosed, &now, now
+		if err := tx.UpdateAccount(account); err != nil {
+			return nil, err
+		}
+		closed = append(closed, account.ID)
+	}
+	return closed, nil
+}
+
+// expireBonuses гасит активные бонусы пользователя и возвращает их ID; сами бонусы остаются в истории
+func expireBonuses(tx database.Tx, userID string) ([]string, error) {
+	bonuses, err := tx.GetBonusesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(bonuses, func(i, j int) bool { return bonuses[i].ID < bonuses[j].ID })
+	expired := []string{}
+	for _, bonus := range bonuses {
+		if bonus.Status != "active" {
+			continue
+		}
+		bonus.Status = "expired"
+		if err := tx.UpdateBonus(bonus); err != nil {
+			return nil, err
+		}
+		expired = append(expired, bonus.ID)
+	}
+	return expired, nil
+}
+
+// pseudonymize заменяет персональные данные пользователя и его устройств и возвращает обезличенные поля.
+// Email заменяется адресом из ID: он остаётся уникальным и освобождает прежний адрес для новой регистрации
+func pseudonymize(tx database.Tx, user *models.User, now time.Time) ([]string, error) {
+	fields := []string{"user.email", "user.name", "user.password_hash"}
+	user.Email = "erased-" + user.ID + "@erased.invalid"
+	user.Name = erasedName
+	user.PasswordHash = ""
+	user.ErasedAt = &now
+	if err := tx.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	code, err := tx.GetReferralCode(user.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && code.DeviceID != "" {
+		code.DeviceID = ""
+		if err := tx.UpdateReferralCode(code); err != nil {
+			return nil, err
+		}
+		fields = append(fields, "referral_code.device_id")
+	}
+
+	referral, err := tx.GetReferral(user.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && referral.DeviceID != "" {
+		referral.DeviceID = ""
+		if err := tx.UpdateReferral(referral); err != nil {
+			return nil, err
+		}
+		fields = append(fields, "referral.device_id")
+	}
+	return fields, nil
+}
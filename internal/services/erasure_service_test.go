@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErasureService_EraseUser(t *testing.T) {
+	db := database.NewInMemoryDB()
+	bus := events.NewBus()
+	var published []events.UserErased
+	events.Subscribe(bus, func(event events.UserErased) error {
+		published = append(published, event)
+		return nil
+	})
+	service := NewErasureService(db, bus, 7)
+	transactions := NewTransactionService(db, nil)
+	accounts := NewAccountService(db)
+	assert.NoError(t, db.CreateReferralCode(&models.ReferralCode{UserID: "user-1", Code: "ERASE234", DeviceID: "phone-1"}))
+	spare, err := accounts.CreateAccount("user-1", "EUR")
+	assert.NoError(t, err)
+
+	// Пока на счёте есть деньги, ничего не меняется
+	_, err = service.EraseUser("user-1", "admin-1")
+	assert.ErrorIs(t, err, ErrBalanceNotZero)
+	account, _ := db.GetAccount("account-1")
+	assert.False(t, account.Closed())
+	user, _ := db.GetUser("user-1")
+	assert.False(t, user.Erased())
+
+	withdrawal, err := transactions.CreateWithdrawal("account-1", models.NewMoney(100000, "USD"), "payout")
+	assert.NoError(t, err)
+
+	certificate, err := service.EraseUser("user-1", "admin-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", certificate.UserID)
+	assert.Equal(t, "admin-1", certificate.RequestedBy)
+	assert.ElementsMatch(t, []string{"account-1", spare.ID}, certificate.ClosedAccounts)
+	assert.Equal(t, []string{"bonus-1"}, certificate.ExpiredBonuses)
+	assert.Equal(t, []string{"user.email", "user.name", "user.password_hash", "referral_code.device_id"}, certificate.ErasedFields)
+	assert.Equal(t, certificate.ErasedAt.AddDate(7, 0, 0), certificate.RetainUntil)
+	assert.True(t, certificate.Verify())
+	if assert.Len(t, published, 1) {
+		assert.Equal(t, *certificate, published[0].Certificate)
+	}
+
+	// Персональные данные обезличены, прежний email свободен
+	user, _ = db.GetUser("user-1")
+	assert.True(t, user.Erased())
+	assert.Equal(t, "erased-user-1@erased.invalid", user.Email)
+	assert.Equal(t, erasedName, user.Name)
+	assert.Empty(t, user.PasswordHash)
+	_, err = db.GetUserByEmail("test@example.com")
+	assert.ErrorIs(t, err, database.ErrNotFound)
+	code, _ := db.GetReferralCode("user-1")
+	assert.Empty(t, code.DeviceID)
+
+	// Финансовые записи остаются, но операции по закрытым счетам запрещены
+	account, _ = db.GetAccount("account-1")
+	assert.True(t, account.Closed())
+	assert.NotNil(t, account.ClosedAt)
+	stored, err := db.GetTransaction(withdrawal.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", stored.Status)
+	bonus, _ := db.GetBonus("bonus-1")
+	assert.Equal(t, "expired", bonus.Status)
+	_, err = transactions.CreateDeposit("account-1", models.NewMoney(100, "USD"), "late")
+	assert.ErrorIs(t, err, ErrAccountClosed)
+	_, err = transactions.ReverseTransaction(withdrawal.ID, "")
+	assert.ErrorIs(t, err, ErrAccountClosed)
+	assert.ErrorIs(t, accounts.DeleteAccount(spare.ID), ErrAccountClosed)
+	_, err = accounts.CreateAccount("user-1", "USD")
+	assert.ErrorIs(t, err, ErrUserErased)
+
+	// Сертификат выдаётся один раз и хранится
+	_, err = service.EraseUser("user-1", "admin-1")
+	assert.ErrorIs(t, err, ErrUserErased)
+	saved, err := service.GetCertificate("user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, certificate, saved)
+}
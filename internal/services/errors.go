@@ -0,0 +1,38 @@
+package services
+
+import "errors"
+
+// Ошибки бизнес-правил. API сопоставляет их с HTTP-статусами и кодами ошибок
+var (
+	ErrNonPositiveAmount    = errors.New("amount must be positive")
+	ErrInsufficientFunds    = errors.New("insufficient funds")
+	ErrUnsupportedCurrency  = errors.New("unsupported currency")
+	ErrAccountNotEmpty      = errors.New("cannot delete account with positive balance")
+	ErrUnsupportedBonusType = errors.New("unsupported transaction type for bonus")
+	ErrBonusNotActive       = errors.New("bonus is not active")
+	ErrBonusExpired         = errors.New("bonus has expired")
+	ErrBonusNotOwned        = errors.New("bonus can only be used on user's own account")
+	ErrBonusInsufficient    = errors.New("amount exceeds the remaining bonus")
+	ErrNoMatchingCampaign   = errors.New("no active campaign matches")
+	ErrWelcomeBonusGranted  = errors.New("welcome bonus has already been granted")
+	ErrInvalidReferralCode  = errors.New("unknown referral code")
+	ErrInvalidPromo         = errors.New("invalid promo code batch")
+	ErrUnknownPromoCode     = errors.New("unknown promo code")
+	ErrPromoNotActive       = errors.New("promo code is not active")
+	ErrPromoExhausted       = errors.New("promo code has no redemptions left")
+	ErrPromoUserLimit       = errors.New("promo code redemption limit reached for user")
+	ErrInsufficientPoints   = errors.New("insufficient loyalty points")
+	ErrInvalidHistoryQuery  = errors.New("invalid transaction history query")
+	ErrInvalidEmail         = errors.New("invalid email address")
+	ErrInvalidUser          = errors.New("invalid user")
+	ErrUnknownUser          = errors.New("user does not exist")
+	ErrAccountClosed        = errors.New("account is closed")
+	// ErrBalanceNotZero у пользователя есть счёт с ненулевым остатком, удалить его нельзя
+	ErrBalanceNotZero = errors.New("user has accounts with non-zero balance")
+	// ErrUserErased персональные данные пользователя уже обезличены
+	ErrUserErased = errors.New("user has been erased")
+	// ErrTransactionNotReversible операция не проведена, уже сторнирована или сама является сторно
+	ErrTransactionNotReversible = errors.New("transaction cannot be reversed")
+	// ErrInvalidTransaction операция не имеет смысла, например перевод со счёта на него же
+	ErrInvalidTransaction = errors.New("invalid transaction")
+)
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/ledger"
+	"petProjectMike/internal/models"
+)
+
+type LedgerService struct {
+	db database.Database
+}
+
+func NewLedgerService(db database.Database) *LedgerService {
+	return &LedgerService{db: db}
+}
+
+// TrialBalance проверяет, что книга сходится
+func (s *LedgerService) TrialBalance() (*ledger.TrialBalance, error) {
+	return ledger.ComputeTrialBalance(s.db)
+}
+
+// GetAccountLedger проводки счёта и остаток, пересчитанный по ним, рядом с сохранённым
+func (s *LedgerService) GetAccountLedger(accountID string) (map[string]interface{}, error) {
+	account, err := s.db.GetAccount(accountID)
+	if err != nil {
+		return nil, err
+	}
+	postings, err := s.db.GetPostingsByAccount(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if postings == nil {
+		postings = []*models.Posting{}
+	}
+	derived, err := ledger.Balance(s.db, accountID, account.Currency)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"account_id":     account.ID,
+		"balance":        derived,
+		"stored_balance": account.Balance,
+		"postings":       postings,
+		"total_postings": len(postings),
+	}, nil
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/loyalty"
+	"petProjectMike/internal/models"
+)
+
+// LoyaltyService ведёт баллы лояльности: начисляет их за операции, возвращает при сторно и показывает
+// баланс с уровнем. Множители уровней и обмен баллов на бонусы — в BonusService
+type LoyaltyService struct {
+	db      database.Database
+	program *loyalty.Program
+}
+
+func NewLoyaltyService(db database.Database, program *loyalty.Program) *LoyaltyService {
+	return &LoyaltyService{db: db, program: program}
+}
+
+// ParseLoyaltyProgram собирает программу из сумм, за которые даётся балл ("USD:1.00,RUB:100.00"),
+// и стоимости пачки из loyalty.ConversionStep баллов по валютам бонуса ("USD:1.00")
+func ParseLoyaltyProgram(earnUnits, stepValues string) (*loyalty.Program, error) {
+	earn, err := parseAmounts("loyalty earn unit", earnUnits)
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseAmounts("loyalty points value", stepValues)
+	if err != nil {
+		return nil, err
+	}
+	return loyalty.New(earn, value), nil
+}
+
+// ID движений баллов по операции выводятся из её ID: повторная доставка события ничего не добавит
+func earnEntryID(transactionID string) string     { return transactionID + ":" + models.PointsEarn }
+func clawbackEntryID(transactionID string) string { return transactionID + ":" + models.PointsClawback }
+
+// EarnPoints начисляет баллы за проведённую операцию тому же, кто получает за неё бонус:
+// за перевод — отправителю, за пополнение — получателю; за переводы между своими счетами баллов нет
+func (s *LoyaltyService) EarnPoints(transaction *models.Transaction) (*models.PointsEntry, error) {
+	points := s.program.Points(transaction.Amount)
+	if rewardedAccount(transaction) == "" || points == 0 {
+		return nil, nil
+	}
+	var entry *models.PointsEntry
+	err := s.retry(func(tx database.Tx) error {
+		entry = nil
+		if _, err := tx.GetPointsEntry(earnEntryID(transaction.ID)); !errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		userID, err := rewardedUser(tx, transaction)
+		if err != nil || userID == "" {
+			return err
+		}
+		entry = &models.PointsEntry{
+			ID: earnEntryID(transaction.ID), UserID: userID, Kind: models.PointsEarn, Points: points,
+			TransactionID: transaction.ID, CreatedAt: transaction.UpdatedAt,
+		}
+		return addPoints(tx, entry)
+	})
+	if errors.Is(err, database.ErrAlreadyExists) {
+		// Параллельная доставка того же события успела начислить баллы первой
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ClawBackPoints списывает баллы, начисленные за сторнированную операцию, даже если баланс уйдёт в минус
+func (s *LoyaltyService) ClawBackPoints(transactionID string) (*models.PointsEntry, error) {
+	var entry *models.PointsEntry
+	err := s.retry(func(tx database.Tx) error {
+		entry = nil
+		earned, err := tx.GetPointsEntry(earnEntryID(transactionID))
+		if errors.Is(err, database.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.GetPointsEntry(clawbackEntryID(transactionID)); !errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		entry = &models.PointsEntry{
+			ID: clawbackEntryID(transactionID), UserID: earned.UserID, Kind: models.PointsClawback, Points: -earned.Points,
+			TransactionID: transactionID, CreatedAt: time.Now(),
+		}
+		return addPoints(tx, entry)
+	})
+	if errors.Is(err, database.ErrAlreadyExists) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// retry выполняет транзакцию, повторяя её при конфликте версий баланса
+func (s *LoyaltyService) retry(fn func(tx database.Tx) error) error {
+	var err error
+	for attempt := 0; attempt < awardAttempts; attempt++ {
+		if err = s.db.RunInTx(fn); !errors.Is(err, database.ErrConflict) {
+			break
+		}
+	}
+	return err
+}
+
+// addPoints записывает движение и меняет на него баланс; баланс заводится при первом движении
+func addPoints(tx database.Tx, entry *models.PointsEntry) error {
+	account, err := tx.GetLoyaltyAccount(entry.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		account = &models.LoyaltyAccount{UserID: entry.UserID, Points: entry.Points, UpdatedAt: entry.CreatedAt}
+		err = tx.CreateLoyaltyAccount(account)
+	} else if err == nil {
+		account.Points += entry.Points
+		account.UpdatedAt = entry.CreatedAt
+		err = tx.UpdateLoyaltyAccount(account)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.CreatePointsEntry(entry)
+}
+
+// Subscribe подписывает баллы на события операций: начисление за проведённые и возврат при сторно
+func (s *LoyaltyService) Subscribe(bus *events.Bus) {
+	events.Subscribe(bus, func(event events.TransactionCompleted) error {
+		_, err := s.EarnPoints(&event.Transaction)
+		return err
+	})
+	events.Subscribe(bus, func(event events.TransactionReversed) error {
+		_, err := s.ClawBackPoints(event.Transaction.ID)
+		return err
+	})
+}
+
+// LoyaltyStatus баланс баллов и уровень пользователя
+type LoyaltyStatus struct {
+	UserID string `json:"user_id"`
+	Points int64  `json:"points"`
+	// Activity баллы за операции за последние loyalty.ActivityMonths месяцев, по которым считается уровень
+	Activity     int64  `json:"activity"`
+	Tier         string `json:"tier"`
+	MultiplierBP int64  `json:"multiplier_bp"`
+	// NextTier и PointsToNextTier пустые на высшем уровне
+	NextTier         string `json:"next_tier,omitempty"`
+	PointsToNextTier int64  `json:"points_to_next_tier,omitempty"`
+}
+
+// Status баланс баллов и уровень пользователя на текущий момент
+func (s *LoyaltyService) Status(userID string) (*LoyaltyStatus, error) {
+	if _, err := s.db.GetUser(userID); err != nil {
+		return nil, err
+	}
+	status := &LoyaltyStatus{UserID: userID}
+	account, err := s.db.GetLoyaltyAccount(userID)
+	switch {
+	case err == nil:
+		status.Points = account.Points
+	case !errors.Is(err, database.ErrNotFound):
+		return nil, err
+	}
+	entries, err := s.db.GetPointsEntriesByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	status.Activity = loyalty.Activity(entries, time.Now(), "")
+	tier := s.program.TierFor(status.Activity)
+	status.Tier, status.MultiplierBP = tier.Name, tier.MultiplierBP
+	if next, ok := s.program.Next(tier); ok {
+		status.NextTier, status.PointsToNextTier = next.Name, next.MinPoints-status.Activity
+	}
+	return status, nil
+}
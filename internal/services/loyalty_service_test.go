@@ -0,0 +1,149 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"petProjectMike/internal/campaigns"
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/loyalty"
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type loyaltyFixture struct {
+	db           *database.InMemoryDB
+	bonuses      *BonusService
+	loyalty      *LoyaltyService
+	transactions *TransactionService
+}
+
+func newLoyaltyFixture(t *testing.T) *loyaltyFixture {
+	db := database.NewInMemoryDB()
+	program, err := ParseLoyaltyProgram("USD:1.00", "USD:1.00")
+	assert.NoError(t, err)
+	bonuses := NewBonusService(db, BonusLimits{}, nil, program)
+	assert.NoError(t, bonuses.SeedCampaigns(campaigns.Defaults(), false))
+	bus := events.NewBus()
+	bonuses.Subscribe(bus)
+	service := NewLoyaltyService(db, program)
+	service.Subscribe(bus)
+	return &loyaltyFixture{db: db, bonuses: bonuses, loyalty: service, transactions: NewTransactionService(db, bus)}
+}
+
+func TestLoyaltyService_EarnAndClawBack(t *testing.T) {
+	f := newLoyaltyFixture(t)
+
+	deposit, err := f.transactions.CreateDeposit("account-1", models.NewMoney(25050, "USD"), "salary")
+	assert.NoError(t, err)
+	status, err := f.loyalty.Status("user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(250), status.Points)
+	assert.Equal(t, int64(250), status.Activity)
+	assert.Equal(t, loyalty.TierBronze, status.Tier)
+	assert.Equal(t, loyalty.TierSilver, status.NextTier)
+	assert.Equal(t, int64(750), status.PointsToNextTier)
+
+	// Повторная доставка события баллов не добавляет
+	_, err = f.loyalty.EarnPoints(deposit)
+	assert.NoError(t, err)
+	_, err = f.transactions.CreateWithdrawal("account-1", models.NewMoney(1000, "USD"), "atm")
+	assert.NoError(t, err)
+	status, _ = f.loyalty.Status("user-1")
+	assert.Equal(t, int64(250), status.Points)
+
+	// Сторно возвращает баллы и снижает активность
+	_, err = f.transactions.ReverseTransaction(deposit.ID, "chargeback")
+	assert.NoError(t, err)
+	_, err = f.loyalty.ClawBackPoints(deposit.ID)
+	assert.NoError(t, err)
+	status, _ = f.loyalty.Status("user-1")
+	assert.Equal(t, int64(0), status.Points)
+	assert.Equal(t, int64(0), status.Activity)
+}
+
+func TestLoyaltyService_NoPointsForTransfersBetweenOwnAccounts(t *testing.T) {
+	f := newLoyaltyFixture(t)
+	assert.NoError(t, f.db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	assert.NoError(t, f.db.CreateUser(&models.User{ID: "user-2", Email: "two@example.com"}))
+	assert.NoError(t, f.db.CreateAccount(&models.Account{ID: "account-3", UserID: "user-2", Balance: models.Zero("USD"), Currency: "USD"}))
+
+	for i := 0; i < 3; i++ {
+		_, err := f.transactions.CreateTransfer("account-1", "account-2", models.NewMoney(50000, "USD"), "shuffle")
+		assert.NoError(t, err)
+		_, err = f.transactions.CreateTransfer("account-2", "account-1", models.NewMoney(50000, "USD"), "shuffle back")
+		assert.NoError(t, err)
+	}
+	status, err := f.loyalty.Status("user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), status.Points)
+	assert.Equal(t, loyalty.TierBronze, status.Tier)
+
+	// Перевод другому пользователю баллы приносит
+	_, err = f.transactions.CreateTransfer("account-1", "account-3", models.NewMoney(2000, "USD"), "gift")
+	assert.NoError(t, err)
+	status, _ = f.loyalty.Status("user-1")
+	assert.Equal(t, int64(20), status.Points)
+}
+
+func TestLoyaltyService_TierMultipliesTransactionBonuses(t *testing.T) {
+	f := newLoyaltyFixture(t)
+
+	// Бонус за операцию, которая поднимает уровень, считается по уровню до неё
+	first, err := f.transactions.CreateDeposit("account-1", models.NewMoney(500000, "USD"), "salary")
+	assert.NoError(t, err)
+	bonuses, _ := f.db.GetBonusesByTransaction(first.ID)
+	if assert.Len(t, bonuses, 1) {
+		assert.Equal(t, models.NewMoney(2500, "USD"), bonuses[0].Amount)
+	}
+
+	status, _ := f.loyalty.Status("user-1")
+	assert.Equal(t, loyalty.TierGold, status.Tier)
+	assert.Equal(t, int64(15000), status.MultiplierBP)
+	assert.Empty(t, status.NextTier)
+
+	second, err := f.transactions.CreateDeposit("account-1", models.NewMoney(20000, "USD"), "salary")
+	assert.NoError(t, err)
+	bonuses, _ = f.db.GetBonusesByTransaction(second.ID)
+	if assert.Len(t, bonuses, 1) {
+		assert.Equal(t, models.NewMoney(150, "USD"), bonuses[0].Amount)
+	}
+	awarded, err := f.bonuses.CreateTransactionBonus("user-1", models.NewMoney(10000, "USD"), models.TriggerTransfer)
+	assert.NoError(t, err)
+	if assert.Len(t, awarded, 1) {
+		assert.Equal(t, models.NewMoney(150, "USD"), awarded[0].Amount)
+	}
+}
+
+func TestBonusService_ConvertPoints(t *testing.T) {
+	f := newLoyaltyFixture(t)
+	_, err := f.bonuses.ConvertPoints("user-1", 100, "USD")
+	assert.ErrorIs(t, err, ErrInsufficientPoints)
+
+	_, err = f.transactions.CreateDeposit("account-1", models.NewMoney(35000, "USD"), "salary")
+	assert.NoError(t, err)
+
+	bonus, err := f.bonuses.ConvertPoints("user-1", 300, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(300, "USD"), bonus.Amount)
+	assert.Equal(t, models.SourcePoints, bonus.Source)
+
+	_, err = f.bonuses.ConvertPoints("user-1", 100, "USD")
+	assert.ErrorIs(t, err, ErrInsufficientPoints)
+	_, err = f.bonuses.ConvertPoints("user-1", 50, "USD")
+	assert.ErrorIs(t, err, loyalty.ErrInvalidPoints)
+	_, err = f.bonuses.ConvertPoints("user-1", 100, "EUR")
+	assert.ErrorIs(t, err, loyalty.ErrNotConvertible)
+
+	// Обмен тратит баллы, но не снижает уровень
+	status, _ := f.loyalty.Status("user-1")
+	assert.Equal(t, int64(50), status.Points)
+	assert.Equal(t, int64(350), status.Activity)
+
+	erasedAt := time.Now()
+	assert.NoError(t, f.db.CreateUser(&models.User{ID: "user-erased", Email: "erased@example.com", CreatedAt: erasedAt, ErasedAt: &erasedAt}))
+	_, err = f.bonuses.ConvertPoints("user-erased", 100, "USD")
+	assert.ErrorIs(t, err, ErrUserErased)
+}
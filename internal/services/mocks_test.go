@@ -1,6 +1,9 @@
 package services
 
 import (
+	"time"
+
+	"petProjectMike/internal/database"
 	"petProjectMike/internal/models"
 
 	"github.com/stretchr/testify/mock"
@@ -13,6 +16,12 @@ type MockDatabase struct {
 	mock.Mock
 }
 
+// RunInTx выполняет fn поверх самого мока: атомарность здесь не проверяется,
+// ожидания на вызовы внутри транзакции задаются как обычно
+func (m *MockDatabase) RunInTx(fn func(tx database.Tx) error) error {
+	return fn(m)
+}
+
 // Account operations
 func (m *MockDatabase) CreateAccount(account *models.Account) error {
 	args := m.Called(account)
@@ -67,6 +76,14 @@ func (m *MockDatabase) GetTransactionsByAccount(accountID string) ([]*models.Tra
 	return args.Get(0).([]*models.Transaction), args.Error(1)
 }
 
+func (m *MockDatabase) QueryTransactions(query database.TransactionQuery) ([]*models.Transaction, error) {
+	args := m.Called(query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Transaction), args.Error(1)
+}
+
 func (m *MockDatabase) UpdateTransaction(transaction *models.Transaction) error {
 	args := m.Called(transaction)
 	return args.Error(0)
@@ -99,6 +116,22 @@ func (m *MockDatabase) GetBonusesByUserID(userID string) ([]*models.Bonus, error
 	return args.Get(0).([]*models.Bonus), args.Error(1)
 }
 
+func (m *MockDatabase) GetBonusesByTransaction(transactionID string) ([]*models.Bonus, error) {
+	args := m.Called(transactionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Bonus), args.Error(1)
+}
+
+func (m *MockDatabase) GetExpiredBonuses(now time.Time) ([]*models.Bonus, error) {
+	args := m.Called(now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Bonus), args.Error(1)
+}
+
 func (m *MockDatabase) UpdateBonus(bonus *models.Bonus) error {
 	args := m.Called(bonus)
 	return args.Error(0)
@@ -109,6 +142,167 @@ func (m *MockDatabase) DeleteBonus(id string) error {
 	return args.Error(0)
 }
 
+// Bonus redemption operations
+func (m *MockDatabase) CreateBonusRedemption(redemption *models.BonusRedemption) error {
+	args := m.Called(redemption)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetBonusRedemptions(bonusID string) ([]*models.BonusRedemption, error) {
+	args := m.Called(bonusID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.BonusRedemption), args.Error(1)
+}
+
+// Referral operations
+func (m *MockDatabase) CreateReferralCode(code *models.ReferralCode) error {
+	args := m.Called(code)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetReferralCode(userID string) (*models.ReferralCode, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ReferralCode), args.Error(1)
+}
+
+func (m *MockDatabase) GetReferralCodeByCode(code string) (*models.ReferralCode, error) {
+	args := m.Called(code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ReferralCode), args.Error(1)
+}
+
+func (m *MockDatabase) UpdateReferralCode(code *models.ReferralCode) error {
+	args := m.Called(code)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) CreateReferral(referral *models.Referral) error {
+	args := m.Called(referral)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetReferral(refereeID string) (*models.Referral, error) {
+	args := m.Called(refereeID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Referral), args.Error(1)
+}
+
+func (m *MockDatabase) GetReferralsByReferrer(referrerID string) ([]*models.Referral, error) {
+	args := m.Called(referrerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Referral), args.Error(1)
+}
+
+func (m *MockDatabase) UpdateReferral(referral *models.Referral) error {
+	args := m.Called(referral)
+	return args.Error(0)
+}
+
+// Promo code operations
+func (m *MockDatabase) CreatePromoCode(code *models.PromoCode) error {
+	args := m.Called(code)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetPromoCode(code string) (*models.PromoCode, error) {
+	args := m.Called(code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PromoCode), args.Error(1)
+}
+
+func (m *MockDatabase) GetPromoCodesByBatch(batchID string) ([]*models.PromoCode, error) {
+	args := m.Called(batchID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PromoCode), args.Error(1)
+}
+
+func (m *MockDatabase) UpdatePromoCode(code *models.PromoCode) error {
+	args := m.Called(code)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) CreatePromoRedemption(redemption *models.PromoRedemption) error {
+	args := m.Called(redemption)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetPromoRedemptions(code string) ([]*models.PromoRedemption, error) {
+	args := m.Called(code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PromoRedemption), args.Error(1)
+}
+
+// Loyalty operations
+func (m *MockDatabase) CreateLoyaltyAccount(account *models.LoyaltyAccount) error {
+	args := m.Called(account)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetLoyaltyAccount(userID string) (*models.LoyaltyAccount, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LoyaltyAccount), args.Error(1)
+}
+
+func (m *MockDatabase) UpdateLoyaltyAccount(account *models.LoyaltyAccount) error {
+	args := m.Called(account)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) CreatePointsEntry(entry *models.PointsEntry) error {
+	args := m.Called(entry)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetPointsEntry(id string) (*models.PointsEntry, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PointsEntry), args.Error(1)
+}
+
+func (m *MockDatabase) GetPointsEntriesByUser(userID string) ([]*models.PointsEntry, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PointsEntry), args.Error(1)
+}
+
+// Erasure operations
+func (m *MockDatabase) CreateErasureCertificate(certificate *models.ErasureCertificate) error {
+	args := m.Called(certificate)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetErasureCertificate(userID string) (*models.ErasureCertificate, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ErasureCertificate), args.Error(1)
+}
+
 // User operations
 func (m *MockDatabase) CreateUser(user *models.User) error {
 	args := m.Called(user)
@@ -140,3 +334,70 @@ func (m *MockDatabase) DeleteUser(id string) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
+
+// Ledger operations
+func (m *MockDatabase) CreateLedgerEntry(entry *models.LedgerEntry) error {
+	args := m.Called(entry)
+	return args.Error(0)
+}
+
+// Campaign operations
+func (m *MockDatabase) CreateCampaign(campaign *models.Campaign) error {
+	args := m.Called(campaign)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetCampaign(id string) (*models.Campaign, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Campaign), args.Error(1)
+}
+
+func (m *MockDatabase) ListCampaigns() ([]*models.Campaign, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Campaign), args.Error(1)
+}
+
+func (m *MockDatabase) UpdateCampaign(campaign *models.Campaign) error {
+	args := m.Called(campaign)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) DeleteCampaign(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetLedgerEntry(id string) (*models.LedgerEntry, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LedgerEntry), args.Error(1)
+}
+
+func (m *MockDatabase) GetPostingsByAccount(accountID string) ([]*models.Posting, error) {
+	args := m.Called(accountID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Posting), args.Error(1)
+}
+
+func (m *MockDatabase) GetAllPostings() ([]*models.Posting, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Posting), args.Error(1)
+}
+
+// LockAccounts в моке ничего не блокирует: конкурентность проверяется на настоящих хранилищах
+func (m *MockDatabase) LockAccounts(ids ...string) error {
+	return nil
+}
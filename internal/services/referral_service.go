@@ -0,0 +1,310 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/models"
+)
+
+// Причины, по которым приглашение считается самоприглашением
+const (
+	rejectSameEmailDomain = "same_email_domain"
+	rejectSameDevice      = "same_device"
+)
+
+// publicEmailDomains домены почтовых сервисов: общий такой домен у двух пользователей
+// ничего не говорит о том, что это один человек
+var publicEmailDomains = map[string]bool{
+	"gmail.com": true, "googlemail.com": true, "yahoo.com": true, "outlook.com": true, "hotmail.com": true,
+	"live.com": true, "icloud.com": true, "proton.me": true, "protonmail.com": true,
+	"mail.ru": true, "yandex.ru": true, "ya.ru": true, "bk.ru": true, "list.ru": true, "inbox.ru": true,
+}
+
+// Коды без похожих символов (0/O, 1/I): их диктуют и переписывают вручную
+const (
+	codeAlphabet       = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	referralCodeLength = 8
+	// referralCodeAttempts сколько раз генерировать код, если выпал уже занятый
+	referralCodeAttempts = 5
+)
+
+type ReferralService struct {
+	db      database.Database
+	bonuses *BonusService
+	// minDeposit минимальное пополнение по валютам, которое подтверждает приглашение;
+	// пустой — подходит любое, иначе пополнение в валюте без минимума не подходит
+	minDeposit map[string]models.Money
+}
+
+func NewReferralService(db database.Database, bonuses *BonusService, minDeposit map[string]models.Money) *ReferralService {
+	return &ReferralService{db: db, bonuses: bonuses, minDeposit: minDeposit}
+}
+
+// ParseReferralMinDeposit разбирает минимальные пополнения вида "USD:20.00,EUR:20.00"; пустая строка — любое пополнение
+func ParseReferralMinDeposit(spec string) (map[string]models.Money, error) {
+	return parseAmounts("referral minimum deposit", spec)
+}
+
+// NormalizeReferralCode код в том виде, в каком он хранится: без пробелов и в верхнем регистре
+func NormalizeReferralCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Enroll выполняется в транзакции регистрации: выдаёт новому пользователю его код и, если он пришёл
+// по коду code, записывает приглашение. Неизвестный код отменяет регистрацию. Приглашение, похожее
+// на самоприглашение, сохраняется отклонённым, а регистрация проходит: ответ не подсказывает, какая проверка сработала
+func (s *ReferralService) Enroll(tx database.Tx, user *models.User, code, deviceID string) error {
+	if _, err := issueReferralCode(tx, user.ID, deviceID); err != nil {
+		return err
+	}
+	code = NormalizeReferralCode(code)
+	if code == "" {
+		return nil
+	}
+	owner, err := tx.GetReferralCodeByCode(code)
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrInvalidReferralCode
+	}
+	if err != nil {
+		return err
+	}
+	referral := &models.Referral{
+		RefereeID:  user.ID,
+		ReferrerID: owner.UserID,
+		Code:       code,
+		Status:     models.ReferralPending,
+		DeviceID:   deviceID,
+		CreatedAt:  user.CreatedAt,
+	}
+	reason, err := selfReferral(tx, owner, user, deviceID)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		referral.Status = models.ReferralRejected
+		referral.RejectReason = reason
+	}
+	return tx.CreateReferral(referral)
+}
+
+// selfReferral почему приглашение похоже на самоприглашение; пустая строка — не похоже.
+// Подозрительны общий корпоративный домен почты и устройство, с которого уже регистрировались
+// пригласивший или другие приглашённые им
+func selfReferral(tx database.Tx, owner *models.ReferralCode, referee *models.User, deviceID string) (string, error) {
+	referrer, err := tx.GetUser(owner.UserID)
+	if err != nil {
+		return "", err
+	}
+	if domain := emailDomain(referee.Email); domain != "" && !publicEmailDomains[domain] && domain == emailDomain(referrer.Email) {
+		return rejectSameEmailDomain, nil
+	}
+	if deviceID == "" {
+		return "", nil
+	}
+	if deviceID == owner.DeviceID {
+		return rejectSameDevice, nil
+	}
+	others, err := tx.GetReferralsByReferrer(owner.UserID)
+	if err != nil {
+		return "", err
+	}
+	for _, other := range others {
+		if other.DeviceID == deviceID {
+			return rejectSameDevice, nil
+		}
+	}
+	return "", nil
+}
+
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+// issueReferralCode выдаёт пользователю новый код, не совпадающий с уже выданными
+func issueReferralCode(tx database.Tx, userID, deviceID string) (*models.ReferralCode, error) {
+	for attempt := 0; attempt < referralCodeAttempts; attempt++ {
+		code, err := randomCode(referralCodeLength)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.GetReferralCodeByCode(code)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, database.ErrNotFound) {
+			return nil, err
+		}
+		issued := &models.ReferralCode{UserID: userID, Code: code, DeviceID: deviceID, CreatedAt: time.Now()}
+		if err := tx.CreateReferralCode(issued); err != nil {
+			return nil, err
+		}
+		return issued, nil
+	}
+	return nil, database.ErrConflict
+}
+
+// randomCode случайный код из length символов codeAlphabet
+func randomCode(length int) (string, error) {
+	size := big.NewInt(int64(len(codeAlphabet)))
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		code[i] = codeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// Code реферальный код пользователя. Зарегистрированным до появления программы он выдаётся при первом запросе
+func (s *ReferralService) Code(userID string) (*models.ReferralCode, error) {
+	code, err := s.db.GetReferralCode(userID)
+	if !errors.Is(err, database.ErrNotFound) {
+		return code, err
+	}
+	err = s.db.RunInTx(func(tx database.Tx) error {
+		if _, err := tx.GetUser(userID); err != nil {
+			return err
+		}
+		code, err = issueReferralCode(tx, userID, "")
+		return err
+	})
+	if errors.Is(err, database.ErrAlreadyExists) {
+		// Параллельный запрос успел выдать код первым
+		return s.db.GetReferralCode(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// qualifies подходит ли сумма пополнения для подтверждения приглашения
+func (s *ReferralService) qualifies(amount models.Money) bool {
+	if !amount.IsPositive() {
+		return false
+	}
+	if len(s.minDeposit) == 0 {
+		return true
+	}
+	minimum, ok := s.minDeposit[amount.Currency]
+	return ok && amount.Minor >= minimum.Minor
+}
+
+// QualifyDeposit подтверждает приглашение владельца счёта, на который пришло подходящее пополнение:
+// приглашение становится qualified, а оба участника получают бонусы по кампаниям. Подтверждается
+// только приглашение в статусе pending, поэтому повторная доставка события ничего не добавляет
+func (s *ReferralService) QualifyDeposit(transaction *models.Transaction) (*models.Referral, error) {
+	if transaction.Type != models.TriggerDeposit || !s.qualifies(transaction.Amount) {
+		return nil, nil
+	}
+	var referral *models.Referral
+	var err error
+	// Начисление меняет бюджеты кампаний, поэтому при конфликте версий подтверждение повторяется
+	for attempt := 0; attempt < awardAttempts; attempt++ {
+		referral = nil
+		err = s.db.RunInTx(func(tx database.Tx) error {
+			account, err := tx.GetAccount(transaction.ToAccount)
+			if err != nil {
+				return err
+			}
+			current, err := tx.GetReferral(account.UserID)
+			if errors.Is(err, database.ErrNotFound) {
+				return nil
+			}
+			if err != nil || current.Status != models.ReferralPending {
+				return err
+			}
+			if _, err := s.bonuses.awardReferral(tx, current, transaction); err != nil {
+				return err
+			}
+			qualifiedAt := transaction.UpdatedAt
+			current.Status = models.ReferralQualified
+			current.TransactionID = transaction.ID
+			current.QualifiedAt = &qualifiedAt
+			if err := tx.UpdateReferral(current); err != nil {
+				return err
+			}
+			referral = current
+			return nil
+		})
+		if !errors.Is(err, database.ErrConflict) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return referral, nil
+}
+
+// Subscribe подписывает приглашения на проведённые пополнения
+func (s *ReferralService) Subscribe(bus *events.Bus) {
+	events.Subscribe(bus, func(event events.TransactionCompleted) error {
+		_, err := s.QualifyDeposit(&event.Transaction)
+		return err
+	})
+}
+
+// ReferralStats итоги приглашений пользователя
+type ReferralStats struct {
+	UserID    string `json:"user_id"`
+	Code      string `json:"code"`
+	Invited   int    `json:"invited"`
+	Pending   int    `json:"pending"`
+	Qualified int    `json:"qualified"`
+	Rejected  int    `json:"rejected"`
+	// Earned бонусы, полученные за приглашения, по валютам; отозванные не считаются
+	Earned []models.Money `json:"earned"`
+}
+
+// Stats итоги приглашений пользователя вместе с его кодом
+func (s *ReferralService) Stats(userID string) (*ReferralStats, error) {
+	code, err := s.Code(userID)
+	if err != nil {
+		return nil, err
+	}
+	referrals, err := s.db.GetReferralsByReferrer(userID)
+	if err != nil {
+		return nil, err
+	}
+	stats := &ReferralStats{UserID: userID, Code: code.Code, Invited: len(referrals), Earned: []models.Money{}}
+	for _, referral := range referrals {
+		switch referral.Status {
+		case models.ReferralPending:
+			stats.Pending++
+		case models.ReferralQualified:
+			stats.Qualified++
+		case models.ReferralRejected:
+			stats.Rejected++
+		}
+	}
+
+	bonuses, err := s.db.GetBonusesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	earned := make(map[string]int64)
+	for _, bonus := range bonuses {
+		if bonus.Source == models.TriggerReferrer && bonus.Status != "revoked" {
+			earned[bonus.Amount.Currency] += bonus.Amount.Minor
+		}
+	}
+	for currency, minor := range earned {
+		stats.Earned = append(stats.Earned, models.NewMoney(minor, currency))
+	}
+	sort.Slice(stats.Earned, func(i, j int) bool { return stats.Earned[i].Currency < stats.Earned[j].Currency })
+	return stats, nil
+}
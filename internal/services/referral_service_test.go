@@ -0,0 +1,149 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"petProjectMike/internal/campaigns"
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type referralFixture struct {
+	db           *database.InMemoryDB
+	auth         *AuthService
+	referrals    *ReferralService
+	transactions *TransactionService
+}
+
+func newReferralFixture(t *testing.T, minDeposit map[string]models.Money) *referralFixture {
+	auth, db := newTestAuthService(t)
+	bonuses := NewBonusService(db, BonusLimits{}, nil, nil)
+	assert.NoError(t, bonuses.SeedCampaigns(campaigns.Defaults(), false))
+	bus := events.NewBus()
+	bonuses.Subscribe(bus)
+	referrals := NewReferralService(db, bonuses, minDeposit)
+	referrals.Subscribe(bus)
+	return &referralFixture{db: db, auth: auth, referrals: referrals, transactions: NewTransactionService(db, bus)}
+}
+
+// signup регистрирует пользователя так же, как это делает API, и возвращает выданный ему ID
+func (f *referralFixture) signup(t *testing.T, email, code, device string) (string, error) {
+	user, err := f.auth.Register(email, "Test", "s3cret-password", func(tx database.Tx, user *models.User) error {
+		return f.referrals.Enroll(tx, user, code, device)
+	})
+	if err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
+
+func TestReferralService_QualifyingDepositAwardsBoth(t *testing.T) {
+	f := newReferralFixture(t, map[string]models.Money{"USD": models.NewMoney(2000, "USD")})
+	referrer, err := f.signup(t, "anna@gmail.com", "", "device-a")
+	assert.NoError(t, err)
+	code, err := f.referrals.Code(referrer)
+	assert.NoError(t, err)
+	assert.Len(t, code.Code, referralCodeLength)
+
+	// Код принимается в любом регистре
+	referee, err := f.signup(t, "boris@gmail.com", " "+strings.ToLower(code.Code)+" ", "device-b")
+	assert.NoError(t, err)
+	account := models.NewAccount(referee, "USD")
+	assert.NoError(t, f.db.CreateAccount(account))
+
+	// Слишком малое пополнение приглашение не подтверждает
+	_, err = f.transactions.CreateDeposit(account.ID, models.NewMoney(1000, "USD"), "small")
+	assert.NoError(t, err)
+	referral, err := f.db.GetReferral(referee)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReferralPending, referral.Status)
+
+	deposit, err := f.transactions.CreateDeposit(account.ID, models.NewMoney(5000, "USD"), "salary")
+	assert.NoError(t, err)
+	referral, err = f.db.GetReferral(referee)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReferralQualified, referral.Status)
+	assert.Equal(t, deposit.ID, referral.TransactionID)
+
+	// Бонус за само пополнение начислен вместе с бонусами за приглашение
+	bonuses, err := f.db.GetBonusesByTransaction(deposit.ID)
+	assert.NoError(t, err)
+	sources := map[string]models.Money{}
+	for _, bonus := range bonuses {
+		sources[bonus.Source] = bonus.Amount
+	}
+	assert.Equal(t, map[string]models.Money{
+		models.TriggerDeposit:  models.NewMoney(25, "USD"),
+		models.TriggerReferrer: models.NewMoney(1000, "USD"),
+		models.TriggerReferee:  models.NewMoney(500, "USD"),
+	}, sources)
+
+	// Следующие пополнения бонусов за приглашение не дают
+	_, err = f.transactions.CreateDeposit(account.ID, models.NewMoney(5000, "USD"), "salary")
+	assert.NoError(t, err)
+	stats, err := f.referrals.Stats(referrer)
+	assert.NoError(t, err)
+	assert.Equal(t, &ReferralStats{UserID: referrer, Code: code.Code, Invited: 1, Qualified: 1,
+		Earned: []models.Money{models.NewMoney(1000, "USD")}}, stats)
+
+	// Сторно подтверждающего пополнения отзывает и бонусы за приглашение
+	_, err = f.transactions.ReverseTransaction(deposit.ID, "chargeback")
+	assert.NoError(t, err)
+	stats, err = f.referrals.Stats(referrer)
+	assert.NoError(t, err)
+	assert.Empty(t, stats.Earned)
+}
+
+func TestReferralService_SelfReferral(t *testing.T) {
+	f := newReferralFixture(t, nil)
+	referrer, err := f.signup(t, "anna@acme.io", "", "device-a")
+	assert.NoError(t, err)
+	code, err := f.referrals.Code(referrer)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name, email, device string
+		status, reason      string
+	}{
+		{"same-domain", "boris@ACME.io", "device-b", models.ReferralRejected, rejectSameEmailDomain},
+		{"same-device", "boris@gmail.com", "device-a", models.ReferralRejected, rejectSameDevice},
+		{"honest", "clara@gmail.com", "device-c", models.ReferralPending, ""},
+		{"reused-device", "dora@gmail.com", "device-c", models.ReferralRejected, rejectSameDevice},
+	}
+	ids := make(map[string]string)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := f.signup(t, tt.email, code.Code, tt.device)
+			assert.NoError(t, err)
+			ids[tt.name] = id
+			referral, err := f.db.GetReferral(id)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, referral.Status)
+			assert.Equal(t, tt.reason, referral.RejectReason)
+		})
+	}
+
+	// Отклонённое приглашение не подтверждается пополнением
+	account := models.NewAccount(ids["same-device"], "USD")
+	assert.NoError(t, f.db.CreateAccount(account))
+	_, err = f.transactions.CreateDeposit(account.ID, models.NewMoney(5000, "USD"), "salary")
+	assert.NoError(t, err)
+	stats, err := f.referrals.Stats(referrer)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stats.Invited)
+	assert.Equal(t, 3, stats.Rejected)
+	assert.Empty(t, stats.Earned)
+}
+
+func TestReferralService_UnknownCodeCancelsSignup(t *testing.T) {
+	f := newReferralFixture(t, nil)
+
+	_, err := f.signup(t, "new@gmail.com", "NOPE2345", "")
+	assert.ErrorIs(t, err, ErrInvalidReferralCode)
+	_, err = f.db.GetUserByEmail("new@gmail.com")
+	assert.ErrorIs(t, err, database.ErrNotFound)
+}
@@ -1,117 +1,327 @@
 package services
 
 import (
-	"errors"
+	"encoding/base64"
+	"fmt"
+	"strings"
 	"time"
 
 	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/ledger"
 	"petProjectMike/internal/models"
 )
 
 type TransactionService struct {
 	db database.Database
+	// events получает события о проведённых и сторнированных операциях; nil — никто не слушает
+	events *events.Bus
 }
 
-func NewTransactionService(db database.Database) *TransactionService {
-	return &TransactionService{db: db}
+func NewTransactionService(db database.Database, bus *events.Bus) *TransactionService {
+	return &TransactionService{db: db, events: bus}
 }
 
-func (s *TransactionService) CreateTransfer(fromAccountID, toAccountID string, amount float64, description string) (*models.Transaction, error) {
-	fromAccount, err := s.db.GetAccount(fromAccountID)
-	if err != nil {
-		return nil, err
+// validateAmount проверяет, что сумма положительна и в валюте счёта
+func validateAmount(amount models.Money, account *models.Account) error {
+	if !amount.IsPositive() {
+		return ErrNonPositiveAmount
 	}
-	toAccount, err := s.db.GetAccount(toAccountID)
-	if err != nil {
-		return nil, err
+	if amount.Currency != account.Currency {
+		return models.ErrCurrencyMismatch
 	}
-	if fromAccount.Balance < amount {
-		return nil, errors.New("insufficient funds")
+	return nil
+}
+
+// complete переводит транзакцию в статус "completed" в рамках той же единицы работы
+func complete(tx database.Tx, transaction *models.Transaction) error {
+	transaction.Status = "completed"
+	transaction.UpdatedAt = time.Now()
+	return tx.UpdateTransaction(transaction)
+}
+
+// ensureFunds проверяет, что списание amount не уведёт остаток счёта в минус
+func ensureFunds(account *models.Account, amount models.Money) error {
+	newBalance, err := account.Balance.Sub(amount)
+	if err != nil {
+		return err
 	}
-	if fromAccount.Currency != toAccount.Currency {
-		return nil, errors.New("currency mismatch")
+	if newBalance.IsNegative() {
+		return ErrInsufficientFunds
 	}
+	return nil
+}
 
-	transaction := models.NewTransaction(fromAccountID, toAccountID, amount, "transfer", description)
-	if err := s.db.CreateTransaction(transaction); err != nil {
-		return nil, err
+// ensureOpen проверяет, что счета не закрыты: по закрытому счёту операции запрещены
+func ensureOpen(accounts ...*models.Account) error {
+	for _, account := range accounts {
+		if account.Closed() {
+			return fmt.Errorf("%w: %s", ErrAccountClosed, account.ID)
+		}
 	}
+	return nil
+}
 
-	fromAccount.Balance -= amount
-	fromAccount.UpdatedAt = time.Now()
-	if err := s.db.UpdateAccount(fromAccount); err != nil {
-		return nil, err
+// record создаёт транзакцию, проводит её через главную книгу и завершает в рамках одной единицы работы
+func record(tx database.Tx, transaction *models.Transaction) error {
+	if err := tx.CreateTransaction(transaction); err != nil {
+		return err
+	}
+	entry := models.NewLedgerEntry(transaction.ID, transaction.Type, transaction.Description,
+		ledger.Move(transaction.FromAccount, transaction.ToAccount, transaction.Amount)...)
+	if err := ledger.Post(tx, entry); err != nil {
+		return err
 	}
+	return complete(tx, transaction)
+}
 
-	toAccount.Balance += amount
-	toAccount.UpdatedAt = time.Now()
-	if err := s.db.UpdateAccount(toAccount); err != nil {
-		return nil, err
+func (s *TransactionService) CreateTransfer(fromAccountID, toAccountID string, amount models.Money, description string) (*models.Transaction, error) {
+	if fromAccountID == toAccountID {
+		return nil, fmt.Errorf("%w: transfer to the same account", ErrInvalidTransaction)
 	}
+	var transaction *models.Transaction
+	err := s.db.RunInTx(func(tx database.Tx) error {
+		// Оба счёта блокируются до чтения остатков, иначе параллельный перевод успеет списать те же деньги
+		if err := tx.LockAccounts(fromAccountID, toAccountID); err != nil {
+			return err
+		}
+		fromAccount, err := tx.GetAccount(fromAccountID)
+		if err != nil {
+			return err
+		}
+		toAccount, err := tx.GetAccount(toAccountID)
+		if err != nil {
+			return err
+		}
+		if err := ensureOpen(fromAccount, toAccount); err != nil {
+			return err
+		}
+		if fromAccount.Currency != toAccount.Currency {
+			return models.ErrCurrencyMismatch
+		}
+		if err := validateAmount(amount, fromAccount); err != nil {
+			return err
+		}
+		if err := ensureFunds(fromAccount, amount); err != nil {
+			return err
+		}
 
-	transaction.Status = "completed"
-	transaction.UpdatedAt = time.Now()
-	if err := s.db.UpdateTransaction(transaction); err != nil {
+		transaction = models.NewTransaction(fromAccountID, toAccountID, amount, "transfer", description)
+		return record(tx, transaction)
+	})
+	if err != nil {
 		return nil, err
 	}
+	s.events.Publish(events.TransactionCompleted{Transaction: *transaction})
 	return transaction, nil
 }
 
-func (s *TransactionService) CreateDeposit(accountID string, amount float64, description string) (*models.Transaction, error) {
-	account, err := s.db.GetAccount(accountID)
+// CreateDeposit зачисляет деньги извне: они приходят с системного счёта cash-in
+func (s *TransactionService) CreateDeposit(accountID string, amount models.Money, description string) (*models.Transaction, error) {
+	var transaction *models.Transaction
+	err := s.db.RunInTx(func(tx database.Tx) error {
+		if err := tx.LockAccounts(accountID); err != nil {
+			return err
+		}
+		account, err := tx.GetAccount(accountID)
+		if err != nil {
+			return err
+		}
+		if err := ensureOpen(account); err != nil {
+			return err
+		}
+		if err := validateAmount(amount, account); err != nil {
+			return err
+		}
+
+		transaction = models.NewTransaction(models.CashInAccount, accountID, amount, "deposit", description)
+		return record(tx, transaction)
+	})
 	if err != nil {
 		return nil, err
 	}
+	s.events.Publish(events.TransactionCompleted{Transaction: *transaction})
+	return transaction, nil
+}
+
+// CreateWithdrawal выводит деньги из системы на системный счёт cash-out
+func (s *TransactionService) CreateWithdrawal(accountID string, amount models.Money, description string) (*models.Transaction, error) {
+	var transaction *models.Transaction
+	err := s.db.RunInTx(func(tx database.Tx) error {
+		if err := tx.LockAccounts(accountID); err != nil {
+			return err
+		}
+		account, err := tx.GetAccount(accountID)
+		if err != nil {
+			return err
+		}
+		if err := ensureOpen(account); err != nil {
+			return err
+		}
+		if err := validateAmount(amount, account); err != nil {
+			return err
+		}
+		if err := ensureFunds(account, amount); err != nil {
+			return err
+		}
 
-	transaction := models.NewTransaction("", accountID, amount, "deposit", description)
-	if err := s.db.CreateTransaction(transaction); err != nil {
+		transaction = models.NewTransaction(accountID, models.CashOutAccount, amount, "withdrawal", description)
+		return record(tx, transaction)
+	})
+	if err != nil {
 		return nil, err
 	}
+	s.events.Publish(events.TransactionCompleted{Transaction: *transaction})
+	return transaction, nil
+}
 
-	account.Balance += amount
-	account.UpdatedAt = time.Now()
-	if err := s.db.UpdateAccount(account); err != nil {
-		return nil, err
+// reversible операции, которые можно сторнировать: проведённые переводы, пополнения и списания
+func reversible(transaction *models.Transaction) bool {
+	if transaction.Status != "completed" {
+		return false
+	}
+	switch transaction.Type {
+	case "transfer", "deposit", "withdrawal":
+		return true
 	}
+	return false
+}
 
-	transaction.Status = "completed"
-	transaction.UpdatedAt = time.Now()
-	if err := s.db.UpdateTransaction(transaction); err != nil {
+// ReverseTransaction сторнирует операцию: деньги возвращаются отдельной операцией "reversal" с обратной
+// проводкой, исходная получает статус "reversed". Вернуть можно только то, что осталось на счёте получателя
+func (s *TransactionService) ReverseTransaction(id, description string) (*models.Transaction, error) {
+	var original, reversal *models.Transaction
+	err := s.db.RunInTx(func(tx database.Tx) error {
+		var err error
+		original, err = tx.GetTransaction(id)
+		if err != nil {
+			return err
+		}
+		if !reversible(original) {
+			return ErrTransactionNotReversible
+		}
+		// Параллельное сторно той же операции не пройдёт коммит: версия original уже изменится
+		if err := tx.LockAccounts(original.FromAccount, original.ToAccount); err != nil {
+			return err
+		}
+		// Сторно по закрытому счёту снова сделало бы его остаток ненулевым
+		if !models.IsSystemAccount(original.FromAccount) {
+			account, err := tx.GetAccount(original.FromAccount)
+			if err != nil {
+				return err
+			}
+			if err := ensureOpen(account); err != nil {
+				return err
+			}
+		}
+		if !models.IsSystemAccount(original.ToAccount) {
+			account, err := tx.GetAccount(original.ToAccount)
+			if err != nil {
+				return err
+			}
+			if err := ensureOpen(account); err != nil {
+				return err
+			}
+			if err := ensureFunds(account, original.Amount); err != nil {
+				return err
+			}
+		}
+
+		original.Status = "reversed"
+		original.UpdatedAt = time.Now()
+		if err := tx.UpdateTransaction(original); err != nil {
+			return err
+		}
+		if description == "" {
+			description = "reversal of " + original.ID
+		}
+		reversal = models.NewTransaction(original.ToAccount, original.FromAccount, original.Amount, "reversal", description)
+		return record(tx, reversal)
+	})
+	if err != nil {
 		return nil, err
 	}
-	return transaction, nil
+	s.events.Publish(events.TransactionReversed{Transaction: *original, Reversal: *reversal})
+	return reversal, nil
+}
+
+// HistoryPage страница истории операций счёта
+type HistoryPage struct {
+	Transactions []*models.Transaction `json:"transactions"`
+	// NextCursor курсор следующей страницы; пустой — страница последняя
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
-func (s *TransactionService) CreateWithdrawal(accountID string, amount float64, description string) (*models.Transaction, error) {
-	account, err := s.db.GetAccount(accountID)
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// GetTransactionHistory страница операций счёта по фильтрам query. Страница начинается после курсора
+// cursor из предыдущей страницы (пустой — с начала), размер по умолчанию 50 и не больше 200.
+// Суммы в фильтрах задаются в валюте счёта
+func (s *TransactionService) GetTransactionHistory(query database.TransactionQuery, cursor string) (*HistoryPage, error) {
+	account, err := s.db.GetAccount(query.AccountID)
 	if err != nil {
 		return nil, err
 	}
-	if account.Balance < amount {
-		return nil, errors.New("insufficient funds")
+	switch {
+	case query.Limit < 0:
+		return nil, fmt.Errorf("%w: limit must not be negative", ErrInvalidHistoryQuery)
+	case query.Limit == 0:
+		query.Limit = defaultHistoryLimit
+	case query.Limit > maxHistoryLimit:
+		query.Limit = maxHistoryLimit
 	}
-
-	transaction := models.NewTransaction(accountID, "", amount, "withdrawal", description)
-	if err := s.db.CreateTransaction(transaction); err != nil {
-		return nil, err
+	for _, bound := range []models.Money{query.MinAmount, query.MaxAmount} {
+		if bound != (models.Money{}) && bound.Currency != account.Currency {
+			return nil, models.ErrCurrencyMismatch
+		}
 	}
-
-	account.Balance -= amount
-	account.UpdatedAt = time.Now()
-	if err := s.db.UpdateAccount(account); err != nil {
-		return nil, err
+	if query.Since != nil && query.Until != nil && !query.Until.After(*query.Since) {
+		return nil, fmt.Errorf("%w: the end of the period must be after its start", ErrInvalidHistoryQuery)
+	}
+	if cursor != "" {
+		if query.After, err = decodeHistoryCursor(cursor); err != nil {
+			return nil, err
+		}
 	}
 
-	transaction.Status = "completed"
-	transaction.UpdatedAt = time.Now()
-	if err := s.db.UpdateTransaction(transaction); err != nil {
+	// Лишняя операция показывает, есть ли следующая страница
+	limit := query.Limit
+	query.Limit++
+	transactions, err := s.db.QueryTransactions(query)
+	if err != nil {
 		return nil, err
 	}
-	return transaction, nil
+	page := &HistoryPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = encodeHistoryCursor(page.Transactions[limit-1])
+	}
+	if page.Transactions == nil {
+		page.Transactions = []*models.Transaction{}
+	}
+	return page, nil
+}
+
+// encodeHistoryCursor курсор после операции: непрозрачная для клиента строка с её временем и ID
+func encodeHistoryCursor(transaction *models.Transaction) string {
+	raw := transaction.CreatedAt.UTC().Format(time.RFC3339Nano) + " " + transaction.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
 }
 
-func (s *TransactionService) GetTransactionHistory(accountID string) ([]*models.Transaction, error) {
-	return s.db.GetTransactionsByAccount(accountID)
+func decodeHistoryCursor(cursor string) (*database.TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidHistoryQuery)
+	}
+	at, id, ok := strings.Cut(string(raw), " ")
+	createdAt, err := time.Parse(time.RFC3339Nano, at)
+	if !ok || id == "" || err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidHistoryQuery)
+	}
+	return &database.TransactionCursor{CreatedAt: createdAt, ID: id}, nil
 }
 
 func (s *TransactionService) GetTransaction(id string) (*models.Transaction, error) {
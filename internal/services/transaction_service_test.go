@@ -0,0 +1,310 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/ledger"
+	"petProjectMike/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingDB настоящая in-memory база, в транзакциях которой обновление заданного счёта падает
+type failingDB struct {
+	*database.InMemoryDB
+	failAccount string
+}
+
+func (f *failingDB) RunInTx(fn func(tx database.Tx) error) error {
+	return f.InMemoryDB.RunInTx(func(tx database.Tx) error {
+		return fn(&failingTx{Tx: tx, failAccount: f.failAccount})
+	})
+}
+
+type failingTx struct {
+	database.Tx
+	failAccount string
+}
+
+func (t *failingTx) UpdateAccount(account *models.Account) error {
+	if account.ID == t.failAccount {
+		return errors.New("storage failure")
+	}
+	return t.Tx.UpdateAccount(account)
+}
+
+func TestTransactionService_CreateTransfer_IsAtomic(t *testing.T) {
+	db := &failingDB{InMemoryDB: database.NewInMemoryDB(), failAccount: "account-2"}
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+
+	service := NewTransactionService(db, nil)
+	transaction, err := service.CreateTransfer("account-1", "account-2", models.NewMoney(10000, "USD"), "rent")
+	assert.Error(t, err)
+	assert.Nil(t, transaction)
+
+	// Списание с первого счёта откатилось вместе с неудачным зачислением
+	from, err := db.GetAccount("account-1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(100000, "USD"), from.Balance)
+
+	// И не осталось "pending" транзакции и проводок
+	history, err := db.GetTransactionsByAccount("account-1")
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+	report, err := ledger.ComputeTrialBalance(db)
+	assert.NoError(t, err)
+	assert.True(t, report.Balanced)
+}
+
+func TestTransactionService_CreateTransfer(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-eur", UserID: "user-1", Balance: models.Zero("EUR"), Currency: "EUR"}))
+
+	service := NewTransactionService(db, nil)
+
+	transaction, err := service.CreateTransfer("account-1", "account-2", models.NewMoney(2550, "USD"), "rent")
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", transaction.Status)
+
+	from, _ := db.GetAccount("account-1")
+	to, _ := db.GetAccount("account-2")
+	assert.Equal(t, models.NewMoney(97450, "USD"), from.Balance)
+	assert.Equal(t, models.NewMoney(2550, "USD"), to.Balance)
+
+	_, err = service.CreateTransfer("account-1", "account-2", models.NewMoney(10000000, "USD"), "too much")
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	_, err = service.CreateTransfer("account-1", "account-eur", models.NewMoney(100, "USD"), "fx")
+	assert.ErrorIs(t, err, models.ErrCurrencyMismatch)
+}
+
+func TestTransactionService_DepositAndWithdrawal(t *testing.T) {
+	db := database.NewInMemoryDB()
+	service := NewTransactionService(db, nil)
+
+	deposit, err := service.CreateDeposit("account-1", models.NewMoney(500, "USD"), "cash")
+	assert.NoError(t, err)
+	assert.Equal(t, models.CashInAccount, deposit.FromAccount)
+
+	withdrawal, err := service.CreateWithdrawal("account-1", models.NewMoney(100500, "USD"), "atm")
+	assert.NoError(t, err)
+	assert.Equal(t, models.CashOutAccount, withdrawal.ToAccount)
+
+	account, _ := db.GetAccount("account-1")
+	assert.True(t, account.Balance.IsZero())
+
+	_, err = service.CreateWithdrawal("account-1", models.NewMoney(1, "USD"), "atm")
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	_, err = service.CreateDeposit("account-1", models.NewMoney(-1, "USD"), "negative")
+	assert.Error(t, err)
+
+	// Деньги не возникают из ниоткуда: приход и расход видны на системных счетах
+	cashIn, err := ledger.Balance(db, models.CashInAccount, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(-500, "USD"), cashIn)
+	cashOut, err := ledger.Balance(db, models.CashOutAccount, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(100500, "USD"), cashOut)
+
+	report, err := ledger.ComputeTrialBalance(db)
+	assert.NoError(t, err)
+	assert.True(t, report.Balanced)
+}
+
+func TestTransactionService_GetTransactionHistory(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	service := NewTransactionService(db, nil)
+
+	// Пять операций, по две с одинаковым временем: страницы не теряют и не повторяют их
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		transaction := &models.Transaction{
+			ID: fmt.Sprintf("tx-%d", i), FromAccount: "account-1", ToAccount: "account-2",
+			Amount: models.NewMoney(int64(i+1)*1000, "USD"), Type: "transfer", Status: "completed",
+			CreatedAt: start.Add(time.Duration(i/2) * time.Minute),
+		}
+		if i == 4 {
+			transaction.FromAccount, transaction.ToAccount, transaction.Type = models.CashInAccount, "account-1", "deposit"
+		}
+		assert.NoError(t, db.CreateTransaction(transaction))
+	}
+
+	var ids []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		page, err := service.GetTransactionHistory(database.TransactionQuery{AccountID: "account-1", Descending: true, Limit: 2}, cursor)
+		assert.NoError(t, err)
+		for _, transaction := range page.Transactions {
+			ids = append(ids, transaction.ID)
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"tx-4", "tx-3", "tx-2", "tx-1", "tx-0"}, ids)
+
+	// Фильтры по типу, сумме, периоду и второй стороне
+	since, until := start.Add(time.Minute), start.Add(2*time.Minute)
+	page, err := service.GetTransactionHistory(database.TransactionQuery{
+		AccountID: "account-1", Types: []string{"transfer"}, MinAmount: models.NewMoney(2000, "USD"),
+		Since: &since, Until: &until, Counterparty: "account-2",
+	}, "")
+	assert.NoError(t, err)
+	if assert.Len(t, page.Transactions, 2) {
+		assert.Equal(t, "tx-2", page.Transactions[0].ID)
+		assert.Equal(t, "tx-3", page.Transactions[1].ID)
+	}
+	assert.Empty(t, page.NextCursor)
+
+	_, err = service.GetTransactionHistory(database.TransactionQuery{AccountID: "account-1"}, "not a cursor")
+	assert.ErrorIs(t, err, ErrInvalidHistoryQuery)
+	_, err = service.GetTransactionHistory(database.TransactionQuery{AccountID: "account-1", MaxAmount: models.NewMoney(100, "EUR")}, "")
+	assert.ErrorIs(t, err, models.ErrCurrencyMismatch)
+	_, err = service.GetTransactionHistory(database.TransactionQuery{AccountID: "account-1", Since: &until, Until: &since}, "")
+	assert.ErrorIs(t, err, ErrInvalidHistoryQuery)
+	_, err = service.GetTransactionHistory(database.TransactionQuery{AccountID: "missing"}, "")
+	assert.ErrorIs(t, err, database.ErrNotFound)
+}
+
+func TestTransactionService_ReverseTransaction(t *testing.T) {
+	db := database.NewInMemoryDB()
+	assert.NoError(t, db.CreateAccount(&models.Account{ID: "account-2", UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+	bus := events.NewBus()
+	var reversed []events.TransactionReversed
+	events.Subscribe(bus, func(e events.TransactionReversed) error {
+		reversed = append(reversed, e)
+		return nil
+	})
+	service := NewTransactionService(db, bus)
+
+	transfer, err := service.CreateTransfer("account-1", "account-2", models.NewMoney(2500, "USD"), "rent")
+	assert.NoError(t, err)
+	reversal, err := service.ReverseTransaction(transfer.ID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "reversal", reversal.Type)
+	assert.Equal(t, "account-2", reversal.FromAccount)
+	assert.Equal(t, "reversal of "+transfer.ID, reversal.Description)
+
+	from, _ := db.GetAccount("account-1")
+	to, _ := db.GetAccount("account-2")
+	assert.Equal(t, models.NewMoney(100000, "USD"), from.Balance)
+	assert.True(t, to.Balance.IsZero())
+	original, _ := db.GetTransaction(transfer.ID)
+	assert.Equal(t, "reversed", original.Status)
+	if assert.Len(t, reversed, 1) {
+		assert.Equal(t, transfer.ID, reversed[0].Transaction.ID)
+		assert.Equal(t, reversal.ID, reversed[0].Reversal.ID)
+	}
+
+	// Дважды сторнировать нельзя, как и само сторно
+	_, err = service.ReverseTransaction(transfer.ID, "")
+	assert.ErrorIs(t, err, ErrTransactionNotReversible)
+	_, err = service.ReverseTransaction(reversal.ID, "")
+	assert.ErrorIs(t, err, ErrTransactionNotReversible)
+
+	// Пополнение, которое уже потрачено, вернуть нечем
+	deposit, err := service.CreateDeposit("account-2", models.NewMoney(1000, "USD"), "cash")
+	assert.NoError(t, err)
+	_, err = service.CreateWithdrawal("account-2", models.NewMoney(600, "USD"), "atm")
+	assert.NoError(t, err)
+	_, err = service.ReverseTransaction(deposit.ID, "")
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	report, err := ledger.ComputeTrialBalance(db)
+	assert.NoError(t, err)
+	assert.True(t, report.Balanced)
+}
+
+// yieldingDB отдаёт планировщику управление после каждого чтения счёта в транзакции,
+// чтобы гонка чтение-изменение-запись проявлялась даже на одном ядре
+type yieldingDB struct {
+	*database.InMemoryDB
+}
+
+func (y *yieldingDB) RunInTx(fn func(tx database.Tx) error) error {
+	return y.InMemoryDB.RunInTx(func(tx database.Tx) error {
+		return fn(&yieldingTx{Tx: tx})
+	})
+}
+
+type yieldingTx struct {
+	database.Tx
+}
+
+func (t *yieldingTx) GetAccount(id string) (*models.Account, error) {
+	account, err := t.Tx.GetAccount(id)
+	runtime.Gosched()
+	return account, err
+}
+
+func TestTransactionService_ParallelTransfersConserveBalance(t *testing.T) {
+	db := &yieldingDB{InMemoryDB: database.NewInMemoryDB()}
+	service := NewTransactionService(db, nil)
+
+	const accounts = 8
+	const transfers = 4000
+	initial := models.NewMoney(50000, "USD")
+	ids := make([]string, accounts)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("stress-%d", i)
+		assert.NoError(t, db.CreateAccount(&models.Account{ID: ids[i], UserID: "user-1", Balance: models.Zero("USD"), Currency: "USD"}))
+		_, err := service.CreateDeposit(ids[i], initial, "initial")
+		assert.NoError(t, err)
+	}
+
+	// Пары и суммы выбираются заранее: много встречных переводов между одними и теми же счетами
+	// и заведомо больше попыток списания, чем денег на счёте
+	rng := rand.New(rand.NewSource(1))
+	type transfer struct {
+		from, to string
+		amount   models.Money
+	}
+	plan := make([]transfer, transfers)
+	for i := range plan {
+		from := rng.Intn(accounts)
+		to := (from + 1 + rng.Intn(accounts-1)) % accounts
+		plan[i] = transfer{ids[from], ids[to], models.NewMoney(int64(1+rng.Intn(5000)), "USD")}
+	}
+
+	var wg sync.WaitGroup
+	var unexpected atomic.Int64
+	for _, tr := range plan {
+		wg.Add(1)
+		go func(tr transfer) {
+			defer wg.Done()
+			_, err := service.CreateTransfer(tr.from, tr.to, tr.amount, "stress")
+			if err != nil && !errors.Is(err, ErrInsufficientFunds) {
+				unexpected.Add(1)
+			}
+		}(tr)
+	}
+	wg.Wait()
+	assert.Zero(t, unexpected.Load())
+
+	total := models.Zero("USD")
+	for _, id := range ids {
+		account, err := db.GetAccount(id)
+		assert.NoError(t, err)
+		assert.False(t, account.Balance.IsNegative(), id)
+		total, err = total.Add(account.Balance)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, models.NewMoney(initial.Minor*accounts, "USD"), total)
+
+	report, err := ledger.ComputeTrialBalance(db)
+	assert.NoError(t, err)
+	assert.True(t, report.Balanced)
+	assert.Empty(t, report.Mismatches)
+}
@@ -1,30 +1,213 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"petProjectMike/internal/api"
+	"petProjectMike/internal/auth"
+	"petProjectMike/internal/campaigns"
 	"petProjectMike/internal/config"
 	"petProjectMike/internal/database"
+	"petProjectMike/internal/events"
+	"petProjectMike/internal/fx"
+	"petProjectMike/internal/scheduler"
 	"petProjectMike/internal/services"
 )
 
+// openDatabase создаёт хранилище по DB_DRIVER; вторым значением возвращается функция закрытия соединений
+func openDatabase(cfg *config.Config) (database.Database, func() error, error) {
+	switch cfg.DBDriver {
+	case "memory":
+		if cfg.MemoryDataDir == "" {
+			return database.NewInMemoryDB(), func() error { return nil }, nil
+		}
+		mem, err := database.OpenInMemoryDB(database.PersistenceOptions{
+			Dir:           cfg.MemoryDataDir,
+			Fsync:         database.FsyncPolicy(cfg.MemoryFsync),
+			SnapshotEvery: cfg.MemorySnapshotEvery,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return mem, mem.Close, nil
+	case "postgres":
+		if cfg.DatabaseURL == "" {
+			return nil, nil, fmt.Errorf("DATABASE_URL is required for DB_DRIVER=postgres")
+		}
+		pg, err := database.NewPostgresDB(cfg.DatabaseURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pg, pg.Close, nil
+	case "sqlite":
+		path := cfg.DatabaseURL
+		if path == "" {
+			path = "banking.db"
+		}
+		lite, err := database.NewSQLiteDB(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return lite, lite.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown DB_DRIVER %q", cfg.DBDriver)
+	}
+}
+
+// openAuth готовит выпуск токенов и API-ключи сервисов
+func openAuth(cfg *config.Config) (*auth.TokenIssuer, *auth.APIKeys, error) {
+	secret := []byte(cfg.JWTSecret)
+	if len(secret) == 0 {
+		if cfg.Env == "production" {
+			return nil, nil, fmt.Errorf("JWT_SECRET is required in production")
+		}
+		log.Print("JWT_SECRET is not set: using a random secret, tokens will not survive a restart")
+		secret = auth.RandomSecret()
+	}
+	tokens, err := auth.NewTokenIssuer(secret, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	apiKeys, err := auth.ParseAPIKeys(cfg.APIKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, apiKeys, nil
+}
+
+// bonusLimits разбирает лимиты бонусов на пользователя из BONUS_USER_DAILY_CAP и BONUS_USER_MONTHLY_CAP
+func bonusLimits(cfg *config.Config) (services.BonusLimits, error) {
+	daily, err := services.ParseBonusCaps(cfg.BonusDailyCap)
+	if err != nil {
+		return services.BonusLimits{}, fmt.Errorf("BONUS_USER_DAILY_CAP: %w", err)
+	}
+	monthly, err := services.ParseBonusCaps(cfg.BonusMonthlyCap)
+	if err != nil {
+		return services.BonusLimits{}, fmt.Errorf("BONUS_USER_MONTHLY_CAP: %w", err)
+	}
+	return services.BonusLimits{Daily: daily, Monthly: monthly}, nil
+}
+
+// seedCampaigns загружает бонусные кампании из CAMPAIGNS_FILE, заменяя одноимённые в базе.
+// Без файла создаются кампании по умолчанию, а изменённые через API не трогаются
+func seedCampaigns(cfg *config.Config, bonusService *services.BonusService) error {
+	if cfg.CampaignsFile == "" {
+		return bonusService.SeedCampaigns(campaigns.Defaults(), false)
+	}
+	list, err := campaigns.LoadFile(cfg.CampaignsFile)
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d campaigns from %s", len(list), cfg.CampaignsFile)
+	return bonusService.SeedCampaigns(list, true)
+}
+
+// jobHistorySize сколько последних запусков каждой фоновой задачи хранится для /api/v1/jobs
+const jobHistorySize = 20
+
+// newScheduler регистрирует фоновые задачи; расписания проверяются до запуска сервера
+func newScheduler(cfg *config.Config, bonusService *services.BonusService) (*scheduler.Scheduler, error) {
+	jobs := scheduler.New(jobHistorySize)
+	expirySchedule, err := scheduler.Parse(cfg.BonusExpirySchedule)
+	if err != nil {
+		return nil, err
+	}
+	err = jobs.Register("expire-bonuses", expirySchedule, func(ctx context.Context) error {
+		expired, err := bonusService.ExpireExpiredBonuses()
+		if expired > 0 {
+			log.Printf("expire-bonuses: %d bonuses expired", expired)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
 func main() {
 
 	cfg := config.Load()
 
-	db := database.NewInMemoryDB()
+	tokens, apiKeys, err := openAuth(cfg)
+	if err != nil {
+		log.Fatal("Failed to configure authentication:", err)
+	}
+
+	limits, err := bonusLimits(cfg)
+	if err != nil {
+		log.Fatal("Failed to configure bonus limits:", err)
+	}
+	rates, err := fx.ParseTable(cfg.FXRates)
+	if err != nil {
+		log.Fatal("Failed to parse FX_RATES:", err)
+	}
+	referralMinDeposit, err := services.ParseReferralMinDeposit(cfg.ReferralMinDeposit)
+	if err != nil {
+		log.Fatal("Failed to parse REFERRAL_MIN_DEPOSIT:", err)
+	}
+	loyaltyProgram, err := services.ParseLoyaltyProgram(cfg.LoyaltyEarnUnits, cfg.LoyaltyPointsValue)
+	if err != nil {
+		log.Fatal("Failed to parse LOYALTY_EARN_UNITS/LOYALTY_POINTS_VALUE:", err)
+	}
+
+	db, closeDB, err := openDatabase(cfg)
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
 
-	transactionService := services.NewTransactionService(db)
-	bonusService := services.NewBonusService(db)
+	// Бонусы за операции и приглашения и баллы лояльности начисляются и отзываются по событиям TransactionService
+	bus := events.NewBus()
+	transactionService := services.NewTransactionService(db, bus)
+	bonusService := services.NewBonusService(db, limits, rates, loyaltyProgram)
+	bonusService.Subscribe(bus)
+	referralService := services.NewReferralService(db, bonusService, referralMinDeposit)
+	referralService.Subscribe(bus)
+	loyaltyService := services.NewLoyaltyService(db, loyaltyProgram)
+	loyaltyService.Subscribe(bus)
 	accountService := services.NewAccountService(db)
+	ledgerService := services.NewLedgerService(db)
+	authService := services.NewAuthService(db, tokens)
+	erasureService := services.NewErasureService(db, bus, cfg.RetentionYears)
 
-	server := api.NewServer(cfg, transactionService, bonusService, accountService)
+	if err := seedCampaigns(cfg, bonusService); err != nil {
+		closeDB()
+		log.Fatal("Failed to load bonus campaigns:", err)
+	}
+
+	jobs, err := newScheduler(cfg, bonusService)
+	if err != nil {
+		closeDB()
+		log.Fatal("Failed to configure background jobs:", err)
+	}
 
-	log.Printf("Starting server on port %s", cfg.Port)
-	if err := server.Run(); err != nil {
-		log.Fatal("Failed to start server:", err)
+	// SIGINT/SIGTERM: сервер перестаёт принимать запросы, планировщик дожидается идущих задач,
+	// и только потом закрывается хранилище
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := api.NewServer(cfg, transactionService, bonusService, accountService, ledgerService, authService, referralService, loyaltyService, erasureService, apiKeys, jobs)
+	if err := jobs.Start(ctx); err != nil {
+		closeDB()
+		log.Fatal("Failed to start background jobs:", err)
+	}
+
+	log.Printf("Starting server on port %s (storage: %s)", cfg.Port, cfg.DBDriver)
+	runErr := server.Run(ctx)
+	jobs.Stop()
+	if err := closeDB(); err != nil {
+		log.Print("Failed to close database:", err)
+	}
+	if runErr != nil && !errors.Is(runErr, http.ErrServerClosed) {
+		log.Print("Server stopped with error:", runErr)
 		os.Exit(1)
 	}
+	log.Print("Server stopped")
 }